@@ -1,10 +1,13 @@
 package work
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gomodule/redigo/redis"
 )
@@ -17,19 +20,27 @@ var ErrNotDeleted = fmt.Errorf("nothing deleted")
 // no object was actually retried by those commmands.
 var ErrNotRetried = fmt.Errorf("nothing retried")
 
+// ErrUnknownJob is returned by functions that operate on a job type to indicate that the job name is not known.
+var ErrUnknownJob = fmt.Errorf("unknown job")
+
+// ErrJobNotFound is returned by Client.FindJob to indicate that the job isn't in any of the searched queues.
+var ErrJobNotFound = fmt.Errorf("job not found")
+
 // Client implements all of the functionality of the web UI. It can be used to inspect the status of a running cluster and retry dead jobs.
 type Client struct {
-	namespace string
-	pool      Pool
-	logger    StructuredLogger
+	keys        keyspace
+	pool        Pool
+	codec       ArgsCodec
+	bulkTimeout time.Duration // see WithClientBulkTimeout
+	logger      StructuredLogger
 }
 
 // NewClient creates a new Client with the specified redis namespace and connection pool.
 func NewClient(namespace string, pool Pool, opts ...ClientOption) *Client {
 	c := &Client{
-		namespace: namespace,
-		pool:      pool,
-		logger:    noopLogger,
+		keys:   newKeyspace(namespace),
+		pool:   pool,
+		logger: noopLogger,
 	}
 
 	for _, o := range opts {
@@ -39,6 +50,11 @@ func NewClient(namespace string, pool Pool, opts ...ClientOption) *Client {
 	return c
 }
 
+// bulkConn gets a connection for the bulk operations, see WithClientBulkTimeout.
+func (c *Client) bulkConn() redis.Conn {
+	return withReadTimeout(c.pool.Get(), c.bulkTimeout)
+}
+
 // WorkerPoolHeartbeat represents the heartbeat from a worker pool. WorkerPool's write a heartbeat every 5 seconds so we know they're alive and includes config information.
 type WorkerPoolHeartbeat struct {
 	WorkerPoolID string   `json:"worker_pool_id"`
@@ -56,7 +72,7 @@ func (c *Client) WorkerPoolHeartbeats() ([]*WorkerPoolHeartbeat, error) {
 	conn := c.pool.Get()
 	defer conn.Close()
 
-	workerPoolsKey := redisKeyWorkerPools(c.namespace)
+	workerPoolsKey := redisKeyWorkerPools(c.keys)
 
 	workerPoolIDs, err := redis.Strings(conn.Do("SMEMBERS", workerPoolsKey))
 	if err != nil {
@@ -65,7 +81,7 @@ func (c *Client) WorkerPoolHeartbeats() ([]*WorkerPoolHeartbeat, error) {
 	sort.Strings(workerPoolIDs)
 
 	for _, wpid := range workerPoolIDs {
-		key := redisKeyHeartbeat(c.namespace, wpid)
+		key := redisKeyHeartbeat(c.keys, wpid)
 		conn.Send("HGETALL", key)
 	}
 
@@ -125,25 +141,43 @@ func (c *Client) WorkerPoolHeartbeats() ([]*WorkerPoolHeartbeat, error) {
 	return heartbeats, nil
 }
 
+// StalePools returns the sorted IDs of the worker pools whose last heartbeat is older than threshold, including
+// the ones without a heartbeat at all. Such pools have most likely died, but the reaper hasn't cleaned them up yet.
+func (c *Client) StalePools(threshold time.Duration) ([]string, error) {
+	heartbeats, err := c.WorkerPoolHeartbeats()
+	if err != nil {
+		return nil, err
+	}
+
+	cutoff := nowEpochSeconds() - int64(threshold/time.Second)
+
+	var stale []string
+	for _, hb := range heartbeats {
+		if hb.HeartbeatAt < cutoff {
+			stale = append(stale, hb.WorkerPoolID)
+		}
+	}
+
+	return stale, nil
+}
+
 // WorkerObservation represents the latest observation taken from a worker. The observation indicates whether the worker is busy processing a job, and if so, information about that job.
 type WorkerObservation struct {
 	WorkerID string `json:"worker_id"`
 	IsBusy   bool   `json:"is_busy"`
 
 	// If IsBusy:
-	JobName   string `json:"job_name"`
-	JobID     string `json:"job_id"`
-	StartedAt int64  `json:"started_at"`
-	ArgsJSON  string `json:"args_json"`
-	Checkin   string `json:"checkin"`
-	CheckinAt int64  `json:"checkin_at"`
+	JobName   string   `json:"job_name"`
+	JobID     string   `json:"job_id"`
+	StartedAt int64    `json:"started_at"`
+	ArgsJSON  string   `json:"args_json"`
+	Checkin   string   `json:"checkin"`
+	CheckinAt int64    `json:"checkin_at"`
+	Progress  *float64 `json:"progress,omitempty"` // percentage reported by CheckinWithProgress, if any
 }
 
 // WorkerObservations returns all of the WorkerObservation's it finds for all worker pools' workers.
 func (c *Client) WorkerObservations() ([]*WorkerObservation, error) {
-	conn := c.pool.Get()
-	defer conn.Close()
-
 	hbs, err := c.WorkerPoolHeartbeats()
 	if err != nil {
 		c.logger.Error("worker_observations.worker_pool_heartbeats", errAttr(err))
@@ -155,8 +189,15 @@ func (c *Client) WorkerObservations() ([]*WorkerObservation, error) {
 		workerIDs = append(workerIDs, hb.WorkerIDs...)
 	}
 
+	return c.workerObservations(workerIDs)
+}
+
+func (c *Client) workerObservations(workerIDs []string) ([]*WorkerObservation, error) {
+	conn := c.pool.Get()
+	defer conn.Close()
+
 	for _, wid := range workerIDs {
-		key := redisKeyWorkerObservation(c.namespace, wid)
+		key := redisKeyWorkerObservation(c.keys, wid)
 		conn.Send("HGETALL", key)
 	}
 
@@ -197,6 +238,10 @@ func (c *Client) WorkerObservations() ([]*WorkerObservation, error) {
 				ob.Checkin = value
 			} else if key == "checkin_at" {
 				ob.CheckinAt, err = strconv.ParseInt(value, 10, 64)
+			} else if key == "progress" {
+				var progress float64
+				progress, err = strconv.ParseFloat(value, 64)
+				ob.Progress = &progress
 			}
 			if err != nil {
 				c.logger.Error("worker_observations.parse", errAttr(err))
@@ -210,7 +255,62 @@ func (c *Client) WorkerObservations() ([]*WorkerObservation, error) {
 	return observations, nil
 }
 
+// WorkerStatus is the status of a worker of a worker pool, see Workers.
+type WorkerStatus struct {
+	WorkerID string `json:"worker_id"`
+	IsBusy   bool   `json:"is_busy"`
+
+	// If IsBusy:
+	JobName   string        `json:"job_name"`
+	JobID     string        `json:"job_id"`
+	Runtime   time.Duration `json:"runtime"`    // since the job was started
+	Checkin   string        `json:"checkin"`    // the last message of Job.Checkin, if any
+	CheckinAt int64         `json:"checkin_at"` // epoch seconds of the last checkin
+}
+
+// Workers returns the status of the workers of the worker pool with the given ID, sorted by worker ID.
+// A worker is busy if it has an observation, i.e. it's running a job. Pools without a heartbeat have no workers.
+func (c *Client) Workers(poolID string) ([]WorkerStatus, error) {
+	conn := c.pool.Get()
+	workerIDs, err := redis.String(conn.Do("HGET", redisKeyHeartbeat(c.keys, poolID), "worker_ids"))
+	conn.Close()
+	if err == redis.ErrNil {
+		return nil, nil
+	} else if err != nil {
+		c.logger.Error("client.workers.hget", errAttr(err))
+		return nil, err
+	}
+
+	ids := strings.Split(workerIDs, ",")
+	sort.Strings(ids)
+
+	observations, err := c.workerObservations(ids)
+	if err != nil {
+		return nil, err
+	}
+
+	now := nowEpochSeconds()
+	statuses := make([]WorkerStatus, 0, len(observations))
+	for _, ob := range observations {
+		status := WorkerStatus{
+			WorkerID:  ob.WorkerID,
+			IsBusy:    ob.IsBusy,
+			JobName:   ob.JobName,
+			JobID:     ob.JobID,
+			Checkin:   ob.Checkin,
+			CheckinAt: ob.CheckinAt,
+		}
+		if ob.IsBusy && ob.StartedAt > 0 && now > ob.StartedAt {
+			status.Runtime = time.Duration(now-ob.StartedAt) * time.Second
+		}
+		statuses = append(statuses, status)
+	}
+
+	return statuses, nil
+}
+
 // Queue represents a queue that holds jobs with the same name. It indicates their name, count, and latency (in seconds). Latency is a measurement of how long ago the next job to be processed was enqueued.
+// The jobs of the priority queues of the job type, see EnqueueWithPriority, are counted too, and the latency is the one of the oldest of its queues.
 type Queue struct {
 	JobName string `json:"job_name"`
 	Count   int64  `json:"count"`
@@ -222,15 +322,40 @@ func (c *Client) Queues() ([]*Queue, error) {
 	conn := c.pool.Get()
 	defer conn.Close()
 
-	key := redisKeyKnownJobs(c.namespace)
+	key := redisKeyKnownJobs(c.keys)
 	jobNames, err := redis.Strings(conn.Do("SMEMBERS", key))
 	if err != nil {
 		return nil, err
 	}
+
+	priorityQueues, err := c.knownPriorityQueues(conn)
+	if err != nil {
+		return nil, err
+	}
+	known := make(map[string]bool, len(jobNames))
+	for _, jobName := range jobNames {
+		known[jobName] = true
+	}
+	for jobName := range priorityQueues {
+		if !known[jobName] {
+			jobNames = append(jobNames, jobName)
+		}
+	}
 	sort.Strings(jobNames)
 
+	// The queues of all the job types, with the Queue of their job type.
+	var keys []string
+	var owners []*Queue
+	queues := make([]*Queue, 0, len(jobNames))
 	for _, jobName := range jobNames {
-		conn.Send("LLEN", redisKeyJobs(c.namespace, jobName))
+		queue := &Queue{JobName: jobName}
+		queues = append(queues, queue)
+
+		for _, k := range append([]string{redisKeyJobs(c.keys, jobName)}, priorityQueues[jobName]...) {
+			keys = append(keys, k)
+			owners = append(owners, queue)
+			conn.Send("LLEN", k)
+		}
 	}
 
 	if err := conn.Flush(); err != nil {
@@ -238,26 +363,21 @@ func (c *Client) Queues() ([]*Queue, error) {
 		return nil, err
 	}
 
-	queues := make([]*Queue, 0, len(jobNames))
-
-	for _, jobName := range jobNames {
+	counts := make([]int64, len(keys))
+	for i := range keys {
 		count, err := redis.Int64(conn.Receive())
 		if err != nil {
 			c.logger.Error("client.queues.receive", errAttr(err))
 			return nil, err
 		}
 
-		queue := &Queue{
-			JobName: jobName,
-			Count:   count,
-		}
-
-		queues = append(queues, queue)
+		counts[i] = count
+		owners[i].Count += count
 	}
 
-	for _, s := range queues {
-		if s.Count > 0 {
-			conn.Send("LINDEX", redisKeyJobs(c.namespace, s.JobName), -1)
+	for i, k := range keys {
+		if counts[i] > 0 {
+			conn.Send("LINDEX", k, -1)
 		}
 	}
 
@@ -268,46 +388,457 @@ func (c *Client) Queues() ([]*Queue, error) {
 
 	now := nowEpochSeconds()
 
-	for _, s := range queues {
-		if s.Count > 0 {
+	for i := range keys {
+		if counts[i] > 0 {
 			b, err := redis.Bytes(conn.Receive())
 			if err != nil {
 				c.logger.Error("client.queues.receive2", errAttr(err))
 				return nil, err
 			}
 
-			job, err := newJob(b, nil, nil)
+			job, err := newJob(b, nil, nil, c.codec)
 			if err != nil {
 				c.logger.Error("client.queues.new_job", errAttr(err))
+				continue
+			}
+			if latency := now - job.EnqueuedAt; latency > owners[i].Latency {
+				owners[i].Latency = latency
 			}
-			s.Latency = now - job.EnqueuedAt
 		}
 	}
 
 	return queues, nil
 }
 
+// knownPriorityQueues returns the keys of the known priority queues by job name, see EnqueueWithPriority.
+func (c *Client) knownPriorityQueues(conn redis.Conn) (map[string][]string, error) {
+	members, err := redis.Strings(conn.Do("SMEMBERS", redisKeyKnownPriorityJobs(c.keys)))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(members)
+
+	queues := make(map[string][]string)
+	for _, member := range members {
+		if jobName, queue, ok := parseKnownPriorityJob(c.keys, member); ok {
+			queues[jobName] = append(queues[jobName], queue)
+		}
+	}
+
+	return queues, nil
+}
+
+// QueueLatency returns how long the next job to be processed from the queue of the specified job has been waiting.
+// It returns zero if the queue is empty.
+func (c *Client) QueueLatency(jobName string) (time.Duration, error) {
+	conn := c.pool.Get()
+	defer conn.Close()
+
+	b, err := redis.Bytes(conn.Do("LINDEX", redisKeyJobs(c.keys, jobName), -1))
+	if err == redis.ErrNil {
+		return 0, nil
+	} else if err != nil {
+		c.logger.Error("client.queue_latency.lindex", errAttr(err))
+		return 0, err
+	}
+
+	job, err := newJob(b, nil, nil, c.codec)
+	if err != nil {
+		c.logger.Error("client.queue_latency.new_job", errAttr(err))
+		return 0, err
+	}
+
+	latency := nowEpochSeconds() - job.EnqueuedAt
+	if latency < 0 {
+		return 0, nil
+	}
+
+	return time.Duration(latency) * time.Second, nil
+}
+
+// ActiveJobCounts returns the number of jobs being processed by all the worker pools, keyed by job name.
+// The jobs of pools with WithLeasedConcurrency are only counted for the job types with MaxConcurrency.
+// Compared to the MaxConcurrency of the job types, it shows how close they are to saturation.
+func (c *Client) ActiveJobCounts() (map[string]int64, error) {
+	conn := c.pool.Get()
+	defer conn.Close()
+
+	jobNames, err := redis.Strings(conn.Do("SMEMBERS", redisKeyKnownJobs(c.keys)))
+	if err != nil {
+		c.logger.Error("client.active_job_counts.smembers", errAttr(err))
+		return nil, err
+	}
+
+	counts := make(map[string]int64, len(jobNames))
+	if len(jobNames) == 0 {
+		return counts, nil
+	}
+
+	keys := make([]interface{}, 0, len(jobNames))
+	for _, jobName := range jobNames {
+		keys = append(keys, redisKeyJobsLock(c.keys, jobName))
+	}
+
+	values, err := redis.Values(conn.Do("MGET", keys...))
+	if err != nil {
+		c.logger.Error("client.active_job_counts.mget", errAttr(err))
+		return nil, err
+	}
+
+	for i, jobName := range jobNames {
+		n, err := redis.Int64(values[i], nil)
+		if err != nil && err != redis.ErrNil {
+			c.logger.Error("client.active_job_counts.int64", errAttr(err))
+			return nil, err
+		}
+
+		// The lock can be negative for a short time until the reaper fixes it.
+		if n < 0 {
+			n = 0
+		}
+		counts[jobName] = n
+	}
+
+	// The jobs of the pools with WithLeasedConcurrency are counted by their live leases, which expire by the
+	// clock of Redis.
+	now, err := redisTimeMillis(conn)
+	if err != nil {
+		c.logger.Error("client.active_job_counts.time", errAttr(err))
+		return nil, err
+	}
+	for _, jobName := range jobNames {
+		if err := conn.Send("ZCOUNT", redisKeyJobsLeases(c.keys, jobName), now, "+inf"); err != nil {
+			c.logger.Error("client.active_job_counts.zcount", errAttr(err))
+			return nil, err
+		}
+	}
+	if err := conn.Flush(); err != nil {
+		c.logger.Error("client.active_job_counts.flush", errAttr(err))
+		return nil, err
+	}
+	for _, jobName := range jobNames {
+		n, err := redis.Int64(conn.Receive())
+		if err != nil {
+			c.logger.Error("client.active_job_counts.zcount", errAttr(err))
+			return nil, err
+		}
+		counts[jobName] += n
+	}
+
+	return counts, nil
+}
+
+// redisTimeMillis returns the time of Redis in milliseconds.
+func redisTimeMillis(conn redis.Conn) (int64, error) {
+	t, err := redis.Int64s(conn.Do("TIME"))
+	if err != nil {
+		return 0, err
+	}
+	return t[0]*1000 + t[1]/1000, nil
+}
+
+// InProgressJobs returns the jobs currently being processed by the worker pool with the given ID, keyed by job name. Job names without in-progress jobs are omitted.
+func (c *Client) InProgressJobs(poolID string) (map[string][]*Job, error) {
+	conn := c.pool.Get()
+	defer conn.Close()
+
+	jobNames, err := redis.Strings(conn.Do("SMEMBERS", redisKeyKnownJobs(c.keys)))
+	if err != nil {
+		c.logger.Error("client.in_progress_jobs.known_jobs", errAttr(err))
+		return nil, err
+	}
+	sort.Strings(jobNames)
+
+	for _, jobName := range jobNames {
+		conn.Send("LRANGE", redisKeyJobsInProgress(c.keys, poolID, jobName), 0, -1)
+	}
+
+	if err := conn.Flush(); err != nil {
+		c.logger.Error("client.in_progress_jobs.flush", errAttr(err))
+		return nil, err
+	}
+
+	jobs := make(map[string][]*Job)
+
+	for _, jobName := range jobNames {
+		values, err := redis.ByteSlices(conn.Receive())
+		if err != nil {
+			c.logger.Error("client.in_progress_jobs.receive", errAttr(err))
+			return nil, err
+		}
+
+		for _, rawJSON := range values {
+			job, err := newJob(rawJSON, nil, nil, c.codec)
+			if err != nil {
+				c.logger.Error("client.in_progress_jobs.new_job", errAttr(err))
+				return nil, err
+			}
+
+			jobs[jobName] = append(jobs[jobName], job)
+		}
+	}
+
+	return jobs, nil
+}
+
+// RequeueInProgressJob moves the job with the specified ID from the in-progress queue of the worker pool back to its
+// job queue and releases its concurrency lock, e.g. to recover a job stuck after a crash without waiting for the reaper.
+// If the job isn't in progress anymore, e.g. because it was already requeued or it has finished, nothing is changed
+// and ErrNotRetried is returned, so it's safe to call twice. If the job is still running, it's processed twice.
+func (c *Client) RequeueInProgressJob(poolID, jobName, jobID string) error {
+	conn := c.pool.Get()
+	defer conn.Close()
+
+	script := redis.NewScript(4, redisLuaRequeueInProgressJob)
+	cnt, err := redis.Int64(script.Do(conn,
+		redisKeyJobsInProgress(c.keys, poolID, jobName),
+		redisKeyJobs(c.keys, jobName),
+		redisKeyJobsLock(c.keys, jobName),
+		redisKeyJobsLockInfo(c.keys, jobName),
+		poolID,
+		jobID,
+	))
+	if err != nil {
+		c.logger.Error("client.requeue_in_progress_job.do", errAttr(err))
+		return err
+	}
+
+	if cnt == 0 {
+		return ErrNotRetried
+	}
+
+	return nil
+}
+
+// JobResult returns the JSON of the result set by the handler of the job with the specified ID with Job.SetResult.
+// It returns nil if there's no result, e.g. because the job hasn't succeeded yet or the result has expired.
+func (c *Client) JobResult(jobID string) ([]byte, error) {
+	conn := c.pool.Get()
+	defer conn.Close()
+
+	result, err := redis.Bytes(conn.Do("GET", redisKeyJobResult(c.keys, jobID)))
+	if err == redis.ErrNil {
+		return nil, nil
+	} else if err != nil {
+		c.logger.Error("client.job_result.get", errAttr(err))
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// PauseJob pauses the processing of jobs with the specified name by all worker pools. Jobs can still be enqueued while paused.
+func (c *Client) PauseJob(jobName string) error {
+	if err := c.checkKnownJob(jobName); err != nil {
+		return err
+	}
+
+	if err := setJobPaused(c.pool, c.keys, jobName, true); err != nil {
+		c.logger.Error("client.pause_job", errAttr(err))
+		return err
+	}
+
+	return nil
+}
+
+// ResumeJob resumes the processing of jobs with the specified name which was paused by PauseJob.
+func (c *Client) ResumeJob(jobName string) error {
+	if err := c.checkKnownJob(jobName); err != nil {
+		return err
+	}
+
+	if err := setJobPaused(c.pool, c.keys, jobName, false); err != nil {
+		c.logger.Error("client.resume_job", errAttr(err))
+		return err
+	}
+
+	return nil
+}
+
+func (c *Client) checkKnownJob(jobName string) error {
+	conn := c.pool.Get()
+	defer conn.Close()
+
+	known, err := redis.Bool(conn.Do("SISMEMBER", redisKeyKnownJobs(c.keys), jobName))
+	if err != nil {
+		c.logger.Error("client.check_known_job", errAttr(err))
+		return err
+	}
+
+	if !known {
+		return ErrUnknownJob
+	}
+
+	return nil
+}
+
+func setJobPaused(pool Pool, keys keyspace, jobName string, paused bool) error {
+	conn := pool.Get()
+	defer conn.Close()
+
+	var err error
+	if paused {
+		_, err = conn.Do("SET", redisKeyJobsPaused(keys, jobName), "1")
+	} else {
+		_, err = conn.Do("DEL", redisKeyJobsPaused(keys, jobName))
+	}
+
+	return err
+}
+
 // RetryJob represents a job in the retry queue.
 type RetryJob struct {
 	RetryAt int64 `json:"retry_at"`
 	*Job
 }
 
+// Wait returns how long the job waits in the retry queue, from its last failure to its retry.
+func (j *RetryJob) Wait() time.Duration {
+	return time.Duration(j.RetryAt-j.FailedAt) * time.Second
+}
+
 // ScheduledJob represents a job in the scheduled queue.
 type ScheduledJob struct {
 	RunAt int64 `json:"run_at"`
 	*Job
 }
 
+// Wait returns how long the job waits in the scheduled queue, from its enqueueing to its scheduled time.
+func (j *ScheduledJob) Wait() time.Duration {
+	return time.Duration(j.RunAt-j.EnqueuedAt) * time.Second
+}
+
+// ZsetStats are the stats of a queue stored as a sorted set, scored by epoch seconds.
+type ZsetStats struct {
+	Count    int64 `json:"count"`
+	MinScore int64 `json:"min_score"` // 0 if the queue is empty
+	MaxScore int64 `json:"max_score"` // 0 if the queue is empty
+}
+
+// ScheduledStats are the stats of the scheduled, retry and dead queues, see Client.ScheduledStats.
+type ScheduledStats struct {
+	Scheduled ZsetStats `json:"scheduled"`
+	Retry     ZsetStats `json:"retry"`
+	Dead      ZsetStats `json:"dead"`
+}
+
+// ScheduledStats returns the number of jobs and the range of scores of the scheduled, retry and dead
+// queues. The scores are the times the jobs are due for the scheduled and retry queues, e.g. the min score
+// of the retry queue is the time of the next retry, and the times jobs died for the dead queue.
+func (c *Client) ScheduledStats() (*ScheduledStats, error) {
+	conn := c.pool.Get()
+	defer conn.Close()
+
+	stats := &ScheduledStats{}
+	zsets := []struct {
+		key   string
+		stats *ZsetStats
+	}{
+		{redisKeyScheduled(c.keys), &stats.Scheduled},
+		{redisKeyRetry(c.keys), &stats.Retry},
+		{redisKeyDead(c.keys), &stats.Dead},
+	}
+
+	for _, z := range zsets {
+		conn.Send("ZCARD", z.key)
+		conn.Send("ZRANGE", z.key, 0, 0, "WITHSCORES")
+		conn.Send("ZRANGE", z.key, -1, -1, "WITHSCORES")
+	}
+
+	if err := conn.Flush(); err != nil {
+		c.logger.Error("client.scheduled_stats.flush", errAttr(err))
+		return nil, err
+	}
+
+	for _, z := range zsets {
+		count, err := redis.Int64(conn.Receive())
+		if err != nil {
+			c.logger.Error("client.scheduled_stats.zcard", errAttr(err))
+			return nil, err
+		}
+		z.stats.Count = count
+
+		for _, score := range []*int64{&z.stats.MinScore, &z.stats.MaxScore} {
+			values, err := redis.Values(conn.Receive())
+			if err != nil {
+				c.logger.Error("client.scheduled_stats.zrange", errAttr(err))
+				return nil, err
+			}
+
+			var jobsWithScores []jobScore
+			if err := redis.ScanSlice(values, &jobsWithScores); err != nil {
+				c.logger.Error("client.scheduled_stats.scan_slice", errAttr(err))
+				return nil, err
+			}
+			if len(jobsWithScores) > 0 {
+				*score = jobsWithScores[0].Score
+			}
+		}
+	}
+
+	return stats, nil
+}
+
 // DeadJob represents a job in the dead queue.
 type DeadJob struct {
 	DiedAt int64 `json:"died_at"`
 	*Job
 }
 
+// DeadJobsByName returns a page of the dead jobs with the specified name, like DeadJobs. The total number of dead
+// jobs with the name is also returned. The dead queue is scanned by a script in batches, so Redis isn't blocked
+// for long even if the dead queue is big, but the page and the count may be off if jobs die or are deleted
+// during the scan.
+func (c *Client) DeadJobsByName(jobName string, page uint) ([]*DeadJob, int64, error) {
+	if page == 0 {
+		page = 1
+	}
+
+	conn := c.bulkConn()
+	defer conn.Close()
+
+	script := redis.NewScript(1, redisLuaZsetPageByName)
+
+	var count int64
+	var jobsWithScores []jobScore
+	for start := int64(0); start >= 0; {
+		values, err := redis.Values(script.Do(conn, redisKeyDead(c.keys), jobName, start, 100, count, (page-1)*20, 20))
+		if err != nil {
+			c.logger.Error("client.dead_jobs_by_name.do", errAttr(err))
+			return nil, 0, err
+		}
+
+		if _, err := redis.Scan(values, &start, &count); err != nil {
+			c.logger.Error("client.dead_jobs_by_name.scan", errAttr(err))
+			return nil, 0, err
+		}
+
+		var batch []jobScore
+		if err := redis.ScanSlice(values[2:], &batch); err != nil {
+			c.logger.Error("client.dead_jobs_by_name.scan_slice", errAttr(err))
+			return nil, 0, err
+		}
+		jobsWithScores = append(jobsWithScores, batch...)
+	}
+
+	jobs := make([]*DeadJob, 0, len(jobsWithScores))
+
+	for _, jws := range jobsWithScores {
+		job, err := newJob(jws.JobBytes, nil, nil, c.codec)
+		if err != nil {
+			c.logger.Error("client.dead_jobs_by_name.new_job", errAttr(err))
+			return nil, 0, err
+		}
+
+		jobs = append(jobs, &DeadJob{DiedAt: jws.Score, Job: job})
+	}
+
+	return jobs, count, nil
+}
+
 // ScheduledJobs returns a list of ScheduledJob's. The page param is 1-based; each page is 20 items. The total number of items (not pages) in the list of scheduled jobs is also returned.
 func (c *Client) ScheduledJobs(page uint) ([]*ScheduledJob, int64, error) {
-	key := redisKeyScheduled(c.namespace)
+	key := redisKeyScheduled(c.keys)
 	jobsWithScores, count, err := c.getZsetPage(key, page)
 	if err != nil {
 		c.logger.Error("client.scheduled_jobs.get_zset_page", errAttr(err))
@@ -325,7 +856,7 @@ func (c *Client) ScheduledJobs(page uint) ([]*ScheduledJob, int64, error) {
 
 // RetryJobs returns a list of RetryJob's. The page param is 1-based; each page is 20 items. The total number of items (not pages) in the list of retry jobs is also returned.
 func (c *Client) RetryJobs(page uint) ([]*RetryJob, int64, error) {
-	key := redisKeyRetry(c.namespace)
+	key := redisKeyRetry(c.keys)
 	jobsWithScores, count, err := c.getZsetPage(key, page)
 	if err != nil {
 		c.logger.Error("client.retry_jobs.get_zset_page", errAttr(err))
@@ -343,7 +874,7 @@ func (c *Client) RetryJobs(page uint) ([]*RetryJob, int64, error) {
 
 // DeadJobs returns a list of DeadJob's. The page param is 1-based; each page is 20 items. The total number of items (not pages) in the list of dead jobs is also returned.
 func (c *Client) DeadJobs(page uint) ([]*DeadJob, int64, error) {
-	key := redisKeyDead(c.namespace)
+	key := redisKeyDead(c.keys)
 	jobsWithScores, count, err := c.getZsetPage(key, page)
 	if err != nil {
 		c.logger.Error("client.dead_jobs.get_zset_page", errAttr(err))
@@ -361,7 +892,7 @@ func (c *Client) DeadJobs(page uint) ([]*DeadJob, int64, error) {
 
 // DeleteDeadJob deletes a dead job from Redis.
 func (c *Client) DeleteDeadJob(diedAt int64, jobID string) error {
-	ok, _, err := c.deleteZsetJob(redisKeyDead(c.namespace), diedAt, jobID)
+	ok, _, err := c.deleteZsetJob(redisKeyDead(c.keys), diedAt, jobID)
 	if err != nil {
 		return err
 	}
@@ -373,6 +904,16 @@ func (c *Client) DeleteDeadJob(diedAt int64, jobID string) error {
 
 // RetryDeadJob retries a dead job. The job will be re-queued on the normal work queue for eventual processing by a worker.
 func (c *Client) RetryDeadJob(diedAt int64, jobID string) error {
+	return c.retryDeadJob(diedAt, jobID, false)
+}
+
+// RequeueDeadJobKeepingHistory retries a dead job like RetryDeadJob, but first appends the time, failures and error
+// of its death to Job.History, so that they aren't lost if the job dies again.
+func (c *Client) RequeueDeadJobKeepingHistory(diedAt int64, jobID string) error {
+	return c.retryDeadJob(diedAt, jobID, true)
+}
+
+func (c *Client) retryDeadJob(diedAt int64, jobID string, keepHistory bool) error {
 	// Get queues for job names
 	queues, err := c.Queues()
 	if err != nil {
@@ -388,15 +929,16 @@ func (c *Client) RetryDeadJob(diedAt int64, jobID string) error {
 
 	script := redis.NewScript(len(jobNames)+1, redisLuaRequeueSingleDeadCmd)
 
-	args := make([]interface{}, 0, len(jobNames)+1+3)
-	args = append(args, redisKeyDead(c.namespace)) // KEY[1]
+	args := make([]interface{}, 0, len(jobNames)+1+5)
+	args = append(args, redisKeyDead(c.keys)) // KEY[1]
 	for _, jobName := range jobNames {
-		args = append(args, redisKeyJobs(c.namespace, jobName)) // KEY[2, 3, ...]
+		args = append(args, redisKeyJobs(c.keys, jobName)) // KEY[2, 3, ...]
 	}
-	args = append(args, redisKeyJobsPrefix(c.namespace)) // ARGV[1]
+	args = append(args, redisKeyJobsPrefix(c.keys)) // ARGV[1]
 	args = append(args, nowEpochSeconds())
 	args = append(args, diedAt)
 	args = append(args, jobID)
+	args = append(args, keepHistory)
 
 	conn := c.pool.Get()
 	defer conn.Close()
@@ -432,15 +974,15 @@ func (c *Client) RetryAllDeadJobs() error {
 	script := redis.NewScript(len(jobNames)+1, redisLuaRequeueAllDeadCmd)
 
 	args := make([]interface{}, 0, len(jobNames)+1+3)
-	args = append(args, redisKeyDead(c.namespace)) // KEY[1]
+	args = append(args, redisKeyDead(c.keys)) // KEY[1]
 	for _, jobName := range jobNames {
-		args = append(args, redisKeyJobs(c.namespace, jobName)) // KEY[2, 3, ...]
+		args = append(args, redisKeyJobs(c.keys, jobName)) // KEY[2, 3, ...]
 	}
-	args = append(args, redisKeyJobsPrefix(c.namespace)) // ARGV[1]
+	args = append(args, redisKeyJobsPrefix(c.keys)) // ARGV[1]
 	args = append(args, nowEpochSeconds())
 	args = append(args, 1000)
 
-	conn := c.pool.Get()
+	conn := c.bulkConn()
 	defer conn.Close()
 
 	// Cap iterations for safety (which could reprocess 1k*1k jobs).
@@ -460,11 +1002,92 @@ func (c *Client) RetryAllDeadJobs() error {
 	return nil
 }
 
+// RequeueRetryJob puts the retry job with the specified retry time and ID back on its queue right away, regardless
+// of its backoff, and resets its failures like RequeueAllRetryJobs and RetryDeadJob, so MaxFails and MaxRetryAge
+// count from scratch, e.g. to run it again right after a fix. It returns the number of requeued jobs, which is 0 if
+// the job wasn't found. A job with an unknown name is moved to the dead queue.
+func (c *Client) RequeueRetryJob(scheduledFor int64, jobID string) (int64, error) {
+	conn := c.pool.Get()
+	defer conn.Close()
+
+	jobNames, err := redis.Strings(conn.Do("SMEMBERS", redisKeyKnownJobs(c.keys)))
+	if err != nil {
+		c.logger.Error("client.requeue_retry_job.smembers", errAttr(err))
+		return 0, err
+	}
+
+	script := redis.NewScript(len(jobNames)+2, redisLuaRequeueSingleRetryCmd)
+
+	args := make([]interface{}, 0, len(jobNames)+2+4)
+	args = append(args, redisKeyRetry(c.keys)) // KEY[1]
+	args = append(args, redisKeyDead(c.keys))  // KEY[2]
+	for _, jobName := range jobNames {
+		args = append(args, redisKeyJobs(c.keys, jobName)) // KEY[3, 4, ...]
+	}
+	args = append(args, redisKeyJobsPrefix(c.keys)) // ARGV[1]
+	args = append(args, nowEpochSeconds())          // ARGV[2]
+	args = append(args, scheduledFor)               // ARGV[3]
+	args = append(args, jobID)                      // ARGV[4]
+
+	requeued, err := redis.Int64(script.Do(conn, args...))
+	if err != nil {
+		c.logger.Error("client.requeue_retry_job.do", errAttr(err))
+		return 0, err
+	}
+
+	return requeued, nil
+}
+
+// RequeueAllRetryJobs puts all the jobs waiting to be retried back on their queues right away, regardless of
+// their backoff, and resets their failures. It returns the number of requeued jobs. Jobs with unknown names
+// are moved to the dead queue.
+func (c *Client) RequeueAllRetryJobs() (int64, error) {
+	conn := c.bulkConn()
+	defer conn.Close()
+
+	jobNames, err := redis.Strings(conn.Do("SMEMBERS", redisKeyKnownJobs(c.keys)))
+	if err != nil {
+		c.logger.Error("client.requeue_all_retry_jobs.smembers", errAttr(err))
+		return 0, err
+	}
+
+	script := redis.NewScript(len(jobNames)+2, redisLuaRequeueAllRetryCmd)
+
+	args := make([]interface{}, 0, len(jobNames)+2+3)
+	args = append(args, redisKeyRetry(c.keys)) // KEY[1]
+	args = append(args, redisKeyDead(c.keys))  // KEY[2]
+	for _, jobName := range jobNames {
+		args = append(args, redisKeyJobs(c.keys, jobName)) // KEY[3, 4, ...]
+	}
+	args = append(args, redisKeyJobsPrefix(c.keys)) // ARGV[1]
+	args = append(args, nowEpochSeconds())          // ARGV[2]
+	args = append(args, 1000)                       // ARGV[3]
+
+	var requeued int64
+
+	// Cap iterations for safety, as in RetryAllDeadJobs.
+	for i := 0; i < 1000; i++ {
+		res, err := redis.Int64s(script.Do(conn, args...))
+		if err != nil {
+			c.logger.Error("client.requeue_all_retry_jobs.do", errAttr(err))
+			return requeued, err
+		}
+
+		requeued += res[1]
+
+		if res[0] == 0 {
+			break
+		}
+	}
+
+	return requeued, nil
+}
+
 // DeleteAllDeadJobs deletes all dead jobs.
 func (c *Client) DeleteAllDeadJobs() error {
-	conn := c.pool.Get()
+	conn := c.bulkConn()
 	defer conn.Close()
-	_, err := conn.Do("DEL", redisKeyDead(c.namespace))
+	_, err := conn.Do("DEL", redisKeyDead(c.keys))
 	if err != nil {
 		c.logger.Error("client.delete_all_dead_jobs", errAttr(err))
 		return err
@@ -473,23 +1096,95 @@ func (c *Client) DeleteAllDeadJobs() error {
 	return nil
 }
 
+// DeleteDeadJobsByName deletes the dead jobs with the specified name, e.g. a batch known to be unrecoverable, and
+// returns the number of deleted jobs. The dead queue is scanned by a script in batches, so Redis isn't blocked
+// for long even if the dead queue is big.
+func (c *Client) DeleteDeadJobsByName(jobName string) (int64, error) {
+	conn := c.bulkConn()
+	defer conn.Close()
+
+	script := redis.NewScript(1, redisLuaZsetDeleteByName)
+
+	var deleted int64
+	for start := int64(0); start >= 0; {
+		res, err := redis.Int64s(script.Do(conn, redisKeyDead(c.keys), jobName, start, 1000))
+		if err != nil {
+			c.logger.Error("client.delete_dead_jobs_by_name.do", errAttr(err))
+			return deleted, err
+		}
+
+		start = res[0]
+		deleted += res[1]
+	}
+
+	return deleted, nil
+}
+
+// MigrateQueue moves up to max jobs named jobName from the queue of srcNamespace to the one of dstNamespace, oldest
+// first, e.g. to drain a queue of an old namespace into a new one during a migration. max <= 0 moves all the jobs.
+// It returns the number of moved jobs. The namespaces are independent of the one of the client, whose pool is
+// used. The jobs are moved by a script in batches, so each batch is atomic but Redis isn't blocked for long.
+// The scheduled and retried jobs aren't moved, nor the locks of unique jobs. Both namespaces must be in the same
+// Redis, and this isn't supported in cluster mode. See MigrateQueueWithRenames for job types renamed between
+// the namespaces.
+func (c *Client) MigrateQueue(srcNamespace, dstNamespace, jobName string, max int64) (int64, error) {
+	return c.MigrateQueueWithRenames(srcNamespace, dstNamespace, jobName, max, nil)
+}
+
+// MigrateQueueWithRenames does the same as MigrateQueue, moving the jobs to the queue of renames[jobName] in
+// dstNamespace if it's set. The name of the moved jobs is rewritten accordingly.
+func (c *Client) MigrateQueueWithRenames(srcNamespace, dstNamespace, jobName string, max int64, renames map[string]string) (int64, error) {
+	dstJobName, rewrite := jobName, 0
+	if name, ok := renames[jobName]; ok && name != jobName {
+		dstJobName, rewrite = name, 1
+	}
+
+	conn := c.bulkConn()
+	defer conn.Close()
+
+	script := redis.NewScript(3, redisLuaMigrateQueue)
+	srcKeys, dstKeys := c.keys.withNamespace(srcNamespace), c.keys.withNamespace(dstNamespace)
+	src, dst := redisKeyJobs(srcKeys, jobName), redisKeyJobs(dstKeys, dstJobName)
+
+	var moved int64
+	for max <= 0 || moved < max {
+		batch := int64(1000)
+		if max > 0 && max-moved < batch {
+			batch = max - moved
+		}
+
+		n, err := redis.Int64(script.Do(conn, src, dst, redisKeyKnownJobs(dstKeys), dstJobName, rewrite, batch))
+		if err != nil {
+			c.logger.Error("client.migrate_queue.do", errAttr(err))
+			return moved, err
+		}
+
+		moved += n
+		if n < batch {
+			break
+		}
+	}
+
+	return moved, nil
+}
+
 // DeleteScheduledJob deletes a job in the scheduled queue.
 func (c *Client) DeleteScheduledJob(scheduledFor int64, jobID string) error {
-	ok, jobBytes, err := c.deleteZsetJob(redisKeyScheduled(c.namespace), scheduledFor, jobID)
+	ok, jobBytes, err := c.deleteZsetJob(redisKeyScheduled(c.keys), scheduledFor, jobID)
 	if err != nil {
 		return err
 	}
 
 	// If we get a job back, parse it and see if it's a unique job. If it is, we need to delete the unique key.
 	if len(jobBytes) > 0 {
-		job, err := newJob(jobBytes, nil, nil)
+		job, err := newJob(jobBytes, nil, nil, c.codec)
 		if err != nil {
 			c.logger.Error("client.delete_scheduled_job.new_job", errAttr(err))
 			return err
 		}
 
 		if job.Unique {
-			uniqueKey, err := redisKeyUniqueJob(c.namespace, job.Name, job.Args)
+			uniqueKey, err := job.uniqueKey(c.keys)
 			if err != nil {
 				c.logger.Error("client.delete_scheduled_job.redis_key_unique_job", errAttr(err))
 				return err
@@ -513,7 +1208,7 @@ func (c *Client) DeleteScheduledJob(scheduledFor int64, jobID string) error {
 
 // DeleteRetryJob deletes a job in the retry queue.
 func (c *Client) DeleteRetryJob(retryAt int64, jobID string) error {
-	ok, _, err := c.deleteZsetJob(redisKeyRetry(c.namespace), retryAt, jobID)
+	ok, _, err := c.deleteZsetJob(redisKeyRetry(c.keys), retryAt, jobID)
 	if err != nil {
 		return err
 	}
@@ -549,6 +1244,246 @@ func (c *Client) deleteZsetJob(zsetKey string, zscore int64, jobID string) (bool
 	return cnt > 0, jobBytes, nil
 }
 
+// ReapNow runs a cycle of the dead pool reaper synchronously and returns what it reaped, see WorkerPool.ReapNow.
+// The locks of all the known job types are checked. The reaper uses the client's codec and logger but none of
+// the options of the pools, so dead jobs aren't trimmed and no reaper hook is called. ErrReaperBusy is
+// returned if another process is running a reap cycle of the namespace.
+func (c *Client) ReapNow() (ReapResult, error) {
+	conn := c.pool.Get()
+	jobNames, err := redis.Strings(conn.Do("SMEMBERS", redisKeyKnownJobs(c.keys)))
+	conn.Close()
+	if err != nil {
+		c.logger.Error("client.reap_now.known_jobs", errAttr(err))
+		return ReapResult{}, err
+	}
+
+	r := newDeadPoolReaper(c.keys, c.pool, jobNames, 0, nil, c.logger)
+	r.codec = c.codec
+	return r.reapNow()
+}
+
+// JobLocationKind is where a job found by Client.FindJob currently lives.
+type JobLocationKind string
+
+// Job location kinds.
+const (
+	JobLocationQueued     JobLocationKind = "queued"      // waiting in the queue of its job type
+	JobLocationInProgress JobLocationKind = "in_progress" // fetched by a worker of the pool JobLocation.PoolID
+	JobLocationRetry      JobLocationKind = "retry"       // failed and waiting for a retry
+	JobLocationScheduled  JobLocationKind = "scheduled"   // waiting for its scheduled time
+	JobLocationDead       JobLocationKind = "dead"        // failed with no retries left
+	JobLocationWaiting    JobLocationKind = "waiting"     // enqueued with EnqueueAfter, waiting for JobLocation.ParentID to succeed
+)
+
+// JobLocation is where a job found by Client.FindJob currently lives.
+type JobLocation struct {
+	Kind     JobLocationKind
+	Key      string // the Redis key of the queue or zset holding the job
+	Score    int64  // the score of the job in the retry, scheduled or dead zset, e.g. for DeleteRetryJob; 0 otherwise
+	PoolID   string // the ID of the worker pool processing the job if it's in progress
+	ParentID string // the ID of the job the job waits for if it's waiting, see EnqueueAfter
+	Job      *Job
+}
+
+// FindJob returns where the job with the specified ID currently lives, or ErrJobNotFound. The scheduled, retry
+// and dead zsets are scanned first with ZSCAN, matching the ID in Redis, then the queues of the known job types,
+// including the priority queues of EnqueueWithPriority, the in-progress queues of all the worker pools and the
+// lists of the jobs enqueued with EnqueueAfter, found with SCAN, are read in batches. So its cost is linear in the
+// number of jobs, and it's meant for occasional lookups, e.g. by support, not for hot paths; Redis isn't blocked
+// for long. The locations aren't read atomically, so a job moving from one to another during the search, e.g.
+// from its queue to the in-progress queue, may be missed.
+func (c *Client) FindJob(jobID string) (*JobLocation, error) {
+	conn := c.bulkConn()
+	defer conn.Close()
+
+	idJSON, err := json.Marshal(jobID)
+	if err != nil {
+		return nil, err
+	}
+	needle := append([]byte(`"id":`), idJSON...)
+
+	zsets := []struct {
+		kind JobLocationKind
+		key  string
+	}{
+		{JobLocationScheduled, redisKeyScheduled(c.keys)},
+		{JobLocationRetry, redisKeyRetry(c.keys)},
+		{JobLocationDead, redisKeyDead(c.keys)},
+	}
+	for _, z := range zsets {
+		job, score, err := c.findZsetJob(conn, z.key, needle, jobID)
+		if err != nil {
+			return nil, err
+		}
+		if job != nil {
+			return &JobLocation{Kind: z.kind, Key: z.key, Score: score, Job: job}, nil
+		}
+	}
+
+	jobNames, err := redis.Strings(conn.Do("SMEMBERS", redisKeyKnownJobs(c.keys)))
+	if err != nil {
+		c.logger.Error("client.find_job.known_jobs", errAttr(err))
+		return nil, err
+	}
+	sort.Strings(jobNames)
+
+	for _, jobName := range jobNames {
+		key := redisKeyJobs(c.keys, jobName)
+		job, err := c.findListJob(conn, key, needle, jobID)
+		if err != nil {
+			return nil, err
+		}
+		if job != nil {
+			return &JobLocation{Kind: JobLocationQueued, Key: key, Job: job}, nil
+		}
+	}
+
+	priorityQueues, err := c.knownPriorityQueues(conn)
+	if err != nil {
+		c.logger.Error("client.find_job.known_priority_jobs", errAttr(err))
+		return nil, err
+	}
+	priorityJobNames := make([]string, 0, len(priorityQueues))
+	for jobName := range priorityQueues {
+		priorityJobNames = append(priorityJobNames, jobName)
+	}
+	sort.Strings(priorityJobNames)
+	for _, jobName := range priorityJobNames {
+		for _, key := range priorityQueues[jobName] {
+			job, err := c.findListJob(conn, key, needle, jobID)
+			if err != nil {
+				return nil, err
+			}
+			if job != nil {
+				return &JobLocation{Kind: JobLocationQueued, Key: key, Job: job}, nil
+			}
+		}
+	}
+
+	poolIDs, err := redis.Strings(conn.Do("SMEMBERS", redisKeyWorkerPools(c.keys)))
+	if err != nil {
+		c.logger.Error("client.find_job.worker_pools", errAttr(err))
+		return nil, err
+	}
+	sort.Strings(poolIDs)
+
+	for _, poolID := range poolIDs {
+		for _, jobName := range jobNames {
+			key := redisKeyJobsInProgress(c.keys, poolID, jobName)
+			job, err := c.findListJob(conn, key, needle, jobID)
+			if err != nil {
+				return nil, err
+			}
+			if job != nil {
+				return &JobLocation{Kind: JobLocationInProgress, Key: key, PoolID: poolID, Job: job}, nil
+			}
+		}
+	}
+
+	return c.findWaitingJob(conn, needle, jobID)
+}
+
+// findWaitingJob scans the lists of the jobs enqueued with EnqueueAfter for the job with the specified ID, whose
+// JSON contains needle. The lists are found with SCAN, since they're only known by the ID of their parent job.
+func (c *Client) findWaitingJob(conn redis.Conn, needle []byte, jobID string) (*JobLocation, error) {
+	prefix := redisKeyJobChildren(c.keys, "")
+	match := redisGlobEscaper.Replace(prefix) + "*"
+	cursor := "0"
+	for {
+		values, err := redis.Values(conn.Do("SCAN", cursor, "MATCH", match, "COUNT", 1000))
+		if err != nil {
+			c.logger.Error("client.find_waiting_job.scan", errAttr(err))
+			return nil, err
+		}
+
+		var keys []string
+		if _, err := redis.Scan(values, &cursor, &keys); err != nil {
+			c.logger.Error("client.find_waiting_job.scan", errAttr(err))
+			return nil, err
+		}
+
+		for _, key := range keys {
+			job, err := c.findListJob(conn, key, needle, jobID)
+			if err != nil {
+				return nil, err
+			}
+			if job != nil {
+				parentID := strings.TrimPrefix(key, prefix)
+				return &JobLocation{Kind: JobLocationWaiting, Key: key, ParentID: parentID, Job: job}, nil
+			}
+		}
+
+		if cursor == "0" {
+			return nil, ErrJobNotFound
+		}
+	}
+}
+
+// findZsetJob scans the zset key for the job with the specified ID, whose JSON contains needle, and returns it
+// with its score, or nil if it isn't found.
+func (c *Client) findZsetJob(conn redis.Conn, key string, needle []byte, jobID string) (*Job, int64, error) {
+	match := "*" + redisGlobEscaper.Replace(string(needle)) + "*"
+	cursor := "0"
+	for {
+		values, err := redis.Values(conn.Do("ZSCAN", key, cursor, "MATCH", match, "COUNT", 1000))
+		if err != nil {
+			c.logger.Error("client.find_zset_job.zscan", errAttr(err))
+			return nil, 0, err
+		}
+
+		var pairs []interface{}
+		if _, err := redis.Scan(values, &cursor, &pairs); err != nil {
+			c.logger.Error("client.find_zset_job.scan", errAttr(err))
+			return nil, 0, err
+		}
+
+		var members []jobScore
+		if err := redis.ScanSlice(pairs, &members); err != nil {
+			c.logger.Error("client.find_zset_job.scan_slice", errAttr(err))
+			return nil, 0, err
+		}
+
+		for _, m := range members {
+			// The match is only a hint, e.g. the ID could be in the args of another job.
+			job, err := newJob(m.JobBytes, nil, nil, c.codec)
+			if err == nil && job.ID == jobID {
+				return job, m.Score, nil
+			}
+		}
+
+		if cursor == "0" {
+			return nil, 0, nil
+		}
+	}
+}
+
+// findListJob reads the list key in batches for the job with the specified ID, whose JSON contains needle, and
+// returns it, or nil if it isn't found.
+func (c *Client) findListJob(conn redis.Conn, key string, needle []byte, jobID string) (*Job, error) {
+	const batch = 1000
+	for start := 0; ; start += batch {
+		values, err := redis.ByteSlices(conn.Do("LRANGE", key, start, start+batch-1))
+		if err != nil {
+			c.logger.Error("client.find_list_job.lrange", errAttr(err))
+			return nil, err
+		}
+
+		for _, rawJSON := range values {
+			if !bytes.Contains(rawJSON, needle) {
+				continue
+			}
+			job, err := newJob(rawJSON, nil, nil, c.codec)
+			if err == nil && job.ID == jobID {
+				return job, nil
+			}
+		}
+
+		if len(values) < batch {
+			return nil, nil
+		}
+	}
+}
+
 type jobScore struct {
 	JobBytes []byte
 	Score    int64
@@ -577,7 +1512,7 @@ func (c *Client) getZsetPage(key string, page uint) ([]jobScore, int64, error) {
 	}
 
 	for i, jws := range jobsWithScores {
-		job, err := newJob(jws.JobBytes, nil, nil)
+		job, err := newJob(jws.JobBytes, nil, nil, c.codec)
 		if err != nil {
 			c.logger.Error("client.get_zset_page.new_job", errAttr(err))
 			return nil, 0, err
@@ -595,9 +1530,101 @@ func (c *Client) getZsetPage(key string, page uint) ([]jobScore, int64, error) {
 	return jobsWithScores, count, nil
 }
 
+// DiscoverNamespaces returns the sorted namespaces under rootPrefix which have worker pools, found by their
+// worker_pools keys, e.g. for a dashboard of all the apps using a shared Redis. The keys are found with SCAN, so
+// Redis isn't blocked, but namespaces with pools starting or stopping during the scan may be missed. Only the
+// namespaces with the default key separator are found; the ones in cluster mode are returned without the braces
+// of their hash tag. On Redis Cluster, only the keys of the node behind pool are scanned.
+func DiscoverNamespaces(pool Pool, rootPrefix string) ([]string, error) {
+	conn := pool.Get()
+	defer conn.Close()
+
+	const suffix = "worker_pools"
+	// The keys of the namespaces in cluster mode start with a brace.
+	match := "*" + redisGlobEscaper.Replace(rootPrefix) + "*" + suffix
+	seen := make(map[string]bool)
+	cursor := "0"
+	for {
+		values, err := redis.Values(conn.Do("SCAN", cursor, "MATCH", match, "COUNT", 1000))
+		if err != nil {
+			return nil, err
+		}
+
+		var keys []string
+		if _, err := redis.Scan(values, &cursor, &keys); err != nil {
+			return nil, err
+		}
+
+		for _, key := range keys {
+			namespace := strings.TrimSuffix(key, suffix)
+			if namespace != "" && !strings.HasSuffix(namespace, defaultKeySeparator) {
+				continue // e.g. "myapp:other_worker_pools"
+			}
+			namespace = strings.TrimSuffix(namespace, defaultKeySeparator)
+
+			if strings.HasPrefix(namespace, "{") && strings.HasSuffix(namespace, "}") {
+				namespace = namespace[1 : len(namespace)-1]
+			}
+
+			if strings.HasPrefix(namespace, rootPrefix) {
+				seen[namespace] = true
+			}
+		}
+
+		if cursor == "0" {
+			break
+		}
+	}
+
+	namespaces := make([]string, 0, len(seen))
+	for namespace := range seen {
+		namespaces = append(namespaces, namespace)
+	}
+	sort.Strings(namespaces)
+
+	return namespaces, nil
+}
+
+// redisGlobEscaper escapes the special characters of the patterns of SCAN MATCH.
+var redisGlobEscaper = strings.NewReplacer(`\`, `\\`, "*", `\*`, "?", `\?`, "[", `\[`, "]", `\]`)
+
 // WorkerPoolOption is an optional option for WorkerPool.
 type ClientOption func(*Client)
 
+// WithClientKeySeparator sets the separator used in the Redis keys of the client. See WithKeySeparator.
+func WithClientKeySeparator(sep string) ClientOption {
+	return func(c *Client) {
+		if sep != "" {
+			c.keys.sep = sep
+		}
+	}
+}
+
+// WithClientClusterMode puts all the keys of the client into a single Redis Cluster hash slot. See WithClusterMode.
+func WithClientClusterMode() ClientOption {
+	return func(c *Client) {
+		c.keys = c.keys.inCluster()
+	}
+}
+
+// WithClientArgsCodec sets the codec used to decode the arguments of jobs. See WithArgsCodec.
+func WithClientArgsCodec(codec ArgsCodec) ClientOption {
+	return func(c *Client) {
+		c.codec = codec
+	}
+}
+
+// WithClientBulkTimeout sets the read timeout of the bulk operations of the client, which can take longer than
+// the other commands on big queues: RetryAllDeadJobs, RequeueAllRetryJobs, DeadJobsByName, DeleteDeadJobsByName,
+// DeleteAllDeadJobs and FindJob. It overrides the one of the Redis pool, so the pool can keep a short timeout,
+// e.g. for the fetches of the workers. It needs the connections of the pool to support per-command timeouts
+// (redis.ConnWithTimeout), like the ones of *redis.Pool; it's ignored otherwise. 0 means the timeout of the pool.
+func WithClientBulkTimeout(timeout time.Duration) ClientOption {
+	return func(c *Client) {
+		c.bulkTimeout = timeout
+	}
+}
+
 // WithClientLogger registers logger.
 func WithClientLogger(l StructuredLogger) ClientOption {
 	return func(c *Client) {
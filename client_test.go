@@ -63,6 +63,34 @@ func TestClientWorkerPoolHeartbeats(t *testing.T) {
 	assert.Equal(t, 0, len(hbs))
 }
 
+func TestClientStalePools(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work"
+	cleanKeyspace(ns, pool)
+
+	setNowEpochSecondsMock(1425263409)
+	defer resetNowEpochSecondsMock()
+
+	conn := pool.Get()
+	defer conn.Close()
+
+	for id, heartbeatAt := range map[string]int64{"alive": 1425263399, "stale": 1425263309} {
+		_, err := conn.Do("HSET", redisKeyHeartbeat(newKeyspace(ns), id), "heartbeat_at", heartbeatAt)
+		assert.NoError(t, err)
+	}
+	_, err := conn.Do("SADD", redisKeyWorkerPools(newKeyspace(ns)), "alive", "stale", "gone")
+	assert.NoError(t, err)
+
+	client := NewClient(ns, pool)
+	stale, err := client.StalePools(time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"gone", "stale"}, stale)
+
+	stale, err = client.StalePools(time.Hour)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"gone"}, stale)
+}
+
 func TestClientWorkerObservations(t *testing.T) {
 	pool := newTestPool(":6379")
 	ns := "work"
@@ -132,6 +160,113 @@ func TestClientWorkerObservations(t *testing.T) {
 	assert.Equal(t, 0, len(observations))
 }
 
+func TestClientWorkerObservationsProgress(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work"
+	cleanKeyspace(ns, pool)
+
+	_, err := NewEnqueuer(ns, pool).Enqueue("wat", nil)
+	assert.NoError(t, err)
+
+	checkedIn := make(chan struct{})
+	release := make(chan struct{})
+
+	wp := NewWorkerPool(TestContext{}, 1, ns, pool)
+	wp.Job("wat", func(job *Job) error {
+		if err := job.CheckinWithProgress("halfway", 50); err != nil {
+			return err
+		}
+		close(checkedIn)
+		<-release
+		return nil
+	})
+	wp.Start()
+	defer wp.Stop()
+
+	<-checkedIn
+	wp.workers[0].observer.drain()
+
+	observations, err := NewClient(ns, pool).WorkerObservations()
+	assert.NoError(t, err)
+	if assert.Equal(t, 1, len(observations)) {
+		assert.Equal(t, "halfway", observations[0].Checkin)
+		assert.True(t, observations[0].CheckinAt > 0)
+		if assert.NotNil(t, observations[0].Progress) {
+			assert.EqualValues(t, 50, *observations[0].Progress)
+		}
+	}
+
+	close(release)
+}
+
+func TestClientWorkers(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work"
+	cleanKeyspace(ns, pool)
+
+	job, err := NewEnqueuer(ns, pool).Enqueue("wat", nil)
+	assert.NoError(t, err)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+
+	wp := NewWorkerPool(TestContext{}, 2, ns, pool)
+	wp.Job("wat", func(job *Job) error {
+		job.Checkin("batch 3/10")
+		close(started)
+		<-release
+		return nil
+	})
+	wp.Start()
+	defer wp.Stop()
+
+	<-started
+	for _, w := range wp.workers {
+		w.observer.drain()
+	}
+	for !keyExists(pool, redisKeyHeartbeat(newKeyspace(ns), wp.workerPoolID)) {
+		time.Sleep(time.Millisecond)
+	}
+
+	// Pretend the job has been running for a minute.
+	busyID := ""
+	for _, w := range wp.workers {
+		key := redisKeyWorkerObservation(newKeyspace(ns), w.workerID)
+		if keyExists(pool, key) {
+			busyID = w.workerID
+			conn := pool.Get()
+			_, err := conn.Do("HSET", key, "started_at", nowEpochSeconds()-60)
+			conn.Close()
+			assert.NoError(t, err)
+		}
+	}
+
+	client := NewClient(ns, pool)
+	workers, err := client.Workers(wp.workerPoolID)
+	assert.NoError(t, err)
+	if assert.Equal(t, 2, len(workers)) {
+		assert.True(t, workers[0].WorkerID < workers[1].WorkerID)
+		for _, w := range workers {
+			if w.WorkerID == busyID {
+				assert.True(t, w.IsBusy)
+				assert.Equal(t, "wat", w.JobName)
+				assert.Equal(t, job.ID, w.JobID)
+				assert.Equal(t, "batch 3/10", w.Checkin)
+				assert.True(t, w.CheckinAt > 0)
+				assert.True(t, w.Runtime >= time.Minute && w.Runtime < time.Minute+3*time.Second, w.Runtime)
+			} else {
+				assert.Equal(t, WorkerStatus{WorkerID: w.WorkerID}, w)
+			}
+		}
+	}
+
+	workers, err = client.Workers("unknown")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(workers))
+
+	close(release)
+}
+
 func TestClientQueues(t *testing.T) {
 	pool := newTestPool(":6379")
 	ns := "work"
@@ -183,6 +318,59 @@ func TestClientQueues(t *testing.T) {
 	assert.EqualValues(t, 0, queues[2].Latency)
 }
 
+func TestClientQueueLatency(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work"
+	cleanKeyspace(ns, pool)
+
+	client := NewClient(ns, pool)
+	latency, err := client.QueueLatency("foo")
+	assert.NoError(t, err)
+	assert.EqualValues(t, 0, latency)
+
+	enqueuer := NewEnqueuer(ns, pool)
+	setNowEpochSecondsMock(1425263409)
+	defer resetNowEpochSecondsMock()
+	_, err = enqueuer.Enqueue("foo", nil)
+	assert.NoError(t, err)
+	setNowEpochSecondsMock(1425263509)
+	_, err = enqueuer.Enqueue("foo", nil)
+	assert.NoError(t, err)
+
+	setNowEpochSecondsMock(1425263709)
+	latency, err = client.QueueLatency("foo")
+	assert.NoError(t, err)
+	assert.Equal(t, 300*time.Second, latency)
+}
+
+func TestClientActiveJobCounts(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work"
+	cleanKeyspace(ns, pool)
+
+	client := NewClient(ns, pool)
+	counts, err := client.ActiveJobCounts()
+	assert.NoError(t, err)
+	assert.Empty(t, counts)
+
+	enqueuer := NewEnqueuer(ns, pool)
+	for _, name := range []string{"foo", "bar", "baz"} {
+		_, err = enqueuer.Enqueue(name, nil)
+		assert.NoError(t, err)
+	}
+
+	conn := pool.Get()
+	defer conn.Close()
+	_, err = conn.Do("SET", redisKeyJobsLock(newKeyspace(ns), "foo"), 3)
+	assert.NoError(t, err)
+	_, err = conn.Do("SET", redisKeyJobsLock(newKeyspace(ns), "bar"), -1)
+	assert.NoError(t, err)
+
+	counts, err = client.ActiveJobCounts()
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int64{"foo": 3, "bar": 0, "baz": 0}, counts)
+}
+
 func TestClientScheduledJobs(t *testing.T) {
 	pool := newTestPool(":6379")
 	ns := "work"
@@ -228,7 +416,16 @@ func TestClientScheduledJobs(t *testing.T) {
 		assert.Equal(t, "", jobs[0].LastErr)
 		assert.Equal(t, "", jobs[1].LastErr)
 		assert.Equal(t, "", jobs[2].LastErr)
+
+		assert.Equal(t, time.Duration(0), jobs[0].Wait())
+		assert.Equal(t, 4*time.Second, jobs[2].Wait())
 	}
+
+	stats, err := client.ScheduledStats()
+	assert.NoError(t, err)
+	assert.Equal(t, &ScheduledStats{
+		Scheduled: ZsetStats{Count: 3, MinScore: 1425263409, MaxScore: 1425263413},
+	}, stats)
 }
 
 func TestClientRetryJobs(t *testing.T) {
@@ -267,6 +464,11 @@ func TestClientRetryJobs(t *testing.T) {
 		assert.EqualValues(t, 1, jobs[0].Fails)
 		assert.EqualValues(t, 1425263429, jobs[0].Job.FailedAt)
 		assert.Equal(t, "ohno", jobs[0].LastErr)
+		assert.Equal(t, time.Duration(jobs[0].RetryAt-1425263429)*time.Second, jobs[0].Wait())
+
+		stats, err := client.ScheduledStats()
+		assert.NoError(t, err)
+		assert.Equal(t, ZsetStats{Count: 1, MinScore: jobs[0].RetryAt, MaxScore: jobs[0].RetryAt}, stats.Retry)
 	}
 }
 
@@ -325,6 +527,52 @@ func TestClientDeadJobs(t *testing.T) {
 	assert.EqualValues(t, 0, count)
 }
 
+func TestClientDeadJobsByName(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "testwork"
+	cleanKeyspace(ns, pool)
+
+	// Enough jobs to span several runs of the script.
+	var foos []*Job
+	for i := int64(0); i < 120; i++ {
+		if i%4 == 0 {
+			foos = append(foos, insertDeadJob(ns, pool, "foo", 12345, 12346+i))
+		} else {
+			insertDeadJob(ns, pool, "wat", 12345, 12346+i)
+		}
+	}
+
+	client := NewClient(ns, pool)
+	jobs, count, err := client.DeadJobsByName("foo", 1)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 30, count)
+	if assert.Equal(t, 20, len(jobs)) {
+		for i, job := range jobs {
+			assert.Equal(t, "foo", job.Name)
+			assert.Equal(t, foos[i].ID, job.ID)
+			assert.Equal(t, foos[i].FailedAt, job.DiedAt)
+		}
+	}
+
+	jobs, count, err = client.DeadJobsByName("foo", 2)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 30, count)
+	if assert.Equal(t, 10, len(jobs)) {
+		assert.Equal(t, foos[20].ID, jobs[0].ID)
+		assert.Equal(t, foos[29].ID, jobs[9].ID)
+	}
+
+	jobs, count, err = client.DeadJobsByName("wat", 5)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 90, count)
+	assert.Equal(t, 10, len(jobs))
+
+	jobs, count, err = client.DeadJobsByName("bar", 1)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 0, count)
+	assert.Equal(t, 0, len(jobs))
+}
+
 func TestClientDeleteDeadJob(t *testing.T) {
 	pool := newTestPool(":6379")
 	ns := "testwork"
@@ -410,6 +658,47 @@ func TestClientRetryDeadJob(t *testing.T) {
 	assert.EqualValues(t, 0, job1.FailedAt)
 }
 
+func TestClientRequeueDeadJobKeepingHistory(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "testwork"
+	cleanKeyspace(ns, pool)
+
+	setNowEpochSecondsMock(1425263409)
+	defer resetNowEpochSecondsMock()
+
+	_, err := NewEnqueuer(ns, pool).Enqueue("wat", nil)
+	assert.NoError(t, err)
+
+	wp := NewWorkerPool(TestContext{}, 1, ns, pool)
+	wp.JobWithOptions("wat", JobOptions{MaxFails: 1}, func(job *Job) error {
+		return fmt.Errorf("ohno %d", len(job.History))
+	})
+
+	client := NewClient(ns, pool)
+	for i := int64(0); i < 2; i++ {
+		setNowEpochSecondsMock(1425263409 + i*100)
+		wp.Start()
+		wp.Drain()
+		wp.Stop()
+
+		jobs, _, err := client.DeadJobs(1)
+		assert.NoError(t, err)
+		if assert.Equal(t, 1, len(jobs)) {
+			assert.NoError(t, client.RequeueDeadJobKeepingHistory(jobs[0].DiedAt, jobs[0].ID))
+		}
+	}
+
+	job := getQueuedJob(ns, pool, "wat")
+	if assert.NotNil(t, job) {
+		assert.EqualValues(t, 0, job.Fails)
+		assert.Equal(t, "", job.LastErr)
+		assert.Equal(t, []JobDeath{
+			{DiedAt: 1425263409, Fails: 1, Err: "ohno 0"},
+			{DiedAt: 1425263509, Fails: 1, Err: "ohno 1"},
+		}, job.History)
+	}
+}
+
 func TestClientRetryDeadJobWithArgs(t *testing.T) {
 	pool := newTestPool(":6379")
 	ns := "testwork"
@@ -433,12 +722,12 @@ func TestClientRetryDeadJobWithArgs(t *testing.T) {
 
 	conn := pool.Get()
 	defer conn.Close()
-	_, err := conn.Do("ZADD", redisKeyDead(ns), failAt, rawJSON)
+	_, err := conn.Do("ZADD", redisKeyDead(newKeyspace(ns)), failAt, rawJSON)
 	if err != nil {
 		panic(err.Error())
 	}
 
-	if _, err := conn.Do("SADD", redisKeyKnownJobs(ns), name); err != nil {
+	if _, err := conn.Do("SADD", redisKeyKnownJobs(newKeyspace(ns)), name); err != nil {
 		panic(err)
 	}
 
@@ -480,6 +769,38 @@ func TestClientDeleteAllDeadJobs(t *testing.T) {
 	assert.EqualValues(t, 0, count)
 }
 
+func TestClientDeleteDeadJobsByName(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "testwork"
+	cleanKeyspace(ns, pool)
+
+	// Enough jobs to span several runs of the script.
+	for i := int64(0); i < 2500; i++ {
+		if i%4 == 0 {
+			insertDeadJob(ns, pool, "foo", 12345, 12346+i)
+		} else {
+			insertDeadJob(ns, pool, "wat", 12345, 12346+i)
+		}
+	}
+
+	client := NewClient(ns, pool)
+	deleted, err := client.DeleteDeadJobsByName("foo")
+	assert.NoError(t, err)
+	assert.EqualValues(t, 625, deleted)
+
+	_, count, err := client.DeadJobsByName("foo", 1)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 0, count)
+
+	_, count, err = client.DeadJobs(1)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 1875, count)
+
+	deleted, err = client.DeleteDeadJobsByName("bar")
+	assert.NoError(t, err)
+	assert.EqualValues(t, 0, deleted)
+}
+
 func TestClientRetryAllDeadJobs(t *testing.T) {
 	pool := newTestPool(":6379")
 	ns := "testwork"
@@ -548,7 +869,7 @@ func TestClientRetryAllDeadJobsBig(t *testing.T) {
 
 	// Ok, we need to efficiently add 10k jobs to the dead queue.
 	// I tried using insertDeadJob but it was too slow (increased test time by 1 second)
-	dead := redisKeyDead(ns)
+	dead := redisKeyDead(newKeyspace(ns))
 	for i := 0; i < 10000; i++ {
 		job := &Job{
 			Name:       "wat1",
@@ -566,7 +887,7 @@ func TestClientRetryAllDeadJobsBig(t *testing.T) {
 	err := conn.Flush()
 	assert.NoError(t, err)
 
-	if _, err := conn.Do("SADD", redisKeyKnownJobs(ns), "wat1"); err != nil {
+	if _, err := conn.Do("SADD", redisKeyKnownJobs(newKeyspace(ns)), "wat1"); err != nil {
 		panic(err)
 	}
 
@@ -599,7 +920,7 @@ func TestClientRetryAllDeadJobsBig(t *testing.T) {
 	assert.NoError(t, err)
 	assert.EqualValues(t, 1, count) // the funny job that we didn't know how to queue up
 
-	jobCount := listSize(pool, redisKeyJobs(ns, "wat1"))
+	jobCount := listSize(pool, redisKeyJobs(newKeyspace(ns), "wat1"))
 	assert.EqualValues(t, 10000, jobCount)
 
 	_, job = jobOnZset(pool, dead)
@@ -625,7 +946,7 @@ func TestClientDeleteScheduledJob(t *testing.T) {
 
 	err = client.DeleteScheduledJob(j.RunAt, j.ID)
 	assert.NoError(t, err)
-	assert.EqualValues(t, 0, zsetSize(pool, redisKeyScheduled(ns)))
+	assert.EqualValues(t, 0, zsetSize(pool, redisKeyScheduled(newKeyspace(ns))))
 }
 
 func TestClientDeleteScheduledUniqueJob(t *testing.T) {
@@ -642,7 +963,7 @@ func TestClientDeleteScheduledUniqueJob(t *testing.T) {
 	client := NewClient(ns, pool)
 	err = client.DeleteScheduledJob(j.RunAt, j.ID)
 	assert.NoError(t, err)
-	assert.EqualValues(t, 0, zsetSize(pool, redisKeyScheduled(ns)))
+	assert.EqualValues(t, 0, zsetSize(pool, redisKeyScheduled(newKeyspace(ns))))
 
 	j, err = enq.EnqueueUniqueIn("foo", 10, nil) // Can do it again
 	assert.NoError(t, err)
@@ -679,10 +1000,348 @@ func TestClientDeleteRetryJob(t *testing.T) {
 	if assert.EqualValues(t, 1, count) {
 		err = client.DeleteRetryJob(jobs[0].RetryAt, job.ID)
 		assert.NoError(t, err)
-		assert.EqualValues(t, 0, zsetSize(pool, redisKeyRetry(ns)))
+		assert.EqualValues(t, 0, zsetSize(pool, redisKeyRetry(newKeyspace(ns))))
 	}
 }
 
+func TestClientRequeueRetryJob(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "testwork"
+	cleanKeyspace(ns, pool)
+
+	setNowEpochSecondsMock(1425263409)
+	defer resetNowEpochSecondsMock()
+
+	enqueuer := NewEnqueuer(ns, pool)
+	for i := 0; i < 2; i++ {
+		_, err := enqueuer.Enqueue("wat", Q{"i": i})
+		assert.NoError(t, err)
+	}
+
+	wp := NewWorkerPool(TestContext{}, 10, ns, pool)
+	wp.Job("wat", func(job *Job) error {
+		return fmt.Errorf("ohno")
+	})
+	wp.Start()
+	wp.Drain()
+	wp.Stop()
+
+	client := NewClient(ns, pool)
+	jobs, count, err := client.RetryJobs(1)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 2, count)
+
+	setNowEpochSecondsMock(1425263429)
+
+	retryJob := jobs[0]
+	n, err := client.RequeueRetryJob(retryJob.RetryAt, retryJob.ID)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 1, n)
+
+	assert.EqualValues(t, 1, zsetSize(pool, redisKeyRetry(newKeyspace(ns))))
+	job := jobOnQueue(pool, redisKeyJobs(newKeyspace(ns), "wat"))
+	assert.Equal(t, retryJob.ID, job.ID)
+	assert.EqualValues(t, 1425263429, job.EnqueuedAt)
+	assert.EqualValues(t, 0, job.Fails)
+	assert.Equal(t, "", job.LastErr)
+	assert.EqualValues(t, 0, job.FirstEnqueuedAt)
+
+	// It's gone from the retry queue now.
+	n, err = client.RequeueRetryJob(retryJob.RetryAt, retryJob.ID)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 0, n)
+
+	// A retry job whose name isn't known anymore is moved to the dead queue.
+	conn := pool.Get()
+	_, err = conn.Do("ZADD", redisKeyRetry(newKeyspace(ns)), 1425263509, `{"name":"gone","id":"123","t":1425263409,"fails":1}`)
+	assert.NoError(t, err)
+	conn.Close()
+
+	n, err = client.RequeueRetryJob(1425263509, "123")
+	assert.NoError(t, err)
+	assert.EqualValues(t, 0, n)
+	assert.EqualValues(t, 1, zsetSize(pool, redisKeyRetry(newKeyspace(ns))))
+	assert.EqualValues(t, 1, zsetSize(pool, redisKeyDead(newKeyspace(ns))))
+}
+
+func TestClientRequeueAllRetryJobs(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "testwork"
+	cleanKeyspace(ns, pool)
+
+	setNowEpochSecondsMock(1425263409)
+	defer resetNowEpochSecondsMock()
+
+	enqueuer := NewEnqueuer(ns, pool)
+	for i := 0; i < 3; i++ {
+		_, err := enqueuer.Enqueue("wat", Q{"i": i})
+		assert.NoError(t, err)
+	}
+
+	wp := NewWorkerPool(TestContext{}, 10, ns, pool)
+	wp.Job("wat", func(job *Job) error {
+		return fmt.Errorf("ohno")
+	})
+	wp.Start()
+	wp.Drain()
+	wp.Stop()
+	assert.EqualValues(t, 3, zsetSize(pool, redisKeyRetry(newKeyspace(ns))))
+
+	// A retry job whose name isn't known anymore.
+	conn := pool.Get()
+	_, err := conn.Do("ZADD", redisKeyRetry(newKeyspace(ns)), 1425263409+100, `{"name":"gone","id":"123","t":1425263409,"fails":1}`)
+	assert.NoError(t, err)
+	conn.Close()
+
+	setNowEpochSecondsMock(1425263429)
+
+	client := NewClient(ns, pool)
+	n, err := client.RequeueAllRetryJobs()
+	assert.NoError(t, err)
+	assert.EqualValues(t, 3, n)
+
+	assert.EqualValues(t, 0, zsetSize(pool, redisKeyRetry(newKeyspace(ns))))
+	assert.EqualValues(t, 1, zsetSize(pool, redisKeyDead(newKeyspace(ns))))
+	assert.EqualValues(t, 3, listSize(pool, redisKeyJobs(newKeyspace(ns), "wat")))
+
+	job := jobOnQueue(pool, redisKeyJobs(newKeyspace(ns), "wat"))
+	assert.EqualValues(t, 1425263429, job.EnqueuedAt)
+	assert.EqualValues(t, 0, job.Fails)
+	assert.Equal(t, "", job.LastErr)
+	assert.EqualValues(t, 0, job.FailedAt)
+
+	n, err = client.RequeueAllRetryJobs()
+	assert.NoError(t, err)
+	assert.EqualValues(t, 0, n)
+}
+
+func TestClientInProgressJobs(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work"
+	cleanKeyspace(ns, pool)
+
+	enqueuer := NewEnqueuer(ns, pool)
+	j1, err := enqueuer.Enqueue("wat", Q{"a": 1})
+	assert.NoError(t, err)
+	j2, err := enqueuer.Enqueue("wat", Q{"a": 2})
+	assert.NoError(t, err)
+	_, err = enqueuer.Enqueue("foo", nil)
+	assert.NoError(t, err)
+
+	conn := pool.Get()
+	defer conn.Close()
+	for i := 0; i < 2; i++ {
+		_, err = conn.Do("RPOPLPUSH", redisKeyJobs(newKeyspace(ns), "wat"), redisKeyJobsInProgress(newKeyspace(ns), "1", "wat"))
+		assert.NoError(t, err)
+	}
+
+	client := NewClient(ns, pool)
+	jobs, err := client.InProgressJobs("1")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(jobs))
+	if assert.Equal(t, 2, len(jobs["wat"])) {
+		assert.ElementsMatch(t, []string{j1.ID, j2.ID}, []string{jobs["wat"][0].ID, jobs["wat"][1].ID})
+	}
+
+	jobs, err = client.InProgressJobs("2")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(jobs))
+}
+
+func TestClientFindJob(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work"
+	cleanKeyspace(ns, pool)
+
+	enqueuer := NewEnqueuer(ns, pool)
+	inProgress, err := enqueuer.Enqueue("wat", nil)
+	assert.NoError(t, err)
+	queued, err := enqueuer.Enqueue("wat", nil)
+	assert.NoError(t, err)
+	scheduled, err := enqueuer.EnqueueIn("foo", 100, nil)
+	assert.NoError(t, err)
+	// The ID in the args of another job isn't a match.
+	_, err = enqueuer.Enqueue("foo", Q{"id": queued.ID})
+	assert.NoError(t, err)
+
+	conn := pool.Get()
+	defer conn.Close()
+	_, err = conn.Do("RPOPLPUSH", redisKeyJobs(newKeyspace(ns), "wat"), redisKeyJobsInProgress(newKeyspace(ns), "1", "wat"))
+	assert.NoError(t, err)
+	_, err = conn.Do("SADD", redisKeyWorkerPools(newKeyspace(ns)), "1")
+	assert.NoError(t, err)
+
+	retry := &Job{Name: "foo", ID: makeIdentifier()}
+	dead := &Job{Name: "foo", ID: makeIdentifier()}
+	for key, job := range map[string]*Job{redisKeyRetry(newKeyspace(ns)): retry, redisKeyDead(newKeyspace(ns)): dead} {
+		rawJSON, err := job.serialize()
+		assert.NoError(t, err)
+		_, err = conn.Do("ZADD", key, 1425263409, rawJSON)
+		assert.NoError(t, err)
+	}
+
+	client := NewClient(ns, pool)
+
+	loc, err := client.FindJob(queued.ID)
+	if assert.NoError(t, err) {
+		assert.Equal(t, JobLocationQueued, loc.Kind)
+		assert.Equal(t, redisKeyJobs(newKeyspace(ns), "wat"), loc.Key)
+		assert.Equal(t, queued.ID, loc.Job.ID)
+	}
+
+	loc, err = client.FindJob(inProgress.ID)
+	if assert.NoError(t, err) {
+		assert.Equal(t, JobLocationInProgress, loc.Kind)
+		assert.Equal(t, "1", loc.PoolID)
+		assert.Equal(t, redisKeyJobsInProgress(newKeyspace(ns), "1", "wat"), loc.Key)
+	}
+
+	loc, err = client.FindJob(scheduled.ID)
+	if assert.NoError(t, err) {
+		assert.Equal(t, JobLocationScheduled, loc.Kind)
+		assert.Equal(t, scheduled.RunAt, loc.Score)
+		assert.Equal(t, "foo", loc.Job.Name)
+	}
+
+	loc, err = client.FindJob(retry.ID)
+	if assert.NoError(t, err) {
+		assert.Equal(t, JobLocationRetry, loc.Kind)
+		assert.EqualValues(t, 1425263409, loc.Score)
+		assert.NoError(t, client.DeleteRetryJob(loc.Score, loc.Job.ID))
+	}
+
+	loc, err = client.FindJob(dead.ID)
+	if assert.NoError(t, err) {
+		assert.Equal(t, JobLocationDead, loc.Kind)
+		assert.Equal(t, redisKeyDead(newKeyspace(ns)), loc.Key)
+	}
+
+	prioritized, err := enqueuer.EnqueueWithPriority("bar", 10, nil)
+	assert.NoError(t, err)
+	loc, err = client.FindJob(prioritized.ID)
+	if assert.NoError(t, err) {
+		assert.Equal(t, JobLocationQueued, loc.Kind)
+		assert.Equal(t, redisKeyJobsPriority(newKeyspace(ns), "bar", 10), loc.Key)
+	}
+
+	child, err := enqueuer.EnqueueAfter(queued.ID, "foo", nil)
+	assert.NoError(t, err)
+	loc, err = client.FindJob(child.ID)
+	if assert.NoError(t, err) {
+		assert.Equal(t, JobLocationWaiting, loc.Kind)
+		assert.Equal(t, queued.ID, loc.ParentID)
+		assert.Equal(t, redisKeyJobChildren(newKeyspace(ns), queued.ID), loc.Key)
+	}
+
+	_, err = client.FindJob(retry.ID)
+	assert.Equal(t, ErrJobNotFound, err)
+	_, err = client.FindJob("nope")
+	assert.Equal(t, ErrJobNotFound, err)
+}
+
+func TestClientRequeueInProgressJob(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work"
+	cleanKeyspace(ns, pool)
+
+	enqueuer := NewEnqueuer(ns, pool)
+	j1, err := enqueuer.Enqueue("wat", Q{"a": 1})
+	assert.NoError(t, err)
+	_, err = enqueuer.Enqueue("wat", Q{"a": 2})
+	assert.NoError(t, err)
+
+	conn := pool.Get()
+	defer conn.Close()
+	for i := 0; i < 2; i++ {
+		_, err = conn.Do("RPOPLPUSH", redisKeyJobs(newKeyspace(ns), "wat"), redisKeyJobsInProgress(newKeyspace(ns), "1", "wat"))
+		assert.NoError(t, err)
+	}
+	_, err = conn.Do("SET", redisKeyJobsLock(newKeyspace(ns), "wat"), 2)
+	assert.NoError(t, err)
+	_, err = conn.Do("HSET", redisKeyJobsLockInfo(newKeyspace(ns), "wat"), "1", 2)
+	assert.NoError(t, err)
+
+	client := NewClient(ns, pool)
+	assert.NoError(t, client.RequeueInProgressJob("1", "wat", j1.ID))
+
+	assert.EqualValues(t, 1, listSize(pool, redisKeyJobsInProgress(newKeyspace(ns), "1", "wat")))
+	assert.EqualValues(t, 1, getInt64(pool, redisKeyJobsLock(newKeyspace(ns), "wat")))
+	assert.EqualValues(t, 1, hgetInt64(pool, redisKeyJobsLockInfo(newKeyspace(ns), "wat"), "1"))
+	assert.Equal(t, j1.ID, jobOnQueue(pool, redisKeyJobs(newKeyspace(ns), "wat")).ID)
+
+	// Calling it again doesn't release the lock twice.
+	assert.Equal(t, ErrNotRetried, client.RequeueInProgressJob("1", "wat", j1.ID))
+	assert.EqualValues(t, 1, getInt64(pool, redisKeyJobsLock(newKeyspace(ns), "wat")))
+	assert.EqualValues(t, 1, hgetInt64(pool, redisKeyJobsLockInfo(newKeyspace(ns), "wat"), "1"))
+}
+
+func TestClientJobResult(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work"
+	cleanKeyspace(ns, pool)
+
+	wp := NewWorkerPool(TestContext{}, 1, ns, pool, WithJobResultTTL(time.Minute))
+	wp.Job("report", func(job *Job) error {
+		job.SetResult(map[string]string{"url": "https://example.com/report"})
+		return nil
+	})
+	wp.Job("quiet", func(job *Job) error {
+		return nil
+	})
+	wp.JobWithOptions("fail", JobOptions{MaxFails: 1}, func(job *Job) error {
+		job.SetResult("partial")
+		return fmt.Errorf("oops")
+	})
+
+	enqueuer := NewEnqueuer(ns, pool)
+	ids := map[string]string{}
+	for _, name := range []string{"report", "quiet", "fail"} {
+		job, err := enqueuer.Enqueue(name, nil)
+		assert.NoError(t, err)
+		ids[name] = job.ID
+	}
+
+	wp.Start()
+	wp.Drain()
+	wp.Stop()
+
+	client := NewClient(ns, pool)
+	result, err := client.JobResult(ids["report"])
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"url":"https://example.com/report"}`, string(result))
+
+	conn := pool.Get()
+	defer conn.Close()
+	ttl, err := redis.Int64(conn.Do("PTTL", redisKeyJobResult(newKeyspace(ns), ids["report"])))
+	assert.NoError(t, err)
+	assert.True(t, ttl > 0 && ttl <= time.Minute.Milliseconds(), "ttl %d", ttl)
+
+	for _, name := range []string{"quiet", "fail"} {
+		result, err = client.JobResult(ids[name])
+		assert.NoError(t, err)
+		assert.Nil(t, result, name)
+	}
+}
+
+func TestClientPauseResumeJob(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work"
+	cleanKeyspace(ns, pool)
+
+	client := NewClient(ns, pool)
+	assert.ErrorIs(t, client.PauseJob("wat"), ErrUnknownJob)
+	assert.ErrorIs(t, client.ResumeJob("wat"), ErrUnknownJob)
+
+	_, err := NewEnqueuer(ns, pool).Enqueue("wat", nil)
+	assert.NoError(t, err)
+
+	assert.NoError(t, client.PauseJob("wat"))
+	assert.True(t, keyExists(pool, redisKeyJobsPaused(newKeyspace(ns), "wat")))
+
+	assert.NoError(t, client.ResumeJob("wat"))
+	assert.False(t, keyExists(pool, redisKeyJobsPaused(newKeyspace(ns), "wat")))
+}
+
 func insertDeadJob(ns string, pool *redis.Pool, name string, encAt, failAt int64) *Job {
 	job := &Job{
 		Name:       name,
@@ -698,12 +1357,12 @@ func insertDeadJob(ns string, pool *redis.Pool, name string, encAt, failAt int64
 
 	conn := pool.Get()
 	defer conn.Close()
-	_, err := conn.Do("ZADD", redisKeyDead(ns), failAt, rawJSON)
+	_, err := conn.Do("ZADD", redisKeyDead(newKeyspace(ns)), failAt, rawJSON)
 	if err != nil {
 		panic(err.Error())
 	}
 
-	if _, err := conn.Do("SADD", redisKeyKnownJobs(ns), name); err != nil {
+	if _, err := conn.Do("SADD", redisKeyKnownJobs(newKeyspace(ns)), name); err != nil {
 		panic(err)
 	}
 
@@ -713,14 +1372,104 @@ func insertDeadJob(ns string, pool *redis.Pool, name string, encAt, failAt int64
 func getQueuedJob(ns string, pool *redis.Pool, name string) *Job {
 	conn := pool.Get()
 	defer conn.Close()
-	jobBytes, err := redis.Bytes(conn.Do("RPOP", redisKeyJobsPrefix(ns)+name))
+	jobBytes, err := redis.Bytes(conn.Do("RPOP", redisKeyJobsPrefix(newKeyspace(ns))+name))
 	if err != nil {
 		return nil
 	}
 
-	job, err := newJob(jobBytes, nil, nil)
+	job, err := newJob(jobBytes, nil, nil, nil)
 	if err != nil {
 		return nil
 	}
 	return job
 }
+
+func TestDiscoverNamespaces(t *testing.T) {
+	pool := newTestPool(":6379")
+	conn := pool.Get()
+	defer conn.Close()
+
+	keys := []string{
+		"discover-a:worker_pools",
+		"discover-b:worker_pools",
+		"{discover-c}:worker_pools",
+		"discover-d:other_worker_pools",
+		"other:worker_pools",
+		"other-discover-e:worker_pools",
+	}
+	for _, key := range keys {
+		_, err := conn.Do("SADD", key, "pool")
+		assert.NoError(t, err)
+		defer conn.Do("DEL", key)
+	}
+
+	namespaces, err := DiscoverNamespaces(pool, "discover-")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"discover-a", "discover-b", "discover-c"}, namespaces)
+
+	namespaces, err = DiscoverNamespaces(pool, "discover-b")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"discover-b"}, namespaces)
+
+	namespaces, err = DiscoverNamespaces(pool, "discover-[")
+	assert.NoError(t, err)
+	assert.Empty(t, namespaces)
+}
+
+func TestClientMigrateQueue(t *testing.T) {
+	pool := newTestPool(":6379")
+	src, dst := "work_old", "work_new"
+	cleanKeyspace(src, pool)
+	cleanKeyspace(dst, pool)
+
+	enqueuer := NewEnqueuer(src, pool)
+	var ids []string
+	for i := 0; i < 1500; i++ {
+		job, err := enqueuer.Enqueue("wat", Q{"i": i})
+		assert.NoError(t, err)
+		ids = append(ids, job.ID)
+	}
+
+	// peek returns the next job to be dequeued from queue.
+	peek := func(queue string) *Job {
+		conn := pool.Get()
+		defer conn.Close()
+
+		rawJSON, err := redis.Bytes(conn.Do("LINDEX", queue, -1))
+		assert.NoError(t, err)
+		job, err := newJob(rawJSON, nil, nil, nil)
+		assert.NoError(t, err)
+		return job
+	}
+
+	client := NewClient("work", pool)
+	moved, err := client.MigrateQueue(src, dst, "wat", 1200)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 1200, moved)
+	assert.EqualValues(t, 300, listSize(pool, redisKeyJobs(newKeyspace(src), "wat")))
+	assert.EqualValues(t, 1200, listSize(pool, redisKeyJobs(newKeyspace(dst), "wat")))
+	assert.Equal(t, []string{"wat"}, knownJobs(pool, redisKeyKnownJobs(newKeyspace(dst))))
+
+	// The oldest jobs are moved first, and stay the first ones to be dequeued.
+	job := peek(redisKeyJobs(newKeyspace(dst), "wat"))
+	assert.Equal(t, ids[0], job.ID)
+	job = peek(redisKeyJobs(newKeyspace(src), "wat"))
+	assert.Equal(t, ids[1200], job.ID)
+
+	// The rest is moved to a renamed job type.
+	moved, err = client.MigrateQueueWithRenames(src, dst, "wat", 0, map[string]string{"wat": "wot"})
+	assert.NoError(t, err)
+	assert.EqualValues(t, 300, moved)
+	assert.EqualValues(t, 0, listSize(pool, redisKeyJobs(newKeyspace(src), "wat")))
+	assert.EqualValues(t, 300, listSize(pool, redisKeyJobs(newKeyspace(dst), "wot")))
+	assert.ElementsMatch(t, []string{"wat", "wot"}, knownJobs(pool, redisKeyKnownJobs(newKeyspace(dst))))
+
+	job = peek(redisKeyJobs(newKeyspace(dst), "wot"))
+	assert.Equal(t, "wot", job.Name)
+	assert.Equal(t, ids[1200], job.ID)
+	assert.EqualValues(t, 1200, job.ArgInt64("i"))
+
+	moved, err = client.MigrateQueue(src, dst, "wat", 0)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 0, moved)
+}
@@ -18,9 +18,14 @@ const (
 	deadTime          = 10 * time.Second // 2 x heartbeat
 	defaultReapPeriod = 5 * time.Minute
 	reapJitterSecs    = 30
-	requeueKeysPerJob = 4
+	defaultReapJitter = -1 // extend the reap period by up to reapJitterSecs
+	requeueKeysPerJob = 5
+	ttlSweepBatchSize = 1000
 )
 
+// ErrReaperBusy is returned by ReapNow when another process is running a reap cycle of the namespace.
+var ErrReaperBusy = errors.New("reaper busy")
+
 // ReapResult is a set of data that reaper works with.
 type ReapResult struct {
 	// Err is any errors during the reaper cycle.
@@ -34,27 +39,71 @@ type ReapResult struct {
 	// DanglingLockJobs is a set of job names that have been adjusted due to
 	// inconsistency in their "lock" and "lock_info" keys.
 	DanglingLockJobs []string
+	// TrimmedDeadJobs is the number of dead jobs removed by the retention policy.
+	TrimmedDeadJobs int64
+	// ExpiredJobs is the number of jobs past their TTL removed from the job queues, see WithJobTTLSweep.
+	ExpiredJobs int64
+	// FixedLocks are the concurrency locks fixed by the reaper: the dangling ones and the ones which went
+	// negative after releasing the locks of a dead pool.
+	FixedLocks []LockFix
+}
+
+// LockFix is a fix of the concurrency lock of a job type by the reaper. Delta is the change of the lock: negative
+// if it counted more jobs than the pools hold, positive if it went negative and was reset to zero.
+type LockFix struct {
+	JobName string
+	Delta   int64
+}
+
+// lockFixReply is a lock fixed by redisLuaReapStaleLocks or redisRemoveDanglingLocksScript.
+type lockFixReply struct {
+	Lock  string
+	Delta int64
 }
 
 // ReaperHook can be used to monitor the reaper's actions.
 type ReaperHook func() (afterHook func(ReapResult))
 
+// ReenqueuedJobHook is called by the reaper for each job it moves from the in-progress queue
+// of a dead worker pool back to the job queue.
+type ReenqueuedJobHook func(poolID, jobName string, job *Job)
+
 type deadPoolReaper struct {
-	namespace   string
+	keys        keyspace
 	pool        Pool
 	deadTime    time.Duration
 	reapPeriod  time.Duration
 	curJobTypes []string
 
+	// jitter is the max random offset of the reap period as a fraction of it.
+	// If it's negative, the period is extended by up to reapJitterSecs instead.
+	jitter float64
+
 	stopChan         chan struct{}
 	doneStoppingChan chan struct{}
 
-	hook   ReaperHook
-	logger StructuredLogger
+	// deadJobMaxAge and deadJobMaxCount limit the dead jobs kept in the dead queue. Zero means no limit.
+	deadJobMaxAge   time.Duration
+	deadJobMaxCount int64
+
+	// sweepTTL makes the reaper remove the jobs past their TTL from the job queues, see WithJobTTLSweep.
+	// priorityQueues are the queues of EnqueueWithPriority swept with the ones of curJobTypes.
+	sweepTTL       bool
+	priorityQueues []string
+
+	hook           ReaperHook
+	reenqueuedHook ReenqueuedJobHook
+	codec          ArgsCodec      // used to decode the jobs passed to reenqueuedHook
+	failover       *failoverState // shared with the other loops of the pool
+	clock          Clock
+	metrics        MetricsReporter
+	logger         StructuredLogger
+
+	fixedLocks []LockFix // the locks fixed by the current reap, see ReapResult.FixedLocks
 }
 
 func newDeadPoolReaper(
-	namespace string,
+	keys keyspace,
 	pool Pool,
 	curJobTypes []string,
 	reapPeriod time.Duration,
@@ -66,14 +115,17 @@ func newDeadPoolReaper(
 	}
 
 	return &deadPoolReaper{
-		namespace:        namespace,
+		keys:             keys,
 		pool:             pool,
 		deadTime:         deadTime,
 		reapPeriod:       reapPeriod,
 		curJobTypes:      curJobTypes,
+		jitter:           defaultReapJitter,
 		stopChan:         make(chan struct{}),
 		doneStoppingChan: make(chan struct{}),
 		hook:             hook,
+		clock:            defaultClock,
+		metrics:          noopMetrics,
 		logger:           logger,
 	}
 }
@@ -91,7 +143,7 @@ func (r *deadPoolReaper) loop() {
 	r.logger.Info("Reaper started", slog.Duration("period", r.reapPeriod))
 
 	// Reap immediately after we provide some time for initialization
-	timer := time.NewTimer(r.deadTime)
+	timer := time.NewTimer(r.firstReapIn())
 	defer timer.Stop()
 
 	for {
@@ -100,42 +152,84 @@ func (r *deadPoolReaper) loop() {
 			r.doneStoppingChan <- struct{}{}
 			return
 		case <-timer.C:
+			// Reap once the pool is done backing off from a failover rather than waiting for the next period
+			if backoff := r.failover.backoff(); backoff > 0 {
+				timer.Reset(backoff)
+				continue
+			}
+
 			// Schedule next occurrence periodically with jitter
-			timer.Reset(r.reapPeriod + time.Duration(rand.Intn(reapJitterSecs))*time.Second)
+			timer.Reset(r.nextReapIn())
 
 			if err := r.reap(); err != nil {
+				r.failover.failed(err)
 				r.logger.Error("dead_pool_reaper.reap", errAttr(err))
 			}
 		}
 	}
 }
 
-func (r *deadPoolReaper) reap() (err error) {
+// firstReapIn returns the delay before the first reap. With a jitter fraction, the delay is
+// randomly extended so that pools started at the same time don't reap in lockstep.
+func (r *deadPoolReaper) firstReapIn() time.Duration {
+	if r.jitter <= 0 {
+		return r.deadTime
+	}
+
+	return r.deadTime + time.Duration(rand.Float64()*r.jitter*float64(r.reapPeriod))
+}
+
+// nextReapIn returns the delay before the next reap.
+func (r *deadPoolReaper) nextReapIn() time.Duration {
+	switch {
+	case r.jitter < 0:
+		return r.reapPeriod + time.Duration(rand.Intn(reapJitterSecs))*time.Second
+	case r.jitter == 0:
+		return r.reapPeriod
+	default:
+		return r.reapPeriod + time.Duration((2*rand.Float64()-1)*r.jitter*float64(r.reapPeriod))
+	}
+}
+
+// reap runs a reap cycle, unless another process is already running one.
+func (r *deadPoolReaper) reap() error {
+	_, err := r.reapNow()
+	if errors.Is(err, ErrReaperBusy) {
+		return nil
+	}
+
+	return err
+}
+
+// reapNow runs a reap cycle and returns its result, or ErrReaperBusy if another process is running one.
+func (r *deadPoolReaper) reapNow() (reapResult ReapResult, err error) {
 	lockValue, err := genValue()
 	if err != nil {
-		return err
+		return reapResult, err
 	}
 
 	r.logger.Info("Reaper: trying to acquire lock...")
 
 	acquired, err := r.acquireLock(lockValue)
 	if err != nil {
-		return fmt.Errorf("acquiring lock: %w", err)
+		return reapResult, fmt.Errorf("acquiring lock: %w", err)
 	}
 
 	// Another reaper is already running
 	if !acquired {
 		r.logger.Info("Reaper: locked by another process")
-		return nil
+		return reapResult, ErrReaperBusy
 	}
 
 	r.logger.Info("Reaper: lock is acquired")
 
 	defer func() {
-		err = r.releaseLock(lockValue)
+		if lErr := r.releaseLock(lockValue); lErr != nil {
+			err = errors.Join(err, lErr)
+		}
 	}()
 
-	reapResult := ReapResult{}
+	r.fixedLocks = nil
 	if r.hook != nil {
 		finish := r.hook()
 
@@ -168,9 +262,91 @@ func (r *deadPoolReaper) reap() (err error) {
 		reapResult.DanglingLockJobs = jobs
 	}
 
-	reapResult.Err = errors.Join(err, rErr, cErr, dErr)
+	trimmed, tErr := r.trimDeadJobs()
+	if trimmed != 0 {
+		r.logger.Info("Reaper: trimmed dead jobs", slog.Int64("count", trimmed))
+
+		reapResult.TrimmedDeadJobs = trimmed
+	}
+
+	expired, eErr := r.sweepExpiredJobs()
+	if expired != 0 {
+		r.logger.Info("Reaper: removed expired jobs", slog.Int64("count", expired))
+
+		reapResult.ExpiredJobs = expired
+	}
+
+	reapResult.FixedLocks = r.fixedLocks
+	reapResult.Err = errors.Join(rErr, cErr, dErr, tErr, eErr)
+
+	return reapResult, reapResult.Err
+}
+
+// trimDeadJobs removes the dead jobs which died more than deadJobMaxAge ago and the oldest ones
+// beyond deadJobMaxCount. It returns the number of removed jobs.
+func (r *deadPoolReaper) trimDeadJobs() (int64, error) {
+	if r.deadJobMaxAge <= 0 && r.deadJobMaxCount <= 0 {
+		return 0, nil
+	}
+
+	conn := r.pool.Get()
+	defer conn.Close()
+
+	var trimmed int64
+	key := redisKeyDead(r.keys)
+
+	if r.deadJobMaxAge > 0 {
+		diedBefore := r.clock.Now().Unix() - int64(r.deadJobMaxAge/time.Second)
+		n, err := redis.Int64(conn.Do("ZREMRANGEBYSCORE", key, "-inf", fmt.Sprintf("(%d", diedBefore)))
+		if err != nil {
+			return trimmed, fmt.Errorf("trimming dead jobs by age: %w", err)
+		}
+		trimmed += n
+	}
+
+	if r.deadJobMaxCount > 0 {
+		n, err := redis.Int64(conn.Do("ZREMRANGEBYRANK", key, 0, -r.deadJobMaxCount-1))
+		if err != nil {
+			return trimmed, fmt.Errorf("trimming dead jobs by count: %w", err)
+		}
+		trimmed += n
+	}
 
-	return reapResult.Err
+	return trimmed, nil
+}
+
+// sweepExpiredJobs removes the jobs past their TTL from the queues of the job types, including their priority
+// queues, in batches of ttlSweepBatchSize jobs so that Redis isn't blocked. It returns the number of removed jobs.
+func (r *deadPoolReaper) sweepExpiredJobs() (int64, error) {
+	if !r.sweepTTL {
+		return 0, nil
+	}
+
+	conn := r.pool.Get()
+	defer conn.Close()
+
+	script := redis.NewScript(1, redisLuaSweepExpiredJobs)
+	now := r.clock.Now().Unix()
+
+	queues := make([]string, 0, len(r.curJobTypes)+len(r.priorityQueues))
+	for _, jobName := range r.curJobTypes {
+		queues = append(queues, redisKeyJobs(r.keys, jobName))
+	}
+	queues = append(queues, r.priorityQueues...)
+
+	var removed int64
+	for _, queue := range queues {
+		for next := int64(0); next >= 0; {
+			values, err := redis.Int64s(script.Do(conn, queue, now, next, ttlSweepBatchSize))
+			if err != nil {
+				return removed, fmt.Errorf("sweeping expired jobs of %s: %w", queue, err)
+			}
+			next = values[0]
+			removed += values[1]
+		}
+	}
+
+	return removed, nil
 }
 
 // reapDeadPools collects the IDs of expired heartbeat pools and releases the
@@ -193,7 +369,7 @@ func (r *deadPoolReaper) reapDeadPools() (poolsJobs, error) {
 				return deadPools, err
 			}
 
-			if _, err = conn.Do("DEL", redisKeyHeartbeat(r.namespace, deadPoolID)); err != nil {
+			if _, err = conn.Do("DEL", redisKeyHeartbeat(r.keys, deadPoolID)); err != nil {
 				return deadPools, err
 			}
 		} else {
@@ -208,7 +384,7 @@ func (r *deadPoolReaper) reapDeadPools() (poolsJobs, error) {
 		}
 
 		// Remove dead pool from worker pools set
-		if _, err = conn.Do("SREM", redisKeyWorkerPools(r.namespace), deadPoolID); err != nil {
+		if _, err = conn.Do("SREM", redisKeyWorkerPools(r.keys), deadPoolID); err != nil {
 			return deadPools, err
 		}
 	}
@@ -243,37 +419,55 @@ func (r *deadPoolReaper) cleanStaleLockInfo(poolID string, jobTypes []string) er
 	var scriptArgs = make([]interface{}, 0, numKeys+1) // +1 for argv[1]
 
 	for _, jobType := range jobTypes {
-		scriptArgs = append(scriptArgs, redisKeyJobsLock(r.namespace, jobType), redisKeyJobsLockInfo(r.namespace, jobType))
+		scriptArgs = append(scriptArgs, redisKeyJobsLock(r.keys, jobType), redisKeyJobsLockInfo(r.keys, jobType))
 	}
 	scriptArgs = append(scriptArgs, poolID) // ARGV[1]
 
 	conn := r.pool.Get()
 	defer conn.Close()
-	if _, err := redisReapLocksScript.Do(conn, scriptArgs...); err != nil {
-		return err
-	}
 
-	negativeLocks, err := redis.Strings(redisReapLocksScript.Do(conn, scriptArgs...))
+	values, err := redis.Values(redisReapLocksScript.Do(conn, scriptArgs...))
 	if err != nil {
 		return err
 	}
-	if len(negativeLocks) > 0 {
-		r.logger.Info("Reaper: negative locks", slog.Any("keys", negativeLocks))
+
+	var negativeLocks []lockFixReply
+	if err := redis.ScanSlice(values, &negativeLocks); err != nil {
+		return err
 	}
+	r.lockFixed(negativeLocks)
 
 	return nil
 }
 
+// lockFixed reports the locks fixed by the scripts, see ReapResult.FixedLocks and LockFixReporter.
+func (r *deadPoolReaper) lockFixed(locks []lockFixReply) {
+	reporter, _ := r.metrics.(LockFixReporter)
+	for _, l := range locks {
+		jobName := redisJobNameFromLockKey(r.keys, l.Lock)
+		r.logger.Warn("Reaper: lock fixed", slog.String("job_name", jobName), slog.Int64("delta", l.Delta))
+
+		r.fixedLocks = append(r.fixedLocks, LockFix{JobName: jobName, Delta: l.Delta})
+		if reporter != nil {
+			reporter.LockFixed(jobName, l.Delta)
+		}
+	}
+}
+
 func (r *deadPoolReaper) requeueInProgressJobs(poolID string, jobTypes []string) error {
-	numKeys := len(jobTypes) * requeueKeysPerJob
+	numKeys := len(jobTypes)*requeueKeysPerJob + 1
 	redisRequeueScript := redis.NewScript(numKeys, redisLuaReenqueueJob)
-	var scriptArgs = make([]interface{}, 0, numKeys+1)
+	var scriptArgs = make([]interface{}, 0, numKeys+3)
 
 	for _, jobType := range jobTypes {
 		// pops from in progress, push into job queue and decrement the queue lock
-		scriptArgs = append(scriptArgs, redisKeyJobsInProgress(r.namespace, poolID, jobType), redisKeyJobs(r.namespace, jobType), redisKeyJobsLock(r.namespace, jobType), redisKeyJobsLockInfo(r.namespace, jobType)) // KEYS[1-4 * N]
+		scriptArgs = append(scriptArgs, redisKeyJobsInProgress(r.keys, poolID, jobType), redisKeyJobs(r.keys, jobType), redisKeyJobsLock(r.keys, jobType), redisKeyJobsLockInfo(r.keys, jobType), redisKeyJobsAtMostOnce(r.keys, jobType)) // KEYS[1-5 * N]
 	}
-	scriptArgs = append(scriptArgs, poolID) // ARGV[1]
+	strictFIFOSuffix := r.keys.sep + "strict_fifo"
+	scriptArgs = append(scriptArgs, redisKeyDead(r.keys)) // KEYS[5 * N + 1]
+	scriptArgs = append(scriptArgs, poolID)               // ARGV[1]
+	scriptArgs = append(scriptArgs, r.clock.Now().Unix()) // ARGV[2]
+	scriptArgs = append(scriptArgs, strictFIFOSuffix)     // ARGV[3]
 
 	conn := r.pool.Get()
 	defer conn.Close()
@@ -290,15 +484,45 @@ func (r *deadPoolReaper) requeueInProgressJobs(poolID string, jobTypes []string)
 		if len(values) != 3 {
 			return fmt.Errorf("need 3 elements back")
 		}
+
+		if queue, _ := redis.String(values[2], nil); queue == redisKeyDead(r.keys) {
+			inProgQueue, _ := redis.String(values[1], nil)
+			r.logger.Warn("Reaper: at most once job moved to dead queue", slog.String("in_progress_queue", inProgQueue))
+		} else if r.reenqueuedHook != nil {
+			r.reportReenqueuedJob(poolID, values)
+		}
 	}
 }
 
+// reportReenqueuedJob calls reenqueuedHook with the job returned by redisLuaReenqueueJob.
+func (r *deadPoolReaper) reportReenqueuedJob(poolID string, values []interface{}) {
+	rawJSON, err := redis.Bytes(values[0], nil)
+	if err != nil {
+		r.logger.Error("Reaper: reenqueued job", errAttr(err))
+		return
+	}
+
+	jobQueue, err := redis.String(values[2], nil)
+	if err != nil {
+		r.logger.Error("Reaper: reenqueued job queue", errAttr(err))
+		return
+	}
+
+	job, err := newJob(rawJSON, nil, nil, r.codec)
+	if err != nil {
+		r.logger.Error("Reaper: reenqueued job", errAttr(err))
+		return
+	}
+
+	r.reenqueuedHook(poolID, redisJobNameFromKey(r.keys, jobQueue), job)
+}
+
 // findDeadPools returns staled pools IDs and associated jobs.
 func (r *deadPoolReaper) findDeadPools() (poolsJobs, error) {
 	conn := r.pool.Get()
 	defer conn.Close()
 
-	workerPoolsKey := redisKeyWorkerPools(r.namespace)
+	workerPoolsKey := redisKeyWorkerPools(r.keys)
 	workerPoolIDs, err := redis.Strings(conn.Do("SMEMBERS", workerPoolsKey))
 	if err != nil {
 		return nil, err
@@ -306,7 +530,7 @@ func (r *deadPoolReaper) findDeadPools() (poolsJobs, error) {
 
 	deadPools := make(poolsJobs, len(workerPoolIDs))
 	for _, workerPoolID := range workerPoolIDs {
-		heartbeatKey := redisKeyHeartbeat(r.namespace, workerPoolID)
+		heartbeatKey := redisKeyHeartbeat(r.keys, workerPoolID)
 		heartbeatAt, err := redis.Int64(conn.Do("HGET", heartbeatKey, "heartbeat_at"))
 		if err == redis.ErrNil {
 			// heartbeat expired, save dead pool and use cur set of jobs from reaper
@@ -318,7 +542,7 @@ func (r *deadPoolReaper) findDeadPools() (poolsJobs, error) {
 		}
 
 		// Check that last heartbeat was long enough ago to consider the pool dead
-		if time.Unix(heartbeatAt, 0).Add(r.deadTime).After(time.Now()) {
+		if time.Unix(heartbeatAt, 0).Add(r.deadTime).After(r.clock.Now()) {
 			continue
 		}
 
@@ -341,10 +565,10 @@ func (r *deadPoolReaper) findDeadPools() (poolsJobs, error) {
 func (r *deadPoolReaper) getUnknownPools() (poolsJobs, error) {
 	scriptArgs := make([]interface{}, 0, len(r.curJobTypes)+2) // +2 for keys count and pools key
 	scriptArgs = append(scriptArgs, len(r.curJobTypes)+1)      // +1 for pools key
-	scriptArgs = append(scriptArgs, redisKeyWorkerPools(r.namespace))
+	scriptArgs = append(scriptArgs, redisKeyWorkerPools(r.keys))
 
 	for _, j := range r.curJobTypes {
-		scriptArgs = append(scriptArgs, redisKeyJobsLockInfo(r.namespace, j))
+		scriptArgs = append(scriptArgs, redisKeyJobsLockInfo(r.keys, j))
 	}
 
 	conn := r.pool.Get()
@@ -357,6 +581,11 @@ func (r *deadPoolReaper) getUnknownPools() (poolsJobs, error) {
 
 	var pools poolsJobs
 
+	// cjson may encode an empty table as an empty array
+	if string(data) == "[]" {
+		return pools, nil
+	}
+
 	if err := json.Unmarshal(data, &pools); err != nil {
 		return nil, err
 	}
@@ -366,7 +595,7 @@ func (r *deadPoolReaper) getUnknownPools() (poolsJobs, error) {
 		jobs := make([]string, 0, len(keys))
 
 		for _, k := range keys {
-			jobs = append(jobs, redisJobNameFromLockInfoKey(r.namespace, k))
+			jobs = append(jobs, redisJobNameFromLockInfoKey(r.keys, k))
 		}
 
 		pools[pool] = jobs
@@ -383,24 +612,31 @@ func (r *deadPoolReaper) removeDanglingLocks() ([]string, error) {
 	scriptArgs = append(scriptArgs, keysCount)
 
 	for _, j := range r.curJobTypes {
-		scriptArgs = append(scriptArgs, redisKeyJobsLock(r.namespace, j))
-		scriptArgs = append(scriptArgs, redisKeyJobsLockInfo(r.namespace, j))
+		scriptArgs = append(scriptArgs, redisKeyJobsLock(r.keys, j))
+		scriptArgs = append(scriptArgs, redisKeyJobsLockInfo(r.keys, j))
 	}
 
 	conn := r.pool.Get()
 	defer conn.Close()
 
-	keys, err := redis.Strings(redisRemoveDanglingLocksScript.Do(conn, scriptArgs...))
+	values, err := redis.Values(redisRemoveDanglingLocksScript.Do(conn, scriptArgs...))
 	if err != nil {
 		return nil, err
 	}
 
+	var locks []lockFixReply
+	if err := redis.ScanSlice(values, &locks); err != nil {
+		return nil, err
+	}
+	r.lockFixed(locks)
+
 	// convert lock keys to job types
-	for i, k := range keys {
-		keys[i] = redisJobNameFromLockKey(r.namespace, k)
+	jobs := make([]string, 0, len(locks))
+	for _, l := range locks {
+		jobs = append(jobs, redisJobNameFromLockKey(r.keys, l.Lock))
 	}
 
-	return keys, nil
+	return jobs, nil
 }
 
 // acquireLock acquires lock with a value and an expiration time for reap period.
@@ -409,7 +645,7 @@ func (r *deadPoolReaper) acquireLock(value string) (bool, error) {
 	defer conn.Close()
 
 	reply, err := conn.Do(
-		"SET", redisKeyReaperLock(r.namespace), value, "NX", "EX", int64(r.reapPeriod/time.Second))
+		"SET", redisKeyReaperLock(r.keys), value, "NX", "EX", int64(r.reapPeriod/time.Second))
 	if err != nil {
 		return false, err
 	}
@@ -422,7 +658,7 @@ func (r *deadPoolReaper) releaseLock(value string) error {
 	conn := r.pool.Get()
 	defer conn.Close()
 
-	_, err := redisReleaseLockScript.Do(conn, redisKeyReaperLock(r.namespace), value)
+	_, err := redisReleaseLockScript.Do(conn, redisKeyReaperLock(r.keys), value)
 
 	return err
 }
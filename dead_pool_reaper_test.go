@@ -1,6 +1,7 @@
 package work
 
 import (
+	"fmt"
 	"testing"
 	"time"
 
@@ -17,7 +18,7 @@ func TestDeadPoolReaper(t *testing.T) {
 	conn := pool.Get()
 	defer conn.Close()
 
-	workerPoolsKey := redisKeyWorkerPools(ns)
+	workerPoolsKey := redisKeyWorkerPools(newKeyspace(ns))
 
 	// Create redis data
 	var err error
@@ -28,19 +29,19 @@ func TestDeadPoolReaper(t *testing.T) {
 	err = conn.Send("SADD", workerPoolsKey, "3")
 	assert.NoError(t, err)
 
-	err = conn.Send("HMSET", redisKeyHeartbeat(ns, "1"),
+	err = conn.Send("HMSET", redisKeyHeartbeat(newKeyspace(ns), "1"),
 		"heartbeat_at", time.Now().Unix(),
 		"job_names", "type1,type2",
 	)
 	assert.NoError(t, err)
 
-	err = conn.Send("HMSET", redisKeyHeartbeat(ns, "2"),
+	err = conn.Send("HMSET", redisKeyHeartbeat(newKeyspace(ns), "2"),
 		"heartbeat_at", time.Now().Add(-1*time.Hour).Unix(),
 		"job_names", "type1,type2",
 	)
 	assert.NoError(t, err)
 
-	err = conn.Send("HMSET", redisKeyHeartbeat(ns, "3"),
+	err = conn.Send("HMSET", redisKeyHeartbeat(newKeyspace(ns), "3"),
 		"heartbeat_at", time.Now().Add(-1*time.Hour).Unix(),
 		"job_names", "type1,type2",
 	)
@@ -49,26 +50,26 @@ func TestDeadPoolReaper(t *testing.T) {
 	assert.NoError(t, err)
 
 	// Test getting dead pool
-	reaper := newDeadPoolReaper(ns, pool, []string{}, 0, nil, noopLogger)
+	reaper := newDeadPoolReaper(newKeyspace(ns), pool, []string{}, 0, nil, noopLogger)
 	deadPools, err := reaper.findDeadPools()
 	assert.NoError(t, err)
 	assert.Equal(t, poolsJobs{"2": {"type1", "type2"}, "3": {"type1", "type2"}}, deadPools)
 
 	// Test requeueing jobs
-	_, err = conn.Do("lpush", redisKeyJobsInProgress(ns, "2", "type1"), "foo")
+	_, err = conn.Do("lpush", redisKeyJobsInProgress(newKeyspace(ns), "2", "type1"), "foo")
 	assert.NoError(t, err)
-	_, err = conn.Do("incr", redisKeyJobsLock(ns, "type1"))
+	_, err = conn.Do("incr", redisKeyJobsLock(newKeyspace(ns), "type1"))
 	assert.NoError(t, err)
-	_, err = conn.Do("hincrby", redisKeyJobsLockInfo(ns, "type1"), "2", 1) // worker pool 2 has lock
+	_, err = conn.Do("hincrby", redisKeyJobsLockInfo(newKeyspace(ns), "type1"), "2", 1) // worker pool 2 has lock
 	assert.NoError(t, err)
 
 	// Ensure 0 jobs in jobs queue
-	jobsCount, err := redis.Int(conn.Do("llen", redisKeyJobs(ns, "type1")))
+	jobsCount, err := redis.Int(conn.Do("llen", redisKeyJobs(newKeyspace(ns), "type1")))
 	assert.NoError(t, err)
 	assert.Equal(t, 0, jobsCount)
 
 	// Ensure 1 job in inprogress queue
-	jobsCount, err = redis.Int(conn.Do("llen", redisKeyJobsInProgress(ns, "2", "type1")))
+	jobsCount, err = redis.Int(conn.Do("llen", redisKeyJobsInProgress(newKeyspace(ns), "2", "type1")))
 	assert.NoError(t, err)
 	assert.Equal(t, 1, jobsCount)
 
@@ -77,18 +78,18 @@ func TestDeadPoolReaper(t *testing.T) {
 	assert.NoError(t, err)
 
 	// Ensure 1 jobs in jobs queue
-	jobsCount, err = redis.Int(conn.Do("llen", redisKeyJobs(ns, "type1")))
+	jobsCount, err = redis.Int(conn.Do("llen", redisKeyJobs(newKeyspace(ns), "type1")))
 	assert.NoError(t, err)
 	assert.Equal(t, 1, jobsCount)
 
 	// Ensure 0 job in inprogress queue
-	jobsCount, err = redis.Int(conn.Do("llen", redisKeyJobsInProgress(ns, "2", "type1")))
+	jobsCount, err = redis.Int(conn.Do("llen", redisKeyJobsInProgress(newKeyspace(ns), "2", "type1")))
 	assert.NoError(t, err)
 	assert.Equal(t, 0, jobsCount)
 
 	// Locks should get cleaned up
-	assert.EqualValues(t, 0, getInt64(pool, redisKeyJobsLock(ns, "type1")))
-	v, _ := conn.Do("HGET", redisKeyJobsLockInfo(ns, "type1"), "2")
+	assert.EqualValues(t, 0, getInt64(pool, redisKeyJobsLock(newKeyspace(ns), "type1")))
+	v, _ := conn.Do("HGET", redisKeyJobsLockInfo(newKeyspace(ns), "type1"), "2")
 	assert.Nil(t, v)
 }
 
@@ -99,7 +100,7 @@ func TestDeadPoolReaperNoHeartbeat(t *testing.T) {
 	conn := pool.Get()
 	defer conn.Close()
 
-	workerPoolsKey := redisKeyWorkerPools(ns)
+	workerPoolsKey := redisKeyWorkerPools(newKeyspace(ns))
 
 	// Create redis data
 	var err error
@@ -111,13 +112,13 @@ func TestDeadPoolReaperNoHeartbeat(t *testing.T) {
 	err = conn.Send("SADD", workerPoolsKey, "3")
 	assert.NoError(t, err)
 	// stale lock info
-	err = conn.Send("SET", redisKeyJobsLock(ns, "type1"), 3)
+	err = conn.Send("SET", redisKeyJobsLock(newKeyspace(ns), "type1"), 3)
 	assert.NoError(t, err)
-	err = conn.Send("HSET", redisKeyJobsLockInfo(ns, "type1"), "1", 1)
+	err = conn.Send("HSET", redisKeyJobsLockInfo(newKeyspace(ns), "type1"), "1", 1)
 	assert.NoError(t, err)
-	err = conn.Send("HSET", redisKeyJobsLockInfo(ns, "type1"), "2", 1)
+	err = conn.Send("HSET", redisKeyJobsLockInfo(newKeyspace(ns), "type1"), "2", 1)
 	assert.NoError(t, err)
-	err = conn.Send("HSET", redisKeyJobsLockInfo(ns, "type1"), "3", 1)
+	err = conn.Send("HSET", redisKeyJobsLockInfo(newKeyspace(ns), "type1"), "3", 1)
 	assert.NoError(t, err)
 	err = conn.Flush()
 	assert.NoError(t, err)
@@ -128,27 +129,27 @@ func TestDeadPoolReaperNoHeartbeat(t *testing.T) {
 	assert.EqualValues(t, 3, numPools)
 
 	// Test getting dead pool ids
-	reaper := newDeadPoolReaper(ns, pool, []string{"type1"}, 0, nil, noopLogger)
+	reaper := newDeadPoolReaper(newKeyspace(ns), pool, []string{"type1"}, 0, nil, noopLogger)
 	deadPools, err := reaper.findDeadPools()
 	assert.NoError(t, err)
 	assert.Equal(t, poolsJobs{"1": nil, "2": nil, "3": nil}, deadPools)
 
 	// Test requeueing jobs
-	_, err = conn.Do("lpush", redisKeyJobsInProgress(ns, "2", "type1"), "foo")
+	_, err = conn.Do("lpush", redisKeyJobsInProgress(newKeyspace(ns), "2", "type1"), "foo")
 	assert.NoError(t, err)
 
 	// Ensure 0 jobs in jobs queue
-	jobsCount, err := redis.Int(conn.Do("llen", redisKeyJobs(ns, "type1")))
+	jobsCount, err := redis.Int(conn.Do("llen", redisKeyJobs(newKeyspace(ns), "type1")))
 	assert.NoError(t, err)
 	assert.Equal(t, 0, jobsCount)
 
 	// Ensure 1 job in inprogress queue
-	jobsCount, err = redis.Int(conn.Do("llen", redisKeyJobsInProgress(ns, "2", "type1")))
+	jobsCount, err = redis.Int(conn.Do("llen", redisKeyJobsInProgress(newKeyspace(ns), "2", "type1")))
 	assert.NoError(t, err)
 	assert.Equal(t, 1, jobsCount)
 
 	// Ensure dead worker pools still in the set
-	jobsCount, err = redis.Int(conn.Do("scard", redisKeyWorkerPools(ns)))
+	jobsCount, err = redis.Int(conn.Do("scard", redisKeyWorkerPools(newKeyspace(ns))))
 	assert.NoError(t, err)
 	assert.Equal(t, 3, jobsCount)
 
@@ -157,24 +158,24 @@ func TestDeadPoolReaperNoHeartbeat(t *testing.T) {
 	assert.NoError(t, err)
 
 	// Ensure jobs queue was not altered
-	jobsCount, err = redis.Int(conn.Do("llen", redisKeyJobs(ns, "type1")))
+	jobsCount, err = redis.Int(conn.Do("llen", redisKeyJobs(newKeyspace(ns), "type1")))
 	assert.NoError(t, err)
 	assert.Equal(t, 0, jobsCount)
 
 	// Ensure inprogress queue was not altered
-	jobsCount, err = redis.Int(conn.Do("llen", redisKeyJobsInProgress(ns, "2", "type1")))
+	jobsCount, err = redis.Int(conn.Do("llen", redisKeyJobsInProgress(newKeyspace(ns), "2", "type1")))
 	assert.NoError(t, err)
 	assert.Equal(t, 1, jobsCount)
 
 	// Ensure dead worker pools were removed from the set
-	jobsCount, err = redis.Int(conn.Do("scard", redisKeyWorkerPools(ns)))
+	jobsCount, err = redis.Int(conn.Do("scard", redisKeyWorkerPools(newKeyspace(ns))))
 	assert.NoError(t, err)
 	assert.Equal(t, 0, jobsCount)
 
 	// Stale lock info was cleaned up using reap.curJobTypes
-	assert.EqualValues(t, 0, getInt64(pool, redisKeyJobsLock(ns, "type1")))
+	assert.EqualValues(t, 0, getInt64(pool, redisKeyJobsLock(newKeyspace(ns), "type1")))
 	for _, poolID := range []string{"1", "2", "3"} {
-		v, _ := conn.Do("HGET", redisKeyJobsLockInfo(ns, "type1"), poolID)
+		v, _ := conn.Do("HGET", redisKeyJobsLockInfo(newKeyspace(ns), "type1"), poolID)
 		assert.Nil(t, v)
 	}
 }
@@ -187,7 +188,7 @@ func TestDeadPoolReaperNoJobTypes(t *testing.T) {
 	conn := pool.Get()
 	defer conn.Close()
 
-	workerPoolsKey := redisKeyWorkerPools(ns)
+	workerPoolsKey := redisKeyWorkerPools(newKeyspace(ns))
 
 	// Create redis data
 	var err error
@@ -196,12 +197,12 @@ func TestDeadPoolReaperNoJobTypes(t *testing.T) {
 	err = conn.Send("SADD", workerPoolsKey, "2")
 	assert.NoError(t, err)
 
-	err = conn.Send("HMSET", redisKeyHeartbeat(ns, "1"),
+	err = conn.Send("HMSET", redisKeyHeartbeat(newKeyspace(ns), "1"),
 		"heartbeat_at", time.Now().Add(-1*time.Hour).Unix(),
 	)
 	assert.NoError(t, err)
 
-	err = conn.Send("HMSET", redisKeyHeartbeat(ns, "2"),
+	err = conn.Send("HMSET", redisKeyHeartbeat(newKeyspace(ns), "2"),
 		"heartbeat_at", time.Now().Add(-1*time.Hour).Unix(),
 		"job_names", "type1,type2",
 	)
@@ -211,27 +212,27 @@ func TestDeadPoolReaperNoJobTypes(t *testing.T) {
 	assert.NoError(t, err)
 
 	// Test getting dead pool
-	reaper := newDeadPoolReaper(ns, pool, []string{}, 0, nil, noopLogger)
+	reaper := newDeadPoolReaper(newKeyspace(ns), pool, []string{}, 0, nil, noopLogger)
 	deadPools, err := reaper.findDeadPools()
 	assert.NoError(t, err)
 	assert.Equal(t, poolsJobs{"2": {"type1", "type2"}}, deadPools)
 
 	// Test requeueing jobs
-	_, err = conn.Do("lpush", redisKeyJobsInProgress(ns, "1", "type1"), "foo")
+	_, err = conn.Do("lpush", redisKeyJobsInProgress(newKeyspace(ns), "1", "type1"), "foo")
 	assert.NoError(t, err)
-	_, err = conn.Do("lpush", redisKeyJobsInProgress(ns, "2", "type1"), "foo")
+	_, err = conn.Do("lpush", redisKeyJobsInProgress(newKeyspace(ns), "2", "type1"), "foo")
 	assert.NoError(t, err)
 
 	// Ensure 0 jobs in jobs queue
-	jobsCount, err := redis.Int(conn.Do("llen", redisKeyJobs(ns, "type1")))
+	jobsCount, err := redis.Int(conn.Do("llen", redisKeyJobs(newKeyspace(ns), "type1")))
 	assert.NoError(t, err)
 	assert.Equal(t, 0, jobsCount)
 
 	// Ensure 1 job in inprogress queue for each job
-	jobsCount, err = redis.Int(conn.Do("llen", redisKeyJobsInProgress(ns, "1", "type1")))
+	jobsCount, err = redis.Int(conn.Do("llen", redisKeyJobsInProgress(newKeyspace(ns), "1", "type1")))
 	assert.NoError(t, err)
 	assert.Equal(t, 1, jobsCount)
-	jobsCount, err = redis.Int(conn.Do("llen", redisKeyJobsInProgress(ns, "2", "type1")))
+	jobsCount, err = redis.Int(conn.Do("llen", redisKeyJobsInProgress(newKeyspace(ns), "2", "type1")))
 	assert.NoError(t, err)
 	assert.Equal(t, 1, jobsCount)
 
@@ -240,17 +241,17 @@ func TestDeadPoolReaperNoJobTypes(t *testing.T) {
 	assert.NoError(t, err)
 
 	// Ensure 1 jobs in jobs queue
-	jobsCount, err = redis.Int(conn.Do("llen", redisKeyJobs(ns, "type1")))
+	jobsCount, err = redis.Int(conn.Do("llen", redisKeyJobs(newKeyspace(ns), "type1")))
 	assert.NoError(t, err)
 	assert.Equal(t, 1, jobsCount)
 
 	// Ensure 1 job in inprogress queue for 1
-	jobsCount, err = redis.Int(conn.Do("llen", redisKeyJobsInProgress(ns, "1", "type1")))
+	jobsCount, err = redis.Int(conn.Do("llen", redisKeyJobsInProgress(newKeyspace(ns), "1", "type1")))
 	assert.NoError(t, err)
 	assert.Equal(t, 1, jobsCount)
 
 	// Ensure 0 jobs in inprogress queue for 2
-	jobsCount, err = redis.Int(conn.Do("llen", redisKeyJobsInProgress(ns, "2", "type1")))
+	jobsCount, err = redis.Int(conn.Do("llen", redisKeyJobsInProgress(newKeyspace(ns), "2", "type1")))
 	assert.NoError(t, err)
 	assert.Equal(t, 0, jobsCount)
 }
@@ -267,24 +268,24 @@ func TestDeadPoolReaperWithWorkerPools(t *testing.T) {
 	// create a stale job with a heartbeat
 	conn := pool.Get()
 	defer conn.Close()
-	_, err := conn.Do("SADD", redisKeyWorkerPools(ns), stalePoolID)
+	_, err := conn.Do("SADD", redisKeyWorkerPools(newKeyspace(ns)), stalePoolID)
 	assert.NoError(t, err)
-	_, err = conn.Do("LPUSH", redisKeyJobsInProgress(ns, stalePoolID, job1), `{"sleep": 10}`)
+	_, err = conn.Do("LPUSH", redisKeyJobsInProgress(newKeyspace(ns), stalePoolID, job1), `{"sleep": 10}`)
 	assert.NoError(t, err)
 	jobTypes := map[string]*jobType{"job1": nil}
-	staleHeart := newWorkerPoolHeartbeater(ns, pool, stalePoolID, jobTypes, 1, []string{"id1"}, noopLogger)
+	staleHeart := newWorkerPoolHeartbeater(newKeyspace(ns), pool, stalePoolID, jobTypes, 1, []string{"id1"}, noopLogger)
 	staleHeart.start()
 
 	// heartbeat dispatched immediately but reaper waits for deadTime before first run
 	time.Sleep(expectedDeadTime)
 
 	// should have 1 stale job and empty job queue
-	assert.EqualValues(t, 1, listSize(pool, redisKeyJobsInProgress(ns, stalePoolID, job1)))
-	assert.EqualValues(t, 0, listSize(pool, redisKeyJobs(ns, job1)))
+	assert.EqualValues(t, 1, listSize(pool, redisKeyJobsInProgress(newKeyspace(ns), stalePoolID, job1)))
+	assert.EqualValues(t, 0, listSize(pool, redisKeyJobs(newKeyspace(ns), job1)))
 
 	// setup a worker pool and start the reaper, which should restart the stale job above
 	wp := setupTestWorkerPool(pool, ns, job1, 1, JobOptions{Priority: 1})
-	wp.deadPoolReaper = newDeadPoolReaper(wp.namespace, wp.pool, []string{"job1"}, 0, nil, noopLogger)
+	wp.deadPoolReaper = newDeadPoolReaper(wp.keys, wp.pool, []string{"job1"}, 0, nil, noopLogger)
 	wp.deadPoolReaper.deadTime = expectedDeadTime
 	wp.deadPoolReaper.start()
 
@@ -292,8 +293,8 @@ func TestDeadPoolReaperWithWorkerPools(t *testing.T) {
 	time.Sleep(expectedDeadTime * 2)
 
 	// now we should have 1 job in queue and no more stale jobs
-	assert.EqualValues(t, 1, listSize(pool, redisKeyJobs(ns, job1)))
-	assert.EqualValues(t, 0, listSize(pool, redisKeyJobsInProgress(ns, wp.workerPoolID, job1)))
+	assert.EqualValues(t, 1, listSize(pool, redisKeyJobs(newKeyspace(ns), job1)))
+	assert.EqualValues(t, 0, listSize(pool, redisKeyJobsInProgress(newKeyspace(ns), wp.workerPoolID, job1)))
 	staleHeart.stop()
 	wp.deadPoolReaper.stop()
 }
@@ -308,10 +309,10 @@ func TestDeadPoolReaperCleanStaleLocks(t *testing.T) {
 	job1, job2 := "type1", "type2"
 	jobNames := []string{job1, job2}
 	workerPoolID1, workerPoolID2 := "1", "2"
-	lock1 := redisKeyJobsLock(ns, job1)
-	lock2 := redisKeyJobsLock(ns, job2)
-	lockInfo1 := redisKeyJobsLockInfo(ns, job1)
-	lockInfo2 := redisKeyJobsLockInfo(ns, job2)
+	lock1 := redisKeyJobsLock(newKeyspace(ns), job1)
+	lock2 := redisKeyJobsLock(newKeyspace(ns), job2)
+	lockInfo1 := redisKeyJobsLockInfo(newKeyspace(ns), job1)
+	lockInfo2 := redisKeyJobsLockInfo(newKeyspace(ns), job2)
 
 	// Create redis data
 	var err error
@@ -328,7 +329,7 @@ func TestDeadPoolReaperCleanStaleLocks(t *testing.T) {
 	err = conn.Flush()
 	assert.NoError(t, err)
 
-	reaper := newDeadPoolReaper(ns, pool, jobNames, 0, nil, noopLogger)
+	reaper := newDeadPoolReaper(newKeyspace(ns), pool, jobNames, 0, nil, noopLogger)
 	// clean lock info for workerPoolID1
 	err = reaper.cleanStaleLockInfo(workerPoolID1, jobNames)
 	assert.NoError(t, err)
@@ -350,6 +351,8 @@ func TestDeadPoolReaperCleanStaleLocks(t *testing.T) {
 	v, err = conn.Do("HGET", lockInfo2, workerPoolID2)
 	assert.NoError(t, err)
 	assert.Nil(t, v)
+	// the lock of job2 went negative and was reset
+	assert.Equal(t, []LockFix{{JobName: job2, Delta: 1}}, reaper.fixedLocks)
 }
 
 func TestDeadPoolReaperTakeDeadPools(t *testing.T) {
@@ -360,7 +363,7 @@ func TestDeadPoolReaperTakeDeadPools(t *testing.T) {
 	conn := pool.Get()
 	defer conn.Close()
 
-	workerPoolsKey := redisKeyWorkerPools(ns)
+	workerPoolsKey := redisKeyWorkerPools(newKeyspace(ns))
 
 	// Create redis data
 	var err error
@@ -371,13 +374,13 @@ func TestDeadPoolReaperTakeDeadPools(t *testing.T) {
 	err = conn.Send("SADD", workerPoolsKey, "3")
 	assert.NoError(t, err)
 
-	err = conn.Send("HMSET", redisKeyHeartbeat(ns, "1"),
+	err = conn.Send("HMSET", redisKeyHeartbeat(newKeyspace(ns), "1"),
 		"heartbeat_at", time.Now().Unix(),
 		"job_names", "type1,type2",
 	)
 	assert.NoError(t, err)
 
-	err = conn.Send("HMSET", redisKeyHeartbeat(ns, "2"),
+	err = conn.Send("HMSET", redisKeyHeartbeat(newKeyspace(ns), "2"),
 		"heartbeat_at", time.Now().Add(-1*time.Hour).Unix(),
 		"job_names", "type1,type2",
 	)
@@ -387,7 +390,7 @@ func TestDeadPoolReaperTakeDeadPools(t *testing.T) {
 	assert.NoError(t, err)
 
 	// Test getting dead pools
-	reaper := newDeadPoolReaper(ns, pool, []string{}, 0, nil, noopLogger)
+	reaper := newDeadPoolReaper(newKeyspace(ns), pool, []string{}, 0, nil, noopLogger)
 	deadPools, err := reaper.findDeadPools()
 	assert.NoError(t, err)
 	assert.Equal(t, poolsJobs{"2": {"type1", "type2"}, "3": nil}, deadPools)
@@ -398,7 +401,7 @@ func TestReaperLock(t *testing.T) {
 	ns := "work"
 	cleanKeyspace(ns, pool)
 
-	reaper := newDeadPoolReaper(ns, pool, []string{}, 0, nil, noopLogger)
+	reaper := newDeadPoolReaper(newKeyspace(ns), pool, []string{}, 0, nil, noopLogger)
 
 	value, err := genValue()
 	assert.NoError(t, err)
@@ -415,11 +418,11 @@ func TestReaperLock(t *testing.T) {
 	defer conn.Close()
 
 	checkLock := func() {
-		ttl, err := redis.Int(conn.Do("TTL", redisKeyReaperLock(ns)))
+		ttl, err := redis.Int(conn.Do("TTL", redisKeyReaperLock(newKeyspace(ns))))
 		assert.NoError(t, err)
 		assert.Greater(t, ttl, 0)
 
-		lvalue, err := redis.String(conn.Do("GET", redisKeyReaperLock(ns)))
+		lvalue, err := redis.String(conn.Do("GET", redisKeyReaperLock(newKeyspace(ns))))
 		assert.NoError(t, err)
 		assert.Equal(t, value, lvalue)
 	}
@@ -434,7 +437,7 @@ func TestReaperLock(t *testing.T) {
 	err = reaper.releaseLock(value)
 	assert.NoError(t, err)
 
-	_, err = redis.String(conn.Do("GET", redisKeyReaperLock(ns)))
+	_, err = redis.String(conn.Do("GET", redisKeyReaperLock(newKeyspace(ns))))
 	assert.Error(t, err)
 }
 
@@ -443,12 +446,12 @@ func TestDeadPoolReaperGetUnknownPools(t *testing.T) {
 	ns := "work"
 	cleanKeyspace(ns, pool)
 
-	workerPoolsKey := redisKeyWorkerPools(ns)
+	workerPoolsKey := redisKeyWorkerPools(newKeyspace(ns))
 	workerPoolID1, workerPoolID2, workerPoolID3 := "1", "2", "3"
 
 	job1, job2 := "type1", "type2"
 	jobNames := []string{job1, job2}
-	lockInfo1, lockInfo2 := redisKeyJobsLockInfo(ns, job1), redisKeyJobsLockInfo(ns, job2)
+	lockInfo1, lockInfo2 := redisKeyJobsLockInfo(newKeyspace(ns), job1), redisKeyJobsLockInfo(newKeyspace(ns), job2)
 
 	conn := pool.Get()
 	defer conn.Close()
@@ -475,7 +478,7 @@ func TestDeadPoolReaperGetUnknownPools(t *testing.T) {
 	assert.NoError(t, conn.Flush())
 
 	// Run test
-	reaper := newDeadPoolReaper(ns, pool, jobNames, 0, nil, noopLogger)
+	reaper := newDeadPoolReaper(newKeyspace(ns), pool, jobNames, 0, nil, noopLogger)
 	unknownPools, err := reaper.getUnknownPools()
 	assert.NoError(t, err)
 	assert.Equal(t, poolsJobs{"2": {"type1", "type2"}, "3": {"type1", "type2"}}, unknownPools)
@@ -486,13 +489,13 @@ func TestDeadPoolReaperClearUnknownPool(t *testing.T) {
 	ns := "work"
 	cleanKeyspace(ns, pool)
 
-	workerPoolsKey := redisKeyWorkerPools(ns)
+	workerPoolsKey := redisKeyWorkerPools(newKeyspace(ns))
 	workerPoolID1, workerPoolID2, workerPoolID3 := "1", "2", "3"
 
 	job1, job2 := "type1", "type2"
 	jobNames := []string{job1, job2}
-	lock1, lock2 := redisKeyJobsLock(ns, job1), redisKeyJobsLock(ns, job2)
-	lockInfo1, lockInfo2 := redisKeyJobsLockInfo(ns, job1), redisKeyJobsLockInfo(ns, job2)
+	lock1, lock2 := redisKeyJobsLock(newKeyspace(ns), job1), redisKeyJobsLock(newKeyspace(ns), job2)
+	lockInfo1, lockInfo2 := redisKeyJobsLockInfo(newKeyspace(ns), job1), redisKeyJobsLockInfo(newKeyspace(ns), job2)
 
 	conn := pool.Get()
 	defer conn.Close()
@@ -512,10 +515,10 @@ func TestDeadPoolReaperClearUnknownPool(t *testing.T) {
 	)
 	assert.NoError(t, err)
 
-	err = conn.Send("LPUSH", redisKeyJobsInProgress(ns, workerPoolID1, job1), "foo")
+	err = conn.Send("LPUSH", redisKeyJobsInProgress(newKeyspace(ns), workerPoolID1, job1), "foo")
 	assert.NoError(t, err)
 
-	err = conn.Send("LPUSH", redisKeyJobsInProgress(ns, workerPoolID3, job1), "bar")
+	err = conn.Send("LPUSH", redisKeyJobsInProgress(newKeyspace(ns), workerPoolID3, job1), "bar")
 	assert.NoError(t, err)
 
 	err = conn.Send("SET", lock2, 2)
@@ -528,13 +531,13 @@ func TestDeadPoolReaperClearUnknownPool(t *testing.T) {
 	)
 	assert.NoError(t, err)
 
-	err = conn.Send("LPUSH", redisKeyJobsInProgress(ns, workerPoolID2, job2), "bar", "baz")
+	err = conn.Send("LPUSH", redisKeyJobsInProgress(newKeyspace(ns), workerPoolID2, job2), "bar", "baz")
 	assert.NoError(t, err)
 
 	assert.NoError(t, conn.Flush())
 
 	// Run test
-	reaper := newDeadPoolReaper(ns, pool, jobNames, 0, nil, noopLogger)
+	reaper := newDeadPoolReaper(newKeyspace(ns), pool, jobNames, 0, nil, noopLogger)
 	_, err = reaper.clearUnknownPools()
 	assert.NoError(t, err)
 
@@ -564,8 +567,8 @@ func TestDeadPoolReaperRemoveDanglingLocks(t *testing.T) {
 
 	job1, job2, job3, job4 := "type1", "type2", "type3", "type4"
 	jobNames := []string{job1, job2, job3, job4}
-	lock1, lock2, lock3 := redisKeyJobsLock(ns, job1), redisKeyJobsLock(ns, job2), redisKeyJobsLock(ns, job3)
-	lockInfo1, lockInfo2 := redisKeyJobsLockInfo(ns, job1), redisKeyJobsLockInfo(ns, job2)
+	lock1, lock2, lock3 := redisKeyJobsLock(newKeyspace(ns), job1), redisKeyJobsLock(newKeyspace(ns), job2), redisKeyJobsLock(newKeyspace(ns), job3)
+	lockInfo1, lockInfo2 := redisKeyJobsLockInfo(newKeyspace(ns), job1), redisKeyJobsLockInfo(newKeyspace(ns), job2)
 
 	conn := pool.Get()
 	defer conn.Close()
@@ -596,9 +599,13 @@ func TestDeadPoolReaperRemoveDanglingLocks(t *testing.T) {
 
 	assert.NoError(t, conn.Flush())
 
-	reaper := newDeadPoolReaper(ns, pool, jobNames, 0, nil, noopLogger)
-	_, err = reaper.removeDanglingLocks()
+	m := newTestMetricsReporter()
+	reaper := newDeadPoolReaper(newKeyspace(ns), pool, jobNames, 0, nil, noopLogger)
+	reaper.metrics = m
+	jobs, err := reaper.removeDanglingLocks()
 	assert.NoError(t, err)
+	assert.Equal(t, []string{job1, job3}, jobs)
+	assert.Equal(t, map[string]int64{job1: -1, job3: -1}, m.locks)
 
 	// Checks
 	nLock1, err := redis.Int(conn.Do("GET", lock1))
@@ -622,20 +629,20 @@ func TestDeadPoolReaperHook(t *testing.T) {
 	workerPoolID1, workerPoolID2 := "1", "2"
 	job1, job2 := "type1", "type2"
 	jobNames := []string{job1, job2}
-	lock2 := redisKeyJobsLock(ns, job2)
-	lockInfo2 := redisKeyJobsLockInfo(ns, job2)
+	lock2 := redisKeyJobsLock(newKeyspace(ns), job2)
+	lockInfo2 := redisKeyJobsLockInfo(newKeyspace(ns), job2)
 
 	conn := pool.Get()
 	defer conn.Close()
 
-	workerPoolsKey := redisKeyWorkerPools(ns)
+	workerPoolsKey := redisKeyWorkerPools(newKeyspace(ns))
 
 	// Stale heartbeat
 	var err error
 	err = conn.Send("SADD", workerPoolsKey, workerPoolID1)
 	assert.NoError(t, err)
 
-	err = conn.Send("HMSET", redisKeyHeartbeat(ns, "1"),
+	err = conn.Send("HMSET", redisKeyHeartbeat(newKeyspace(ns), "1"),
 		"heartbeat_at", time.Now().Add(-1*time.Hour).Unix(),
 		"job_names", job1,
 	)
@@ -656,13 +663,339 @@ func TestDeadPoolReaperHook(t *testing.T) {
 	unknownPoolJobs := []string{job2}
 	danglingLockJobs := []string{job2}
 
-	reaper := newDeadPoolReaper(ns, pool, jobNames, 0, func() func(ReapResult) {
+	reaper := newDeadPoolReaper(newKeyspace(ns), pool, jobNames, 0, func() func(ReapResult) {
 		return func(rr ReapResult) {
 			assert.NoError(t, rr.Err)
 			assert.Equal(t, noPoolHeartBeatJobs, rr.NoPoolHeartBeatJobs)
 			assert.Equal(t, unknownPoolJobs, rr.UnknownPoolJobs)
 			assert.Equal(t, danglingLockJobs, rr.DanglingLockJobs)
+			assert.Equal(t, []LockFix{{JobName: job2, Delta: -1}}, rr.FixedLocks)
 		}
 	}, noopLogger)
 	require.NoError(t, reaper.reap())
 }
+
+func TestDeadPoolReaperJitter(t *testing.T) {
+	pool := newTestPool(":6379")
+	reapPeriod := 10 * time.Minute
+
+	reaper := newDeadPoolReaper(newKeyspace("work"), pool, []string{}, reapPeriod, nil, noopLogger)
+	for i := 0; i < 100; i++ {
+		assert.Equal(t, deadTime, reaper.firstReapIn())
+
+		next := reaper.nextReapIn()
+		assert.True(t, next >= reapPeriod)
+		assert.True(t, next < reapPeriod+reapJitterSecs*time.Second)
+	}
+
+	reaper.jitter = 0
+	for i := 0; i < 100; i++ {
+		assert.Equal(t, deadTime, reaper.firstReapIn())
+		assert.Equal(t, reapPeriod, reaper.nextReapIn())
+	}
+
+	reaper.jitter = 0.2
+	for i := 0; i < 100; i++ {
+		first := reaper.firstReapIn()
+		assert.True(t, first >= deadTime)
+		assert.True(t, first <= deadTime+2*time.Minute)
+
+		next := reaper.nextReapIn()
+		assert.True(t, next >= 8*time.Minute)
+		assert.True(t, next <= 12*time.Minute)
+	}
+
+	wp := NewWorkerPool(TestContext{}, 1, "work", pool, WithReapJitter(2))
+	assert.EqualValues(t, 1, wp.reapJitter)
+	wp = NewWorkerPool(TestContext{}, 1, "work", pool, WithReapJitter(0.2))
+	assert.EqualValues(t, 0.2, wp.reapJitter)
+	wp = NewWorkerPool(TestContext{}, 1, "work", pool)
+	assert.EqualValues(t, defaultReapJitter, wp.reapJitter)
+}
+
+func TestDeadPoolReaperReenqueuedJobHook(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work"
+	cleanKeyspace(ns, pool)
+
+	conn := pool.Get()
+	defer conn.Close()
+
+	for i, jobType := range []string{"type1", "type2", "type2"} {
+		job := &Job{Name: jobType, ID: fmt.Sprintf("job%d", i), Args: Q{"i": i}}
+		rawJSON, err := job.serialize()
+		require.NoError(t, err)
+		_, err = conn.Do("LPUSH", redisKeyJobsInProgress(newKeyspace(ns), "2", jobType), rawJSON)
+		require.NoError(t, err)
+	}
+
+	type reenqueued struct {
+		poolID, jobName, jobID string
+	}
+	var got []reenqueued
+
+	reaper := newDeadPoolReaper(newKeyspace(ns), pool, []string{"type1", "type2"}, 0, nil, noopLogger)
+	reaper.reenqueuedHook = func(poolID, jobName string, job *Job) {
+		got = append(got, reenqueued{poolID, jobName, job.ID})
+	}
+	require.NoError(t, reaper.requeueInProgressJobs("2", []string{"type1", "type2"}))
+
+	assert.Equal(t, []reenqueued{
+		{"2", "type1", "job0"},
+		{"2", "type2", "job1"},
+		{"2", "type2", "job2"},
+	}, got)
+	assert.EqualValues(t, 2, listSize(pool, redisKeyJobs(newKeyspace(ns), "type2")))
+
+	wp := NewWorkerPool(TestContext{}, 1, ns, pool, WithReenqueuedJobHook(reaper.reenqueuedHook))
+	assert.NotNil(t, wp.reenqueuedHook)
+}
+
+func TestDeadPoolReaperAtMostOnce(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work"
+	cleanKeyspace(ns, pool)
+
+	wp := NewWorkerPool(TestContext{}, 1, ns, pool)
+	wp.JobWithOptions("charge", JobOptions{AtMostOnce: true}, func(job *Job) error { return nil })
+	wp.Job("notify", func(job *Job) error { return nil })
+	wp.writeConcurrencyControlsToRedis()
+
+	conn := pool.Get()
+	defer conn.Close()
+
+	for i, jobType := range []string{"charge", "notify"} {
+		job := &Job{Name: jobType, ID: fmt.Sprintf("job%d", i), Args: Q{"i": i}}
+		rawJSON, err := job.serialize()
+		require.NoError(t, err)
+		_, err = conn.Do("LPUSH", redisKeyJobsInProgress(newKeyspace(ns), "2", jobType), rawJSON)
+		require.NoError(t, err)
+	}
+
+	var reenqueued []string
+	reaper := newDeadPoolReaper(newKeyspace(ns), pool, []string{"charge", "notify"}, 0, nil, noopLogger)
+	reaper.reenqueuedHook = func(poolID, jobName string, job *Job) {
+		reenqueued = append(reenqueued, job.ID)
+	}
+	require.NoError(t, reaper.requeueInProgressJobs("2", []string{"charge", "notify"}))
+
+	assert.Equal(t, []string{"job1"}, reenqueued)
+	assert.EqualValues(t, 0, listSize(pool, redisKeyJobs(newKeyspace(ns), "charge")))
+	assert.EqualValues(t, 1, listSize(pool, redisKeyJobs(newKeyspace(ns), "notify")))
+
+	_, job := jobOnZset(pool, redisKeyDead(newKeyspace(ns)))
+	require.NotNil(t, job)
+	assert.Equal(t, "job0", job.ID)
+	assert.EqualValues(t, 0, job.ArgInt64("i"))
+	assert.EqualValues(t, 1, job.Fails)
+	assert.Contains(t, job.LastErr, "at most once")
+	assert.True(t, job.FailedAt > 0)
+
+	// The option is cleared when the job type is registered without it.
+	wp = NewWorkerPool(TestContext{}, 1, ns, pool)
+	wp.Job("charge", func(job *Job) error { return nil })
+	wp.writeConcurrencyControlsToRedis()
+	assert.False(t, keyExists(pool, redisKeyJobsAtMostOnce(newKeyspace(ns), "charge")))
+}
+
+func TestDeadPoolReaperLeasedConcurrency(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work"
+	cleanKeyspace(ns, pool)
+
+	conn := pool.Get()
+	defer conn.Close()
+
+	// The dead pool "2" counted its running job with a lease, so the lock only counts the job of the pool "1".
+	_, err := conn.Do("SET", redisKeyJobsLock(newKeyspace(ns), "wat"), 1)
+	require.NoError(t, err)
+	_, err = conn.Do("HSET", redisKeyJobsLockInfo(newKeyspace(ns), "wat"), "1", 1)
+	require.NoError(t, err)
+	rawJSON, err := (&Job{Name: "wat", ID: "job0"}).serialize()
+	require.NoError(t, err)
+	_, err = conn.Do("LPUSH", redisKeyJobsInProgress(newKeyspace(ns), "2", "wat"), rawJSON)
+	require.NoError(t, err)
+
+	reaper := newDeadPoolReaper(newKeyspace(ns), pool, []string{"wat"}, 0, nil, noopLogger)
+	require.NoError(t, reaper.requeueInProgressJobs("2", []string{"wat"}))
+
+	assert.EqualValues(t, 1, listSize(pool, redisKeyJobs(newKeyspace(ns), "wat")))
+	assert.EqualValues(t, 1, getInt64(pool, redisKeyJobsLock(newKeyspace(ns), "wat")))
+	lockInfo := readHash(pool, redisKeyJobsLockInfo(newKeyspace(ns), "wat"))
+	assert.Equal(t, map[string]string{"1": "1"}, lockInfo)
+}
+
+func TestDeadPoolReaperTrimDeadJobs(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work"
+	cleanKeyspace(ns, pool)
+
+	now := int64(1425263409)
+	setNowEpochSecondsMock(now)
+	defer resetNowEpochSecondsMock()
+
+	conn := pool.Get()
+	defer conn.Close()
+
+	// One dead job per hour in the last 10 hours.
+	for i := int64(0); i < 10; i++ {
+		_, err := conn.Do("ZADD", redisKeyDead(newKeyspace(ns)), now-i*3600, fmt.Sprintf(`{"name":"wat","id":"%d"}`, i))
+		require.NoError(t, err)
+	}
+
+	reaper := newDeadPoolReaper(newKeyspace(ns), pool, []string{"wat"}, 0, nil, noopLogger)
+	trimmed, err := reaper.trimDeadJobs()
+	require.NoError(t, err)
+	assert.EqualValues(t, 0, trimmed)
+
+	reaper.deadJobMaxAge = 5 * time.Hour
+	trimmed, err = reaper.trimDeadJobs()
+	require.NoError(t, err)
+	assert.EqualValues(t, 4, trimmed)
+	assert.EqualValues(t, 6, zsetSize(pool, redisKeyDead(newKeyspace(ns))))
+
+	reaper.deadJobMaxCount = 2
+	trimmed, err = reaper.trimDeadJobs()
+	require.NoError(t, err)
+	assert.EqualValues(t, 4, trimmed)
+
+	ids, err := redis.Strings(conn.Do("ZRANGE", redisKeyDead(newKeyspace(ns)), 0, -1))
+	require.NoError(t, err)
+	assert.Equal(t, []string{`{"name":"wat","id":"1"}`, `{"name":"wat","id":"0"}`}, ids)
+
+	wp := NewWorkerPool(TestContext{}, 1, ns, pool, WithDeadJobRetention(time.Hour, 100))
+	assert.Equal(t, time.Hour, wp.deadJobMaxAge)
+	assert.EqualValues(t, 100, wp.deadJobMaxCount)
+}
+
+func TestReapNow(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work"
+	cleanKeyspace(ns, pool)
+
+	conn := pool.Get()
+	defer conn.Close()
+
+	addDeadPool := func(poolID string) {
+		_, err := conn.Do("SADD", redisKeyWorkerPools(newKeyspace(ns)), poolID)
+		require.NoError(t, err)
+		_, err = conn.Do("HMSET", redisKeyHeartbeat(newKeyspace(ns), poolID),
+			"heartbeat_at", time.Now().Add(-1*time.Hour).Unix(),
+			"job_names", "type1",
+		)
+		require.NoError(t, err)
+		_, err = conn.Do("LPUSH", redisKeyJobsInProgress(newKeyspace(ns), poolID, "type1"), "foo")
+		require.NoError(t, err)
+	}
+
+	// The pool doesn't need to be started, nor to run the reaper.
+	addDeadPool("1")
+	wp := NewWorkerPool(TestContext{}, 1, ns, pool, WithoutReaper())
+	wp.Job("type1", func(job *Job) error { return nil })
+	res, err := wp.ReapNow()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"type1"}, res.NoPoolHeartBeatJobs)
+	assert.EqualValues(t, 1, listSize(pool, redisKeyJobs(newKeyspace(ns), "type1")))
+	assert.EqualValues(t, 0, listSize(pool, redisKeyJobsInProgress(newKeyspace(ns), "1", "type1")))
+
+	addDeadPool("2")
+	res, err = NewClient(ns, pool).ReapNow()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"type1"}, res.NoPoolHeartBeatJobs)
+	assert.EqualValues(t, 2, listSize(pool, redisKeyJobs(newKeyspace(ns), "type1")))
+	assert.False(t, keyExists(pool, redisKeyReaperLock(newKeyspace(ns))))
+
+	// Nothing is reaped while another process holds the lock.
+	addDeadPool("3")
+	_, err = conn.Do("SET", redisKeyReaperLock(newKeyspace(ns)), "other")
+	require.NoError(t, err)
+	_, err = wp.ReapNow()
+	assert.Equal(t, ErrReaperBusy, err)
+	_, err = NewClient(ns, pool).ReapNow()
+	assert.Equal(t, ErrReaperBusy, err)
+	assert.EqualValues(t, 1, listSize(pool, redisKeyJobsInProgress(newKeyspace(ns), "3", "type1")))
+}
+
+func TestDeadPoolReaperSweepExpiredJobs(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work"
+	cleanKeyspace(ns, pool)
+
+	setNowEpochSecondsMock(1425263409)
+	defer resetNowEpochSecondsMock()
+
+	// More jobs than a batch, every third one expired.
+	enqueuer := NewEnqueuer(ns, pool)
+	for i := 0; i < 2500; i++ {
+		ttl := time.Hour
+		if i%3 == 0 {
+			ttl = time.Minute
+		}
+		_, err := enqueuer.EnqueueWithTTL("type1", ttl, Q{"i": i})
+		require.NoError(t, err)
+	}
+	_, err := enqueuer.Enqueue("type1", nil)
+	require.NoError(t, err)
+	// The priority queues are swept too.
+	conn := pool.Get()
+	_, err = conn.Do("LPUSH", redisKeyJobsPriority(newKeyspace(ns), "type1", 10), `{"name":"type1","id":"p","t":1425263409,"expires_at":1425263410}`)
+	conn.Close()
+	require.NoError(t, err)
+
+	reaper := newDeadPoolReaper(newKeyspace(ns), pool, []string{"type1"}, 0, nil, noopLogger)
+	reaper.priorityQueues = []string{redisKeyJobsPriority(newKeyspace(ns), "type1", 10)}
+	reaper.clock = &fakeClock{now: time.Unix(1425263409+90, 0)}
+
+	// Nothing is removed unless enabled.
+	res, err := reaper.reapNow()
+	require.NoError(t, err)
+	assert.Zero(t, res.ExpiredJobs)
+	assert.EqualValues(t, 2501, listSize(pool, redisKeyJobs(newKeyspace(ns), "type1")))
+
+	reaper.sweepTTL = true
+	res, err = reaper.reapNow()
+	require.NoError(t, err)
+	assert.EqualValues(t, 835, res.ExpiredJobs)
+	assert.EqualValues(t, 1667, listSize(pool, redisKeyJobs(newKeyspace(ns), "type1")))
+	assert.EqualValues(t, 0, listSize(pool, redisKeyJobsPriority(newKeyspace(ns), "type1", 10)))
+
+	conn = pool.Get()
+	defer conn.Close()
+	values, err := redis.ByteSlices(conn.Do("LRANGE", redisKeyJobs(newKeyspace(ns), "type1"), 0, -1))
+	require.NoError(t, err)
+	for _, v := range values {
+		job, err := newJob(v, nil, nil, nil)
+		require.NoError(t, err)
+		assert.False(t, job.ttlExpired(1425263409+90), "%s", v)
+	}
+}
+
+func TestDeadPoolReaperStrictFIFO(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work"
+	cleanKeyspace(ns, pool)
+
+	wp := NewWorkerPool(TestContext{}, 1, ns, pool)
+	wp.JobWithOptions("wat", JobOptions{StrictFIFO: true}, func(job *Job) error { return nil })
+	wp.writeConcurrencyControlsToRedis()
+
+	enqueuer := NewEnqueuer(ns, pool)
+	for i := 0; i < 2; i++ {
+		_, err := enqueuer.Enqueue("wat", nil)
+		require.NoError(t, err)
+	}
+
+	// The job left in progress by the dead pool was the oldest one, so it runs next.
+	conn := pool.Get()
+	defer conn.Close()
+	rawJSON, err := (&Job{Name: "wat", ID: "oldest"}).serialize()
+	require.NoError(t, err)
+	_, err = conn.Do("LPUSH", redisKeyJobsInProgress(newKeyspace(ns), "2", "wat"), rawJSON)
+	require.NoError(t, err)
+
+	reaper := newDeadPoolReaper(newKeyspace(ns), pool, []string{"wat"}, 0, nil, noopLogger)
+	require.NoError(t, reaper.requeueInProgressJobs("2", []string{"wat"}))
+
+	assert.EqualValues(t, 3, listSize(pool, redisKeyJobs(newKeyspace(ns), "wat")))
+	assert.Equal(t, "oldest", jobOnQueue(pool, redisKeyJobs(newKeyspace(ns), "wat")).ID)
+}
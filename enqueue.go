@@ -2,39 +2,163 @@ package work
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"strconv"
 	"sync"
 	"time"
 
 	"github.com/gomodule/redigo/redis"
 )
 
+// ErrQueueFull is returned when a job isn't enqueued because its queue has reached the max length
+// set with WithMaxQueueLength. The job can be enqueued again later, once workers have drained the queue:
+//
+//	for {
+//		_, err := enqueuer.Enqueue("send_email", args)
+//		if !errors.Is(err, work.ErrQueueFull) {
+//			return err
+//		}
+//		time.Sleep(time.Second)
+//	}
+var ErrQueueFull = errors.New("queue full")
+
+// ErrInvalidPriority is returned by EnqueueWithPriority when the priority isn't between 1 and 100000.
+var ErrInvalidPriority = errors.New("invalid priority")
+
+// ErrParentFailed is returned by EnqueueAfter when the job isn't enqueued because its parent job has failed.
+var ErrParentFailed = errors.New("parent job failed")
+
+// maxEnqueueAtDelay is how far in the past the time passed to EnqueueAt can be.
+// Times in the past are run right away, but a time further in the past is most likely a bug, e.g. a zero time.
+const maxEnqueueAtDelay = 24 * time.Hour
+
+// defaultIdempotencyTTL is how long the idempotency keys of EnqueueIdempotent are kept if WithIdempotencyTTL isn't set.
+const defaultIdempotencyTTL = 10 * time.Minute
+
+// jobDependencyTTL is how long the children of EnqueueAfter wait for their parent job.
+const jobDependencyTTL = 7 * 24 * time.Hour
+
+// jobOutcomeTTL is how long the outcome of a job is kept for the children enqueued after it's done, see
+// WithJobDependencies.
+const jobOutcomeTTL = 24 * time.Hour
+
+// maxEnqueueEveryCount is the max number of jobs EnqueueEvery can schedule at once.
+const maxEnqueueEveryCount = 1000
+
 // Enqueuer can enqueue jobs.
 type Enqueuer struct {
 	Namespace string // eg, "myapp-work"
 	Pool      Pool
 
+	keys                  keyspace
 	queuePrefix           string // eg, "myapp-work:jobs:"
+	enqueueScript         *redis.Script
 	enqueueUniqueScript   *redis.Script
 	enqueueUniqueInScript *redis.Script
+	enqueueIdemScript     *redis.Script
+	enqueueAfterScript    *redis.Script
+
+	codec           ArgsCodec
+	maxQueueLengths map[string]int64
+	idempotencyTTL  time.Duration
+	middleware      []EnqueueMiddleware
+
+	mtx               sync.RWMutex
+	knownJobs         map[string]int64
+	knownPriorityJobs map[string]int64 // by member of redisKeyKnownPriorityJobs
+}
+
+// EnqueuerOption is an optional option for Enqueuer.
+type EnqueuerOption func(e *Enqueuer)
+
+// WithEnqueuerKeySeparator sets the separator used in the Redis keys of the enqueuer. See WithKeySeparator.
+func WithEnqueuerKeySeparator(sep string) EnqueuerOption {
+	return func(e *Enqueuer) {
+		if sep != "" {
+			e.keys.sep = sep
+		}
+	}
+}
 
-	mtx       sync.RWMutex
-	knownJobs map[string]int64
+// WithEnqueuerClusterMode puts all the keys of the enqueuer into a single Redis Cluster hash slot. See WithClusterMode.
+func WithEnqueuerClusterMode() EnqueuerOption {
+	return func(e *Enqueuer) {
+		e.keys = e.keys.inCluster()
+	}
+}
+
+// WithEnqueuerArgsCodec sets the codec used to encode the arguments of jobs. See WithArgsCodec.
+func WithEnqueuerArgsCodec(codec ArgsCodec) EnqueuerOption {
+	return func(e *Enqueuer) {
+		e.codec = codec
+	}
+}
+
+// WithMaxQueueLength limits the number of jobs waiting in the queue of the job. Enqueueing into a full queue
+// fails with ErrQueueFull. A max of 0 removes the limit.
+// The limit is stored in Redis on every enqueue of the job, so it's also enforced by the enqueuers that don't have
+// this option and by the worker pools, which drop the periodic jobs that don't fit into the queue.
+// Jobs that are retried or were scheduled with EnqueueIn are always enqueued since they were accepted before.
+func WithMaxQueueLength(jobName string, max int64) EnqueuerOption {
+	return func(e *Enqueuer) {
+		if e.maxQueueLengths == nil {
+			e.maxQueueLengths = make(map[string]int64)
+		}
+		e.maxQueueLengths[jobName] = max
+	}
+}
+
+// WithIdempotencyTTL sets how long EnqueueIdempotent remembers the idempotency keys of enqueued jobs.
+// It defaults to 10 minutes.
+func WithIdempotencyTTL(ttl time.Duration) EnqueuerOption {
+	return func(e *Enqueuer) {
+		e.idempotencyTTL = ttl
+	}
+}
+
+// EnqueueMiddleware transforms or validates the args of a job before it's enqueued, e.g. to add the ID of the
+// tenant or the version of the schema of the args. It returns the args to enqueue the job with, or an error to
+// abort the enqueue, which is returned by the Enqueue methods. It may modify and return args, which belongs to the
+// caller of the Enqueue method, or return a new map.
+type EnqueueMiddleware func(jobName string, args map[string]interface{}) (map[string]interface{}, error)
+
+// WithEnqueueMiddleware adds a middleware called with the args of every job enqueued by the Enqueuer or its
+// PipelinedEnqueuers, before the job is serialized. The middleware are called in the order they're added. For the
+// unique jobs, the args returned by the middleware define the uniqueness.
+func WithEnqueueMiddleware(mw EnqueueMiddleware) EnqueuerOption {
+	return func(e *Enqueuer) {
+		e.middleware = append(e.middleware, mw)
+	}
 }
 
 // NewEnqueuer creates a new enqueuer with the specified Redis namespace and Redis pool.
-func NewEnqueuer(namespace string, pool Pool) *Enqueuer {
+func NewEnqueuer(namespace string, pool Pool, opts ...EnqueuerOption) *Enqueuer {
 	if pool == nil {
 		panic("NewEnqueuer needs a non-nil Pool")
 	}
 
-	return &Enqueuer{
+	e := &Enqueuer{
 		Namespace:             namespace,
 		Pool:                  pool,
-		queuePrefix:           redisKeyJobsPrefix(namespace),
+		keys:                  newKeyspace(namespace),
 		knownJobs:             make(map[string]int64),
-		enqueueUniqueScript:   redis.NewScript(2, redisLuaEnqueueUnique),
+		knownPriorityJobs:     make(map[string]int64),
+		enqueueScript:         redis.NewScript(2, redisLuaEnqueue),
+		enqueueUniqueScript:   redis.NewScript(3, redisLuaEnqueueUnique),
 		enqueueUniqueInScript: redis.NewScript(2, redisLuaEnqueueUniqueIn),
+		enqueueIdemScript:     redis.NewScript(3, redisLuaEnqueueIdempotent),
+		enqueueAfterScript:    redis.NewScript(3, redisLuaEnqueueAfter),
+		idempotencyTTL:        defaultIdempotencyTTL,
 	}
+
+	for _, opt := range opts {
+		opt(e)
+	}
+
+	e.queuePrefix = redisKeyJobsPrefix(e.keys)
+
+	return e
 }
 
 // Enqueue will enqueue the specified job name and arguments. The args param can be nil if no args ar needed.
@@ -51,22 +175,166 @@ func (e *Enqueuer) EnqueueContext(ctx context.Context, jobName string, args Q) (
 		ID:         makeIdentifier(),
 		EnqueuedAt: nowEpochSeconds(),
 		Args:       args,
+		codec:      e.codec,
+	}
+
+	return e.enqueue(ctx, job, e.queuePrefix+jobName)
+}
+
+func (e *Enqueuer) enqueue(ctx context.Context, job *Job, queue string) (*Job, error) {
+	rawJSON, err := e.serialize(ctx, job)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := getConn(ctx, e.Pool)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	res, err := redis.String(e.enqueueScript.Do(conn, e.enqueueScriptArgs(queue, job.Name, rawJSON)...))
+	if err != nil {
+		return nil, err
+	}
+
+	if res == "full" {
+		return nil, ErrQueueFull
+	}
+
+	if err := e.addToKnownJobs(conn, job.Name); err != nil {
+		return job, err
+	}
+
+	return job, nil
+}
+
+// serialize passes the args of the job through the middleware of WithEnqueueMiddleware and serializes the job
+// with the trace context of ctx.
+func (e *Enqueuer) serialize(ctx context.Context, job *Job) ([]byte, error) {
+	for _, mw := range e.middleware {
+		args, err := mw(job.Name, job.Args)
+		if err != nil {
+			return nil, err
+		}
+		job.Args = args
 	}
 
 	job.injectTraceContext(ctx)
 
-	rawJSON, err := job.serialize()
+	return job.serialize()
+}
+
+func (e *Enqueuer) enqueueScriptArgs(queue, jobName string, rawJSON []byte) []interface{} {
+	scriptArgs := make([]interface{}, 0, 4)
+	scriptArgs = append(scriptArgs, queue)                                  // KEY[1]
+	scriptArgs = append(scriptArgs, redisKeyJobsMaxLength(e.keys, jobName)) // KEY[2]
+	scriptArgs = append(scriptArgs, rawJSON)                                // ARGV[1]
+	scriptArgs = append(scriptArgs, e.maxQueueLength(jobName))              // ARGV[2]
+
+	return scriptArgs
+}
+
+// maxQueueLength returns the max length of the queue set with WithMaxQueueLength
+// or an empty string if the stored one must be used.
+func (e *Enqueuer) maxQueueLength(jobName string) string {
+	if max, ok := e.maxQueueLengths[jobName]; ok {
+		return strconv.FormatInt(max, 10)
+	}
+	return ""
+}
+
+// EnqueueWithPriority enqueues a job like Enqueue, but into the queue of the job type with the given priority
+// instead of its default queue, e.g. to run the export of a VIP user before the others. The priority must be
+// one of the JobOptions.PriorityQueues of the job type: the worker pools don't fetch from the other queues.
+// ErrInvalidPriority is returned if it isn't between 1 and 100000, like the priorities of JobOptions.
+// The worker pools sample the queue like the one of a job type of this priority, see JobOptions.Priority.
+// The max queue length of the job type, see WithMaxQueueLength, applies to each of its queues. The queue is
+// registered, so that its jobs are counted by Client.Queues.
+func (e *Enqueuer) EnqueueWithPriority(jobName string, priority uint, args Q) (*Job, error) {
+	return e.EnqueueContextWithPriority(context.Background(), jobName, priority, args)
+}
+
+// EnqueueContextWithPriority does the same as EnqueueWithPriority with context propagation.
+func (e *Enqueuer) EnqueueContextWithPriority(ctx context.Context, jobName string, priority uint, args Q) (*Job, error) {
+	if priority == 0 || priority > maxPriority {
+		return nil, ErrInvalidPriority
+	}
+
+	job := &Job{
+		Name:       jobName,
+		ID:         makeIdentifier(),
+		EnqueuedAt: nowEpochSeconds(),
+		Args:       args,
+		codec:      e.codec,
+	}
+
+	job, err := e.enqueue(ctx, job, redisKeyJobsPriority(e.keys, jobName, priority))
+	if err != nil {
+		return job, err
+	}
+
+	return job, e.addToKnownPriorityJobs(ctx, jobName, priority)
+}
+
+// EnqueueIdempotent enqueues a job like Enqueue unless a job with the same name was already enqueued with the same
+// idempotency key in the last 10 minutes, see WithIdempotencyTTL. In this case the original job is returned and nothing
+// is pushed, so a producer can safely retry an enqueue that failed with a network error.
+// Unlike EnqueueUniqueByKey, the key only guards the enqueue: it isn't released when the job is run.
+func (e *Enqueuer) EnqueueIdempotent(jobName, key string, args Q) (*Job, error) {
+	return e.EnqueueContextIdempotent(context.Background(), jobName, key, args)
+}
+
+// EnqueueContextIdempotent does the same as EnqueueIdempotent with context propagation.
+func (e *Enqueuer) EnqueueContextIdempotent(ctx context.Context, jobName, key string, args Q) (*Job, error) {
+	job := &Job{
+		Name:       jobName,
+		ID:         makeIdentifier(),
+		EnqueuedAt: nowEpochSeconds(),
+		Args:       args,
+		codec:      e.codec,
+	}
+
+	rawJSON, err := e.serialize(ctx, job)
 	if err != nil {
 		return nil, err
 	}
 
-	conn := e.Pool.Get()
+	conn, err := getConn(ctx, e.Pool)
+	if err != nil {
+		return nil, err
+	}
 	defer conn.Close()
 
-	if _, err := conn.Do("LPUSH", e.queuePrefix+jobName, rawJSON); err != nil {
+	scriptArgs := make([]interface{}, 0, 6)
+	scriptArgs = append(scriptArgs, e.queuePrefix+jobName)                     // KEY[1]
+	scriptArgs = append(scriptArgs, redisKeyJobsMaxLength(e.keys, jobName))    // KEY[2]
+	scriptArgs = append(scriptArgs, redisKeyIdempotency(e.keys, jobName, key)) // KEY[3]
+	scriptArgs = append(scriptArgs, rawJSON)                                   // ARGV[1]
+	scriptArgs = append(scriptArgs, e.maxQueueLength(jobName))                 // ARGV[2]
+	scriptArgs = append(scriptArgs, e.idempotencyTTL.Milliseconds())           // ARGV[3]
+
+	values, err := redis.Values(e.enqueueIdemScript.Do(conn, scriptArgs...))
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := redis.String(values[0], nil)
+	if err != nil {
 		return nil, err
 	}
 
+	switch res {
+	case "full":
+		return nil, ErrQueueFull
+	case "dup":
+		orig, err := redis.Bytes(values[1], nil)
+		if err != nil {
+			return nil, err
+		}
+		return newJob(orig, nil, nil, e.codec)
+	}
+
 	if err := e.addToKnownJobs(conn, jobName); err != nil {
 		return job, err
 	}
@@ -74,6 +342,172 @@ func (e *Enqueuer) EnqueueContext(ctx context.Context, jobName string, args Q) (
 	return job, nil
 }
 
+// EnqueueAfter enqueues a job like Enqueue once the job with the ID parentJobID has succeeded, e.g. for the steps of a
+// pipeline. Until then the job waits in a list of children of the parent job, for up to a week. If the parent job
+// succeeded in the last day, the job is enqueued right away; if it failed, i.e. it died, was discarded or expired,
+// the job isn't enqueued and ErrParentFailed is returned. The children of a parent job failing later are dropped.
+// It needs the worker pools running the parent job to have WithJobDependencies, and ignores WithMaxQueueLength.
+func (e *Enqueuer) EnqueueAfter(parentJobID, jobName string, args Q) (*Job, error) {
+	return e.EnqueueContextAfter(context.Background(), parentJobID, jobName, args)
+}
+
+// EnqueueContextAfter does the same as EnqueueAfter with context propagation.
+func (e *Enqueuer) EnqueueContextAfter(ctx context.Context, parentJobID, jobName string, args Q) (*Job, error) {
+	job := &Job{
+		Name:       jobName,
+		ID:         makeIdentifier(),
+		EnqueuedAt: nowEpochSeconds(),
+		Args:       args,
+		codec:      e.codec,
+	}
+
+	rawJSON, err := e.serialize(ctx, job)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := getConn(ctx, e.Pool)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	scriptArgs := make([]interface{}, 0, 5)
+	scriptArgs = append(scriptArgs, redisKeyJobChildren(e.keys, parentJobID)) // KEY[1]
+	scriptArgs = append(scriptArgs, redisKeyJobOutcome(e.keys, parentJobID))  // KEY[2]
+	scriptArgs = append(scriptArgs, e.queuePrefix+jobName)                    // KEY[3]
+	scriptArgs = append(scriptArgs, rawJSON)                                  // ARGV[1]
+	scriptArgs = append(scriptArgs, int64(jobDependencyTTL.Seconds()))        // ARGV[2]
+
+	res, err := redis.String(e.enqueueAfterScript.Do(conn, scriptArgs...))
+	if err != nil {
+		return nil, err
+	}
+
+	if res == "cancelled" {
+		return nil, ErrParentFailed
+	}
+
+	if err := e.addToKnownJobs(conn, jobName); err != nil {
+		return job, err
+	}
+
+	return job, nil
+}
+
+// EnqueueBatch enqueues a job with the specified name for each of the args in argsList in a single round trip to Redis.
+// If some of the jobs couldn't be enqueued, the jobs that were enqueued are returned along with an error.
+// The error wraps ErrQueueFull if the queue has reached its max length.
+func (e *Enqueuer) EnqueueBatch(jobName string, argsList []map[string]interface{}) ([]*Job, error) {
+	jobs := make([]*Job, 0, len(argsList))
+	rawJSONs := make([][]byte, 0, len(argsList))
+
+	for _, args := range argsList {
+		job := &Job{
+			Name:       jobName,
+			ID:         makeIdentifier(),
+			EnqueuedAt: nowEpochSeconds(),
+			Args:       args,
+			codec:      e.codec,
+		}
+
+		rawJSON, err := e.serialize(context.Background(), job)
+		if err != nil {
+			return nil, err
+		}
+
+		jobs = append(jobs, job)
+		rawJSONs = append(rawJSONs, rawJSON)
+	}
+
+	if len(jobs) == 0 {
+		return jobs, nil
+	}
+
+	conn := e.Pool.Get()
+	defer conn.Close()
+
+	for _, rawJSON := range rawJSONs {
+		if err := e.enqueueScript.Send(conn, e.enqueueScriptArgs(e.queuePrefix+jobName, jobName, rawJSON)...); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := conn.Flush(); err != nil {
+		return nil, err
+	}
+
+	enqueued := make([]*Job, 0, len(jobs))
+	var lastErr error
+
+	for _, job := range jobs {
+		res, err := redis.String(conn.Receive())
+		if err != nil {
+			lastErr = err
+			continue
+		} else if res == "full" {
+			lastErr = ErrQueueFull
+			continue
+		}
+
+		enqueued = append(enqueued, job)
+	}
+
+	var knownErr error
+	if len(enqueued) > 0 {
+		knownErr = e.addToKnownJobs(conn, jobName)
+	}
+
+	if lastErr != nil {
+		lastErr = fmt.Errorf("%d of %d jobs weren't enqueued: %w", len(jobs)-len(enqueued), len(jobs), lastErr)
+	}
+
+	return enqueued, errors.Join(lastErr, knownErr)
+}
+
+// EnqueueWithDeadline will enqueue the specified job name and arguments. If the job isn't picked up by a worker
+// before the deadline, it's skipped instead of being run. Skipped jobs aren't counted as failures.
+func (e *Enqueuer) EnqueueWithDeadline(jobName string, deadline time.Time, args Q) (*Job, error) {
+	return e.EnqueueContextWithDeadline(context.Background(), jobName, deadline, args)
+}
+
+// EnqueueContextWithDeadline does the same as EnqueueWithDeadline with context propagation.
+func (e *Enqueuer) EnqueueContextWithDeadline(ctx context.Context, jobName string, deadline time.Time, args Q) (*Job, error) {
+	job := &Job{
+		Name:             jobName,
+		ID:               makeIdentifier(),
+		EnqueuedAt:       nowEpochSeconds(),
+		Args:             args,
+		codec:            e.codec,
+		StartingDeadline: deadline.Unix(),
+	}
+
+	return e.enqueue(ctx, job, e.queuePrefix+jobName)
+}
+
+// EnqueueWithTTL will enqueue the specified job name and arguments. If the job isn't picked up by a worker within
+// ttl, it's discarded silently: it's neither run nor passed to the hook of WithExpiredJobHook, and it isn't
+// counted as a failure. Expired jobs are removed when they're dequeued, or by the reaper with WithJobTTLSweep.
+// The TTL has a one second resolution.
+func (e *Enqueuer) EnqueueWithTTL(jobName string, ttl time.Duration, args Q) (*Job, error) {
+	return e.EnqueueContextWithTTL(context.Background(), jobName, ttl, args)
+}
+
+// EnqueueContextWithTTL does the same as EnqueueWithTTL with context propagation.
+func (e *Enqueuer) EnqueueContextWithTTL(ctx context.Context, jobName string, ttl time.Duration, args Q) (*Job, error) {
+	now := nowEpochSeconds()
+	job := &Job{
+		Name:       jobName,
+		ID:         makeIdentifier(),
+		EnqueuedAt: now,
+		Args:       args,
+		codec:      e.codec,
+		ExpiresAt:  now + int64(ttl/time.Second),
+	}
+
+	return e.enqueue(ctx, job, e.queuePrefix+jobName)
+}
+
 // EnqueueIn enqueues a job in the scheduled job queue for execution in secondsFromNow seconds.
 func (e *Enqueuer) EnqueueIn(jobName string, secondsFromNow int64, args map[string]interface{}) (*ScheduledJob, error) {
 	return e.EnqueueContextIn(context.Background(), jobName, secondsFromNow, args)
@@ -86,24 +520,62 @@ func (e *Enqueuer) EnqueueContextIn(ctx context.Context, jobName string, seconds
 		ID:         makeIdentifier(),
 		EnqueuedAt: nowEpochSeconds(),
 		Args:       args,
+		codec:      e.codec,
 	}
 
-	job.injectTraceContext(ctx)
+	return e.enqueueAt(ctx, job, nowEpochSeconds()+secondsFromNow)
+}
+
+// EnqueueAt enqueues a job in the scheduled job queue for execution at t. Unlike EnqueueIn, the time doesn't depend
+// on the clock of the enqueuer. Times in the past are run as soon as possible, but t can't be more than a day in the past.
+func (e *Enqueuer) EnqueueAt(jobName string, t time.Time, args Q) (*ScheduledJob, error) {
+	return e.EnqueueContextAt(context.Background(), jobName, t, args)
+}
+
+// EnqueueContextAt does the same as EnqueueAt with context propagation.
+func (e *Enqueuer) EnqueueContextAt(ctx context.Context, jobName string, t time.Time, args Q) (*ScheduledJob, error) {
+	if err := validateEnqueueAt(t); err != nil {
+		return nil, err
+	}
+
+	job := &Job{
+		Name:       jobName,
+		ID:         makeIdentifier(),
+		EnqueuedAt: nowEpochSeconds(),
+		Args:       args,
+		codec:      e.codec,
+	}
+
+	return e.enqueueAt(ctx, job, t.Unix())
+}
+
+func validateEnqueueAt(t time.Time) error {
+	if earliest := nowEpochSeconds() - int64(maxEnqueueAtDelay/time.Second); t.Unix() < earliest {
+		return fmt.Errorf("work: can't enqueue at %s, it's more than %s in the past", t.UTC().Format(time.RFC3339), maxEnqueueAtDelay)
+	}
+	return nil
+}
 
-	rawJSON, err := job.serialize()
+func (e *Enqueuer) enqueueAt(ctx context.Context, job *Job, runAt int64) (*ScheduledJob, error) {
+	jobName := job.Name
+
+	rawJSON, err := e.serialize(ctx, job)
 	if err != nil {
 		return nil, err
 	}
 
-	conn := e.Pool.Get()
+	conn, err := getConn(ctx, e.Pool)
+	if err != nil {
+		return nil, err
+	}
 	defer conn.Close()
 
 	scheduledJob := &ScheduledJob{
-		RunAt: nowEpochSeconds() + secondsFromNow,
+		RunAt: runAt,
 		Job:   job,
 	}
 
-	_, err = conn.Do("ZADD", redisKeyScheduled(e.Namespace), scheduledJob.RunAt, rawJSON)
+	_, err = conn.Do("ZADD", redisKeyScheduled(e.keys), scheduledJob.RunAt, rawJSON)
 	if err != nil {
 		return nil, err
 	}
@@ -115,53 +587,150 @@ func (e *Enqueuer) EnqueueContextIn(ctx context.Context, jobName string, seconds
 	return scheduledJob, nil
 }
 
+// EnqueueEvery schedules count jobs with the same name and args, the first one to run now and the next ones every
+// interval after it, e.g. every 5 minutes for the next hour. Each job has its own ID. Unlike PeriodicallyEnqueue,
+// nothing is registered: the jobs are only in the scheduled job queue, so they're run by any worker pool.
+// The interval is rounded down to seconds and must be at least a second, and count must be between 1 and 1000.
+func (e *Enqueuer) EnqueueEvery(jobName string, interval time.Duration, count int, args Q) ([]*ScheduledJob, error) {
+	return e.EnqueueContextEvery(context.Background(), jobName, interval, count, args)
+}
+
+// EnqueueContextEvery does the same as EnqueueEvery with context propagation.
+func (e *Enqueuer) EnqueueContextEvery(ctx context.Context, jobName string, interval time.Duration, count int, args Q) ([]*ScheduledJob, error) {
+	if interval < time.Second {
+		return nil, fmt.Errorf("work: can't enqueue every %s, the interval must be at least a second", interval)
+	}
+	if count < 1 || count > maxEnqueueEveryCount {
+		return nil, fmt.Errorf("work: can't enqueue %d jobs, the count must be between 1 and %d", count, maxEnqueueEveryCount)
+	}
+
+	now := nowEpochSeconds()
+	step := int64(interval / time.Second)
+
+	scheduledJobs := make([]*ScheduledJob, 0, count)
+	zaddArgs := make([]interface{}, 0, 2*count+1)
+	zaddArgs = append(zaddArgs, redisKeyScheduled(e.keys))
+
+	for i := 0; i < count; i++ {
+		job := &Job{
+			Name:       jobName,
+			ID:         makeIdentifier(),
+			EnqueuedAt: now,
+			Args:       args,
+			codec:      e.codec,
+		}
+		rawJSON, err := e.serialize(ctx, job)
+		if err != nil {
+			return nil, err
+		}
+
+		runAt := now + int64(i)*step
+		scheduledJobs = append(scheduledJobs, &ScheduledJob{RunAt: runAt, Job: job})
+		zaddArgs = append(zaddArgs, runAt, rawJSON)
+	}
+
+	conn, err := getConn(ctx, e.Pool)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if _, err := conn.Do("ZADD", zaddArgs...); err != nil {
+		return nil, err
+	}
+
+	if err := e.addToKnownJobs(conn, jobName); err != nil {
+		return scheduledJobs, err
+	}
+
+	return scheduledJobs, nil
+}
+
 // EnqueueUnique enqueues a job unless a job is already enqueued with the same name and arguments.
 // The already-enqueued job can be in the normal work queue or in the scheduled job queue.
 // Once a worker begins processing a job, another job with the same name and arguments can be enqueued again.
 // Any failed jobs in the retry queue or dead queue don't count against the uniqueness -- so if a job fails and is retried, two unique jobs with the same name and arguments can be enqueued at once.
 // In order to add robustness to the system, jobs are only unique for 24 hours after they're enqueued. This is mostly relevant for scheduled jobs.
-// EnqueueUnique returns the job if it was enqueued and nil if it wasn't
+// EnqueueUnique returns the job if it was enqueued and nil if it wasn't. ErrQueueFull is returned if the queue is full.
 func (e *Enqueuer) EnqueueUnique(jobName string, args Q) (*Job, error) {
 	return e.EnqueueContextUnique(context.Background(), jobName, args)
 }
 
 // EnqueueContextUnique does the same as EnqueueUnique with context propagation.
 func (e *Enqueuer) EnqueueContextUnique(ctx context.Context, jobName string, args Q) (*Job, error) {
-	uniqueKey, err := redisKeyUniqueJob(e.Namespace, jobName, args)
-	if err != nil {
-		return nil, err
+	job := &Job{
+		Name:       jobName,
+		ID:         makeIdentifier(),
+		EnqueuedAt: nowEpochSeconds(),
+		Args:       args,
+		codec:      e.codec,
+		Unique:     true,
 	}
 
+	return e.enqueueUnique(ctx, job)
+}
+
+// EnqueueUniqueByKey enqueues a job unless a job is already enqueued with the same name and key.
+// Unlike EnqueueUnique, the uniqueness is defined by the key supplied by the caller instead of the arguments,
+// so jobs with different arguments but the same key are considered duplicates. The args are still passed to the handler.
+// The key is stored with the job, so it's released once a worker begins processing the job, as with EnqueueUnique.
+// EnqueueUniqueByKey returns the job if it was enqueued and nil if it wasn't
+func (e *Enqueuer) EnqueueUniqueByKey(jobName, key string, args Q) (*Job, error) {
+	return e.EnqueueContextUniqueByKey(context.Background(), jobName, key, args)
+}
+
+// EnqueueContextUniqueByKey does the same as EnqueueUniqueByKey with context propagation.
+func (e *Enqueuer) EnqueueContextUniqueByKey(ctx context.Context, jobName, key string, args Q) (*Job, error) {
 	job := &Job{
 		Name:       jobName,
 		ID:         makeIdentifier(),
 		EnqueuedAt: nowEpochSeconds(),
 		Args:       args,
+		codec:      e.codec,
 		Unique:     true,
+		UniqueKey:  key,
 	}
 
-	job.injectTraceContext(ctx)
+	return e.enqueueUnique(ctx, job)
+}
 
-	rawJSON, err := job.serialize()
+// enqueueUnique enqueues the job unless a job with the same unique key, computed once its args went through the
+// middleware, is already enqueued.
+func (e *Enqueuer) enqueueUnique(ctx context.Context, job *Job) (*Job, error) {
+	jobName := job.Name
+
+	rawJSON, err := e.serialize(ctx, job)
 	if err != nil {
 		return nil, err
 	}
 
-	conn := e.Pool.Get()
+	uniqueKey, err := job.uniqueKey(e.keys)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := getConn(ctx, e.Pool)
+	if err != nil {
+		return nil, err
+	}
 	defer conn.Close()
 
 	if err := e.addToKnownJobs(conn, jobName); err != nil {
 		return nil, err
 	}
 
-	scriptArgs := make([]interface{}, 0, 3)
-	scriptArgs = append(scriptArgs, e.queuePrefix+jobName) // KEY[1]
-	scriptArgs = append(scriptArgs, uniqueKey)             // KEY[2]
-	scriptArgs = append(scriptArgs, rawJSON)               // ARGV[1]
+	scriptArgs := make([]interface{}, 0, 5)
+	scriptArgs = append(scriptArgs, e.queuePrefix+jobName)                  // KEY[1]
+	scriptArgs = append(scriptArgs, uniqueKey)                              // KEY[2]
+	scriptArgs = append(scriptArgs, redisKeyJobsMaxLength(e.keys, jobName)) // KEY[3]
+	scriptArgs = append(scriptArgs, rawJSON)                                // ARGV[1]
+	scriptArgs = append(scriptArgs, e.maxQueueLength(jobName))              // ARGV[2]
 
 	res, err := redis.String(e.enqueueUniqueScript.Do(conn, scriptArgs...))
 	if res == "ok" && err == nil {
 		return job, nil
+	} else if res == "full" && err == nil {
+		return nil, ErrQueueFull
 	}
 
 	return nil, err
@@ -174,8 +743,27 @@ func (e *Enqueuer) EnqueueUniqueIn(jobName string, secondsFromNow int64, args Q)
 
 // // EnqueueContextUniqueIn does the same as EnqueueUniqueIn with context propagation.
 func (e *Enqueuer) EnqueueContextUniqueIn(ctx context.Context, jobName string, secondsFromNow int64, args Q) (*ScheduledJob, error) {
-	uniqueKey, err := redisKeyUniqueJob(e.Namespace, jobName, args)
-	if err != nil {
+	job := &Job{
+		Name:       jobName,
+		ID:         makeIdentifier(),
+		EnqueuedAt: nowEpochSeconds(),
+		Args:       args,
+		codec:      e.codec,
+		Unique:     true,
+	}
+
+	return e.enqueueUniqueAt(ctx, job, nowEpochSeconds()+secondsFromNow)
+}
+
+// EnqueueUniqueAt enqueues a unique job in the scheduled job queue for execution at t.
+// See EnqueueAt and EnqueueUnique for the semantics.
+func (e *Enqueuer) EnqueueUniqueAt(jobName string, t time.Time, args Q) (*ScheduledJob, error) {
+	return e.EnqueueContextUniqueAt(context.Background(), jobName, t, args)
+}
+
+// EnqueueContextUniqueAt does the same as EnqueueUniqueAt with context propagation.
+func (e *Enqueuer) EnqueueContextUniqueAt(ctx context.Context, jobName string, t time.Time, args Q) (*ScheduledJob, error) {
+	if err := validateEnqueueAt(t); err != nil {
 		return nil, err
 	}
 
@@ -184,33 +772,65 @@ func (e *Enqueuer) EnqueueContextUniqueIn(ctx context.Context, jobName string, s
 		ID:         makeIdentifier(),
 		EnqueuedAt: nowEpochSeconds(),
 		Args:       args,
+		codec:      e.codec,
 		Unique:     true,
 	}
 
-	job.injectTraceContext(ctx)
+	return e.enqueueUniqueAt(ctx, job, t.Unix())
+}
 
-	rawJSON, err := job.serialize()
+// EnqueueUniqueInByKey enqueues a unique job in the scheduled job queue for execution in secondsFromNow seconds.
+// The uniqueness is defined by the key instead of the arguments. See EnqueueUniqueByKey for the semantics.
+func (e *Enqueuer) EnqueueUniqueInByKey(jobName, key string, secondsFromNow int64, args Q) (*ScheduledJob, error) {
+	return e.EnqueueContextUniqueInByKey(context.Background(), jobName, key, secondsFromNow, args)
+}
+
+// EnqueueContextUniqueInByKey does the same as EnqueueUniqueInByKey with context propagation.
+func (e *Enqueuer) EnqueueContextUniqueInByKey(ctx context.Context, jobName, key string, secondsFromNow int64, args Q) (*ScheduledJob, error) {
+	job := &Job{
+		Name:       jobName,
+		ID:         makeIdentifier(),
+		EnqueuedAt: nowEpochSeconds(),
+		Args:       args,
+		codec:      e.codec,
+		Unique:     true,
+		UniqueKey:  key,
+	}
+
+	return e.enqueueUniqueAt(ctx, job, nowEpochSeconds()+secondsFromNow)
+}
+
+func (e *Enqueuer) enqueueUniqueAt(ctx context.Context, job *Job, runAt int64) (*ScheduledJob, error) {
+	rawJSON, err := e.serialize(ctx, job)
 	if err != nil {
 		return nil, err
 	}
 
-	conn := e.Pool.Get()
+	uniqueKey, err := job.uniqueKey(e.keys)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := getConn(ctx, e.Pool)
+	if err != nil {
+		return nil, err
+	}
 	defer conn.Close()
 
-	if err := e.addToKnownJobs(conn, jobName); err != nil {
+	if err := e.addToKnownJobs(conn, job.Name); err != nil {
 		return nil, err
 	}
 
 	scheduledJob := &ScheduledJob{
-		RunAt: nowEpochSeconds() + secondsFromNow,
+		RunAt: runAt,
 		Job:   job,
 	}
 
 	scriptArgs := make([]interface{}, 0, 4)
-	scriptArgs = append(scriptArgs, redisKeyScheduled(e.Namespace)) // KEY[1]
-	scriptArgs = append(scriptArgs, uniqueKey)                      // KEY[2]
-	scriptArgs = append(scriptArgs, rawJSON)                        // ARGV[1]
-	scriptArgs = append(scriptArgs, scheduledJob.RunAt)             // ARGV[2]
+	scriptArgs = append(scriptArgs, redisKeyScheduled(e.keys)) // KEY[1]
+	scriptArgs = append(scriptArgs, uniqueKey)                 // KEY[2]
+	scriptArgs = append(scriptArgs, rawJSON)                   // ARGV[1]
+	scriptArgs = append(scriptArgs, scheduledJob.RunAt)        // ARGV[2]
 
 	res, err := redis.String(e.enqueueUniqueInScript.Do(conn, scriptArgs...))
 
@@ -235,7 +855,7 @@ func (e *Enqueuer) addToKnownJobs(conn redis.Conn, jobName string) error {
 		}
 	}
 	if needSadd {
-		if _, err := conn.Do("SADD", redisKeyKnownJobs(e.Namespace), jobName); err != nil {
+		if _, err := conn.Do("SADD", redisKeyKnownJobs(e.keys), jobName); err != nil {
 			return err
 		}
 
@@ -246,3 +866,34 @@ func (e *Enqueuer) addToKnownJobs(conn redis.Conn, jobName string) error {
 
 	return nil
 }
+
+// addToKnownPriorityJobs registers the priority queue of the job type like addToKnownJobs, getting a connection
+// only when it must be registered again.
+func (e *Enqueuer) addToKnownPriorityJobs(ctx context.Context, jobName string, priority uint) error {
+	member := knownPriorityJob(e.keys, jobName, priority)
+	now := time.Now().Unix()
+
+	e.mtx.RLock()
+	t, ok := e.knownPriorityJobs[member]
+	e.mtx.RUnlock()
+
+	if ok && now < t {
+		return nil
+	}
+
+	conn, err := getConn(ctx, e.Pool)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.Do("SADD", redisKeyKnownPriorityJobs(e.keys), member); err != nil {
+		return err
+	}
+
+	e.mtx.Lock()
+	e.knownPriorityJobs[member] = now + 300
+	e.mtx.Unlock()
+
+	return nil
+}
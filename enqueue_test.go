@@ -2,11 +2,13 @@ package work
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"sync"
 	"testing"
 	"time"
 
+	"github.com/gomodule/redigo/redis"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"go.opentelemetry.io/otel/sdk/trace"
@@ -29,17 +31,17 @@ func TestEnqueue(t *testing.T) {
 	assert.NoError(t, job.ArgError())
 
 	// Make sure "wat" is in the known jobs
-	assert.EqualValues(t, []string{"wat"}, knownJobs(pool, redisKeyKnownJobs(ns)))
+	assert.EqualValues(t, []string{"wat"}, knownJobs(pool, redisKeyKnownJobs(newKeyspace(ns))))
 
 	// Make sure the cache is set
 	expiresAt := enqueuer.knownJobs["wat"]
 	assert.True(t, expiresAt > (time.Now().Unix()+290))
 
 	// Make sure the length of the queue is 1
-	assert.EqualValues(t, 1, listSize(pool, redisKeyJobs(ns, "wat")))
+	assert.EqualValues(t, 1, listSize(pool, redisKeyJobs(newKeyspace(ns), "wat")))
 
 	// Get the job
-	j := jobOnQueue(pool, redisKeyJobs(ns, "wat"))
+	j := jobOnQueue(pool, redisKeyJobs(newKeyspace(ns), "wat"))
 	assert.Equal(t, "wat", j.Name)
 	assert.True(t, len(j.ID) > 10)                        // Something is in it
 	assert.True(t, j.EnqueuedAt > (time.Now().Unix()-10)) // Within 10 seconds
@@ -52,7 +54,7 @@ func TestEnqueue(t *testing.T) {
 	_, err = enqueuer.Enqueue("wat", Q{"a": 1, "b": "cool"})
 	_, err = enqueuer.Enqueue("wat", Q{"a": 1, "b": "cool"})
 	assert.Nil(t, err)
-	assert.EqualValues(t, 2, listSize(pool, redisKeyJobs(ns, "wat")))
+	assert.EqualValues(t, 2, listSize(pool, redisKeyJobs(newKeyspace(ns), "wat")))
 }
 
 func TestEnqueueContext(t *testing.T) {
@@ -73,10 +75,226 @@ func TestEnqueueContext(t *testing.T) {
 	require.NoError(t, err)
 	assert.NotNil(t, j.TraceContext)
 
-	job := jobOnQueue(pool, redisKeyJobs(ns, jobName))
+	job := jobOnQueue(pool, redisKeyJobs(newKeyspace(ns), jobName))
 	assert.Equal(t, j.TraceContext, job.TraceContext)
 }
 
+func TestEnqueueContextPool(t *testing.T) {
+	pool := newTestPool(":6379")
+	pool.MaxActive = 1
+	ns := "work"
+	cleanKeyspace(ns, pool)
+
+	// A *redis.Pool is a ContextPool: waiting for a connection of the exhausted pool stops with the context.
+	conn := pool.Get()
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := NewEnqueuer(ns, pool).EnqueueContext(ctx, "wat", nil)
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+	conn.Close()
+
+	// Pools with Get only still work.
+	_, err = NewEnqueuer(ns, getOnlyPool{pool}).EnqueueContext(ctx, "wat", nil)
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, listSize(pool, redisKeyJobs(newKeyspace(ns), "wat")))
+}
+
+type getOnlyPool struct {
+	pool Pool
+}
+
+func (p getOnlyPool) Get() redis.Conn { return p.pool.Get() }
+
+func TestEnqueueAfter(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work"
+	cleanKeyspace(ns, pool)
+	enqueuer := NewEnqueuer(ns, pool)
+
+	// The children wait for their parent job.
+	for i := 0; i < 2; i++ {
+		job, err := enqueuer.EnqueueAfter("parent", "child", Q{"i": i})
+		require.NoError(t, err)
+		assert.Equal(t, "child", job.Name)
+	}
+	assert.EqualValues(t, 0, listSize(pool, redisKeyJobs(newKeyspace(ns), "child")))
+	assert.EqualValues(t, 2, listSize(pool, redisKeyJobChildren(newKeyspace(ns), "parent")))
+	assert.True(t, knownJobs(pool, redisKeyKnownJobs(newKeyspace(ns)))[0] == "child")
+
+	// They're enqueued right away once it has succeeded, and not at all once it has failed.
+	conn := pool.Get()
+	_, err := conn.Do("SET", redisKeyJobOutcome(newKeyspace(ns), "done"), "succeeded")
+	require.NoError(t, err)
+	_, err = conn.Do("SET", redisKeyJobOutcome(newKeyspace(ns), "dead"), "failed")
+	require.NoError(t, err)
+	conn.Close()
+
+	job, err := enqueuer.EnqueueAfter("done", "child", Q{"i": 2})
+	require.NoError(t, err)
+	assert.Equal(t, job.ID, jobOnQueue(pool, redisKeyJobs(newKeyspace(ns), "child")).ID)
+
+	job, err = enqueuer.EnqueueAfter("dead", "child", nil)
+	assert.ErrorIs(t, err, ErrParentFailed)
+	assert.Nil(t, job)
+	assert.EqualValues(t, 0, listSize(pool, redisKeyJobs(newKeyspace(ns), "child")))
+	assert.False(t, keyExists(pool, redisKeyJobChildren(newKeyspace(ns), "dead")))
+}
+
+func TestEnqueueIdempotent(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work"
+	cleanKeyspace(ns, pool)
+	enqueuer := NewEnqueuer(ns, pool, WithIdempotencyTTL(time.Minute))
+
+	job, err := enqueuer.EnqueueIdempotent("wat", "order-1", Q{"a": 1})
+	require.NoError(t, err)
+
+	// A retry of the same enqueue returns the original job.
+	dup, err := enqueuer.EnqueueIdempotent("wat", "order-1", Q{"a": 2})
+	require.NoError(t, err)
+	assert.Equal(t, job.ID, dup.ID)
+	assert.EqualValues(t, 1, dup.ArgInt64("a"))
+	assert.EqualValues(t, 1, listSize(pool, redisKeyJobs(newKeyspace(ns), "wat")))
+
+	// Unlike the keys of unique jobs, the key is kept once the job is run.
+	assert.Equal(t, job.ID, jobOnQueue(pool, redisKeyJobs(newKeyspace(ns), "wat")).ID)
+	dup, err = enqueuer.EnqueueIdempotent("wat", "order-1", nil)
+	require.NoError(t, err)
+	assert.Equal(t, job.ID, dup.ID)
+	assert.EqualValues(t, 0, listSize(pool, redisKeyJobs(newKeyspace(ns), "wat")))
+
+	other, err := enqueuer.EnqueueIdempotent("wat", "order-2", nil)
+	require.NoError(t, err)
+	assert.NotEqual(t, job.ID, other.ID)
+	assert.EqualValues(t, 1, listSize(pool, redisKeyJobs(newKeyspace(ns), "wat")))
+	assert.Equal(t, []string{"wat"}, knownJobs(pool, redisKeyKnownJobs(newKeyspace(ns))))
+
+	ttl, err := redis.Int64(pool.Get().Do("PTTL", redisKeyIdempotency(newKeyspace(ns), "wat", "order-2")))
+	require.NoError(t, err)
+	assert.True(t, ttl > 0 && ttl <= time.Minute.Milliseconds())
+}
+
+func TestEnqueueBatch(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work"
+	cleanKeyspace(ns, pool)
+	enqueuer := NewEnqueuer(ns, pool)
+
+	jobs, err := enqueuer.EnqueueBatch("wat", []map[string]interface{}{{"a": 1}, {"a": 2}, {"a": 3}})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, len(jobs))
+
+	ids := make(map[string]struct{})
+	for _, job := range jobs {
+		assert.Equal(t, "wat", job.Name)
+		assert.True(t, job.EnqueuedAt > (time.Now().Unix()-10))
+		ids[job.ID] = struct{}{}
+	}
+	assert.Equal(t, 3, len(ids))
+
+	assert.EqualValues(t, []string{"wat"}, knownJobs(pool, redisKeyKnownJobs(newKeyspace(ns))))
+	assert.EqualValues(t, 3, listSize(pool, redisKeyJobs(newKeyspace(ns), "wat")))
+
+	for i := int64(1); i <= 3; i++ {
+		j := jobOnQueue(pool, redisKeyJobs(newKeyspace(ns), "wat"))
+		assert.EqualValues(t, i, j.ArgInt64("a"))
+	}
+
+	jobs, err = enqueuer.EnqueueBatch("wat", nil)
+	assert.NoError(t, err)
+	assert.Empty(t, jobs)
+}
+
+func TestEnqueueMaxQueueLength(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work"
+	cleanKeyspace(ns, pool)
+	enqueuer := NewEnqueuer(ns, pool, WithMaxQueueLength("wat", 2))
+
+	for i := 0; i < 2; i++ {
+		_, err := enqueuer.Enqueue("wat", Q{"a": i})
+		assert.NoError(t, err)
+	}
+
+	job, err := enqueuer.Enqueue("wat", Q{"a": 2})
+	assert.Equal(t, ErrQueueFull, err)
+	assert.Nil(t, job)
+	assert.EqualValues(t, 2, listSize(pool, redisKeyJobs(newKeyspace(ns), "wat")))
+
+	job, err = enqueuer.EnqueueUnique("wat", Q{"a": 2})
+	assert.Equal(t, ErrQueueFull, err)
+	assert.Nil(t, job)
+
+	// Other queues aren't limited.
+	_, err = enqueuer.Enqueue("foo", nil)
+	assert.NoError(t, err)
+
+	// The limit is stored in Redis, so it's enforced by other enqueuers too.
+	other := NewEnqueuer(ns, pool)
+	_, err = other.Enqueue("wat", nil)
+	assert.Equal(t, ErrQueueFull, err)
+
+	jobWat := jobOnQueue(pool, redisKeyJobs(newKeyspace(ns), "wat"))
+	assert.EqualValues(t, 0, jobWat.ArgInt64("a"))
+
+	jobs, err := other.EnqueueBatch("wat", []map[string]interface{}{{"a": 3}, {"a": 4}})
+	assert.True(t, errors.Is(err, ErrQueueFull))
+	assert.Equal(t, 1, len(jobs))
+	assert.EqualValues(t, 2, listSize(pool, redisKeyJobs(newKeyspace(ns), "wat")))
+
+	// The job type of a partly enqueued batch is known.
+	limited := NewEnqueuer(ns, pool, WithMaxQueueLength("bar", 1))
+	jobs, err = limited.EnqueueBatch("bar", []map[string]interface{}{{"a": 0}, {"a": 1}})
+	assert.True(t, errors.Is(err, ErrQueueFull))
+	assert.Equal(t, 1, len(jobs))
+	assert.Contains(t, knownJobs(pool, redisKeyKnownJobs(newKeyspace(ns))), "bar")
+
+	// A max of 0 removes the limit.
+	unlimited := NewEnqueuer(ns, pool, WithMaxQueueLength("wat", 0))
+	_, err = unlimited.Enqueue("wat", nil)
+	assert.NoError(t, err)
+	_, err = other.Enqueue("wat", nil)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 4, listSize(pool, redisKeyJobs(newKeyspace(ns), "wat")))
+}
+
+func TestEnqueueWithDeadline(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work"
+	cleanKeyspace(ns, pool)
+	enqueuer := NewEnqueuer(ns, pool)
+
+	deadline := time.Now().Add(time.Minute)
+	job, err := enqueuer.EnqueueWithDeadline("wat", deadline, Q{"a": 1})
+	assert.NoError(t, err)
+	assert.Equal(t, deadline.Unix(), job.StartingDeadline)
+
+	assert.EqualValues(t, []string{"wat"}, knownJobs(pool, redisKeyKnownJobs(newKeyspace(ns))))
+
+	j := jobOnQueue(pool, redisKeyJobs(newKeyspace(ns), "wat"))
+	assert.Equal(t, job.ID, j.ID)
+	assert.Equal(t, deadline.Unix(), j.StartingDeadline)
+}
+
+func TestEnqueueWithTTL(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work"
+	cleanKeyspace(ns, pool)
+	enqueuer := NewEnqueuer(ns, pool)
+
+	setNowEpochSecondsMock(1425263409)
+	defer resetNowEpochSecondsMock()
+
+	job, err := enqueuer.EnqueueWithTTL("wat", time.Minute, Q{"a": 1})
+	assert.NoError(t, err)
+	assert.EqualValues(t, 1425263409+60, job.ExpiresAt)
+	assert.Zero(t, job.StartingDeadline)
+
+	j := jobOnQueue(pool, redisKeyJobs(newKeyspace(ns), "wat"))
+	assert.Equal(t, job.ID, j.ID)
+	assert.EqualValues(t, 1425263409+60, j.ExpiresAt)
+}
+
 func TestEnqueueIn(t *testing.T) {
 	pool := newTestPool(":6379")
 	ns := "work"
@@ -100,17 +318,17 @@ func TestEnqueueIn(t *testing.T) {
 	}
 
 	// Make sure "wat" is in the known jobs
-	assert.EqualValues(t, []string{"wat"}, knownJobs(pool, redisKeyKnownJobs(ns)))
+	assert.EqualValues(t, []string{"wat"}, knownJobs(pool, redisKeyKnownJobs(newKeyspace(ns))))
 
 	// Make sure the cache is set
 	expiresAt := enqueuer.knownJobs["wat"]
 	assert.True(t, expiresAt > (time.Now().Unix()+290))
 
 	// Make sure the length of the scheduled job queue is 1
-	assert.EqualValues(t, 1, zsetSize(pool, redisKeyScheduled(ns)))
+	assert.EqualValues(t, 1, zsetSize(pool, redisKeyScheduled(newKeyspace(ns))))
 
 	// Get the job
-	score, j := jobOnZset(pool, redisKeyScheduled(ns))
+	score, j := jobOnZset(pool, redisKeyScheduled(newKeyspace(ns)))
 
 	assert.True(t, score > time.Now().Unix()+290)
 	assert.True(t, score <= time.Now().Unix()+300)
@@ -124,6 +342,109 @@ func TestEnqueueIn(t *testing.T) {
 	assert.NoError(t, j.ArgError())
 }
 
+func TestEnqueueAt(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work"
+	cleanKeyspace(ns, pool)
+	enqueuer := NewEnqueuer(ns, pool)
+
+	setNowEpochSecondsMock(1425263409)
+	defer resetNowEpochSecondsMock()
+
+	at := time.Unix(1425263409+3600, 0)
+	job, err := enqueuer.EnqueueAt("wat", at, Q{"a": 1})
+	assert.NoError(t, err)
+	if assert.NotNil(t, job) {
+		assert.EqualValues(t, at.Unix(), job.RunAt)
+		assert.EqualValues(t, 1425263409, job.EnqueuedAt)
+	}
+
+	assert.EqualValues(t, []string{"wat"}, knownJobs(pool, redisKeyKnownJobs(newKeyspace(ns))))
+
+	score, j := jobOnZset(pool, redisKeyScheduled(newKeyspace(ns)))
+	assert.Equal(t, at.Unix(), score)
+	assert.Equal(t, job.ID, j.ID)
+
+	// A bit in the past is fine, it's run right away.
+	_, err = enqueuer.EnqueueAt("wat", time.Unix(1425263409-60, 0), nil)
+	assert.NoError(t, err)
+
+	job, err = enqueuer.EnqueueAt("wat", time.Time{}, nil)
+	assert.Error(t, err)
+	assert.Nil(t, job)
+	assert.EqualValues(t, 2, zsetSize(pool, redisKeyScheduled(newKeyspace(ns))))
+}
+
+func TestEnqueueEvery(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work"
+	cleanKeyspace(ns, pool)
+	enqueuer := NewEnqueuer(ns, pool)
+
+	setNowEpochSecondsMock(1425263409)
+	defer resetNowEpochSecondsMock()
+
+	jobs, err := enqueuer.EnqueueEvery("wat", 5*time.Minute, 12, Q{"a": 1})
+	assert.NoError(t, err)
+	assert.Equal(t, 12, len(jobs))
+	assert.EqualValues(t, 12, zsetSize(pool, redisKeyScheduled(newKeyspace(ns))))
+	assert.EqualValues(t, []string{"wat"}, knownJobs(pool, redisKeyKnownJobs(newKeyspace(ns))))
+
+	ids := map[string]bool{}
+	for i, job := range jobs {
+		assert.EqualValues(t, 1425263409+i*300, job.RunAt)
+		assert.EqualValues(t, 1425263409, job.EnqueuedAt)
+		assert.EqualValues(t, 1, job.ArgInt64("a"))
+		ids[job.ID] = true
+	}
+	assert.Equal(t, 12, len(ids))
+
+	score, j := jobOnZset(pool, redisKeyScheduled(newKeyspace(ns)))
+	assert.EqualValues(t, 1425263409, score)
+	assert.Equal(t, jobs[0].ID, j.ID)
+
+	for _, c := range []struct {
+		interval time.Duration
+		count    int
+	}{
+		{time.Millisecond, 1},
+		{time.Minute, 0},
+		{time.Minute, maxEnqueueEveryCount + 1},
+	} {
+		jobs, err := enqueuer.EnqueueEvery("wat", c.interval, c.count, nil)
+		assert.Error(t, err)
+		assert.Nil(t, jobs)
+	}
+	assert.EqualValues(t, 12, zsetSize(pool, redisKeyScheduled(newKeyspace(ns))))
+}
+
+func TestEnqueueUniqueAt(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work"
+	cleanKeyspace(ns, pool)
+	enqueuer := NewEnqueuer(ns, pool)
+
+	at := time.Now().Add(time.Hour)
+	job, err := enqueuer.EnqueueUniqueAt("wat", at, Q{"a": 1})
+	assert.NoError(t, err)
+	if assert.NotNil(t, job) {
+		assert.EqualValues(t, at.Unix(), job.RunAt)
+		assert.True(t, job.Unique)
+	}
+
+	job, err = enqueuer.EnqueueUniqueAt("wat", at.Add(time.Hour), Q{"a": 1})
+	assert.NoError(t, err)
+	assert.Nil(t, job)
+
+	job, err = enqueuer.EnqueueUniqueAt("wat", at, Q{"a": 2})
+	assert.NoError(t, err)
+	assert.NotNil(t, job)
+
+	_, err = enqueuer.EnqueueUniqueAt("wat", time.Time{}, Q{"a": 3})
+	assert.Error(t, err)
+	assert.EqualValues(t, 2, zsetSize(pool, redisKeyScheduled(newKeyspace(ns))))
+}
+
 func TestEnqueueUnique(t *testing.T) {
 	pool := newTestPool(":6379")
 	ns := "work"
@@ -225,7 +546,7 @@ func TestEnqueueUniqueIn(t *testing.T) {
 	assert.Nil(t, job)
 
 	// Get the job
-	score, j := jobOnZset(pool, redisKeyScheduled(ns))
+	score, j := jobOnZset(pool, redisKeyScheduled(newKeyspace(ns)))
 
 	assert.True(t, score > time.Now().Unix()+290) // We don't want to overwrite the time
 	assert.True(t, score <= time.Now().Unix()+300)
@@ -256,3 +577,165 @@ func TestEnqueueUniqueIn(t *testing.T) {
 	assert.NoError(t, err)
 	assert.NotNil(t, job)
 }
+
+func TestEnqueueUniqueByKey(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work"
+	cleanKeyspace(ns, pool)
+	enqueuer := NewEnqueuer(ns, pool)
+	var mutex = &sync.Mutex{}
+
+	job, err := enqueuer.EnqueueUniqueByKey("wat", "123", Q{"a": 1, "b": "cool"})
+	assert.NoError(t, err)
+	if assert.NotNil(t, job) {
+		assert.Equal(t, "wat", job.Name)
+		assert.True(t, job.Unique)
+		assert.Equal(t, "123", job.UniqueKey)
+	}
+
+	// Different args, same key -- it's a duplicate.
+	job, err = enqueuer.EnqueueUniqueByKey("wat", "123", Q{"a": 1, "b": "coolio"})
+	assert.NoError(t, err)
+	assert.Nil(t, job)
+
+	job, err = enqueuer.EnqueueUniqueByKey("wat", "124", Q{"a": 1, "b": "cool"})
+	assert.NoError(t, err)
+	assert.NotNil(t, job)
+
+	var args []string
+	wp := NewWorkerPool(TestContext{}, 3, ns, pool)
+	wp.Job("wat", func(job *Job) error {
+		mutex.Lock()
+		args = append(args, job.ArgString("b"))
+		mutex.Unlock()
+		return nil
+	})
+	wp.Start()
+	wp.Drain()
+	wp.Stop()
+
+	assert.ElementsMatch(t, []string{"cool", "cool"}, args)
+
+	// The unique key was released when the job was processed.
+	job, err = enqueuer.EnqueueUniqueByKey("wat", "123", Q{"a": 1, "b": "coolio"})
+	assert.NoError(t, err)
+	assert.NotNil(t, job)
+}
+
+func TestEnqueueUniqueInByKey(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work"
+	cleanKeyspace(ns, pool)
+	enqueuer := NewEnqueuer(ns, pool)
+
+	setNowEpochSecondsMock(1425263409)
+	defer resetNowEpochSecondsMock()
+
+	job, err := enqueuer.EnqueueUniqueInByKey("wat", "daily", 300, Q{"day": 1})
+	assert.NoError(t, err)
+	if assert.NotNil(t, job) {
+		assert.EqualValues(t, 1425263409+300, job.RunAt)
+		assert.Equal(t, "daily", job.UniqueKey)
+	}
+
+	// Different args, same key -- it's a duplicate.
+	job, err = enqueuer.EnqueueUniqueInByKey("wat", "daily", 300, Q{"day": 2})
+	assert.NoError(t, err)
+	assert.Nil(t, job)
+	assert.EqualValues(t, 1, zsetSize(pool, redisKeyScheduled(newKeyspace(ns))))
+
+	uniqueKey := redisKeyUniqueJobByKey(newKeyspace(ns), "wat", "daily")
+	assert.True(t, keyExists(pool, uniqueKey))
+
+	// Once the scheduled job runs, the key is released.
+	setNowEpochSecondsMock(1425263409 + 301)
+	r := newRequeuer(newKeyspace(ns), pool, redisKeyScheduled(newKeyspace(ns)), []string{"wat"}, noopMetrics, noopLogger)
+	assert.True(t, r.process())
+
+	var days []int64
+	jobTypes := map[string]*jobType{
+		"wat": {
+			Name:       "wat",
+			JobOptions: JobOptions{Priority: 1},
+			isGeneric:  true,
+			genericHandler: func(job *Job) error {
+				days = append(days, job.ArgInt64("day"))
+				return nil
+			},
+		},
+	}
+	w := newWorker(newKeyspace(ns), "1", pool, tstCtxType, nil, jobTypes, noopLogger, nil)
+	w.start()
+	w.drain()
+	w.stop()
+
+	assert.Equal(t, []int64{1}, days)
+	assert.False(t, keyExists(pool, uniqueKey))
+
+	job, err = enqueuer.EnqueueUniqueInByKey("wat", "daily", 300, Q{"day": 2})
+	assert.NoError(t, err)
+	assert.NotNil(t, job)
+}
+
+func TestEnqueueMiddleware(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work"
+	cleanKeyspace(ns, pool)
+
+	errNoUser := errors.New("no user")
+	enqueuer := NewEnqueuer(ns, pool,
+		WithEnqueueMiddleware(func(jobName string, args map[string]interface{}) (map[string]interface{}, error) {
+			if _, ok := args["user"]; !ok {
+				return nil, errNoUser
+			}
+			return args, nil
+		}),
+		WithEnqueueMiddleware(func(jobName string, args map[string]interface{}) (map[string]interface{}, error) {
+			withTenant := Q{"tenant": "acme"}
+			for k, v := range args {
+				withTenant[k] = v
+			}
+			return withTenant, nil
+		}),
+	)
+
+	args := Q{"user": "u1"}
+	job, err := enqueuer.Enqueue("wat", args)
+	require.NoError(t, err)
+	assert.Equal(t, "acme", job.ArgString("tenant"))
+	assert.Equal(t, Q{"user": "u1"}, args)
+	assert.Equal(t, "acme", jobOnQueue(pool, redisKeyJobs(newKeyspace(ns), "wat")).ArgString("tenant"))
+
+	_, err = enqueuer.Enqueue("wat", nil)
+	assert.Equal(t, errNoUser, err)
+	_, err = enqueuer.EnqueueIn("wat", 10, Q{})
+	assert.Equal(t, errNoUser, err)
+	_, err = enqueuer.EnqueueBatch("wat", []map[string]interface{}{{"user": "u1"}, {}})
+	assert.Equal(t, errNoUser, err)
+	assert.EqualValues(t, 0, listSize(pool, redisKeyJobs(newKeyspace(ns), "wat")))
+	assert.EqualValues(t, 0, zsetSize(pool, redisKeyScheduled(newKeyspace(ns))))
+
+	scheduled, err := enqueuer.EnqueueIn("wat", 10, Q{"user": "u1"})
+	require.NoError(t, err)
+	assert.Equal(t, "acme", scheduled.ArgString("tenant"))
+
+	// The uniqueness is defined by the args returned by the middleware.
+	job, err = enqueuer.EnqueueUnique("wat", Q{"user": "u1"})
+	require.NoError(t, err)
+	require.NotNil(t, job)
+	uniqueKey, err := redisKeyUniqueJob(newKeyspace(ns), "wat", Q{"user": "u1", "tenant": "acme"}, nil)
+	require.NoError(t, err)
+	assert.True(t, keyExists(pool, uniqueKey))
+
+	job, err = enqueuer.EnqueueUnique("wat", Q{"user": "u1"})
+	assert.NoError(t, err)
+	assert.Nil(t, job)
+
+	_, err = enqueuer.EnqueueUnique("wat", Q{})
+	assert.Equal(t, errNoUser, err)
+
+	p := NewPipelinedEnqueuer(enqueuer, 10)
+	_, err = p.Enqueue("wat", nil)
+	assert.Equal(t, errNoUser, err)
+	assert.Equal(t, 0, p.Buffered())
+}
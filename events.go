@@ -0,0 +1,88 @@
+package work
+
+import (
+	"sync"
+	"time"
+)
+
+// eventsBufferSize is the capacity of the channel returned by WorkerPool.Events.
+const eventsBufferSize = 1024
+
+// JobEventType is the type of a JobEvent.
+type JobEventType string
+
+// Job event types.
+const (
+	JobEventEnqueued    JobEventType = "enqueued"    // the pool scheduled a periodic job, see PeriodicallyEnqueue
+	JobEventStarted     JobEventType = "started"     // a worker started to run the job
+	JobEventSucceeded   JobEventType = "succeeded"   // the handler returned nil
+	JobEventSkipped     JobEventType = "skipped"     // the handler or a middleware returned ErrSkipJob
+	JobEventRescheduled JobEventType = "rescheduled" // the handler called Job.Reschedule and returned nil
+	JobEventRetried     JobEventType = "retried"     // the job failed and was scheduled for a retry
+	JobEventDied        JobEventType = "died"        // the job failed with no retries left
+)
+
+// JobEvent is a transition in the lifecycle of a job processed by a worker pool.
+type JobEvent struct {
+	Type    JobEventType
+	JobName string
+	JobID   string
+	Time    time.Time
+}
+
+// jobEvents delivers the job events of a worker pool to its subscriber. Nothing is delivered
+// until the channel is created by subscribe.
+type jobEvents struct {
+	mtx sync.Mutex
+	ch  chan JobEvent
+}
+
+func (e *jobEvents) subscribe() <-chan JobEvent {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	if e.ch == nil {
+		e.ch = make(chan JobEvent, eventsBufferSize)
+	}
+
+	return e.ch
+}
+
+// emit sends an event without blocking. If the channel is full, the oldest event is dropped.
+func (e *jobEvents) emit(t JobEventType, job *Job) {
+	if e == nil {
+		return
+	}
+
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	if e.ch == nil {
+		return
+	}
+
+	ev := JobEvent{Type: t, JobName: job.Name, JobID: job.ID, Time: time.Now()}
+	for {
+		select {
+		case e.ch <- ev:
+			return
+		default:
+		}
+
+		select {
+		case <-e.ch:
+		default:
+		}
+	}
+}
+
+// close closes the channel of the subscriber, if any. A new one is created by the next subscribe.
+func (e *jobEvents) close() {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	if e.ch != nil {
+		close(e.ch)
+		e.ch = nil
+	}
+}
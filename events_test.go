@@ -0,0 +1,100 @@
+package work
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWorkerPoolEvents(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work"
+	cleanKeyspace(ns, pool)
+
+	wp := NewWorkerPool(TestContext{}, 1, ns, pool)
+	wp.Job("ok", func(job *Job) error { return nil })
+	wp.JobWithOptions("retry", JobOptions{MaxFails: 2}, func(job *Job) error { return fmt.Errorf("oops") })
+	wp.JobWithOptions("die", JobOptions{MaxFails: 1}, func(job *Job) error { return fmt.Errorf("oops") })
+
+	events := wp.Events()
+
+	enqueuer := NewEnqueuer(ns, pool)
+	ids := map[string]string{}
+	for _, name := range []string{"ok", "retry", "die"} {
+		job, err := enqueuer.Enqueue(name, nil)
+		require.NoError(t, err)
+		ids[name] = job.ID
+	}
+
+	wp.Start()
+	wp.Drain()
+	wp.Stop()
+
+	got := map[string][]JobEventType{}
+	for ev := range events {
+		assert.Equal(t, ids[ev.JobName], ev.JobID)
+		assert.False(t, ev.Time.IsZero())
+		got[ev.JobName] = append(got[ev.JobName], ev.Type)
+	}
+
+	assert.Equal(t, map[string][]JobEventType{
+		"ok":    {JobEventStarted, JobEventSucceeded},
+		"retry": {JobEventStarted, JobEventRetried},
+		"die":   {JobEventStarted, JobEventDied},
+	}, got)
+}
+
+func TestPeriodicEnqueuerEvents(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work"
+	cleanKeyspace(ns, pool)
+
+	var pjs []*periodicJob
+	pjs = appendPeriodicJob(pjs, "0/29 * * * * *", "foo")
+
+	var e jobEvents
+	ch := e.subscribe()
+	pe := newPeriodicEnqueuer(newKeyspace(ns), pool, pjs, noopLogger)
+	pe.clock = &fakeClock{now: time.Unix(1468359453, 0)}
+	pe.events = &e
+
+	// The jobs already scheduled aren't reported again.
+	require.NoError(t, pe.enqueue())
+	require.NoError(t, pe.enqueue())
+	e.close()
+
+	ids := map[string]bool{}
+	for ev := range ch {
+		assert.Equal(t, JobEventEnqueued, ev.Type)
+		assert.Equal(t, "foo", ev.JobName)
+		assert.False(t, ids[ev.JobID])
+		ids[ev.JobID] = true
+	}
+	assert.NotEmpty(t, ids)
+	assert.EqualValues(t, zsetSize(pool, redisKeyScheduled(newKeyspace(ns))), len(ids))
+}
+
+func TestJobEventsDropOldest(t *testing.T) {
+	var e jobEvents
+	e.emit(JobEventStarted, &Job{ID: "ignored"})
+
+	ch := e.subscribe()
+	for i := 0; i < eventsBufferSize+2; i++ {
+		e.emit(JobEventStarted, &Job{ID: fmt.Sprint(i)})
+	}
+	e.close()
+
+	var ids []string
+	for ev := range ch {
+		ids = append(ids, ev.JobID)
+	}
+	require.Equal(t, eventsBufferSize, len(ids))
+	assert.Equal(t, "2", ids[0])
+	assert.Equal(t, fmt.Sprint(eventsBufferSize+1), ids[len(ids)-1])
+
+	// Emitting after close is a no-op.
+	e.emit(JobEventStarted, &Job{})
+}
@@ -0,0 +1,120 @@
+package work
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// failoverErrorPrefixes are the prefixes of the errors replied by Redis while a failover is in progress:
+// the master is down, the new master is loading its dataset, or the node was demoted to a replica.
+var failoverErrorPrefixes = []string{"MASTERDOWN", "LOADING", "READONLY"}
+
+const (
+	failoverMinBackoff = 50 * time.Millisecond
+	failoverMaxBackoff = 5 * time.Second
+)
+
+// FailoverHandler is called when Redis replies with an error showing a failover is in progress, see
+// WithFailoverHandler.
+type FailoverHandler func(err error)
+
+// isFailoverError returns whether err is a reply of Redis during a failover, see failoverErrorPrefixes.
+func isFailoverError(err error) bool {
+	var redisErr redis.Error
+	if !errors.As(err, &redisErr) {
+		return false
+	}
+
+	for _, prefix := range failoverErrorPrefixes {
+		if strings.HasPrefix(string(redisErr), prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// failoverBackoff returns how long to wait after the given number of consecutive failover errors. It doubles
+// from failoverMinBackoff up to failoverMaxBackoff.
+func failoverBackoff(failovers int) time.Duration {
+	backoff := failoverMinBackoff
+	for i := 1; i < failovers && backoff < failoverMaxBackoff; i++ {
+		backoff *= 2
+	}
+
+	if backoff > failoverMaxBackoff {
+		backoff = failoverMaxBackoff
+	}
+
+	return backoff
+}
+
+// failoverState is shared by the workers and the background loops of a pool, so that they back off together while
+// Redis fails over and the FailoverHandler is called once per backoff rather than by each of them for every error.
+// A nil *failoverState never backs off.
+type failoverState struct {
+	handler FailoverHandler
+
+	mtx       sync.Mutex
+	failovers int       // backoffs since Redis last replied without a failover error
+	until     time.Time // end of the current backoff
+}
+
+// failed returns whether err shows a failover is in progress. The first such error after the current backoff
+// starts the next, longer one and calls the handler.
+func (f *failoverState) failed(err error) bool {
+	if !isFailoverError(err) {
+		return false
+	}
+	if f == nil {
+		return true
+	}
+
+	f.mtx.Lock()
+	now := time.Now()
+	if now.Before(f.until) {
+		f.mtx.Unlock()
+		return true
+	}
+	f.failovers++
+	f.until = now.Add(failoverBackoff(f.failovers))
+	f.mtx.Unlock()
+
+	if f.handler != nil {
+		f.handler(err)
+	}
+
+	return true
+}
+
+// succeeded resets the backoff once Redis replies again.
+func (f *failoverState) succeeded() {
+	if f == nil {
+		return
+	}
+
+	f.mtx.Lock()
+	f.failovers = 0
+	f.until = time.Time{}
+	f.mtx.Unlock()
+}
+
+// backoff returns how long to wait before calling Redis again, 0 outside of a backoff.
+func (f *failoverState) backoff() time.Duration {
+	if f == nil {
+		return 0
+	}
+
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	if d := time.Until(f.until); d > 0 {
+		return d
+	}
+
+	return 0
+}
@@ -0,0 +1,118 @@
+package work
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsFailoverError(t *testing.T) {
+	assert.True(t, isFailoverError(redis.Error("MASTERDOWN Link with MASTER is down")))
+	assert.True(t, isFailoverError(redis.Error("LOADING Redis is loading the dataset in memory")))
+	assert.True(t, isFailoverError(fmt.Errorf("fetch: %w", redis.Error("READONLY You can't write against a read only replica."))))
+	assert.False(t, isFailoverError(redis.Error("NOSCRIPT No matching script")))
+	assert.False(t, isFailoverError(errors.New("LOADING")))
+	assert.False(t, isFailoverError(nil))
+}
+
+func TestFailoverBackoff(t *testing.T) {
+	assert.Equal(t, 50*time.Millisecond, failoverBackoff(1))
+	assert.Equal(t, 100*time.Millisecond, failoverBackoff(2))
+	assert.Equal(t, 400*time.Millisecond, failoverBackoff(4))
+	assert.Equal(t, failoverMaxBackoff, failoverBackoff(10))
+	assert.Equal(t, failoverMaxBackoff, failoverBackoff(1000))
+}
+
+// loadingPool returns connections whose commands fail as if Redis was loading its dataset.
+type loadingPool struct{}
+
+func (loadingPool) Get() redis.Conn { return loadingConn{} }
+
+type loadingConn struct{ redis.Conn }
+
+func (loadingConn) Do(string, ...interface{}) (interface{}, error) {
+	return nil, redis.Error("LOADING Redis is loading the dataset in memory")
+}
+
+func (loadingConn) Send(string, ...interface{}) error { return nil }
+
+func (loadingConn) Flush() error {
+	return redis.Error("LOADING Redis is loading the dataset in memory")
+}
+
+func (loadingConn) Close() error { return nil }
+
+func TestFailoverState(t *testing.T) {
+	var handled int64
+	f := &failoverState{handler: func(err error) { atomic.AddInt64(&handled, 1) }}
+	loading := redis.Error("LOADING Redis is loading the dataset in memory")
+
+	assert.False(t, f.failed(redis.Error("NOSCRIPT No matching script")))
+	assert.EqualValues(t, 0, f.backoff())
+
+	// The errors seen during a backoff don't extend it, nor call the handler again.
+	assert.True(t, f.failed(loading))
+	assert.True(t, f.failed(loading))
+	assert.EqualValues(t, 1, atomic.LoadInt64(&handled))
+	backoff := f.backoff()
+	assert.True(t, backoff > 0 && backoff <= failoverMinBackoff, "backoff: %v", backoff)
+
+	f.succeeded()
+	assert.EqualValues(t, 0, f.backoff())
+
+	// A nil state only tells the failover errors apart.
+	var none *failoverState
+	assert.True(t, none.failed(loading))
+	assert.EqualValues(t, 0, none.backoff())
+	none.succeeded()
+}
+
+func TestWorkerFailoverBackoff(t *testing.T) {
+	jobTypes := map[string]*jobType{
+		"wat": {Name: "wat", JobOptions: JobOptions{Priority: 1}, isGeneric: true, genericHandler: func(*Job) error { return nil }},
+	}
+
+	// The workers of a pool share the backoff and the handler.
+	var failovers int64
+	f := &failoverState{handler: func(err error) {
+		assert.True(t, isFailoverError(err))
+		atomic.AddInt64(&failovers, 1)
+	}}
+	var workers []*worker
+	for i := 0; i < 3; i++ {
+		w := newWorker(newKeyspace("work"), "1", loadingPool{}, tstCtxType, nil, jobTypes, noopLogger, nil,
+			workerWithFailover(f))
+		w.start()
+		workers = append(workers, w)
+	}
+	time.Sleep(200 * time.Millisecond)
+	for _, w := range workers {
+		w.stop()
+	}
+
+	// Backoffs at 0, 50ms and 150ms, the next one is at 350ms. Without the backoff there would be about 20 per
+	// worker.
+	n := atomic.LoadInt64(&failovers)
+	assert.True(t, n >= 2 && n <= 4, "failovers: %d", n)
+}
+
+func TestFailoverBackgroundLoops(t *testing.T) {
+	var failovers int64
+	f := &failoverState{handler: func(err error) { atomic.AddInt64(&failovers, 1) }}
+
+	// The background loops of the pool start the backoff of its workers, and call the handler once for all.
+	r := newRequeuer(newKeyspace("work"), loadingPool{}, redisKeyRetry(newKeyspace("work")), []string{"wat"}, noopMetrics, noopLogger)
+	r.failover = f
+	assert.False(t, r.process())
+	assert.True(t, f.backoff() > 0)
+
+	h := newWorkerPoolHeartbeater(newKeyspace("work"), loadingPool{}, "1", nil, 1, nil, noopLogger)
+	h.failover = f
+	h.heartbeat()
+	assert.EqualValues(t, 1, atomic.LoadInt64(&failovers))
+}
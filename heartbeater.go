@@ -4,6 +4,8 @@ import (
 	"os"
 	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -13,24 +15,31 @@ const (
 
 type workerPoolHeartbeater struct {
 	workerPoolID string
-	namespace    string // eg, "myapp-work"
+	keys         keyspace
 	pool         Pool
 	beatPeriod   time.Duration
-	concurrency  uint
 	jobNames     string
 	startedAt    int64
 	pid          int
 	hostname     string
-	workerIDs    string
+
+	mtx         sync.Mutex // guards concurrency and workerIDs, see setWorkers
+	concurrency uint
+	workerIDs   string
 
 	stopChan         chan struct{}
 	doneStoppingChan chan struct{}
 
-	logger StructuredLogger
+	// lastHeartbeatAt is the time of the last written heartbeat in Unix nanoseconds, or of the start.
+	lastHeartbeatAt atomic.Int64
+
+	failover *failoverState // shared with the other loops of the pool
+	clock    Clock
+	logger   StructuredLogger
 }
 
 func newWorkerPoolHeartbeater(
-	namespace string,
+	keys keyspace,
 	pool Pool,
 	workerPoolID string,
 	jobTypes map[string]*jobType,
@@ -40,12 +49,12 @@ func newWorkerPoolHeartbeater(
 ) *workerPoolHeartbeater {
 	h := &workerPoolHeartbeater{
 		workerPoolID:     workerPoolID,
-		namespace:        namespace,
+		keys:             keys,
 		pool:             pool,
 		beatPeriod:       beatPeriod,
-		concurrency:      concurrency,
 		stopChan:         make(chan struct{}),
 		doneStoppingChan: make(chan struct{}),
+		clock:            defaultClock,
 		logger:           logger,
 	}
 
@@ -56,8 +65,7 @@ func newWorkerPoolHeartbeater(
 	sort.Strings(jobNames)
 	h.jobNames = strings.Join(jobNames, ",")
 
-	sort.Strings(workerIDs)
-	h.workerIDs = strings.Join(workerIDs, ",")
+	h.setWorkers(concurrency, workerIDs)
 
 	h.pid = os.Getpid()
 	host, err := os.Hostname()
@@ -70,17 +78,33 @@ func newWorkerPoolHeartbeater(
 	return h
 }
 
+// setWorkers sets the concurrency and the worker IDs written by the next heartbeats.
+func (h *workerPoolHeartbeater) setWorkers(concurrency uint, workerIDs []string) {
+	sort.Strings(workerIDs)
+
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+
+	h.concurrency = concurrency
+	h.workerIDs = strings.Join(workerIDs, ",")
+}
+
 func (h *workerPoolHeartbeater) start() {
+	h.startedAt = h.clock.Now().Unix()
+	h.lastHeartbeatAt.Store(h.clock.Now().UnixNano())
 	go h.loop()
 }
 
+func (h *workerPoolHeartbeater) lastHeartbeat() time.Time {
+	return time.Unix(0, h.lastHeartbeatAt.Load())
+}
+
 func (h *workerPoolHeartbeater) stop() {
 	h.stopChan <- struct{}{}
 	<-h.doneStoppingChan
 }
 
 func (h *workerPoolHeartbeater) loop() {
-	h.startedAt = nowEpochSeconds()
 	h.heartbeat() // do it right away
 	ticker := time.Tick(h.beatPeriod)
 	for {
@@ -90,7 +114,9 @@ func (h *workerPoolHeartbeater) loop() {
 			h.doneStoppingChan <- struct{}{}
 			return
 		case <-ticker:
-			h.heartbeat()
+			if h.failover.backoff() == 0 {
+				h.heartbeat()
+			}
 		}
 	}
 }
@@ -99,31 +125,39 @@ func (h *workerPoolHeartbeater) heartbeat() {
 	conn := h.pool.Get()
 	defer conn.Close()
 
-	workerPoolsKey := redisKeyWorkerPools(h.namespace)
-	heartbeatKey := redisKeyHeartbeat(h.namespace, h.workerPoolID)
+	workerPoolsKey := redisKeyWorkerPools(h.keys)
+	heartbeatKey := redisKeyHeartbeat(h.keys, h.workerPoolID)
+
+	h.mtx.Lock()
+	concurrency, workerIDs := h.concurrency, h.workerIDs
+	h.mtx.Unlock()
 
 	conn.Send("SADD", workerPoolsKey, h.workerPoolID)
 	conn.Send("HMSET", heartbeatKey,
-		"heartbeat_at", nowEpochSeconds(),
+		"heartbeat_at", h.clock.Now().Unix(),
 		"started_at", h.startedAt,
 		"job_names", h.jobNames,
-		"concurrency", h.concurrency,
-		"worker_ids", h.workerIDs,
+		"concurrency", concurrency,
+		"worker_ids", workerIDs,
 		"host", h.hostname,
 		"pid", h.pid,
 	)
 
 	if err := conn.Flush(); err != nil {
+		h.failover.failed(err)
 		h.logger.Error("heartbeat", errAttr(err))
+		return
 	}
+
+	h.lastHeartbeatAt.Store(h.clock.Now().UnixNano())
 }
 
 func (h *workerPoolHeartbeater) removeHeartbeat() {
 	conn := h.pool.Get()
 	defer conn.Close()
 
-	workerPoolsKey := redisKeyWorkerPools(h.namespace)
-	heartbeatKey := redisKeyHeartbeat(h.namespace, h.workerPoolID)
+	workerPoolsKey := redisKeyWorkerPools(h.keys)
+	heartbeatKey := redisKeyHeartbeat(h.keys, h.workerPoolID)
 
 	conn.Send("SREM", workerPoolsKey, h.workerPoolID)
 	conn.Send("DEL", heartbeatKey)
@@ -21,14 +21,14 @@ func TestHeartbeater(t *testing.T) {
 		"bar": nil,
 	}
 
-	heart := newWorkerPoolHeartbeater(ns, pool, "abcd", jobTypes, 10, []string{"ccc", "bbb"}, noopLogger)
+	heart := newWorkerPoolHeartbeater(newKeyspace(ns), pool, "abcd", jobTypes, 10, []string{"ccc", "bbb"}, noopLogger)
 	heart.start()
 
 	time.Sleep(20 * time.Millisecond)
 
-	assert.True(t, redisInSet(pool, redisKeyWorkerPools(ns), "abcd"))
+	assert.True(t, redisInSet(pool, redisKeyWorkerPools(newKeyspace(ns)), "abcd"))
 
-	h := readHash(pool, redisKeyHeartbeat(ns, "abcd"))
+	h := readHash(pool, redisKeyHeartbeat(newKeyspace(ns), "abcd"))
 	assert.Equal(t, "1425263409", h["heartbeat_at"])
 	assert.Equal(t, "1425263409", h["started_at"])
 	assert.Equal(t, "bar,foo", h["job_names"])
@@ -40,7 +40,7 @@ func TestHeartbeater(t *testing.T) {
 
 	heart.stop()
 
-	assert.False(t, redisInSet(pool, redisKeyWorkerPools(ns), "abcd"))
+	assert.False(t, redisInSet(pool, redisKeyWorkerPools(newKeyspace(ns)), "abcd"))
 }
 
 func redisInSet(pool *redis.Pool, key, member string) bool {
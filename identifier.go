@@ -2,13 +2,19 @@ package work
 
 import (
 	"crypto/rand"
+	"encoding/binary"
 	"fmt"
 	"io"
+	"time"
 )
 
+// makeIdentifier returns a random identifier that sorts by creation time, like a UUIDv7 without dashes:
+// 48 bits of Unix time in milliseconds followed by 80 random bits, hex encoded.
 func makeIdentifier() string {
-	b := make([]byte, 12)
-	_, err := io.ReadFull(rand.Reader, b)
+	b := make([]byte, 16)
+	binary.BigEndian.PutUint64(b, uint64(time.Now().UnixMilli())<<16)
+
+	_, err := io.ReadFull(rand.Reader, b[6:])
 	if err != nil {
 		return ""
 	}
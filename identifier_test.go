@@ -1,6 +1,9 @@
 package work
 
-import "testing"
+import (
+	"testing"
+	"time"
+)
 
 func TestMakeIdentifier(t *testing.T) {
 	id := makeIdentifier()
@@ -8,3 +11,22 @@ func TestMakeIdentifier(t *testing.T) {
 		t.Errorf("expected a string of length 10 at least")
 	}
 }
+
+func TestMakeIdentifierSortable(t *testing.T) {
+	prev := makeIdentifier()
+	time.Sleep(2 * time.Millisecond)
+
+	seen := map[string]bool{prev: true}
+	for i := 0; i < 1000; i++ {
+		id := makeIdentifier()
+		if seen[id] {
+			t.Fatalf("duplicate identifier %s", id)
+		}
+		seen[id] = true
+	}
+
+	time.Sleep(2 * time.Millisecond)
+	if next := makeIdentifier(); next <= prev {
+		t.Errorf("expected %s to sort after %s", next, prev)
+	}
+}
@@ -0,0 +1,124 @@
+package work
+
+import (
+	"log/slog"
+	"sort"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// inProgressSweeperMaxPeriod caps how long a job can stay in progress after its lease expired.
+const inProgressSweeperMaxPeriod = time.Minute
+
+// inProgressSweeper requeues the jobs of its pool which are still in progress after their lease expired, see
+// WithInProgressLeases. Unlike the reaper, it doesn't wait for the pool to die, so it recovers the jobs of
+// wedged workers.
+type inProgressSweeper struct {
+	keys         keyspace
+	pool         Pool
+	workerPoolID string
+	jobNames     []string
+	period       time.Duration
+
+	sweepScript *redis.Script
+
+	stopChan         chan struct{}
+	doneStoppingChan chan struct{}
+
+	failover *failoverState // shared with the other loops of the pool
+	clock    Clock
+	logger   StructuredLogger
+}
+
+func newInProgressSweeper(
+	keys keyspace,
+	pool Pool,
+	workerPoolID string,
+	jobNames []string,
+	leaseTTL time.Duration,
+	logger StructuredLogger,
+) *inProgressSweeper {
+	jobNames = append([]string(nil), jobNames...)
+	sort.Strings(jobNames)
+
+	period := leaseTTL / 4
+	if period > inProgressSweeperMaxPeriod {
+		period = inProgressSweeperMaxPeriod
+	}
+
+	return &inProgressSweeper{
+		keys:         keys,
+		pool:         pool,
+		workerPoolID: workerPoolID,
+		jobNames:     jobNames,
+		period:       period,
+
+		sweepScript: redis.NewScript(8, redisLuaSweepInProgressLeases),
+
+		stopChan:         make(chan struct{}),
+		doneStoppingChan: make(chan struct{}),
+
+		clock:  defaultClock,
+		logger: logger,
+	}
+}
+
+func (s *inProgressSweeper) start() {
+	go s.loop()
+}
+
+func (s *inProgressSweeper) stop() {
+	s.stopChan <- struct{}{}
+	<-s.doneStoppingChan
+}
+
+func (s *inProgressSweeper) loop() {
+	ticker := time.NewTicker(s.period)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stopChan:
+			s.doneStoppingChan <- struct{}{}
+			return
+		case <-ticker.C:
+			if s.failover.backoff() == 0 {
+				s.sweep()
+			}
+		}
+	}
+}
+
+// sweep requeues the jobs of all the job types of the pool whose lease expired.
+func (s *inProgressSweeper) sweep() {
+	conn := s.pool.Get()
+	defer conn.Close()
+
+	now := s.clock.Now()
+	for _, jobName := range s.jobNames {
+		counts, err := redis.Int64s(s.sweepScript.Do(conn,
+			redisKeyJobsInProgressLeases(s.keys, s.workerPoolID, jobName),
+			redisKeyJobsInProgress(s.keys, s.workerPoolID, jobName),
+			redisKeyJobs(s.keys, jobName),
+			redisKeyJobsLock(s.keys, jobName),
+			redisKeyJobsLockInfo(s.keys, jobName),
+			redisKeyJobsAtMostOnce(s.keys, jobName),
+			redisKeyJobsStrictFIFO(s.keys, jobName),
+			redisKeyDead(s.keys),
+			s.workerPoolID,
+			now.UnixMilli(),
+			now.Unix(),
+		))
+		if err != nil {
+			s.failover.failed(err)
+			s.logger.Error("in_progress_sweeper.sweep", slog.String("job_name", jobName), errAttr(err))
+			continue
+		}
+
+		if counts[0] > 0 || counts[1] > 0 {
+			s.logger.Warn("in_progress_sweeper.lease_expired", slog.String("job_name", jobName),
+				slog.Int64("requeued", counts[0]), slog.Int64("dead", counts[1]))
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package work
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInProgressSweeper(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work"
+	cleanKeyspace(ns, pool)
+
+	jobTypes := map[string]*jobType{
+		"wat": {Name: "wat", JobOptions: JobOptions{Priority: 1, MaxConcurrency: 1}, isGeneric: true, genericHandler: func(*Job) error { return nil }},
+		"foo": {Name: "foo", JobOptions: JobOptions{Priority: 1}, isGeneric: true, genericHandler: func(*Job) error { return nil }},
+	}
+	conn := pool.Get()
+	defer conn.Close()
+	_, err := conn.Do("SET", redisKeyJobsConcurrency(newKeyspace(ns), "wat"), 1)
+	require.NoError(t, err)
+	_, err = conn.Do("SET", redisKeyJobsAtMostOnce(newKeyspace(ns), "foo"), 1)
+	require.NoError(t, err)
+
+	enqueuer := NewEnqueuer(ns, pool)
+	_, err = enqueuer.Enqueue("wat", Q{"a": 1})
+	require.NoError(t, err)
+	_, err = enqueuer.Enqueue("foo", nil)
+	require.NoError(t, err)
+
+	clock := &fakeClock{now: time.Unix(1425263409, 0)}
+	w := newWorker(newKeyspace(ns), "1", pool, tstCtxType, nil, jobTypes, noopLogger, nil,
+		workerWithClock(clock), workerWithInProgressLeases(time.Minute))
+	wedged := make(map[string]*Job)
+	for i := 0; i < 2; i++ {
+		job, err := w.fetchJob(w.fetchSamples())
+		require.NoError(t, err)
+		require.NotNil(t, job)
+		wedged[job.Name] = job
+	}
+
+	leases := redisKeyJobsInProgressLeases(newKeyspace(ns), "1", "wat")
+	score, err := redis.Int64(conn.Do("ZSCORE", leases, wedged["wat"].rawJSON))
+	assert.NoError(t, err)
+	assert.Equal(t, clock.Now().Add(time.Minute).UnixMilli(), score)
+
+	s := newInProgressSweeper(newKeyspace(ns), pool, "1", []string{"wat", "foo"}, time.Minute, noopLogger)
+	s.clock = clock
+	clock.Advance(30 * time.Second)
+	s.sweep()
+	assert.EqualValues(t, 1, listSize(pool, redisKeyJobsInProgress(newKeyspace(ns), "1", "wat")))
+	assert.EqualValues(t, 1, getInt64(pool, redisKeyJobsLock(newKeyspace(ns), "wat")))
+
+	// The expired jobs are requeued and their locks released, even though the pool is alive.
+	clock.Advance(31 * time.Second)
+	s.sweep()
+	assert.EqualValues(t, 0, listSize(pool, redisKeyJobsInProgress(newKeyspace(ns), "1", "wat")))
+	assert.EqualValues(t, 0, getInt64(pool, redisKeyJobsLock(newKeyspace(ns), "wat")))
+	assert.False(t, keyExists(pool, leases))
+	assert.EqualValues(t, 1, listSize(pool, redisKeyJobs(newKeyspace(ns), "wat")))
+
+	// The at most once job may have run already, so it's dead instead.
+	assert.EqualValues(t, 0, listSize(pool, redisKeyJobs(newKeyspace(ns), "foo")))
+	_, dead := jobOnZset(pool, redisKeyDead(newKeyspace(ns)))
+	assert.Equal(t, wedged["foo"].ID, dead.ID)
+	assert.EqualValues(t, 1, dead.Fails)
+
+	// The lease of the job fetched again is removed with it, and the late end of the wedged run changes nothing.
+	job, err := w.fetchJob(w.fetchSamples())
+	require.NoError(t, err)
+	require.NotNil(t, job)
+	assert.Equal(t, wedged["wat"].ID, job.ID)
+	assert.EqualValues(t, 1, zsetSize(pool, leases))
+
+	_, err = w.removeJobFromInProgress(job, jobTypes["wat"], nil, true, noopLogger)
+	assert.NoError(t, err)
+	_, err = w.removeJobFromInProgress(wedged["wat"], jobTypes["wat"], nil, true, noopLogger)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 0, zsetSize(pool, leases))
+	assert.EqualValues(t, 0, getInt64(pool, redisKeyJobsLock(newKeyspace(ns), "wat")))
+	assert.EqualValues(t, 0, listSize(pool, redisKeyJobsInProgress(newKeyspace(ns), "1", "wat")))
+}
@@ -1,11 +1,14 @@
 package work
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"math"
 	"reflect"
+	"time"
 
 	"go.opentelemetry.io/otel/propagation"
 	"go.opentelemetry.io/otel/trace"
@@ -19,43 +22,143 @@ type Job struct {
 	EnqueuedAt int64                  `json:"t"`
 	Args       map[string]interface{} `json:"args"`
 	Unique     bool                   `json:"unique,omitempty"`
+	UniqueKey  string                 `json:"unique_key,omitempty"` // set if the job was enqueued with an explicit unique key
 
 	// Inputs when retrying
 	Fails    int64  `json:"fails,omitempty"` // number of times this job has failed
 	LastErr  string `json:"err,omitempty"`
 	FailedAt int64  `json:"failed_at,omitempty"`
 
-	// StartingDeadline is used to skip periodic jobs that are no longer relevant.
+	// LastErrRecovered is set if LastErr is the value of a recovered panic.
+	LastErrRecovered bool `json:"err_recovered,omitempty"`
+
+	// Attempts is the number of times the handler has been run, including the inline retries (see JobOptions.InlineRetries).
+	Attempts int64 `json:"attempts,omitempty"`
+
+	// FirstEnqueuedAt is the EnqueuedAt of the first attempt. It's set when the job fails since EnqueuedAt
+	// is updated every time the job is retried.
+	FirstEnqueuedAt int64 `json:"first_t,omitempty"`
+
+	// StartingDeadline is the epoch time after which the job is no longer relevant and is skipped instead of being run.
+	// It's set for periodic jobs and for jobs enqueued with EnqueueWithDeadline.
 	StartingDeadline int64 `json:"d,omitempty"`
 
+	// ExpiresAt is the epoch time after which the job is discarded silently instead of being run, see
+	// EnqueueWithTTL. Unlike the jobs past their StartingDeadline, the expired jobs aren't passed to any hook.
+	ExpiresAt int64 `json:"expires_at,omitempty"`
+
 	// TraceContext contains the OpenTelemetry trace context to propagate the context.
 	TraceContext map[string]string `json:"trace,omitempty"`
 
+	// History records the previous deaths of the job, oldest first. It's only kept by Client.RequeueDeadJobKeepingHistory.
+	History []JobDeath `json:"history,omitempty"`
+
 	rawJSON      []byte
 	dequeuedFrom []byte
 	inProgQueue  []byte
 	argError     error
 	observer     *observer
+	codec        ArgsCodec // encodes Args if set
+	encodedArgs  []byte    // Args encoded with a codec which this job wasn't decoded with
+	startedAt    time.Time // when the worker started processing the job
+	result       interface{}
+	hasResult    bool
+	rescheduled  bool          // see Reschedule
+	rescheduleIn time.Duration // see Reschedule
+}
+
+// JobDeath is a previous death of a job which was requeued from the dead queue.
+type JobDeath struct {
+	DiedAt int64  `json:"died_at"`
+	Fails  int64  `json:"fails,omitempty"`
+	Err    string `json:"err,omitempty"`
+}
+
+// ArgsCodec encodes and decodes the arguments of jobs. It can be used to preserve the types that
+// don't survive a round trip through JSON, like time.Time or []byte. The job itself is still stored
+// as JSON, with the encoded arguments in a separate field. All the enqueuers, worker pools and
+// clients sharing a namespace must use the same codec. The keys of unique jobs are built from
+// the encoded arguments, so Marshal must be deterministic for them to be deduplicated.
+type ArgsCodec interface {
+	Marshal(args map[string]interface{}) ([]byte, error)
+	Unmarshal(data []byte) (map[string]interface{}, error)
+}
+
+// jobJSON is the alias of Job without its methods, used to customize the serialization.
+type jobJSON Job
+
+// encodedJob is the JSON representation of a job with arguments encoded with an ArgsCodec.
+type encodedJob struct {
+	*jobJSON
+	Args        jobArgs `json:"args,omitempty"` // hides jobJSON.Args
+	EncodedArgs []byte  `json:"args_enc,omitempty"`
+}
+
+// jobArgs are the arguments of a job read from JSON. Lua's cjson may encode an empty table as an empty array, so
+// the empty args of a job rewritten by a script, e.g. one enqueued by gocraft/work with Q{}, can be an empty
+// array, which is read as empty args.
+type jobArgs map[string]interface{}
+
+func (a *jobArgs) UnmarshalJSON(data []byte) error {
+	if string(bytes.TrimSpace(data)) == "[]" {
+		*a = jobArgs{}
+		return nil
+	}
+
+	return json.Unmarshal(data, (*map[string]interface{})(a))
 }
 
 // Q is a shortcut to easily specify arguments for jobs when enqueueing them.
 // Example: e.Enqueue("send_email", work.Q{"addr": "test@example.com", "track": true})
 type Q map[string]interface{}
 
-func newJob(rawJSON, dequeuedFrom, inProgQueue []byte) (*Job, error) {
+func newJob(rawJSON, dequeuedFrom, inProgQueue []byte, codec ArgsCodec) (*Job, error) {
 	var job Job
-	err := json.Unmarshal(rawJSON, &job)
+	enc := encodedJob{jobJSON: (*jobJSON)(&job)}
+	err := json.Unmarshal(rawJSON, &enc)
 	if err != nil {
 		return nil, err
 	}
+	job.Args = map[string]interface{}(enc.Args)
+
+	if len(enc.EncodedArgs) > 0 {
+		if codec == nil {
+			// Keep the args as is, so that they aren't lost if the job is serialized again.
+			job.encodedArgs = enc.EncodedArgs
+		} else if job.Args, err = codec.Unmarshal(enc.EncodedArgs); err != nil {
+			return nil, err
+		}
+	}
+
 	job.rawJSON = rawJSON
 	job.dequeuedFrom = dequeuedFrom
 	job.inProgQueue = inProgQueue
+	job.codec = codec
 	return &job, nil
 }
 
 func (j *Job) serialize() ([]byte, error) {
-	return json.Marshal(j)
+	if j.codec == nil && j.encodedArgs == nil {
+		return json.Marshal(j)
+	}
+
+	enc := encodedJob{jobJSON: (*jobJSON)(j), EncodedArgs: j.encodedArgs}
+	if j.codec != nil {
+		var err error
+		if enc.EncodedArgs, err = j.codec.Marshal(j.Args); err != nil {
+			return nil, err
+		}
+	}
+
+	return json.Marshal(enc)
+}
+
+// uniqueKey returns the Redis key used to enforce the uniqueness of the job.
+func (j *Job) uniqueKey(keys keyspace) (string, error) {
+	if j.UniqueKey != "" {
+		return redisKeyUniqueJobByKey(keys, j.Name, j.UniqueKey), nil
+	}
+	return redisKeyUniqueJob(keys, j.Name, j.Args, j.codec)
 }
 
 // setArg sets a single named argument on the job.
@@ -66,19 +169,109 @@ func (j *Job) setArg(key string, val interface{}) {
 	j.Args[key] = val
 }
 
-func (j *Job) failed(err error) {
+// EnqueuedTime returns EnqueuedAt as a time. It's the time of the last enqueue of the job, e.g. of its last retry,
+// see FirstEnqueuedAt for the first one.
+func (j *Job) EnqueuedTime() time.Time {
+	return time.Unix(j.EnqueuedAt, 0)
+}
+
+// StartedTime returns when the worker started processing the job, before the middleware runs. It's zero for the
+// jobs which aren't being processed, like the ones returned by Client.
+func (j *Job) StartedTime() time.Time {
+	return j.startedAt
+}
+
+// QueueWait returns how long the job waited in its queue before being processed, from its last enqueue until
+// StartedTime, e.g. to report the queue latency from a middleware. It's zero if the job isn't being processed.
+// EnqueuedAt has a one second resolution.
+func (j *Job) QueueWait() time.Duration {
+	if j.startedAt.IsZero() {
+		return 0
+	}
+
+	return j.startedAt.Sub(j.EnqueuedTime())
+}
+
+// ttlExpired reports whether the job has outlived its TTL at now, see EnqueueWithTTL.
+func (j *Job) ttlExpired(now int64) bool {
+	return j.ExpiresAt != 0 && now > j.ExpiresAt
+}
+
+// expired reports whether the job has missed its deadline at now. maxWait is the Deadline
+// of the job type, which limits the time the job can wait in the queue after being enqueued.
+func (j *Job) expired(now int64, maxWait time.Duration) bool {
+	if j.StartingDeadline != 0 && now > j.StartingDeadline {
+		return true
+	}
+
+	return maxWait > 0 && now > j.EnqueuedAt+int64(maxWait/time.Second)
+}
+
+func (j *Job) failed(err error, now int64) {
+	if j.FirstEnqueuedAt == 0 {
+		j.FirstEnqueuedAt = j.EnqueuedAt
+	}
 	j.Fails++
 	j.LastErr = err.Error()
-	j.FailedAt = nowEpochSeconds()
+	j.FailedAt = now
+
+	var jobErr *JobError
+	j.LastErrRecovered = errors.As(err, &jobErr) && jobErr.Recovered
+}
+
+// LastError returns the last error of a failed job as a *JobError, or nil if the job hasn't failed.
+// Only the message of the underlying error is kept once the job is stored in Redis.
+func (j *Job) LastError() error {
+	if j.LastErr == "" {
+		return nil
+	}
+
+	return &JobError{
+		JobName:   j.Name,
+		JobID:     j.ID,
+		Fails:     j.Fails - 1,
+		Recovered: j.LastErrRecovered,
+		Err:       errors.New(j.LastErr),
+	}
 }
 
 // Checkin will update the status of the executing job to the specified messages. This message is visible within the web UI. This is useful for indicating some sort of progress on very long running jobs. For instance, on a job that has to process a million records over the course of an hour, the job could call Checkin with the current job number every 10k jobs.
 func (j *Job) Checkin(msg string) {
 	if j.observer != nil {
-		j.observer.observeCheckin(j.Name, j.ID, msg)
+		j.observer.observeCheckin(j.Name, j.ID, msg, nil)
 	}
 }
 
+// SetResult sets the result of the job. If the handler succeeds, the result is stored as JSON for the time set with
+// WithJobResultTTL, and it can be read with Client.JobResult. Results aren't stored for jobs which don't set one.
+func (j *Job) SetResult(v interface{}) {
+	j.result = v
+	j.hasResult = true
+}
+
+// Reschedule makes the worker move the job to the scheduled queue to run again in the given duration once the
+// handler returns nil, e.g. when a dependency of the job isn't ready yet, instead of marking it as done. It doesn't
+// count as a failure: the fails of the job and its backoff are left alone. Calling it again replaces the delay.
+// It has no effect if the handler returns an error, including ErrSkipJob. The delay has a one second resolution.
+func (j *Job) Reschedule(in time.Duration) {
+	j.rescheduled = true
+	j.rescheduleIn = in
+}
+
+// CheckinWithProgress is like Checkin, but also reports the progress of the job as a percentage from 0 to 100,
+// so that a UI can render a progress bar. It returns an error if percent is out of range.
+func (j *Job) CheckinWithProgress(msg string, percent float64) error {
+	if !(percent >= 0 && percent <= 100) {
+		return fmt.Errorf("work: checkin progress %v is out of range [0, 100]", percent)
+	}
+
+	if j.observer != nil {
+		j.observer.observeCheckin(j.Name, j.ID, msg, &percent)
+	}
+
+	return nil
+}
+
 // ArgString returns j.Args[key] typed to a string. If the key is missing or of the wrong type, it sets an argument error
 // on the job. This function is meant to be used in the body of a job handling function while extracting arguments,
 // followed by a single call to j.ArgError().
@@ -182,14 +375,10 @@ func (j *Job) injectTraceContext(ctx context.Context) {
 	j.TraceContext = carrier
 }
 
-// extractTraceContext returns a context with a trace context. It uses the default
+// extractTraceContext returns a context with a trace context, see ExtractTraceContext. It uses the default
 // W3C propagator.
 func (j *Job) extractTraceContext(ctx context.Context) context.Context {
-	if j.TraceContext == nil {
-		return ctx
-	}
-
-	return propagation.TraceContext{}.Extract(ctx, propagation.MapCarrier(j.TraceContext))
+	return ExtractTraceContext(ctx, j)
 }
 
 func isIntKind(v reflect.Value) bool {
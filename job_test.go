@@ -1,10 +1,14 @@
 package work
 
 import (
+	"bytes"
+	"encoding/gob"
 	"math"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestJobArgumentExtraction(t *testing.T) {
@@ -254,3 +258,123 @@ func TestJobArgumentExtractionBadFloat(t *testing.T) {
 		j.argError = nil
 	}
 }
+
+type gobArgsCodec struct{}
+
+func (gobArgsCodec) Marshal(args map[string]interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	err := gob.NewEncoder(&buf).Encode(args)
+	return buf.Bytes(), err
+}
+
+func (gobArgsCodec) Unmarshal(data []byte) (map[string]interface{}, error) {
+	var args map[string]interface{}
+	err := gob.NewDecoder(bytes.NewReader(data)).Decode(&args)
+	return args, err
+}
+
+func init() {
+	gob.Register(time.Time{})
+}
+
+func TestJobArgsCodec(t *testing.T) {
+	at := time.Date(2024, 3, 1, 12, 30, 15, 123456789, time.UTC)
+	j := &Job{
+		Name:  "foo",
+		ID:    "1",
+		Args:  map[string]interface{}{"at": at, "raw": []byte{0, 1, 2}},
+		Fails: 2,
+		codec: gobArgsCodec{},
+	}
+
+	rawJSON, err := j.serialize()
+	assert.NoError(t, err)
+	assert.NotContains(t, string(rawJSON), `"args"`)
+	assert.Contains(t, string(rawJSON), `"args_enc"`)
+
+	decoded, err := newJob(rawJSON, nil, nil, gobArgsCodec{})
+	assert.NoError(t, err)
+	assert.Equal(t, "foo", decoded.Name)
+	assert.EqualValues(t, 2, decoded.Fails)
+	assert.Equal(t, at, decoded.Args["at"])
+	assert.Equal(t, []byte{0, 1, 2}, decoded.Args["raw"])
+
+	// Without the codec the args aren't decoded, but they survive serialization.
+	opaque, err := newJob(rawJSON, nil, nil, nil)
+	assert.NoError(t, err)
+	assert.Nil(t, opaque.Args)
+	opaque.Fails++
+	rawJSON, err = opaque.serialize()
+	assert.NoError(t, err)
+
+	decoded, err = newJob(rawJSON, nil, nil, gobArgsCodec{})
+	assert.NoError(t, err)
+	assert.EqualValues(t, 3, decoded.Fails)
+	assert.Equal(t, at, decoded.Args["at"])
+
+	// Jobs serialized without a codec are decoded as usual.
+	plain, err := (&Job{Name: "foo", Args: map[string]interface{}{"a": "b"}}).serialize()
+	assert.NoError(t, err)
+	decoded, err = newJob(plain, nil, nil, gobArgsCodec{})
+	assert.NoError(t, err)
+	assert.Equal(t, "b", decoded.ArgString("a"))
+}
+
+func TestJobQueueWait(t *testing.T) {
+	j := &Job{EnqueuedAt: 1425263409}
+	assert.Equal(t, time.Unix(1425263409, 0), j.EnqueuedTime())
+	assert.True(t, j.StartedTime().IsZero())
+	assert.Equal(t, time.Duration(0), j.QueueWait())
+
+	j.startedAt = time.Unix(1425263412, 500)
+	assert.Equal(t, 3*time.Second+500, j.QueueWait())
+}
+
+// gocraftJobs are jobs as written to Redis by github.com/gocraft/work v0.5.1, the upstream of this fork, which
+// doesn't know the fields added since, like "d" or "attempts".
+var gocraftJobs = map[string]string{
+	"queued":    `{"name":"send_email","id":"5a3bd2ba1e6b6f8ebe1ac1f2","t":1425263409,"args":{"address":"test@example.com","customer_id":4}}`,
+	"nil_args":  `{"name":"send_email","id":"5a3bd2ba1e6b6f8ebe1ac1f3","t":1425263409,"args":null}`,
+	"unique":    `{"name":"send_email","id":"5a3bd2ba1e6b6f8ebe1ac1f4","t":1425263409,"args":{"address":"u@example.com"},"unique":true}`,
+	"retry":     `{"name":"send_email","id":"5a3bd2ba1e6b6f8ebe1ac1f5","t":1425263409,"args":{},"fails":1,"err":"smtp: i/o timeout","failed_at":1425263410}`,
+	"dead":      `{"name":"send_email","id":"5a3bd2ba1e6b6f8ebe1ac1f6","t":1425263409,"args":{"customer_id":5},"fails":4,"err":"smtp: i/o timeout","failed_at":1425263420}`,
+	"scheduled": `{"name":"send_email","id":"5a3bd2ba1e6b6f8ebe1ac1f7","t":1425263409,"args":{"customer_id":6}}`,
+}
+
+func TestNewJobGocraftCompat(t *testing.T) {
+	for name, rawJSON := range gocraftJobs {
+		job, err := newJob([]byte(rawJSON), nil, nil, nil)
+		require.NoError(t, err, name)
+		assert.Equal(t, "send_email", job.Name, name)
+		assert.EqualValues(t, 1425263409, job.EnqueuedAt, name)
+		assert.Zero(t, job.StartingDeadline, name)
+		assert.Zero(t, job.Attempts, name)
+		assert.Nil(t, job.History, name)
+
+		// Serializing the job again keeps its fields.
+		b, err := job.serialize()
+		require.NoError(t, err, name)
+		again, err := newJob(b, nil, nil, nil)
+		require.NoError(t, err, name)
+		assert.Equal(t, job.ID, again.ID, name)
+		assert.Equal(t, job.Args, again.Args, name)
+		assert.Equal(t, job.Fails, again.Fails, name)
+	}
+
+	job, err := newJob([]byte(gocraftJobs["queued"]), nil, nil, nil)
+	require.NoError(t, err)
+	assert.EqualValues(t, 4, job.ArgInt64("customer_id"))
+	assert.NoError(t, job.ArgError())
+
+	job, err = newJob([]byte(gocraftJobs["retry"]), nil, nil, nil)
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, job.Fails)
+	assert.Equal(t, "smtp: i/o timeout", job.LastErr)
+	assert.EqualValues(t, 1425263410, job.FailedAt)
+	assert.NotNil(t, job.LastError())
+
+	// The empty args of a job rewritten by a script may be encoded as an empty array.
+	job, err = newJob([]byte(`{"name":"send_email","id":"1","t":1425263409,"args":[]}`), nil, nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{}, job.Args)
+}
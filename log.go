@@ -37,3 +37,47 @@ var noopLogger = slog.New(slog.NewTextHandler(io.Discard, nil))
 func errAttr(e error) slog.Attr {
 	return slog.Any("error", e)
 }
+
+// jobLogger adds attributes to the logs of a job, see WithJobLogFields.
+type jobLogger struct {
+	StructuredLogger
+	attrs []any
+}
+
+func newJobLogger(logger StructuredLogger, attrs []slog.Attr) StructuredLogger {
+	if len(attrs) == 0 {
+		return logger
+	}
+
+	l := jobLogger{StructuredLogger: logger, attrs: make([]any, 0, len(attrs))}
+	for _, a := range attrs {
+		l.attrs = append(l.attrs, a)
+	}
+
+	return l
+}
+
+func (l jobLogger) with(args []any) []any {
+	return append(args[:len(args):len(args)], l.attrs...)
+}
+
+func (l jobLogger) Error(msg string, args ...any) { l.StructuredLogger.Error(msg, l.with(args)...) }
+func (l jobLogger) Warn(msg string, args ...any)  { l.StructuredLogger.Warn(msg, l.with(args)...) }
+func (l jobLogger) Info(msg string, args ...any)  { l.StructuredLogger.Info(msg, l.with(args)...) }
+func (l jobLogger) Debug(msg string, args ...any) { l.StructuredLogger.Debug(msg, l.with(args)...) }
+
+func (l jobLogger) ErrorContext(ctx context.Context, msg string, args ...any) {
+	l.StructuredLogger.ErrorContext(ctx, msg, l.with(args)...)
+}
+
+func (l jobLogger) WarnContext(ctx context.Context, msg string, args ...any) {
+	l.StructuredLogger.WarnContext(ctx, msg, l.with(args)...)
+}
+
+func (l jobLogger) InfoContext(ctx context.Context, msg string, args ...any) {
+	l.StructuredLogger.InfoContext(ctx, msg, l.with(args)...)
+}
+
+func (l jobLogger) DebugContext(ctx context.Context, msg string, args ...any) {
+	l.StructuredLogger.DebugContext(ctx, msg, l.with(args)...)
+}
@@ -0,0 +1,38 @@
+package work
+
+import "time"
+
+// MetricsReporter receives metrics about processed jobs and queues. It can be
+// used to export them to a monitoring system like Prometheus.
+// Implementations must be safe for concurrent use.
+type MetricsReporter interface {
+	// JobStarted is called when a worker starts processing a job.
+	JobStarted(name string)
+	// JobCompleted is called when a handler returns. err is the handler's
+	// error or nil on success.
+	JobCompleted(name string, d time.Duration, err error)
+	// JobRetried is called when a failed job is scheduled for retry.
+	JobRetried(name string)
+	// JobDied is called when a failed job is moved to the dead queue.
+	JobDied(name string)
+	// QueueDepth reports the number of jobs waiting in the job queue.
+	QueueDepth(name string, n int64)
+}
+
+type noopMetricsReporter struct{}
+
+func (noopMetricsReporter) JobStarted(string)                         {}
+func (noopMetricsReporter) JobCompleted(string, time.Duration, error) {}
+func (noopMetricsReporter) JobRetried(string)                         {}
+func (noopMetricsReporter) JobDied(string)                            {}
+func (noopMetricsReporter) QueueDepth(string, int64)                  {}
+
+var noopMetrics MetricsReporter = noopMetricsReporter{}
+
+// LockFixReporter can be implemented by a MetricsReporter to count the concurrency locks fixed by the reaper,
+// see ReapResult.FixedLocks. The locks only drift because of a bug or jobs lost without releasing their lock,
+// so the fixes are worth an alert.
+type LockFixReporter interface {
+	// LockFixed is called when the reaper changes the lock of the job type by delta to fix it.
+	LockFixed(name string, delta int64)
+}
@@ -0,0 +1,122 @@
+package work
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testMetricsReporter struct {
+	mu        sync.Mutex
+	started   map[string]int
+	completed map[string]int
+	failed    map[string]int
+	retried   map[string]int
+	died      map[string]int
+	depths    map[string]int64
+	locks     map[string]int64
+}
+
+func newTestMetricsReporter() *testMetricsReporter {
+	return &testMetricsReporter{
+		started:   make(map[string]int),
+		completed: make(map[string]int),
+		failed:    make(map[string]int),
+		retried:   make(map[string]int),
+		died:      make(map[string]int),
+		depths:    make(map[string]int64),
+		locks:     make(map[string]int64),
+	}
+}
+
+func (r *testMetricsReporter) JobStarted(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.started[name]++
+}
+
+func (r *testMetricsReporter) JobCompleted(name string, d time.Duration, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.completed[name]++
+	if err != nil {
+		r.failed[name]++
+	}
+}
+
+func (r *testMetricsReporter) JobRetried(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.retried[name]++
+}
+
+func (r *testMetricsReporter) JobDied(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.died[name]++
+}
+
+func (r *testMetricsReporter) QueueDepth(name string, n int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.depths[name] = n
+}
+
+func (r *testMetricsReporter) LockFixed(name string, delta int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.locks[name] += delta
+}
+
+func TestWorkerPoolMetrics(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work"
+	cleanKeyspace(ns, pool)
+
+	m := newTestMetricsReporter()
+
+	wp := NewWorkerPool(TestContext{}, 2, ns, pool, WithMetricsReporter(m))
+	wp.Job("ok", func(job *Job) error { return nil })
+	wp.JobWithOptions("retry", JobOptions{MaxFails: 2}, func(job *Job) error { return fmt.Errorf("retry") })
+	wp.JobWithOptions("die", JobOptions{MaxFails: 1}, func(job *Job) error { return fmt.Errorf("die") })
+
+	enqueuer := NewEnqueuer(ns, pool)
+	for _, name := range []string{"ok", "ok", "retry", "die"} {
+		_, err := enqueuer.Enqueue(name, nil)
+		assert.NoError(t, err)
+	}
+
+	wp.Start()
+	wp.Drain()
+	wp.Stop()
+
+	assert.Equal(t, map[string]int{"ok": 2, "retry": 1, "die": 1}, m.started)
+	assert.Equal(t, map[string]int{"ok": 2, "retry": 1, "die": 1}, m.completed)
+	assert.Equal(t, map[string]int{"retry": 1, "die": 1}, m.failed)
+	assert.Equal(t, map[string]int{"retry": 1}, m.retried)
+	assert.Equal(t, map[string]int{"die": 1}, m.died)
+}
+
+func TestRequeuerMetrics(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work"
+	cleanKeyspace(ns, pool)
+
+	enqueuer := NewEnqueuer(ns, pool)
+	_, err := enqueuer.EnqueueIn("wat", -1, nil)
+	assert.NoError(t, err)
+	_, err = enqueuer.EnqueueIn("wat", -1, nil)
+	assert.NoError(t, err)
+
+	m := newTestMetricsReporter()
+
+	re := newRequeuer(newKeyspace(ns), pool, redisKeyScheduled(newKeyspace(ns)), []string{"wat", "foo"}, m, noopLogger)
+	re.start()
+	re.drain()
+	re.stop()
+
+	assert.Equal(t, map[string]int64{"wat": 2, "foo": 0}, m.depths)
+}
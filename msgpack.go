@@ -0,0 +1,459 @@
+package work
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"time"
+)
+
+// MsgpackArgsCodec is an ArgsCodec encoding the arguments of jobs with MessagePack, which is more compact and
+// faster to decode than JSON for numeric and binary data, and preserves []byte and time.Time values. The job
+// itself stays a JSON envelope, since the Lua scripts read its routing fields like the name and the deadline,
+// so the encoded arguments are stored base64 encoded in it.
+//
+// It encodes the nil, boolean, numeric, string, []byte and time.Time values, and the pointers, slices, arrays
+// and string keyed maps of them. Map keys are sorted so that the encoding is deterministic, as required for
+// unique jobs. Integers are decoded as int64, or uint64 if they don't fit, floats as float64, arrays as
+// []interface{} and maps as map[string]interface{}.
+type MsgpackArgsCodec struct{}
+
+// Marshal encodes args with MessagePack.
+func (MsgpackArgsCodec) Marshal(args map[string]interface{}) ([]byte, error) {
+	var e msgpackEncoder
+	if err := e.encode(reflect.ValueOf(args)); err != nil {
+		return nil, err
+	}
+	return e.buf, nil
+}
+
+// Unmarshal decodes args encoded by Marshal.
+func (MsgpackArgsCodec) Unmarshal(data []byte) (map[string]interface{}, error) {
+	d := msgpackDecoder{buf: data}
+	v, err := d.decode()
+	if err != nil {
+		return nil, err
+	}
+	if d.pos != len(d.buf) {
+		return nil, errors.New("work: msgpack: trailing data")
+	}
+
+	switch args := v.(type) {
+	case nil:
+		return nil, nil
+	case map[string]interface{}:
+		return args, nil
+	default:
+		return nil, fmt.Errorf("work: msgpack: args are a %T, not a map", v)
+	}
+}
+
+// msgpackTimestampExt is the extension type of the timestamps of the MessagePack spec.
+const msgpackTimestampExt = -1
+
+// msgpackMaxDepth caps the nesting of the arrays, maps and pointers of the args, so that deeply nested or cyclic
+// args, or corrupted data, don't exhaust the stack of the encoder or of the decoder.
+const msgpackMaxDepth = 100
+
+var errMsgpackDepth = fmt.Errorf("work: msgpack: args nested deeper than %d levels", msgpackMaxDepth)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+type msgpackEncoder struct {
+	buf   []byte
+	depth int // of the arrays, maps and pointers being encoded
+}
+
+// nest enters an array, map or pointer, returning errMsgpackDepth if it's nested too deep. The returned func
+// leaves it.
+func (e *msgpackEncoder) nest() (func(), error) {
+	if e.depth >= msgpackMaxDepth {
+		return nil, errMsgpackDepth
+	}
+	e.depth++
+	return func() { e.depth-- }, nil
+}
+
+func (e *msgpackEncoder) encode(v reflect.Value) error {
+	if !v.IsValid() {
+		e.buf = append(e.buf, 0xc0)
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			e.buf = append(e.buf, 0xc0)
+			return nil
+		}
+		if v.Kind() == reflect.Ptr {
+			leave, err := e.nest()
+			if err != nil {
+				return err
+			}
+			defer leave()
+		}
+		return e.encode(v.Elem())
+	case reflect.Bool:
+		if v.Bool() {
+			e.buf = append(e.buf, 0xc3)
+		} else {
+			e.buf = append(e.buf, 0xc2)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		e.encodeInt(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		e.encodeUint(v.Uint())
+	case reflect.Float32:
+		e.buf = append(e.buf, 0xca)
+		e.buf = binary.BigEndian.AppendUint32(e.buf, math.Float32bits(float32(v.Float())))
+	case reflect.Float64:
+		e.buf = append(e.buf, 0xcb)
+		e.buf = binary.BigEndian.AppendUint64(e.buf, math.Float64bits(v.Float()))
+	case reflect.String:
+		e.encodeHeader(len(v.String()), 0xa0, 31, 0xd9, 0xda, 0xdb)
+		e.buf = append(e.buf, v.String()...)
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			e.buf = append(e.buf, 0xc0)
+			return nil
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			e.encodeHeader(v.Len(), 0, -1, 0xc4, 0xc5, 0xc6)
+			for i := 0; i < v.Len(); i++ {
+				e.buf = append(e.buf, byte(v.Index(i).Uint()))
+			}
+			return nil
+		}
+		leave, err := e.nest()
+		if err != nil {
+			return err
+		}
+		defer leave()
+
+		e.encodeHeader(v.Len(), 0x90, 15, 0, 0xdc, 0xdd)
+		for i := 0; i < v.Len(); i++ {
+			if err := e.encode(v.Index(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		if v.IsNil() {
+			e.buf = append(e.buf, 0xc0)
+			return nil
+		}
+		if v.Type().Key().Kind() != reflect.String {
+			return fmt.Errorf("work: msgpack: unsupported map key type %s", v.Type().Key())
+		}
+		leave, err := e.nest()
+		if err != nil {
+			return err
+		}
+		defer leave()
+
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+
+		e.encodeHeader(len(keys), 0x80, 15, 0, 0xde, 0xdf)
+		for _, k := range keys {
+			if err := e.encode(reflect.ValueOf(k.String())); err != nil {
+				return err
+			}
+			if err := e.encode(v.MapIndex(k)); err != nil {
+				return err
+			}
+		}
+	case reflect.Struct:
+		if v.Type() != timeType {
+			return fmt.Errorf("work: msgpack: unsupported type %s", v.Type())
+		}
+		e.encodeTime(v.Interface().(time.Time))
+	default:
+		return fmt.Errorf("work: msgpack: unsupported type %s", v.Type())
+	}
+
+	return nil
+}
+
+// encodeHeader appends the header of a string, binary, array or map of length n. The fix format is used up to
+// fixMax, then the formats with 8, 16 and 32 bits lengths. A zero format is skipped.
+func (e *msgpackEncoder) encodeHeader(n int, fix byte, fixMax int, f8, f16, f32 byte) {
+	switch {
+	case n <= fixMax:
+		e.buf = append(e.buf, fix|byte(n))
+	case n <= math.MaxUint8 && f8 != 0:
+		e.buf = append(e.buf, f8, byte(n))
+	case n <= math.MaxUint16:
+		e.buf = append(e.buf, f16)
+		e.buf = binary.BigEndian.AppendUint16(e.buf, uint16(n))
+	default:
+		e.buf = append(e.buf, f32)
+		e.buf = binary.BigEndian.AppendUint32(e.buf, uint32(n))
+	}
+}
+
+func (e *msgpackEncoder) encodeInt(n int64) {
+	switch {
+	case n >= 0:
+		e.encodeUint(uint64(n))
+	case n >= -32:
+		e.buf = append(e.buf, byte(n))
+	case n >= math.MinInt8:
+		e.buf = append(e.buf, 0xd0, byte(n))
+	case n >= math.MinInt16:
+		e.buf = append(e.buf, 0xd1)
+		e.buf = binary.BigEndian.AppendUint16(e.buf, uint16(n))
+	case n >= math.MinInt32:
+		e.buf = append(e.buf, 0xd2)
+		e.buf = binary.BigEndian.AppendUint32(e.buf, uint32(n))
+	default:
+		e.buf = append(e.buf, 0xd3)
+		e.buf = binary.BigEndian.AppendUint64(e.buf, uint64(n))
+	}
+}
+
+func (e *msgpackEncoder) encodeUint(n uint64) {
+	switch {
+	case n <= 0x7f:
+		e.buf = append(e.buf, byte(n))
+	case n <= math.MaxUint8:
+		e.buf = append(e.buf, 0xcc, byte(n))
+	case n <= math.MaxUint16:
+		e.buf = append(e.buf, 0xcd)
+		e.buf = binary.BigEndian.AppendUint16(e.buf, uint16(n))
+	case n <= math.MaxUint32:
+		e.buf = append(e.buf, 0xce)
+		e.buf = binary.BigEndian.AppendUint32(e.buf, uint32(n))
+	default:
+		e.buf = append(e.buf, 0xcf)
+		e.buf = binary.BigEndian.AppendUint64(e.buf, n)
+	}
+}
+
+// encodeTime appends t as a timestamp 96, which holds any time.Time. The location isn't kept.
+func (e *msgpackEncoder) encodeTime(t time.Time) {
+	e.buf = append(e.buf, 0xc7, 12, 0xff) // msgpackTimestampExt
+	e.buf = binary.BigEndian.AppendUint32(e.buf, uint32(t.Nanosecond()))
+	e.buf = binary.BigEndian.AppendUint64(e.buf, uint64(t.Unix()))
+}
+
+var errMsgpackShort = errors.New("work: msgpack: unexpected end of data")
+
+type msgpackDecoder struct {
+	buf   []byte
+	pos   int
+	depth int // of the arrays and maps being decoded
+}
+
+// nest enters an array or map, returning errMsgpackDepth if it's nested too deep. The returned func leaves it.
+func (d *msgpackDecoder) nest() (func(), error) {
+	if d.depth >= msgpackMaxDepth {
+		return nil, errMsgpackDepth
+	}
+	d.depth++
+	return func() { d.depth-- }, nil
+}
+
+func (d *msgpackDecoder) next(n int) ([]byte, error) {
+	if n < 0 || len(d.buf)-d.pos < n {
+		return nil, errMsgpackShort
+	}
+	b := d.buf[d.pos : d.pos+n]
+	d.pos += n
+	return b, nil
+}
+
+// uint reads a big endian unsigned integer of n bytes.
+func (d *msgpackDecoder) uint(n int) (uint64, error) {
+	b, err := d.next(n)
+	if err != nil {
+		return 0, err
+	}
+
+	var v uint64
+	for _, c := range b {
+		v = v<<8 | uint64(c)
+	}
+	return v, nil
+}
+
+func (d *msgpackDecoder) decode() (interface{}, error) {
+	b, err := d.next(1)
+	if err != nil {
+		return nil, err
+	}
+	c := b[0]
+
+	switch {
+	case c <= 0x7f:
+		return int64(c), nil
+	case c >= 0xe0:
+		return int64(int8(c)), nil
+	case c&0xf0 == 0x80:
+		return d.decodeMap(int(c & 0x0f))
+	case c&0xf0 == 0x90:
+		return d.decodeArray(int(c & 0x0f))
+	case c&0xe0 == 0xa0:
+		return d.decodeString(int(c & 0x1f))
+	}
+
+	switch c {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xc4, 0xc5, 0xc6:
+		n, err := d.uint(1 << (c - 0xc4))
+		if err != nil {
+			return nil, err
+		}
+		bin, err := d.next(int(n))
+		if err != nil {
+			return nil, err
+		}
+		return append([]byte{}, bin...), nil
+	case 0xc7, 0xc8, 0xc9:
+		n, err := d.uint(1 << (c - 0xc7))
+		if err != nil {
+			return nil, err
+		}
+		return d.decodeExt(int(n))
+	case 0xca:
+		n, err := d.uint(4)
+		return float64(math.Float32frombits(uint32(n))), err
+	case 0xcb:
+		n, err := d.uint(8)
+		return math.Float64frombits(n), err
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		n, err := d.uint(1 << (c - 0xcc))
+		if n > math.MaxInt64 {
+			return n, err
+		}
+		return int64(n), err
+	case 0xd0:
+		n, err := d.uint(1)
+		return int64(int8(n)), err
+	case 0xd1:
+		n, err := d.uint(2)
+		return int64(int16(n)), err
+	case 0xd2:
+		n, err := d.uint(4)
+		return int64(int32(n)), err
+	case 0xd3:
+		n, err := d.uint(8)
+		return int64(n), err
+	case 0xd4, 0xd5, 0xd6, 0xd7, 0xd8:
+		return d.decodeExt(1 << (c - 0xd4))
+	case 0xd9, 0xda, 0xdb:
+		n, err := d.uint(1 << (c - 0xd9))
+		if err != nil {
+			return nil, err
+		}
+		return d.decodeString(int(n))
+	case 0xdc, 0xdd:
+		n, err := d.uint(2 << (c - 0xdc))
+		if err != nil {
+			return nil, err
+		}
+		return d.decodeArray(int(n))
+	case 0xde, 0xdf:
+		n, err := d.uint(2 << (c - 0xde))
+		if err != nil {
+			return nil, err
+		}
+		return d.decodeMap(int(n))
+	}
+
+	return nil, fmt.Errorf("work: msgpack: unsupported format 0x%x", c)
+}
+
+func (d *msgpackDecoder) decodeString(n int) (interface{}, error) {
+	b, err := d.next(n)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+func (d *msgpackDecoder) decodeArray(n int) (interface{}, error) {
+	if n > len(d.buf)-d.pos {
+		return nil, errMsgpackShort
+	}
+	leave, err := d.nest()
+	if err != nil {
+		return nil, err
+	}
+	defer leave()
+
+	arr := make([]interface{}, n)
+	for i := range arr {
+		v, err := d.decode()
+		if err != nil {
+			return nil, err
+		}
+		arr[i] = v
+	}
+	return arr, nil
+}
+
+func (d *msgpackDecoder) decodeMap(n int) (interface{}, error) {
+	if n > len(d.buf)-d.pos {
+		return nil, errMsgpackShort
+	}
+	leave, err := d.nest()
+	if err != nil {
+		return nil, err
+	}
+	defer leave()
+
+	m := make(map[string]interface{}, n)
+	for i := 0; i < n; i++ {
+		k, err := d.decode()
+		if err != nil {
+			return nil, err
+		}
+		key, ok := k.(string)
+		if !ok {
+			return nil, fmt.Errorf("work: msgpack: unsupported map key %T", k)
+		}
+
+		v, err := d.decode()
+		if err != nil {
+			return nil, err
+		}
+		m[key] = v
+	}
+	return m, nil
+}
+
+// decodeExt decodes an extension of n bytes. Only the timestamps are supported.
+func (d *msgpackDecoder) decodeExt(n int) (interface{}, error) {
+	typ, err := d.next(1)
+	if err != nil {
+		return nil, err
+	}
+	data, err := d.next(n)
+	if err != nil {
+		return nil, err
+	}
+	if int8(typ[0]) != msgpackTimestampExt {
+		return nil, fmt.Errorf("work: msgpack: unsupported extension type %d", int8(typ[0]))
+	}
+
+	switch n {
+	case 4:
+		return time.Unix(int64(binary.BigEndian.Uint32(data)), 0), nil
+	case 8:
+		v := binary.BigEndian.Uint64(data)
+		return time.Unix(int64(v&(1<<34-1)), int64(v>>34)), nil
+	case 12:
+		return time.Unix(int64(binary.BigEndian.Uint64(data[4:])), int64(binary.BigEndian.Uint32(data))), nil
+	}
+
+	return nil, fmt.Errorf("work: msgpack: invalid timestamp of %d bytes", n)
+}
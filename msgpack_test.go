@@ -0,0 +1,176 @@
+package work
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMsgpackArgsCodecEncoding(t *testing.T) {
+	// Encodings from the MessagePack spec.
+	tests := []struct {
+		v    interface{}
+		want []byte
+	}{
+		{nil, []byte{0xc0}},
+		{true, []byte{0xc3}},
+		{1, []byte{0x01}},
+		{-1, []byte{0xff}},
+		{200, []byte{0xcc, 0xc8}},
+		{-200, []byte{0xd1, 0xff, 0x38}},
+		{uint64(math.MaxUint64), []byte{0xcf, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}},
+		{1.5, []byte{0xcb, 0x3f, 0xf8, 0, 0, 0, 0, 0, 0}},
+		{"ab", []byte{0xa2, 'a', 'b'}},
+		{[]byte{1, 2}, []byte{0xc4, 0x02, 0x01, 0x02}},
+		{[]interface{}{1, "a"}, []byte{0x92, 0x01, 0xa1, 'a'}},
+		{time.Unix(1, 2), []byte{0xc7, 12, 0xff, 0, 0, 0, 2, 0, 0, 0, 0, 0, 0, 0, 1}},
+	}
+	for _, tt := range tests {
+		data, err := MsgpackArgsCodec{}.Marshal(map[string]interface{}{"v": tt.v})
+		require.NoError(t, err)
+		assert.Equal(t, append([]byte{0x81, 0xa1, 'v'}, tt.want...), data, "%#v", tt.v)
+	}
+
+	// Keys are sorted.
+	data, err := MsgpackArgsCodec{}.Marshal(map[string]interface{}{"b": 2, "a": 1})
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0x82, 0xa1, 'a', 0x01, 0xa1, 'b', 0x02}, data)
+
+	_, err = MsgpackArgsCodec{}.Marshal(map[string]interface{}{"v": struct{}{}})
+	assert.Error(t, err)
+	_, err = MsgpackArgsCodec{}.Marshal(map[string]interface{}{"v": map[int]int{1: 1}})
+	assert.Error(t, err)
+}
+
+func TestMsgpackArgsCodecRoundTrip(t *testing.T) {
+	at := time.Date(2024, 3, 1, 12, 30, 15, 123456789, time.UTC)
+	long := strings.Repeat("x", 70000)
+	args := map[string]interface{}{
+		"nil":    nil,
+		"bool":   false,
+		"int":    -70000,
+		"uint":   uint32(70000),
+		"big":    uint64(math.MaxUint64),
+		"float":  float32(0.5),
+		"str":    long,
+		"raw":    []byte{0, 1, 2},
+		"at":     at,
+		"list":   []string{"a", "b"},
+		"nested": map[string]int{"a": 1},
+	}
+
+	data, err := MsgpackArgsCodec{}.Marshal(args)
+	require.NoError(t, err)
+	decoded, err := MsgpackArgsCodec{}.Unmarshal(data)
+	require.NoError(t, err)
+
+	assert.Nil(t, decoded["nil"])
+	assert.Equal(t, false, decoded["bool"])
+	assert.Equal(t, int64(-70000), decoded["int"])
+	assert.Equal(t, int64(70000), decoded["uint"])
+	assert.Equal(t, uint64(math.MaxUint64), decoded["big"])
+	assert.Equal(t, 0.5, decoded["float"])
+	assert.Equal(t, long, decoded["str"])
+	assert.Equal(t, []byte{0, 1, 2}, decoded["raw"])
+	assert.True(t, at.Equal(decoded["at"].(time.Time)))
+	assert.Equal(t, []interface{}{"a", "b"}, decoded["list"])
+	assert.Equal(t, map[string]interface{}{"a": int64(1)}, decoded["nested"])
+
+	decoded, err = MsgpackArgsCodec{}.Unmarshal([]byte{0xc0})
+	assert.NoError(t, err)
+	assert.Nil(t, decoded)
+
+	for _, data := range [][]byte{nil, {0x81, 0xa1}, {0x01}, {0x80, 0x01}, {0xdf, 0xff, 0xff, 0xff, 0xff}} {
+		_, err := MsgpackArgsCodec{}.Unmarshal(data)
+		assert.Error(t, err, "%x", data)
+	}
+}
+
+func TestMsgpackArgsCodecDepth(t *testing.T) {
+	nested := func(depth int) []byte {
+		data := []byte{0x81, 0xa1, 'v'}
+		for i := 1; i < depth; i++ {
+			data = append(data, 0x91)
+		}
+		return append(data, 0xc0)
+	}
+
+	_, err := MsgpackArgsCodec{}.Unmarshal(nested(msgpackMaxDepth))
+	assert.NoError(t, err)
+	_, err = MsgpackArgsCodec{}.Unmarshal(nested(msgpackMaxDepth + 1))
+	assert.ErrorIs(t, err, errMsgpackDepth)
+	_, err = MsgpackArgsCodec{}.Unmarshal(bytes.Repeat([]byte{0x91}, 1<<20))
+	assert.ErrorIs(t, err, errMsgpackDepth)
+
+	// Cyclic args can't be encoded.
+	cyclic := map[string]interface{}{}
+	cyclic["self"] = cyclic
+	_, err = MsgpackArgsCodec{}.Marshal(cyclic)
+	assert.ErrorIs(t, err, errMsgpackDepth)
+}
+
+func FuzzMsgpackArgsCodec(f *testing.F) {
+	for _, args := range []map[string]interface{}{
+		nil,
+		{"a": 1, "b": "x", "c": []interface{}{true, nil, 1.5}},
+		{"raw": []byte{0, 1}, "at": time.Unix(1, 2), "nested": map[string]interface{}{"n": int64(-70000)}},
+	} {
+		data, err := MsgpackArgsCodec{}.Marshal(args)
+		require.NoError(f, err)
+		f.Add(data)
+	}
+	f.Add(bytes.Repeat([]byte{0x91}, 1000))
+	f.Add([]byte{0xdf, 0xff, 0xff, 0xff, 0xff})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		args, err := MsgpackArgsCodec{}.Unmarshal(data)
+		if err != nil {
+			return
+		}
+
+		// The decoded args are encoded again, to the same bytes once they're normalized.
+		encoded, err := MsgpackArgsCodec{}.Marshal(args)
+		require.NoError(t, err)
+		decoded, err := MsgpackArgsCodec{}.Unmarshal(encoded)
+		require.NoError(t, err)
+		reencoded, err := MsgpackArgsCodec{}.Marshal(decoded)
+		require.NoError(t, err)
+		assert.Equal(t, encoded, reencoded)
+	})
+}
+
+func TestWorkerPoolMsgpackArgsCodec(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work"
+	job1 := "job1"
+	cleanKeyspace(ns, pool)
+
+	var got []byte
+	var n int64
+	wp := NewWorkerPool(TestContext{}, 1, ns, pool, WithArgsCodec(MsgpackArgsCodec{}))
+	wp.Job(job1, func(job *Job) error {
+		got, _ = job.Args["raw"].([]byte)
+		n = job.ArgInt64("n")
+		return job.ArgError()
+	})
+
+	enqueuer := NewEnqueuer(ns, pool, WithEnqueuerArgsCodec(MsgpackArgsCodec{}))
+	_, err := enqueuer.EnqueueUnique(job1, Q{"raw": []byte{0, 1}, "n": 3})
+	require.NoError(t, err)
+	job, err := enqueuer.EnqueueUnique(job1, Q{"n": 3, "raw": []byte{0, 1}})
+	require.NoError(t, err)
+	assert.Nil(t, job)
+
+	wp.Start()
+	wp.Drain()
+	wp.Stop()
+
+	assert.Equal(t, []byte{0, 1}, got)
+	assert.EqualValues(t, 3, n)
+	assert.EqualValues(t, 0, zsetSize(pool, redisKeyDead(newKeyspace(ns))))
+}
@@ -0,0 +1,110 @@
+package work
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// MultiPool starts and stops several worker pools together, e.g. the pools of the namespaces of several apps
+// run by a single process. The pools can share a single Pool of Redis connections, since all their keys are
+// prefixed with their namespaces.
+type MultiPool struct {
+	pools []*WorkerPool
+}
+
+// NewMultiPool creates a MultiPool of the specified worker pools. Several pools can have the same namespace,
+// but it panics if the keys of different namespaces could collide, e.g. for "app" and "app:jobs".
+func NewMultiPool(pools ...*WorkerPool) *MultiPool {
+	for i, a := range pools {
+		if a == nil {
+			panic("NewMultiPool needs non-nil WorkerPools")
+		}
+
+		for _, b := range pools[:i] {
+			pa, pb := redisNamespacePrefix(a.keys), redisNamespacePrefix(b.keys)
+			if pa != pb && (strings.HasPrefix(pa, pb) || strings.HasPrefix(pb, pa)) {
+				panic(fmt.Sprintf("work: the keys of namespaces %q and %q collide", b.keys.namespace, a.keys.namespace))
+			}
+		}
+	}
+
+	return &MultiPool{pools: pools}
+}
+
+// Start starts the pools in order.
+func (mp *MultiPool) Start() {
+	for _, wp := range mp.pools {
+		wp.Start()
+	}
+}
+
+// Stop stops the pools in reverse order.
+func (mp *MultiPool) Stop() {
+	_ = mp.StopContext(context.Background())
+}
+
+// StopContext stops the pools in reverse order like Stop, waiting for the in-flight jobs of each of them until ctx
+// is done, see WorkerPool.StopContext. The errors of the pools are joined.
+func (mp *MultiPool) StopContext(ctx context.Context) error {
+	var errs []error
+	for i := len(mp.pools) - 1; i >= 0; i-- {
+		if err := mp.pools[i].StopContext(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("stopping worker pool %s: %w", mp.pools[i].workerPoolID, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Drain drains the pools in order, see WorkerPool.Drain.
+func (mp *MultiPool) Drain() {
+	for _, wp := range mp.pools {
+		wp.Drain()
+	}
+}
+
+// WatchdogStats returns the watchdog stats of the pools keyed by worker pool ID.
+func (mp *MultiPool) WatchdogStats() map[string][]WatchdogStat {
+	stats := make(map[string][]WatchdogStat, len(mp.pools))
+	for _, wp := range mp.pools {
+		stats[wp.workerPoolID] = wp.WatchdogStats()
+	}
+
+	return stats
+}
+
+// Heartbeats returns the heartbeats of the pools, in the order of the pools. Pools without a heartbeat,
+// e.g. because they aren't started, are omitted.
+func (mp *MultiPool) Heartbeats() ([]*WorkerPoolHeartbeat, error) {
+	byID := make(map[string]*WorkerPoolHeartbeat)
+	seen := make(map[keyspace]bool)
+
+	for _, wp := range mp.pools {
+		if seen[wp.keys] {
+			continue
+		}
+		seen[wp.keys] = true
+
+		client := NewClient(wp.keys.namespace, wp.pool, WithClientLogger(wp.logger))
+		client.keys = wp.keys
+		heartbeats, err := client.WorkerPoolHeartbeats()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, hb := range heartbeats {
+			byID[hb.WorkerPoolID] = hb
+		}
+	}
+
+	heartbeats := make([]*WorkerPoolHeartbeat, 0, len(mp.pools))
+	for _, wp := range mp.pools {
+		if hb := byID[wp.workerPoolID]; hb != nil && hb.HeartbeatAt > 0 {
+			heartbeats = append(heartbeats, hb)
+		}
+	}
+
+	return heartbeats, nil
+}
@@ -0,0 +1,68 @@
+package work
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMultiPool(t *testing.T) {
+	pool := newTestPool(":6379")
+	namespaces := []string{"work-a", "work-b"}
+
+	var processed int64
+	var pools []*WorkerPool
+	for _, ns := range namespaces {
+		cleanKeyspace(ns, pool)
+
+		wp := NewWorkerPool(TestContext{}, 1, ns, pool)
+		wp.Job("wat", func(job *Job) error {
+			atomic.AddInt64(&processed, 1)
+			return nil
+		})
+		pools = append(pools, wp)
+
+		_, err := NewEnqueuer(ns, pool).Enqueue("wat", nil)
+		require.NoError(t, err)
+	}
+
+	mp := NewMultiPool(pools...)
+	mp.Start()
+	mp.Drain()
+	assert.EqualValues(t, 2, atomic.LoadInt64(&processed))
+
+	heartbeats, err := mp.Heartbeats()
+	require.NoError(t, err)
+	if assert.Equal(t, 2, len(heartbeats)) {
+		assert.Equal(t, pools[0].workerPoolID, heartbeats[0].WorkerPoolID)
+		assert.Equal(t, pools[1].workerPoolID, heartbeats[1].WorkerPoolID)
+	}
+
+	stats := mp.WatchdogStats()
+	assert.Equal(t, 2, len(stats))
+	assert.Contains(t, stats, pools[0].workerPoolID)
+
+	assert.NoError(t, mp.StopContext(context.Background()))
+
+	heartbeats, err = mp.Heartbeats()
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(heartbeats))
+}
+
+func TestMultiPoolKeyCollision(t *testing.T) {
+	pool := newTestPool(":6379")
+
+	assert.Panics(t, func() {
+		NewMultiPool(NewWorkerPool(TestContext{}, 1, "app", pool), NewWorkerPool(TestContext{}, 1, "app:jobs", pool))
+	})
+	assert.Panics(t, func() {
+		NewMultiPool(NewWorkerPool(TestContext{}, 1, "app", pool), NewWorkerPool(TestContext{}, 1, "", pool))
+	})
+	assert.NotPanics(t, func() {
+		NewMultiPool(NewWorkerPool(TestContext{}, 1, "app", pool), NewWorkerPool(TestContext{}, 1, "app", pool))
+		NewMultiPool(NewWorkerPool(TestContext{}, 1, "app", pool), NewWorkerPool(TestContext{}, 1, "app2", pool))
+	})
+}
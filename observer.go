@@ -2,15 +2,16 @@ package work
 
 import (
 	"encoding/json"
+	"fmt"
 	"log/slog"
 	"time"
 )
 
 // An observer observes a single worker. Each worker has its own observer.
 type observer struct {
-	namespace string
-	workerID  string
-	pool      Pool
+	keys     keyspace
+	workerID string
+	pool     Pool
 
 	// nil: worker isn't doing anything that we know of
 	// not nil: the last started observation that we received on the channel.
@@ -30,7 +31,16 @@ type observer struct {
 	drainChan        chan struct{}
 	doneDrainingChan chan struct{}
 
-	logger StructuredLogger
+	// argsLimit is the max size of the JSON args stored in an observation. Zero means no limit.
+	argsLimit int
+
+	// minDuration is how long a job must run before its observation is written, see WithObservationSampling.
+	// written is whether an observation is stored in redis, so the one of a skipped job isn't deleted.
+	minDuration time.Duration
+	written     bool
+
+	failover *failoverState // shared with the other loops of the pool
+	logger   StructuredLogger
 }
 
 type observationKind int
@@ -58,13 +68,14 @@ type observation struct {
 	// If this is a checkin, set these.
 	checkin   string
 	checkinAt int64
+	progress  *float64 // set if the checkin reports progress
 }
 
 const observerBufferSize = 1024
 
-func newObserver(namespace string, pool Pool, workerID string, logger StructuredLogger) *observer {
+func newObserver(keys keyspace, pool Pool, workerID string, logger StructuredLogger) *observer {
 	return &observer{
-		namespace:        namespace,
+		keys:             keys,
 		workerID:         workerID,
 		pool:             pool,
 		observationsChan: make(chan *observation, observerBufferSize),
@@ -112,13 +123,14 @@ func (o *observer) observeDone(jobName, jobID string, err error) {
 	}
 }
 
-func (o *observer) observeCheckin(jobName, jobID, checkin string) {
+func (o *observer) observeCheckin(jobName, jobID, checkin string, progress *float64) {
 	o.observationsChan <- &observation{
 		kind:      observationKindCheckin,
 		jobName:   jobName,
 		jobID:     jobID,
 		checkin:   checkin,
 		checkinAt: nowEpochSeconds(),
+		progress:  progress,
 	}
 }
 
@@ -140,7 +152,7 @@ func (o *observer) loop() {
 				case obv := <-o.observationsChan:
 					o.process(obv)
 				default:
-					if err := o.writeStatus(o.currentStartedObservation); err != nil {
+					if err := o.flush(); err != nil {
 						o.logger.Error("observer.write", errAttr(err))
 					}
 					o.doneDrainingChan <- struct{}{}
@@ -148,11 +160,11 @@ func (o *observer) loop() {
 				}
 			}
 		case <-ticker:
-			if o.lastWrittenVersion != o.version {
-				if err := o.writeStatus(o.currentStartedObservation); err != nil {
+			if o.lastWrittenVersion != o.version && o.failover.backoff() == 0 {
+				if err := o.flush(); err != nil {
+					o.failover.failed(err)
 					o.logger.Error("observer.write", errAttr(err))
 				}
-				o.lastWrittenVersion = o.version
 			}
 		case obv := <-o.observationsChan:
 			o.process(obv)
@@ -169,6 +181,7 @@ func (o *observer) process(obv *observation) {
 		if (o.currentStartedObservation != nil) && (obv.jobID == o.currentStartedObservation.jobID) {
 			o.currentStartedObservation.checkin = obv.checkin
 			o.currentStartedObservation.checkinAt = obv.checkinAt
+			o.currentStartedObservation.progress = obv.progress
 		} else {
 			o.logger.Error("observer.checkin_mismatch", slog.String(
 				"error",
@@ -180,18 +193,42 @@ func (o *observer) process(obv *observation) {
 
 	// If this is the version observation we got, just go ahead and write it.
 	if o.version == 1 {
-		if err := o.writeStatus(o.currentStartedObservation); err != nil {
+		if err := o.flush(); err != nil {
 			o.logger.Error("observer.first_write", errAttr(err))
 		}
+	}
+}
+
+// flush writes the current observation to redis. With a minDuration, the observation of a job running for less
+// than it isn't written but left pending, so a later flush writes it if the job is still running then. Nothing
+// is deleted if no observation was written.
+func (o *observer) flush() error {
+	obv := o.currentStartedObservation
+	pending := obv != nil && o.minDuration > 0 &&
+		time.Duration(nowEpochSeconds()-obv.startedAt)*time.Second < o.minDuration
+	if pending {
+		obv = nil
+	}
+
+	if obv != nil || o.written || o.minDuration == 0 {
+		if err := o.writeStatus(obv); err != nil {
+			return err
+		}
+		o.written = obv != nil
+	}
+
+	if !pending {
 		o.lastWrittenVersion = o.version
 	}
+
+	return nil
 }
 
 func (o *observer) writeStatus(obv *observation) error {
 	conn := o.pool.Get()
 	defer conn.Close()
 
-	key := redisKeyWorkerObservation(o.namespace, o.workerID)
+	key := redisKeyWorkerObservation(o.keys, o.workerID)
 
 	if obv == nil {
 		if _, err := conn.Do("DEL", key); err != nil {
@@ -205,6 +242,7 @@ func (o *observer) writeStatus(obv *observation) error {
 		// args -> json.Encode(obv.arguments)
 		// checkin -> obv.checkin
 		// checkin_at -> obv.checkinAt
+		// progress -> obv.progress
 
 		var argsJSON []byte
 		if len(obv.arguments) == 0 {
@@ -215,9 +253,13 @@ func (o *observer) writeStatus(obv *observation) error {
 			if err != nil {
 				return err
 			}
+
+			if o.argsLimit > 0 && len(argsJSON) > o.argsLimit {
+				argsJSON = []byte(fmt.Sprintf(`"<truncated: %d bytes>"`, len(argsJSON)))
+			}
 		}
 
-		args := make([]interface{}, 0, 13)
+		args := make([]interface{}, 0, 15)
 		args = append(args,
 			key,
 			"job_name", obv.jobName,
@@ -233,6 +275,12 @@ func (o *observer) writeStatus(obv *observation) error {
 			)
 		}
 
+		if obv.progress != nil {
+			args = append(args, "progress", *obv.progress)
+		} else {
+			conn.Send("HDEL", key, "progress")
+		}
+
 		conn.Send("HMSET", args...)
 		conn.Send("EXPIRE", key, 60*60*24)
 		if err := conn.Flush(); err != nil {
@@ -2,7 +2,9 @@ package work
 
 import (
 	"fmt"
+	"math"
 	"testing"
+	"time"
 
 	"github.com/gomodule/redigo/redis"
 	"github.com/stretchr/testify/assert"
@@ -16,20 +18,41 @@ func TestObserverStarted(t *testing.T) {
 	setNowEpochSecondsMock(tMock)
 	defer resetNowEpochSecondsMock()
 
-	observer := newObserver(ns, pool, "abcd", noopLogger)
+	observer := newObserver(newKeyspace(ns), pool, "abcd", noopLogger)
 	observer.start()
 	observer.observeStarted("foo", "bar", Q{"a": 1, "b": "wat"})
 	//observer.observeDone("foo", "bar", nil)
 	observer.drain()
 	observer.stop()
 
-	h := readHash(pool, redisKeyWorkerObservation(ns, "abcd"))
+	h := readHash(pool, redisKeyWorkerObservation(newKeyspace(ns), "abcd"))
 	assert.Equal(t, "foo", h["job_name"])
 	assert.Equal(t, "bar", h["job_id"])
 	assert.Equal(t, fmt.Sprint(tMock), h["started_at"])
 	assert.Equal(t, `{"a":1,"b":"wat"}`, h["args"])
 }
 
+func TestObserverArgsLimit(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work"
+
+	observer := newObserver(newKeyspace(ns), pool, "abcd", noopLogger)
+	observer.argsLimit = 20
+	observer.start()
+	observer.observeStarted("foo", "bar", Q{"a": 1})
+	observer.drain()
+
+	h := readHash(pool, redisKeyWorkerObservation(newKeyspace(ns), "abcd"))
+	assert.Equal(t, `{"a":1}`, h["args"])
+
+	observer.observeStarted("foo", "baz", Q{"a": "0123456789abcdef"})
+	observer.drain()
+	observer.stop()
+
+	h = readHash(pool, redisKeyWorkerObservation(newKeyspace(ns), "abcd"))
+	assert.Equal(t, `"<truncated: 24 bytes>"`, h["args"])
+}
+
 func TestObserverStartedDone(t *testing.T) {
 	pool := newTestPool(":6379")
 	ns := "work"
@@ -38,14 +61,14 @@ func TestObserverStartedDone(t *testing.T) {
 	setNowEpochSecondsMock(tMock)
 	defer resetNowEpochSecondsMock()
 
-	observer := newObserver(ns, pool, "abcd", noopLogger)
+	observer := newObserver(newKeyspace(ns), pool, "abcd", noopLogger)
 	observer.start()
 	observer.observeStarted("foo", "bar", Q{"a": 1, "b": "wat"})
 	observer.observeDone("foo", "bar", nil)
 	observer.drain()
 	observer.stop()
 
-	h := readHash(pool, redisKeyWorkerObservation(ns, "abcd"))
+	h := readHash(pool, redisKeyWorkerObservation(newKeyspace(ns), "abcd"))
 	assert.Equal(t, 0, len(h))
 }
 
@@ -53,7 +76,7 @@ func TestObserverCheckin(t *testing.T) {
 	pool := newTestPool(":6379")
 	ns := "work"
 
-	observer := newObserver(ns, pool, "abcd", noopLogger)
+	observer := newObserver(newKeyspace(ns), pool, "abcd", noopLogger)
 	observer.start()
 
 	tMock := int64(1425263401)
@@ -63,11 +86,11 @@ func TestObserverCheckin(t *testing.T) {
 
 	tMockCheckin := int64(1425263402)
 	setNowEpochSecondsMock(tMockCheckin)
-	observer.observeCheckin("foo", "bar", "doin it")
+	observer.observeCheckin("foo", "bar", "doin it", nil)
 	observer.drain()
 	observer.stop()
 
-	h := readHash(pool, redisKeyWorkerObservation(ns, "abcd"))
+	h := readHash(pool, redisKeyWorkerObservation(newKeyspace(ns), "abcd"))
 	assert.Equal(t, "foo", h["job_name"])
 	assert.Equal(t, "bar", h["job_id"])
 	assert.Equal(t, fmt.Sprint(tMock), h["started_at"])
@@ -80,7 +103,7 @@ func TestObserverCheckinFromJob(t *testing.T) {
 	pool := newTestPool(":6379")
 	ns := "work"
 
-	observer := newObserver(ns, pool, "abcd", noopLogger)
+	observer := newObserver(newKeyspace(ns), pool, "abcd", noopLogger)
 	observer.start()
 
 	tMock := int64(1425263401)
@@ -97,7 +120,7 @@ func TestObserverCheckinFromJob(t *testing.T) {
 	observer.drain()
 	observer.stop()
 
-	h := readHash(pool, redisKeyWorkerObservation(ns, "abcd"))
+	h := readHash(pool, redisKeyWorkerObservation(newKeyspace(ns), "abcd"))
 	assert.Equal(t, "foo", h["job_name"])
 	assert.Equal(t, "barbar", h["job_id"])
 	assert.Equal(t, fmt.Sprint(tMock), h["started_at"])
@@ -105,6 +128,38 @@ func TestObserverCheckinFromJob(t *testing.T) {
 	assert.Equal(t, fmt.Sprint(tMockCheckin), h["checkin_at"])
 }
 
+func TestObserverCheckinWithProgress(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work"
+	cleanKeyspace(ns, pool)
+
+	observer := newObserver(newKeyspace(ns), pool, "abcd", noopLogger)
+	observer.start()
+
+	observer.observeStarted("foo", "barbar", nil)
+
+	j := &Job{Name: "foo", ID: "barbar", observer: observer}
+	assert.Error(t, j.CheckinWithProgress("too far", 100.5))
+	assert.Error(t, j.CheckinWithProgress("backwards", -1))
+	assert.Error(t, j.CheckinWithProgress("nan", math.NaN()))
+	assert.NoError(t, j.CheckinWithProgress("halfway", 50.5))
+
+	observer.drain()
+
+	h := readHash(pool, redisKeyWorkerObservation(newKeyspace(ns), "abcd"))
+	assert.Equal(t, "halfway", h["checkin"])
+	assert.Equal(t, "50.5", h["progress"])
+
+	// A plain checkin clears the progress.
+	j.Checkin("sup")
+	observer.drain()
+	observer.stop()
+
+	h = readHash(pool, redisKeyWorkerObservation(newKeyspace(ns), "abcd"))
+	assert.Equal(t, "sup", h["checkin"])
+	assert.NotContains(t, h, "progress")
+}
+
 func readHash(pool *redis.Pool, key string) map[string]string {
 	m := make(map[string]string)
 
@@ -122,3 +177,43 @@ func readHash(pool *redis.Pool, key string) map[string]string {
 
 	return m
 }
+
+func TestObserverSampling(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work"
+	cleanKeyspace(ns, pool)
+
+	tMock := int64(1425263401)
+	setNowEpochSecondsMock(tMock)
+	defer resetNowEpochSecondsMock()
+
+	observer := newObserver(newKeyspace(ns), pool, "abcd", noopLogger)
+	observer.minDuration = 5 * time.Second
+	observer.start()
+	defer observer.stop()
+
+	// A short job is neither written nor deleted.
+	observer.observeStarted("foo", "bar", Q{"a": 1})
+	observer.drain()
+	assert.False(t, keyExists(pool, redisKeyWorkerObservation(newKeyspace(ns), "abcd")))
+	observer.observeDone("foo", "bar", nil)
+	observer.drain()
+	assert.False(t, keyExists(pool, redisKeyWorkerObservation(newKeyspace(ns), "abcd")))
+
+	// A long job is written once it ran for the min duration.
+	observer.observeStarted("foo", "baz", Q{"a": 2})
+	observer.drain()
+	assert.False(t, keyExists(pool, redisKeyWorkerObservation(newKeyspace(ns), "abcd")))
+
+	setNowEpochSecondsMock(tMock + 5)
+	observer.drain()
+	h := readHash(pool, redisKeyWorkerObservation(newKeyspace(ns), "abcd"))
+	assert.Equal(t, "baz", h["job_id"])
+	assert.Equal(t, fmt.Sprint(tMock), h["started_at"])
+
+	// Its observation is deleted when it's done, even if the next job is short.
+	observer.observeDone("foo", "baz", nil)
+	observer.observeStarted("foo", "qux", Q{"a": 3})
+	observer.drain()
+	assert.False(t, keyExists(pool, redisKeyWorkerObservation(newKeyspace(ns), "abcd")))
+}
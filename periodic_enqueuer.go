@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"log/slog"
 	"math/rand"
+	"sync"
 	"time"
 
 	"github.com/gomodule/redigo/redis"
@@ -16,19 +17,30 @@ const (
 )
 
 type periodicEnqueuer struct {
-	namespace             string
+	keys                  keyspace
 	pool                  Pool
+	enqueueOnceScript     *redis.Script
+	mtx                   sync.Mutex // guards periodicJobs
 	periodicJobs          []*periodicJob
 	scheduledPeriodicJobs []*scheduledPeriodicJob
 	stopChan              chan struct{}
 	doneStoppingChan      chan struct{}
+	failover              *failoverState // shared with the other loops of the pool
+	clock                 Clock
 	logger                StructuredLogger
+	events                *jobEvents // see WorkerPool.Events
+
+	// dryRun makes the enqueuer log the jobs instead of enqueuing them, see WithPeriodicDryRun.
+	// dryRunHorizon is the end of the last logged period, so that the jobs are logged once.
+	dryRun        bool
+	dryRunHorizon time.Time
 }
 
 type periodicJob struct {
 	jobName  string
 	spec     string
 	schedule cron.Schedule
+	argsFn   func(time.Time) map[string]interface{} // see PeriodicallyEnqueueWithArgs
 }
 
 type scheduledPeriodicJob struct {
@@ -38,21 +50,38 @@ type scheduledPeriodicJob struct {
 }
 
 func newPeriodicEnqueuer(
-	namespace string,
+	keys keyspace,
 	pool Pool,
 	periodicJobs []*periodicJob,
 	logger StructuredLogger,
 ) *periodicEnqueuer {
 	return &periodicEnqueuer{
-		namespace:        namespace,
-		pool:             pool,
-		periodicJobs:     periodicJobs,
-		stopChan:         make(chan struct{}),
-		doneStoppingChan: make(chan struct{}),
-		logger:           logger,
+		keys:              keys,
+		pool:              pool,
+		enqueueOnceScript: redis.NewScript(2, redisLuaEnqueueUniqueIn),
+		periodicJobs:      periodicJobs,
+		stopChan:          make(chan struct{}),
+		doneStoppingChan:  make(chan struct{}),
+		clock:             defaultClock,
+		logger:            logger,
 	}
 }
 
+// setPeriodicJobs replaces the periodic jobs to enqueue, e.g. when one is removed while the enqueuer runs.
+func (pe *periodicEnqueuer) setPeriodicJobs(jobs []*periodicJob) {
+	pe.mtx.Lock()
+	defer pe.mtx.Unlock()
+
+	pe.periodicJobs = jobs
+}
+
+func (pe *periodicEnqueuer) jobs() []*periodicJob {
+	pe.mtx.Lock()
+	defer pe.mtx.Unlock()
+
+	return pe.periodicJobs
+}
+
 func (pe *periodicEnqueuer) start() {
 	go pe.loop()
 }
@@ -80,10 +109,17 @@ func (pe *periodicEnqueuer) loop() {
 			pe.doneStoppingChan <- struct{}{}
 			return
 		case <-timer.C:
+			// Enqueue once the pool is done backing off from a failover rather than waiting for the next period
+			if backoff := pe.failover.backoff(); backoff > 0 {
+				timer.Reset(backoff)
+				continue
+			}
+
 			timer.Reset(periodicEnqueuerSleep + time.Duration(rand.Intn(30))*time.Second)
 			if pe.shouldEnqueue() {
 				err := pe.enqueue()
 				if err != nil {
+					pe.failover.failed(err)
 					pe.logger.Error("periodic_enqueuer.loop.enqueue", errAttr(err))
 				}
 			}
@@ -92,14 +128,19 @@ func (pe *periodicEnqueuer) loop() {
 }
 
 func (pe *periodicEnqueuer) enqueue() error {
-	now := nowEpochSeconds()
+	if pe.dryRun {
+		pe.logDryRun()
+		return nil
+	}
+
+	now := pe.clock.Now().Unix()
 	nowTime := time.Unix(now, 0)
 	horizon := nowTime.Add(periodicEnqueuerHorizon)
 
 	conn := pe.pool.Get()
 	defer conn.Close()
 
-	for _, pj := range pe.periodicJobs {
+	for _, pj := range pe.jobs() {
 		for t := pj.schedule.Next(nowTime); t.Before(horizon); t = pj.schedule.Next(t) {
 			epoch := t.Unix()
 			id := makeUniquePeriodicID(pj.jobName, pj.spec, epoch)
@@ -127,28 +168,77 @@ func (pe *periodicEnqueuer) enqueue() error {
 				slog.String("job_id", id),
 			)
 
+			if pj.argsFn != nil {
+				job.Args = pj.argsFn(t)
+			}
+
 			rawJSON, err := job.serialize()
 			if err != nil {
 				return err
 			}
 
-			_, err = conn.Do("ZADD", redisKeyScheduled(pe.namespace), epoch, rawJSON)
+			// Only the pool which adds the job reports it, once.
+			var added bool
+			if pj.argsFn != nil {
+				// The args computed by the pools may differ, so the identical bytes of the job can't be relied on
+				// to add it only once: the first pool to enqueue it wins.
+				var res string
+				res, err = redis.String(pe.enqueueOnceScript.Do(conn, redisKeyScheduled(pe.keys), redisKeyPeriodicJob(pe.keys, id), rawJSON, epoch))
+				added = res == "ok"
+			} else {
+				var n int
+				n, err = redis.Int(conn.Do("ZADD", redisKeyScheduled(pe.keys), epoch, rawJSON))
+				added = n > 0
+			}
 			if err != nil {
 				return err
 			}
+			if added {
+				pe.events.emit(JobEventEnqueued, job)
+			}
 		}
 	}
 
-	_, err := conn.Do("SET", redisKeyLastPeriodicEnqueue(pe.namespace), now)
+	_, err := conn.Do("SET", redisKeyLastPeriodicEnqueue(pe.keys), now)
 
 	return err
 }
 
+// logDryRun logs the jobs which would be enqueued up to the horizon, skipping the ones already logged.
+// Nothing is written to Redis.
+func (pe *periodicEnqueuer) logDryRun() {
+	nowTime := time.Unix(pe.clock.Now().Unix(), 0)
+	horizon := nowTime.Add(periodicEnqueuerHorizon)
+
+	// Next returns the times after from, and the ones before the last horizon were already logged.
+	from := nowTime
+	if last := pe.dryRunHorizon.Add(-time.Second); last.After(from) {
+		from = last
+	}
+
+	for _, pj := range pe.jobs() {
+		for t := pj.schedule.Next(from); t.Before(horizon); t = pj.schedule.Next(t) {
+			pe.logger.Info("periodic_enqueuer.dry_run",
+				slog.Time("job_scheduled_time", t),
+				slog.String("job_name", pj.jobName),
+				slog.String("job_id", makeUniquePeriodicID(pj.jobName, pj.spec, t.Unix())),
+			)
+		}
+	}
+
+	pe.dryRunHorizon = horizon
+}
+
 func (pe *periodicEnqueuer) shouldEnqueue() bool {
+	if pe.dryRun {
+		// Nothing is written to Redis, so the last enqueue of the other pools is irrelevant.
+		return true
+	}
+
 	conn := pe.pool.Get()
 	defer conn.Close()
 
-	lastEnqueue, err := redis.Int64(conn.Do("GET", redisKeyLastPeriodicEnqueue(pe.namespace)))
+	lastEnqueue, err := redis.Int64(conn.Do("GET", redisKeyLastPeriodicEnqueue(pe.keys)))
 	if err == redis.ErrNil {
 		return true
 	} else if err != nil {
@@ -156,7 +246,7 @@ func (pe *periodicEnqueuer) shouldEnqueue() bool {
 		return true
 	}
 
-	return lastEnqueue < (nowEpochSeconds() - int64(periodicEnqueuerSleep/time.Second))
+	return lastEnqueue < (pe.clock.Now().Unix() - int64(periodicEnqueuerSleep/time.Second))
 }
 
 func makeUniquePeriodicID(name, spec string, epoch int64) string {
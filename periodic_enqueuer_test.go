@@ -1,12 +1,16 @@
 package work
 
 import (
+	"bytes"
+	"log/slog"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/gomodule/redigo/redis"
 	"github.com/robfig/cron/v3"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestPeriodicEnqueuer(t *testing.T) {
@@ -22,7 +26,7 @@ func TestPeriodicEnqueuer(t *testing.T) {
 	setNowEpochSecondsMock(1468359453)
 	defer resetNowEpochSecondsMock()
 
-	pe := newPeriodicEnqueuer(ns, pool, pjs, noopLogger)
+	pe := newPeriodicEnqueuer(newKeyspace(ns), pool, pjs, noopLogger)
 	err := pe.enqueue()
 	assert.NoError(t, err)
 
@@ -73,7 +77,7 @@ func TestPeriodicEnqueuer(t *testing.T) {
 	defer conn.Close()
 
 	// Make sure the last periodic enqueued was set
-	lastEnqueue, err := redis.Int64(conn.Do("GET", redisKeyLastPeriodicEnqueue(ns)))
+	lastEnqueue, err := redis.Int64(conn.Do("GET", redisKeyLastPeriodicEnqueue(newKeyspace(ns))))
 	assert.NoError(t, err)
 	assert.EqualValues(t, 1468359453, lastEnqueue)
 
@@ -88,7 +92,7 @@ func TestPeriodicEnqueuer(t *testing.T) {
 	assert.EqualValues(t, 20, count)
 
 	// Make sure the last periodic enqueued was set
-	lastEnqueue, err = redis.Int64(conn.Do("GET", redisKeyLastPeriodicEnqueue(ns)))
+	lastEnqueue, err = redis.Int64(conn.Do("GET", redisKeyLastPeriodicEnqueue(newKeyspace(ns))))
 	assert.NoError(t, err)
 	assert.EqualValues(t, 1468359454, lastEnqueue)
 
@@ -104,11 +108,156 @@ func TestPeriodicEnqueuerSpawn(t *testing.T) {
 	ns := "work"
 	cleanKeyspace(ns, pool)
 
-	pe := newPeriodicEnqueuer(ns, pool, nil, noopLogger)
+	pe := newPeriodicEnqueuer(newKeyspace(ns), pool, nil, noopLogger)
 	pe.start()
 	pe.stop()
 }
 
+func TestPeriodicEnqueuerInLocationAcrossDST(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work"
+
+	loc, err := time.LoadLocation("America/New_York")
+	require.NoError(t, err)
+
+	// Daily at 9:00 in New York. DST starts on 2024-03-10, so the job runs
+	// at 14:00 UTC before the transition and at 13:00 UTC after it.
+	pj, err := newPeriodicJobInLocation("0 0 9 * * *", "report", loc)
+	require.NoError(t, err)
+	assert.Equal(t, "CRON_TZ=America/New_York 0 0 9 * * *", pj.spec)
+
+	tzPj, err := newPeriodicJob("CRON_TZ=America/New_York 0 0 9 * * *", "report")
+	require.NoError(t, err)
+
+	_, err = newPeriodicJobInLocation("CRON_TZ=America/New_York 0 0 9 * * *", "report", loc)
+	assert.Error(t, err)
+
+	defer resetNowEpochSecondsMock()
+
+	cases := []struct {
+		now          time.Time
+		scheduledFor time.Time
+		deadline     time.Time
+	}{
+		{
+			now:          time.Date(2024, 3, 9, 13, 58, 0, 0, time.UTC),
+			scheduledFor: time.Date(2024, 3, 9, 14, 0, 0, 0, time.UTC),
+			deadline:     time.Date(2024, 3, 10, 13, 0, 0, 0, time.UTC),
+		},
+		{
+			now:          time.Date(2024, 3, 10, 12, 58, 0, 0, time.UTC),
+			scheduledFor: time.Date(2024, 3, 10, 13, 0, 0, 0, time.UTC),
+			deadline:     time.Date(2024, 3, 11, 13, 0, 0, 0, time.UTC),
+		},
+	}
+
+	for _, pj := range []*periodicJob{pj, tzPj} {
+		for _, c := range cases {
+			cleanKeyspace(ns, pool)
+			setNowEpochSecondsMock(c.now.Unix())
+
+			pe := newPeriodicEnqueuer(newKeyspace(ns), pool, []*periodicJob{pj}, noopLogger)
+			require.NoError(t, pe.enqueue())
+
+			scheduledJobs, count, err := NewClient(ns, pool).ScheduledJobs(1)
+			require.NoError(t, err)
+			if assert.EqualValues(t, 1, count) {
+				assert.Equal(t, c.scheduledFor.Unix(), scheduledJobs[0].RunAt)
+				assert.Equal(t, c.deadline.Unix(), scheduledJobs[0].StartingDeadline)
+			}
+		}
+	}
+}
+
+func TestPeriodicEnqueuerWithArgs(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work"
+	cleanKeyspace(ns, pool)
+
+	setNowEpochSecondsMock(1468359453)
+	defer resetNowEpochSecondsMock()
+
+	// Two pools computing different args: only the args of the first one are used.
+	for _, day := range []string{"first", "second"} {
+		day := day
+		pjs := appendPeriodicJob(nil, "0 0/2 * * * *", "report") // Every 2 minutes
+		pjs[0].argsFn = func(t time.Time) map[string]interface{} {
+			return map[string]interface{}{"from": t.Add(-2 * time.Minute).Unix(), "to": t.Unix(), "pool": day}
+		}
+
+		pe := newPeriodicEnqueuer(newKeyspace(ns), pool, pjs, noopLogger)
+		require.NoError(t, pe.enqueue())
+	}
+
+	scheduledJobs, count, err := NewClient(ns, pool).ScheduledJobs(1)
+	require.NoError(t, err)
+	require.EqualValues(t, 2, count)
+	for _, job := range scheduledJobs {
+		assert.Equal(t, job.RunAt, job.ArgInt64("to"))
+		assert.Equal(t, job.RunAt-120, job.ArgInt64("from"))
+		assert.Equal(t, "first", job.ArgString("pool"))
+	}
+
+	wp := NewWorkerPool(TestContext{}, 1, ns, pool)
+	assert.Panics(t, func() { wp.PeriodicallyEnqueueWithArgs("0 0 * * * *", "report", nil) })
+	wp.PeriodicallyEnqueueWithArgs("0 0 * * * *", "report", func(time.Time) map[string]interface{} { return nil })
+	assert.Equal(t, 1, len(wp.periodicJobs))
+}
+
+func TestTryPeriodicallyEnqueue(t *testing.T) {
+	pool := newTestPool(":6379")
+	wp := NewWorkerPool(TestContext{}, 1, "work", pool)
+
+	assert.Error(t, wp.TryPeriodicallyEnqueue("0 0 25 * * *", "foo"))
+	assert.Error(t, wp.TryPeriodicallyEnqueue("CRON_TZ=Nowhere/Atlantis 0 0 * * * *", "foo"))
+	assert.Empty(t, wp.periodicJobs)
+
+	require.NoError(t, wp.TryPeriodicallyEnqueue("0 0 * * * *", "foo"))
+	require.Len(t, wp.periodicJobs, 1)
+	assert.Equal(t, "foo", wp.periodicJobs[0].jobName)
+	assert.Equal(t, "0 0 * * * *", wp.periodicJobs[0].spec)
+}
+
+func TestRemovePeriodicJob(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work"
+	cleanKeyspace(ns, pool)
+
+	// The jobs are enqueued by the test and left in the scheduled set.
+	wp := NewWorkerPool(TestContext{}, 1, ns, pool, WithoutPeriodicEnqueuer(), WithoutScheduler())
+	wp.Job("foo", func(*Job) error { return nil })
+	wp.Job("bar", func(*Job) error { return nil })
+	wp.PeriodicallyEnqueue("* * * * * *", "foo")
+	wp.PeriodicallyEnqueue("*/2 * * * * *", "foo")
+	wp.PeriodicallyEnqueue("* * * * * *", "bar")
+
+	wp.RemovePeriodicJob("* * * * * *", "baz")
+	wp.RemovePeriodicJob("*/2 * * * * *", "foo")
+	assert.Len(t, wp.periodicJobs, 2)
+
+	wp.Start()
+	defer wp.Stop()
+
+	wp.RemovePeriodicJob("* * * * * *", "foo")
+	require.Len(t, wp.periodicEnqueuer.jobs(), 1)
+	assert.Equal(t, "bar", wp.periodicEnqueuer.jobs()[0].jobName)
+	wp.watchdog.mtx.Lock()
+	assert.False(t, wp.watchdog.isPeriodic("foo"))
+	assert.True(t, wp.watchdog.isPeriodic("bar"))
+	wp.watchdog.mtx.Unlock()
+	for _, info := range wp.RegisteredJobs() {
+		assert.Equal(t, info.Name == "bar", info.Periodic, info.Name)
+	}
+
+	require.NoError(t, wp.periodicEnqueuer.enqueue())
+	jobs, count, err := NewClient(ns, pool).ScheduledJobs(1)
+	require.NoError(t, err)
+	assert.True(t, count > 0)
+	for _, job := range jobs {
+		assert.Equal(t, "bar", job.Name)
+	}
+}
+
 func appendPeriodicJob(pjs []*periodicJob, spec, jobName string) []*periodicJob {
 	sched, err := cron.NewParser(cronFormat).Parse(spec)
 	if err != nil {
@@ -117,3 +266,32 @@ func appendPeriodicJob(pjs []*periodicJob, spec, jobName string) []*periodicJob
 	pj := &periodicJob{jobName: jobName, spec: spec, schedule: sched}
 	return append(pjs, pj)
 }
+
+func TestPeriodicEnqueuerDryRun(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work"
+	cleanKeyspace(ns, pool)
+
+	var pjs []*periodicJob
+	pjs = appendPeriodicJob(pjs, "0 * * * * *", "foo") // Every minute
+
+	var logs bytes.Buffer
+	clock := &fakeClock{now: time.Unix(1468359453, 0)} // 33 seconds past the minute
+	pe := newPeriodicEnqueuer(newKeyspace(ns), pool, pjs, slog.New(slog.NewTextHandler(&logs, nil)))
+	pe.clock = clock
+	pe.dryRun = true
+
+	assert.True(t, pe.shouldEnqueue())
+	require.NoError(t, pe.enqueue())
+	assert.Equal(t, 4, strings.Count(logs.String(), "periodic_enqueuer.dry_run"))
+	assert.Contains(t, logs.String(), `job_name=foo job_id="periodic:foo:0 * * * * *:1468359480"`)
+
+	// The jobs logged by the previous run aren't logged again.
+	clock.Advance(2 * time.Minute)
+	require.NoError(t, pe.enqueue())
+	assert.Equal(t, 6, strings.Count(logs.String(), "periodic_enqueuer.dry_run"))
+	assert.Equal(t, 1, strings.Count(logs.String(), ":1468359660"))
+
+	assert.EqualValues(t, 0, zsetSize(pool, redisKeyScheduled(newKeyspace(ns))))
+	assert.False(t, keyExists(pool, redisKeyLastPeriodicEnqueue(newKeyspace(ns))))
+}
@@ -0,0 +1,171 @@
+package work
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// PipelinedEnqueuer buffers enqueued jobs and sends them to Redis in a single round trip, either when
+// the buffer reaches the batch size or when Flush is called. It's meant for producers enqueueing many
+// jobs, for which getting a connection from the pool for every job is too expensive.
+//
+// Buffered jobs aren't visible to workers until they're flushed, and they're lost if the process exits
+// before Flush is called. If a flush fails, the jobs which weren't enqueued are kept and sent again by the
+// next flush. A job whose reply is lost, e.g. because the connection dropped, is kept too even though Redis
+// may have enqueued it, so jobs are enqueued at least once.
+// Jobs rejected because their queue is full (see WithMaxQueueLength) are dropped.
+//
+// It's safe for concurrent use.
+type PipelinedEnqueuer struct {
+	enqueuer  *Enqueuer
+	batchSize int
+
+	mtx      sync.Mutex
+	jobs     []*Job
+	rawJSONs [][]byte
+}
+
+// NewPipelinedEnqueuer creates a pipelined enqueuer which enqueues jobs with the namespace, pool and options
+// of enqueuer. The buffered jobs are flushed automatically once there are batchSize of them.
+func NewPipelinedEnqueuer(enqueuer *Enqueuer, batchSize int) *PipelinedEnqueuer {
+	if enqueuer == nil {
+		panic("NewPipelinedEnqueuer needs a non-nil Enqueuer")
+	}
+	if batchSize < 1 {
+		batchSize = 1
+	}
+
+	return &PipelinedEnqueuer{
+		enqueuer:  enqueuer,
+		batchSize: batchSize,
+	}
+}
+
+// Enqueue buffers a job with the specified name and arguments. If the buffer is full, all the buffered jobs are
+// flushed and the error of the flush is returned. The job is returned even then, since it's kept in the buffer.
+func (p *PipelinedEnqueuer) Enqueue(jobName string, args Q) (*Job, error) {
+	return p.EnqueueContext(context.Background(), jobName, args)
+}
+
+// EnqueueContext does the same as Enqueue with context propagation.
+func (p *PipelinedEnqueuer) EnqueueContext(ctx context.Context, jobName string, args Q) (*Job, error) {
+	job := &Job{
+		Name:       jobName,
+		ID:         makeIdentifier(),
+		EnqueuedAt: nowEpochSeconds(),
+		Args:       args,
+		codec:      p.enqueuer.codec,
+	}
+
+	rawJSON, err := p.enqueuer.serialize(ctx, job)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	p.jobs = append(p.jobs, job)
+	p.rawJSONs = append(p.rawJSONs, rawJSON)
+
+	if len(p.jobs) >= p.batchSize {
+		return job, p.flush(ctx)
+	}
+
+	return job, nil
+}
+
+// Buffered returns the number of jobs waiting to be flushed.
+func (p *PipelinedEnqueuer) Buffered() int {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	return len(p.jobs)
+}
+
+// Flush sends the buffered jobs to Redis. The returned error wraps ErrQueueFull if some jobs were dropped
+// because their queue was full. The jobs which failed with any other error are kept in the buffer.
+func (p *PipelinedEnqueuer) Flush() error {
+	return p.FlushContext(context.Background())
+}
+
+// FlushContext does the same as Flush with context propagation.
+func (p *PipelinedEnqueuer) FlushContext(ctx context.Context) error {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	return p.flush(ctx)
+}
+
+func (p *PipelinedEnqueuer) flush(ctx context.Context) error {
+	if len(p.jobs) == 0 {
+		return nil
+	}
+
+	e := p.enqueuer
+
+	conn, err := getConn(ctx, e.Pool)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	for i, job := range p.jobs {
+		if err := e.enqueueScript.Send(conn, e.enqueueScriptArgs(e.queuePrefix+job.Name, job.Name, p.rawJSONs[i])...); err != nil {
+			return err
+		}
+	}
+
+	if err := conn.Flush(); err != nil {
+		return err
+	}
+
+	// Every reply is read so that only the jobs which weren't enqueued stay in the buffer.
+	n := len(p.jobs)
+	var (
+		full, kept int
+		errs       []error
+		jobNames   = make(map[string]struct{})
+	)
+	for i, job := range p.jobs {
+		res, err := redis.String(conn.Receive())
+		switch {
+		case err != nil:
+			errs = append(errs, err)
+			p.jobs[kept] = job
+			p.rawJSONs[kept] = p.rawJSONs[i]
+			kept++
+		case res == "full":
+			full++
+		default:
+			jobNames[job.Name] = struct{}{}
+		}
+	}
+
+	for i := kept; i < n; i++ {
+		p.jobs[i] = nil
+		p.rawJSONs[i] = nil
+	}
+	p.jobs = p.jobs[:kept]
+	p.rawJSONs = p.rawJSONs[:kept]
+
+	for jobName := range jobNames {
+		if err := e.addToKnownJobs(conn, jobName); err != nil {
+			errs = append(errs, err)
+			break
+		}
+	}
+
+	if kept > 0 {
+		errs[0] = fmt.Errorf("%d of %d jobs weren't enqueued and are kept in the buffer: %w", kept, n, errs[0])
+	}
+	if full > 0 {
+		errs = append(errs, fmt.Errorf("%d of %d jobs weren't enqueued: %w", full, n, ErrQueueFull))
+	}
+
+	return errors.Join(errs...)
+}
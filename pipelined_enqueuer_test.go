@@ -0,0 +1,123 @@
+package work
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPipelinedEnqueuer(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work"
+	cleanKeyspace(ns, pool)
+
+	p := NewPipelinedEnqueuer(NewEnqueuer(ns, pool), 3)
+
+	for i := 0; i < 2; i++ {
+		job, err := p.Enqueue("wat", Q{"i": i})
+		require.NoError(t, err)
+		assert.Equal(t, "wat", job.Name)
+	}
+	assert.Equal(t, 2, p.Buffered())
+	assert.EqualValues(t, 0, listSize(pool, redisKeyJobs(newKeyspace(ns), "wat")))
+
+	// The third job fills the buffer.
+	_, err := p.Enqueue("foo", nil)
+	require.NoError(t, err)
+	assert.Equal(t, 0, p.Buffered())
+	assert.EqualValues(t, 2, listSize(pool, redisKeyJobs(newKeyspace(ns), "wat")))
+	assert.EqualValues(t, 1, listSize(pool, redisKeyJobs(newKeyspace(ns), "foo")))
+	assert.ElementsMatch(t, []string{"wat", "foo"}, knownJobs(pool, redisKeyKnownJobs(newKeyspace(ns))))
+
+	_, err = p.Enqueue("wat", Q{"i": 2})
+	require.NoError(t, err)
+	require.NoError(t, p.Flush())
+	require.NoError(t, p.Flush())
+	assert.EqualValues(t, 3, listSize(pool, redisKeyJobs(newKeyspace(ns), "wat")))
+
+	for i := int64(0); i < 3; i++ {
+		assert.Equal(t, i, jobOnQueue(pool, redisKeyJobs(newKeyspace(ns), "wat")).ArgInt64("i"))
+	}
+}
+
+func TestPipelinedEnqueuerQueueFull(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work"
+	cleanKeyspace(ns, pool)
+
+	p := NewPipelinedEnqueuer(NewEnqueuer(ns, pool, WithMaxQueueLength("wat", 1)), 10)
+	for i := 0; i < 3; i++ {
+		_, err := p.Enqueue("wat", nil)
+		require.NoError(t, err)
+	}
+
+	err := p.Flush()
+	assert.True(t, errors.Is(err, ErrQueueFull))
+	assert.Equal(t, 0, p.Buffered())
+	assert.EqualValues(t, 1, listSize(pool, redisKeyJobs(newKeyspace(ns), "wat")))
+}
+
+func TestPipelinedEnqueuerPartialFailure(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work"
+	cleanKeyspace(ns, pool)
+
+	// The queue of the "bad" jobs isn't a list, so they fail while the others are enqueued.
+	conn := pool.Get()
+	_, err := conn.Do("SET", redisKeyJobs(newKeyspace(ns), "bad"), "x")
+	require.NoError(t, err)
+
+	p := NewPipelinedEnqueuer(NewEnqueuer(ns, pool), 10)
+	for _, jobName := range []string{"wat", "bad", "wat"} {
+		_, err := p.Enqueue(jobName, nil)
+		require.NoError(t, err)
+	}
+
+	assert.Error(t, p.Flush())
+	assert.Equal(t, 1, p.Buffered())
+	assert.EqualValues(t, 2, listSize(pool, redisKeyJobs(newKeyspace(ns), "wat")))
+	assert.ElementsMatch(t, []string{"wat"}, knownJobs(pool, redisKeyKnownJobs(newKeyspace(ns))))
+
+	// Only the failed job is sent again.
+	_, err = conn.Do("DEL", redisKeyJobs(newKeyspace(ns), "bad"))
+	require.NoError(t, err)
+	conn.Close()
+
+	require.NoError(t, p.Flush())
+	assert.Equal(t, 0, p.Buffered())
+	assert.EqualValues(t, 2, listSize(pool, redisKeyJobs(newKeyspace(ns), "wat")))
+	assert.EqualValues(t, 1, listSize(pool, redisKeyJobs(newKeyspace(ns), "bad")))
+}
+
+func BenchmarkEnqueue(b *testing.B) {
+	pool := newTestPool(":6379")
+	ns := "work"
+	cleanKeyspace(ns, pool)
+	enqueuer := NewEnqueuer(ns, pool)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := enqueuer.Enqueue("wat", Q{"i": i}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkPipelinedEnqueue(b *testing.B) {
+	pool := newTestPool(":6379")
+	ns := "work"
+	cleanKeyspace(ns, pool)
+	p := NewPipelinedEnqueuer(NewEnqueuer(ns, pool), 100)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := p.Enqueue("wat", Q{"i": i}); err != nil {
+			b.Fatal(err)
+		}
+	}
+	if err := p.Flush(); err != nil {
+		b.Fatal(err)
+	}
+}
@@ -2,6 +2,7 @@ package work
 
 import (
 	"math/rand"
+	"sort"
 )
 
 type prioritySampler struct {
@@ -19,9 +20,13 @@ type sampleItem struct {
 	redisJobsLock           string
 	redisJobsLockInfo       string
 	redisJobsMaxConcurrency string
+	redisJobsRateLimit      string
+	redisJobsBlocked        string
+	redisRetry              string
+	redisJobsInProgLeases   string
 }
 
-func (s *prioritySampler) add(priority uint, redisJobs, redisJobsInProg, redisJobsPaused, redisJobsLock, redisJobsLockInfo, redisJobsMaxConcurrency string) {
+func (s *prioritySampler) add(priority uint, redisJobs, redisJobsInProg, redisJobsPaused, redisJobsLock, redisJobsLockInfo, redisJobsMaxConcurrency, redisJobsRateLimit, redisJobsBlocked, redisRetry, redisJobsInProgLeases string) {
 	sample := sampleItem{
 		priority:                priority,
 		redisJobs:               redisJobs,
@@ -30,6 +35,10 @@ func (s *prioritySampler) add(priority uint, redisJobs, redisJobsInProg, redisJo
 		redisJobsLock:           redisJobsLock,
 		redisJobsLockInfo:       redisJobsLockInfo,
 		redisJobsMaxConcurrency: redisJobsMaxConcurrency,
+		redisJobsRateLimit:      redisJobsRateLimit,
+		redisJobsBlocked:        redisJobsBlocked,
+		redisRetry:              redisRetry,
+		redisJobsInProgLeases:   redisJobsInProgLeases,
 	}
 	s.samples = append(s.samples, sample)
 	s.sum += priority
@@ -79,3 +88,17 @@ func (s *prioritySampler) sample() []sampleItem {
 
 	return s.samples
 }
+
+// byPriority returns a copy of the samples sorted by descending priority, and by queue for equal priorities, so the
+// order is deterministic. Unlike sample, it doesn't modify s.samples.
+func (s *prioritySampler) byPriority() []sampleItem {
+	samples := append([]sampleItem(nil), s.samples...)
+	sort.Slice(samples, func(i, j int) bool {
+		if samples[i].priority != samples[j].priority {
+			return samples[i].priority > samples[j].priority
+		}
+		return samples[i].redisJobs < samples[j].redisJobs
+	})
+
+	return samples
+}
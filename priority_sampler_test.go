@@ -10,9 +10,9 @@ import (
 func TestPrioritySampler(t *testing.T) {
 	ps := prioritySampler{}
 
-	ps.add(5, "jobs.5", "jobsinprog.5", "jobspaused.5", "jobslock.5", "jobslockinfo.5", "jobsconcurrency.5")
-	ps.add(2, "jobs.2a", "jobsinprog.2a", "jobspaused.2a", "jobslock.2a", "jobslockinfo.2a", "jobsconcurrency.2a")
-	ps.add(1, "jobs.1b", "jobsinprog.1b", "jobspaused.1b", "jobslock.1b", "jobslockinfo.1b", "jobsconcurrency.1b")
+	ps.add(5, "jobs.5", "jobsinprog.5", "jobspaused.5", "jobslock.5", "jobslockinfo.5", "jobsconcurrency.5", "jobsratelimit.5", "jobsblocked.5", "retry", "jobsinprogleases.5")
+	ps.add(2, "jobs.2a", "jobsinprog.2a", "jobspaused.2a", "jobslock.2a", "jobslockinfo.2a", "jobsconcurrency.2a", "jobsratelimit.2a", "jobsblocked.2a", "retry", "jobsinprogleases.2a")
+	ps.add(1, "jobs.1b", "jobsinprog.1b", "jobspaused.1b", "jobslock.1b", "jobslockinfo.1b", "jobsconcurrency.1b", "jobsratelimit.1b", "jobsblocked.1b", "retry", "jobsinprogleases.1b")
 
 	var c5 = 0
 	var c2 = 0
@@ -49,7 +49,11 @@ func BenchmarkPrioritySampler(b *testing.B) {
 			"jobspaused."+fmt.Sprint(i),
 			"jobslock."+fmt.Sprint(i),
 			"jobslockinfo."+fmt.Sprint(i),
-			"jobsmaxconcurrency."+fmt.Sprint(i))
+			"jobsmaxconcurrency."+fmt.Sprint(i),
+			"jobsratelimit."+fmt.Sprint(i),
+			"jobsblocked."+fmt.Sprint(i),
+			"retry",
+			"jobsinprogleases."+fmt.Sprint(i))
 	}
 
 	b.ResetTimer()
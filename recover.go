@@ -0,0 +1,52 @@
+package work
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+)
+
+// PanicError is returned by RecoverMiddleware when a handler panics.
+type PanicError struct {
+	Value interface{} // the value passed to panic
+	Stack []byte      // the stack trace of the goroutine at the time of the panic
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v\n\n%s", e.Value, e.Stack)
+}
+
+// Unwrap returns the panic value if it's an error.
+func (e *PanicError) Unwrap() error {
+	err, _ := e.Value.(error)
+	return err
+}
+
+// RecoverMiddleware returns a middleware that recovers panics of the next middleware and the handler.
+// The panic is returned as a *PanicError, so the job is retried or sent to the dead queue as if it had failed,
+// with the stack trace in its error. The panic is logged with the logger, which can be nil.
+//
+// Panics are recovered by the workers even without this middleware, but their stack traces are lost.
+func RecoverMiddleware(logger StructuredLogger) JobContextMiddleware {
+	if logger == nil {
+		logger = noopLogger
+	}
+
+	return func(ctx context.Context, job *Job, next JobContextHandler) (err error) {
+		defer func() {
+			if v := recover(); v != nil {
+				panicErr := &PanicError{Value: v, Stack: debug.Stack()}
+				logger.ErrorContext(ctx, "recover_middleware.panic",
+					slog.String("job_name", job.Name),
+					slog.String("job_id", job.ID),
+					slog.Any("panic", v),
+					slog.String("stack", string(panicErr.Stack)),
+				)
+				err = panicErr
+			}
+		}()
+
+		return next(ctx, job)
+	}
+}
@@ -0,0 +1,57 @@
+package work
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecoverMiddleware(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work"
+	cleanKeyspace(ns, pool)
+
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&logs, nil))
+
+	wp := NewWorkerPool(TestContext{}, 1, ns, pool)
+	wp.Middleware(RecoverMiddleware(logger))
+	wp.JobWithOptions("explode", JobOptions{MaxFails: 1}, func(job *Job) error {
+		panic("boom")
+	})
+
+	_, err := NewEnqueuer(ns, pool).Enqueue("explode", nil)
+	require.NoError(t, err)
+
+	wp.Start()
+	wp.Drain()
+	wp.Stop()
+
+	jobs, _, err := NewClient(ns, pool).DeadJobs(1)
+	require.NoError(t, err)
+	require.Equal(t, 1, len(jobs))
+	assert.True(t, strings.HasPrefix(jobs[0].LastErr, "panic: boom\n"))
+	assert.Contains(t, jobs[0].LastErr, "recover_test.go")
+
+	var jobErr *JobError
+	if assert.True(t, errors.As(jobs[0].LastError(), &jobErr)) {
+		assert.Equal(t, "explode", jobErr.JobName)
+		assert.Equal(t, jobs[0].ID, jobErr.JobID)
+		assert.EqualValues(t, 0, jobErr.Fails)
+		assert.True(t, jobErr.Recovered)
+	}
+
+	assert.Contains(t, logs.String(), "recover_middleware.panic")
+	assert.Contains(t, logs.String(), "job_name=explode")
+}
+
+func TestPanicErrorUnwrap(t *testing.T) {
+	errBoom := errors.New("boom")
+	assert.True(t, errors.Is(&PanicError{Value: errBoom}, errBoom))
+	assert.Nil(t, (&PanicError{Value: "boom"}).Unwrap())
+}
@@ -4,98 +4,244 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"strconv"
 	"strings"
 
 	"github.com/gomodule/redigo/redis"
 )
 
-func redisNamespacePrefix(namespace string) string {
-	l := len(namespace)
-	if (l > 0) && (namespace[l-1] != ':') {
-		namespace = namespace + ":"
+const defaultKeySeparator = ":"
+
+// keyspace is the namespace of the Redis keys of a component with the separator and the cluster mode it was
+// created with, see WithKeySeparator and WithClusterMode. The keys of all the components sharing a namespace must
+// match, so they must all be created with the same options.
+type keyspace struct {
+	namespace string
+	sep       string
+	cluster   bool // wrap the namespace in a hash tag, so that all the keys are in a single Redis Cluster slot
+}
+
+// newKeyspace returns the keyspace of the namespace with the default separator, outside of cluster mode.
+func newKeyspace(namespace string) keyspace {
+	return keyspace{namespace: namespace, sep: defaultKeySeparator}
+}
+
+// withNamespace returns the keyspace of another namespace with the same options, e.g. the one of
+// JobOptions.RetryQueue.
+func (ks keyspace) withNamespace(namespace string) keyspace {
+	ks.namespace = namespace
+	return ks
+}
+
+// inCluster returns the keyspace in cluster mode, so that the scripts accessing the keys of several job types
+// don't fail with CROSSSLOT on Redis Cluster.
+func (ks keyspace) inCluster() keyspace {
+	if ks.namespace == "" {
+		panic("work: cluster mode needs a non-empty namespace")
+	}
+
+	ks.cluster = true
+	return ks
+}
+
+// redisHashTag returns the hash tag of the key, which is the only part of the key
+// hashed by Redis Cluster if it's present, or an empty string.
+func redisHashTag(key string) string {
+	start := strings.IndexByte(key, '{')
+	if start < 0 {
+		return ""
+	}
+
+	end := strings.IndexByte(key[start+1:], '}')
+	if end <= 0 {
+		return ""
+	}
+
+	return key[start+1 : start+1+end]
+}
+
+func redisNamespacePrefix(ks keyspace) string {
+	namespace, sep := ks.namespace, ks.sep
+	if ks.cluster && redisHashTag(namespace) == "" {
+		namespace = "{" + namespace + "}"
+	}
+	if len(namespace) > 0 && !strings.HasSuffix(namespace, sep) {
+		namespace = namespace + sep
 	}
 	return namespace
 }
 
-func redisKeyKnownJobs(namespace string) string {
-	return redisNamespacePrefix(namespace) + "known_jobs"
+func redisKeyKnownJobs(ks keyspace) string {
+	return redisNamespacePrefix(ks) + "known_jobs"
+}
+
+// returns "<namespace>:known_priority_jobs", the set of the queues of EnqueueWithPriority jobs are known to be in,
+// see knownPriorityJob
+func redisKeyKnownPriorityJobs(ks keyspace) string {
+	return redisNamespacePrefix(ks) + "known_priority_jobs"
+}
+
+// knownPriorityJob returns the member of the queue of jobName with the priority in redisKeyKnownPriorityJobs:
+// "<job name><separator><priority>", eg, "export:10".
+func knownPriorityJob(ks keyspace, jobName string, priority uint) string {
+	return jobName + ks.sep + strconv.FormatUint(uint64(priority), 10)
+}
+
+// parseKnownPriorityJob returns the job name and the queue key of a member of redisKeyKnownPriorityJobs. The
+// priority is the part after the last separator, since the job name may contain it.
+func parseKnownPriorityJob(ks keyspace, member string) (string, string, bool) {
+	i := strings.LastIndex(member, ks.sep)
+	if i < 0 {
+		return "", "", false
+	}
+
+	priority, err := strconv.ParseUint(member[i+len(ks.sep):], 10, 0)
+	if err != nil {
+		return "", "", false
+	}
+
+	return member[:i], redisKeyJobsPriority(ks, member[:i], uint(priority)), true
 }
 
 // returns "<namespace>:jobs:"
 // so that we can just append the job name and be good to go
-func redisKeyJobsPrefix(namespace string) string {
-	return redisNamespacePrefix(namespace) + "jobs:"
+func redisKeyJobsPrefix(ks keyspace) string {
+	return redisNamespacePrefix(ks) + "jobs" + ks.sep
+}
+
+func redisKeyJobs(ks keyspace, jobName string) string {
+	return redisKeyJobsPrefix(ks) + jobName
+}
+
+func redisJobNameFromKey(ks keyspace, key string) string {
+	return strings.TrimPrefix(key, redisKeyJobsPrefix(ks))
 }
 
-func redisKeyJobs(namespace, jobName string) string {
-	return redisKeyJobsPrefix(namespace) + jobName
+func redisKeyJobsInProgress(ks keyspace, poolID, jobName string) string {
+	sep := ks.sep
+	return redisKeyJobs(ks, jobName) + sep + poolID + sep + "inprogress"
 }
 
-func redisJobNameFromKey(namespace, key string) string {
-	return strings.TrimPrefix(key, redisKeyJobsPrefix(namespace))
+// redisKeyJobsInProgressLeases is the zset of the jobs in the in-progress queue of the pool, scored by the time
+// their lease expires at in milliseconds, see WithInProgressLeases.
+func redisKeyJobsInProgressLeases(ks keyspace, poolID, jobName string) string {
+	return redisKeyJobsInProgress(ks, poolID, jobName) + ks.sep + "leases"
 }
 
-func redisKeyJobsInProgress(namespace, poolID, jobName string) string {
-	return fmt.Sprintf("%s:%s:inprogress", redisKeyJobs(namespace, jobName), poolID)
+func redisKeyRetry(ks keyspace) string {
+	return redisNamespacePrefix(ks) + "retry"
 }
 
-func redisKeyRetry(namespace string) string {
-	return redisNamespacePrefix(namespace) + "retry"
+func redisKeyDead(ks keyspace) string {
+	return redisNamespacePrefix(ks) + "dead"
 }
 
-func redisKeyDead(namespace string) string {
-	return redisNamespacePrefix(namespace) + "dead"
+// redisKeyMalformed is the default zset of the raw jobs which couldn't be decoded, see WithMalformedJobsKey.
+func redisKeyMalformed(ks keyspace) string {
+	return redisNamespacePrefix(ks) + "malformed"
 }
 
-func redisKeyScheduled(namespace string) string {
-	return redisNamespacePrefix(namespace) + "scheduled"
+func redisKeyScheduled(ks keyspace) string {
+	return redisNamespacePrefix(ks) + "scheduled"
 }
 
-func redisKeyWorkerObservation(namespace, workerID string) string {
-	return redisNamespacePrefix(namespace) + "worker:" + workerID
+func redisKeyWorkerObservation(ks keyspace, workerID string) string {
+	return redisNamespacePrefix(ks) + "worker" + ks.sep + workerID
 }
 
-func redisKeyWorkerPools(namespace string) string {
-	return redisNamespacePrefix(namespace) + "worker_pools"
+// redisKeyWorkerFetch is the hash of the last job fetched by the worker with WithFetchTimeout, so that the worker can
+// take it back if the reply of the fetch was lost.
+func redisKeyWorkerFetch(ks keyspace, workerID string) string {
+	return redisKeyWorkerObservation(ks, workerID) + ks.sep + "fetch"
 }
 
-func redisKeyHeartbeat(namespace, workerPoolID string) string {
-	return redisNamespacePrefix(namespace) + "worker_pools:" + workerPoolID
+func redisKeyWorkerPools(ks keyspace) string {
+	return redisNamespacePrefix(ks) + "worker_pools"
 }
 
-func redisKeyJobsPaused(namespace, jobName string) string {
-	return redisKeyJobs(namespace, jobName) + ":paused"
+func redisKeyHeartbeat(ks keyspace, workerPoolID string) string {
+	return redisKeyWorkerPools(ks) + ks.sep + workerPoolID
 }
 
-func redisKeyJobsLock(namespace, jobName string) string {
-	return redisKeyJobs(namespace, jobName) + ":lock"
+func redisKeyJobsPaused(ks keyspace, jobName string) string {
+	return redisKeyJobs(ks, jobName) + ks.sep + "paused"
 }
 
-func redisJobNameFromLockKey(namespace, key string) string {
-	return redisJobNameFromKey(namespace, strings.TrimSuffix(key, ":lock"))
+func redisKeyJobsLock(ks keyspace, jobName string) string {
+	return redisKeyJobs(ks, jobName) + ks.sep + "lock"
 }
 
-func redisKeyJobsLockInfo(namespace, jobName string) string {
-	return redisKeyJobs(namespace, jobName) + ":lock_info"
+func redisJobNameFromLockKey(ks keyspace, key string) string {
+	return redisJobNameFromKey(ks, strings.TrimSuffix(key, ks.sep+"lock"))
 }
 
-func redisJobNameFromLockInfoKey(namespace, key string) string {
-	return redisJobNameFromKey(namespace, strings.TrimSuffix(key, ":lock_info"))
+func redisKeyJobsLockInfo(ks keyspace, jobName string) string {
+	return redisKeyJobs(ks, jobName) + ks.sep + "lock_info"
 }
 
-func redisKeyJobsConcurrency(namespace, jobName string) string {
-	return redisKeyJobs(namespace, jobName) + ":max_concurrency"
+func redisJobNameFromLockInfoKey(ks keyspace, key string) string {
+	return redisJobNameFromKey(ks, strings.TrimSuffix(key, ks.sep+"lock_info"))
 }
 
-func redisKeyUniqueJob(namespace, jobName string, args map[string]interface{}) (string, error) {
+// redisKeyJobsPriority is the queue of the jobs enqueued with EnqueueWithPriority. It isn't under the jobs prefix,
+// so that it can't collide with the queue of another job type.
+func redisKeyJobsPriority(ks keyspace, jobName string, priority uint) string {
+	sep := ks.sep
+	return redisNamespacePrefix(ks) + "priority_jobs" + sep + jobName + sep + strconv.FormatUint(uint64(priority), 10)
+}
+
+func redisKeyJobsLeases(ks keyspace, jobName string) string {
+	return redisKeyJobs(ks, jobName) + ks.sep + "leases"
+}
+
+func redisKeyJobsConcurrency(ks keyspace, jobName string) string {
+	return redisKeyJobs(ks, jobName) + ks.sep + "max_concurrency"
+}
+
+// redisKeyJobsRateLimit is the hash of the token bucket of JobOptions.RateLimit: the rate and burst written by the
+// pools, and the tokens left and the time they were counted at, updated by the fetch script.
+func redisKeyJobsRateLimit(ks keyspace, jobName string) string {
+	return redisKeyJobs(ks, jobName) + ks.sep + "rate_limit"
+}
+
+// redisKeyJobsAtMostOnce is set if the job type has JobOptions.AtMostOnce, so that the reaper of any pool knows it.
+func redisKeyJobsAtMostOnce(ks keyspace, jobName string) string {
+	return redisKeyJobs(ks, jobName) + ks.sep + "at_most_once"
+}
+
+// redisKeyJobsStrictFIFO is set if the job type has JobOptions.StrictFIFO, so that the requeuers and the reaper of
+// any pool push its jobs back to the end of the queue which is popped first.
+func redisKeyJobsStrictFIFO(ks keyspace, jobName string) string {
+	return redisKeyJobs(ks, jobName) + ks.sep + "strict_fifo"
+}
+
+// redisKeyJobsStrictFIFOBlocked is the hash of the retry queue and the failed job of a JobOptions.StrictFIFO job
+// type: the type isn't fetched while the job is in the retry queue.
+func redisKeyJobsStrictFIFOBlocked(ks keyspace, jobName string) string {
+	return redisKeyJobs(ks, jobName) + ks.sep + "strict_fifo_blocked"
+}
+
+func redisKeyJobsMaxLength(ks keyspace, jobName string) string {
+	return redisKeyJobs(ks, jobName) + ks.sep + "max_length"
+}
+
+func redisKeyUniqueJob(ks keyspace, jobName string, args map[string]interface{}, codec ArgsCodec) (string, error) {
 	var buf bytes.Buffer
+	sep := ks.sep
 
-	buf.WriteString(redisNamespacePrefix(namespace))
-	buf.WriteString("unique:")
+	buf.WriteString(redisNamespacePrefix(ks))
+	buf.WriteString("unique")
+	buf.WriteString(sep)
 	buf.WriteString(jobName)
-	buf.WriteRune(':')
+	buf.WriteString(sep)
 
-	if args != nil {
+	if args != nil && codec != nil {
+		b, err := codec.Marshal(args)
+		if err != nil {
+			return "", err
+		}
+		buf.Write(b)
+	} else if args != nil {
 		err := json.NewEncoder(&buf).Encode(args)
 		if err != nil {
 			return "", err
@@ -105,30 +251,151 @@ func redisKeyUniqueJob(namespace, jobName string, args map[string]interface{}) (
 	return buf.String(), nil
 }
 
-func redisKeyLastPeriodicEnqueue(namespace string) string {
-	return redisNamespacePrefix(namespace) + "last_periodic_enqueue"
+func redisKeyJobResult(ks keyspace, jobID string) string {
+	return redisNamespacePrefix(ks) + "results" + ks.sep + jobID
+}
+
+func redisKeyUniqueJobByKey(ks keyspace, jobName, key string) string {
+	sep := ks.sep
+	return redisNamespacePrefix(ks) + "unique" + sep + jobName + sep + key
+}
+
+func redisKeyIdempotency(ks keyspace, jobName, key string) string {
+	sep := ks.sep
+	return redisNamespacePrefix(ks) + "idempotency" + sep + jobName + sep + key
+}
+
+// redisKeyJobChildren is the list of the jobs enqueued with EnqueueAfter waiting for the job to succeed.
+func redisKeyJobChildren(ks keyspace, jobID string) string {
+	return redisNamespacePrefix(ks) + "children" + ks.sep + jobID
+}
+
+// redisKeyJobOutcome is set to "succeeded" or "failed" once a job is done by the pools with WithJobDependencies,
+// so that EnqueueAfter knows what to do with the children enqueued after that.
+func redisKeyJobOutcome(ks keyspace, jobID string) string {
+	return redisNamespacePrefix(ks) + "outcome" + ks.sep + jobID
+}
+
+func redisKeyPeriodicJob(ks keyspace, id string) string {
+	return redisNamespacePrefix(ks) + "periodic" + ks.sep + id
+}
+
+func redisKeyLastPeriodicEnqueue(ks keyspace) string {
+	return redisNamespacePrefix(ks) + "last_periodic_enqueue"
 }
 
-func redisKeyReaperLock(namespace string) string {
-	return redisNamespacePrefix(namespace) + "reaper_lock"
+func redisKeyReaperLock(ks keyspace) string {
+	return redisNamespacePrefix(ks) + "reaper_lock"
 }
 
 // Used to fetch the next job to run
 //
-// KEYS[1] = the 1st job queue we want to try, eg, "work:jobs:emails"
+// All the keys the script may access are passed in KEYS, as required on Redis Cluster, in groups of
+// fetchKeysPerJobType keys for each job queue we want to try, in order:
+//
+// KEYS[1] = the 1st job queue, eg, "work:jobs:emails"
 // KEYS[2] = the 1st job queue's in prog queue, eg, "work:jobs:emails:97c84119d13cb54119a38743:inprogress"
-// KEYS[3] = the 2nd job queue...
-// KEYS[4] = the 2nd job queue's in prog queue...
-// ...
-// KEYS[N] = the last job queue...
-// KEYS[N+1] = the last job queue's in prog queue...
+// KEYS[3] = the 1st job queue's paused key
+// KEYS[4] = the 1st job queue's lock key, or leases key with WithLeasedConcurrency
+// KEYS[5] = the 1st job queue's lock info key
+// KEYS[6] = the 1st job queue's max concurrency key
+// KEYS[7] = the 1st job queue's rate limit key, see JobOptions.RateLimit
+// KEYS[8] = the 1st job queue's strict FIFO blocked key, see JobOptions.StrictFIFO
+// KEYS[9] = the 1st job queue's retry queue, which holds the job blocking a strict FIFO job type
+// KEYS[10] = the 1st job queue's in-progress leases key, see WithInProgressLeases
+// KEYS[11...N] = the same keys of the other job queues...
+// KEYS[N+1...] = the in prog queues of all the job types of the worker pool, see ARGV[7]
+// KEYS[last] = the fetch record of the worker, see redisKeyWorkerFetch
 // ARGV[1] = job queue's workerPoolID
+// ARGV[2] = lease id of the worker if the lock keys are leases keys, see WithLeasedConcurrency, or empty
+// ARGV[3] = current time in milliseconds, used with in-progress leases. The leases of WithLeasedConcurrency and the
+// rate limits use the time of Redis instead, since they're shared with the other hosts, whose clocks may disagree.
+// ARGV[4] = lease TTL in milliseconds, used with leases
+// ARGV[5] = maximum number of jobs the worker pool runs at once, see WithMaxTotalConcurrency, or -1 if it has no limit
+// ARGV[6] = in-progress lease TTL in milliseconds, see WithInProgressLeases, or 0 without in-progress leases
+// ARGV[7] = number of the in prog queues of the worker pool before the fetch record, 0 if ARGV[5] is -1 and ARGV[8] is 0
+// ARGV[8] = ID of this fetch, increasing for each fetch of the worker, to record the fetched job under, or 0
+// ARGV[9] = ID of the first fetch of the worker whose reply was lost since its last reply, or 0
+// ARGV[10] = TTL of the fetch record in milliseconds
+//
+// Returns 0 instead of nil if the worker pool has no free slot. If a fetch since ARGV[9] took a job which is still in
+// progress, that job is returned again instead of a new one, so that a timed out fetch doesn't strand its job.
 var redisLuaFetchJob = fmt.Sprintf(`
-local function acquireLock(lockKey, lockInfoKey, workerPoolID)
+%s
+local leaseID, now, leaseTTL = ARGV[2], tonumber(ARGV[3]), tonumber(ARGV[4])
+-- the leases of all the hosts expire by the clock of Redis
+local leaseNow = 0
+if leaseID ~= '' then
+  leaseNow = redisNow()
+end
+local inProgLeaseTTL = tonumber(ARGV[6])
+
+local maxTotal, numInProgQueues = tonumber(ARGV[5]), tonumber(ARGV[7])
+local fetchKey, fetchID, lostFetchID, fetchTTL = KEYS[#KEYS], tonumber(ARGV[8]), tonumber(ARGV[9]), tonumber(ARGV[10])
+local keylen = #KEYS - numInProgQueues - 1
+
+-- the job taken by a fetch whose reply was lost is still in one of the in prog queues of the pool, holding its lock
+if lostFetchID > 0 then
+  local lost = redis.call('hmget', fetchKey, 'id', 'job', 'queue', 'inprog')
+  if tonumber(lost[1]) and tonumber(lost[1]) >= lostFetchID then
+    for i=keylen+1,#KEYS-1 do
+      if KEYS[i] == lost[4] and redis.call('lrem', KEYS[i], 1, lost[2]) > 0 then
+        redis.call('lpush', KEYS[i], lost[2])
+        -- this reply may be lost too
+        redis.call('hset', fetchKey, 'id', fetchID)
+        return {lost[2], lost[3], lost[4]}
+      end
+    end
+  end
+end
+
+-- the in prog queues of the pool hold the jobs it runs, so the job taken below reserves its slot
+if maxTotal >= 0 then
+  local freeSlots = maxTotal
+  for i=keylen+1,#KEYS-1 do
+    freeSlots = freeSlots - redis.call('llen', KEYS[i])
+  end
+  -- a saturated pool leaves the jobs in the queues for the other pools, without taking any lock
+  if freeSlots <= 0 then
+    return 0
+  end
+end
+
+local function acquireLock(lockKey, lockInfoKey, workerPoolID, maxConcurrency)
+  if leaseID ~= '' then
+    -- the leases are only needed to cap the concurrency
+    if maxConcurrency and maxConcurrency > 0 then
+      redis.call('zadd', lockKey, leaseNow + leaseTTL, leaseID)
+      redis.call('pexpire', lockKey, leaseTTL)
+    end
+    return
+  end
   redis.call('incr', lockKey)
   redis.call('hincrby', lockInfoKey, workerPoolID, 1)
 end
 
+-- takes a token from the bucket of the job type, refilled at its rate since the last token was taken
+local function takeToken(rateLimitKey)
+  local bucket = redis.call('hmget', rateLimitKey, 'rate', 'burst', 'tokens', 'ts')
+  local rate = tonumber(bucket[1])
+  if not rate or rate <= 0 then
+    return true
+  end
+  local burst = tonumber(bucket[2]) or 1
+  local tokens = tonumber(bucket[3]) or burst
+  local now = redisNow()
+  local ts = tonumber(bucket[4]) or now
+  if now > ts then
+    tokens = math.min(burst, tokens + (now - ts) * rate / 1000)
+    ts = now
+  end
+  if tokens < 1 then
+    return false
+  end
+  redis.call('hset', rateLimitKey, 'tokens', tokens - 1, 'ts', ts)
+  return true
+end
+
 local function haveJobs(jobQueue)
   return redis.call('llen', jobQueue) > 0
 end
@@ -137,8 +404,30 @@ local function isPaused(pauseKey)
   return redis.call('get', pauseKey)
 end
 
+-- a strict FIFO job type is blocked while its failed job waits in the retry queue
+local function isBlocked(blockedKey, retryQueue)
+  local blocked = redis.call('hmget', blockedKey, 'queue', 'job')
+  if not blocked[2] then
+    return false
+  end
+  -- the job waits in the retry queue of the job type, unless its RetryQueue was changed since it failed
+  if blocked[1] == retryQueue and redis.call('zscore', retryQueue, blocked[2]) then
+    return true
+  end
+  -- the retry was requeued or deleted
+  redis.call('del', blockedKey)
+  return false
+end
+
 local function canRun(lockKey, maxConcurrency)
-  local activeJobs = tonumber(redis.call('get', lockKey))
+  local activeJobs
+  if leaseID ~= '' and maxConcurrency and maxConcurrency > 0 then
+    -- the expired leases are the ones of crashed workers
+    redis.call('zremrangebyscore', lockKey, '-inf', leaseNow)
+    activeJobs = redis.call('zcard', lockKey)
+  elseif leaseID == '' then
+    activeJobs = tonumber(redis.call('get', lockKey))
+  end
   if (not maxConcurrency or maxConcurrency == 0) or (not activeJobs or activeJobs < maxConcurrency) then
     -- default case: maxConcurrency not defined or set to 0 means no cap on concurrent jobs OR
     -- maxConcurrency set, but lock does not yet exist OR
@@ -150,8 +439,8 @@ local function canRun(lockKey, maxConcurrency)
   end
 end
 
-local res, jobQueue, inProgQueue, pauseKey, lockKey, maxConcurrency, workerPoolID, concurrencyKey, lockInfoKey
-local keylen = #KEYS
+local res, jobQueue, inProgQueue, pauseKey, lockKey, maxConcurrency, workerPoolID, concurrencyKey, lockInfoKey, rateLimitKey
+local blockedKey, retryQueue, inProgLeasesKey
 workerPoolID = ARGV[1]
 
 for i=1,keylen,%d do
@@ -161,30 +450,58 @@ for i=1,keylen,%d do
   lockKey = KEYS[i+3]
   lockInfoKey = KEYS[i+4]
   concurrencyKey = KEYS[i+5]
+  rateLimitKey = KEYS[i+6]
+  blockedKey = KEYS[i+7]
+  retryQueue = KEYS[i+8]
+  inProgLeasesKey = KEYS[i+9]
 
   maxConcurrency = tonumber(redis.call('get', concurrencyKey))
 
-  if haveJobs(jobQueue) and not isPaused(pauseKey) and canRun(lockKey, maxConcurrency) then
-    acquireLock(lockKey, lockInfoKey, workerPoolID)
+  if haveJobs(jobQueue) and not isPaused(pauseKey) and not isBlocked(blockedKey, retryQueue) and canRun(lockKey, maxConcurrency) and takeToken(rateLimitKey) then
+    acquireLock(lockKey, lockInfoKey, workerPoolID, maxConcurrency)
     res = redis.call('rpoplpush', jobQueue, inProgQueue)
+    if inProgLeaseTTL > 0 then
+      -- the key outlives the leases, so the sweeper sees them expire, but not the pool if it dies
+      redis.call('zadd', inProgLeasesKey, now + inProgLeaseTTL, res)
+      redis.call('pexpire', inProgLeasesKey, 2 * inProgLeaseTTL)
+    end
+    if fetchID > 0 then
+      redis.call('hset', fetchKey, 'id', fetchID, 'job', res, 'queue', jobQueue, 'inprog', inProgQueue)
+      redis.call('pexpire', fetchKey, fetchTTL)
+    end
     return {res, jobQueue, inProgQueue}
   end
 end
-return nil`, fetchKeysPerJobType)
+return nil`, redisLuaNow, fetchKeysPerJobType)
 
 // Used to remove job from the in-progress queue.
 //
 // KEYS[1] = in-progress job queue
-// KEYS[2] = job's lock key
+// KEYS[2] = job's lock key, or leases key
 // KEYS[3] = job's lock info key
 // KEYS[4] = forward queue
+// KEYS[5] = in-progress leases key, see WithInProgressLeases
+// KEYS[6] = strict FIFO blocked key of the job type, see JobOptions.StrictFIFO
+// KEYS[7] = children of the job, see EnqueueAfter
+// KEYS[8] = outcome of the job
 // ARGV[1] = worker pool id
 // ARGV[2] = job value
 // ARGV[3] = should the failed job be redirected to another queue?
 // ARGV[4] = failed job score
 // ARGV[5] = failed job value
-var redisRemoveJobFromInProgress = redis.NewScript(4, `
+// ARGV[6] = lease id if KEYS[2] is the job's leases key, see WithLeasedConcurrency
+// ARGV[7] = 1 if the job has an in-progress lease in KEYS[5], 0 otherwise
+// ARGV[8] = 1 if the job type must be blocked until the forwarded job leaves the forward queue, 0 otherwise
+// ARGV[9] = 'succeeded' or 'failed' to enqueue or cancel the children in KEYS[7], or empty if the job isn't done
+// ARGV[10] = TTL of the outcome in seconds
+// ARGV[11] = jobs prefix, eg, "work:jobs:". We'll take that and append the job name from the JSON object in order to queue up a child
+// Returns the number of children enqueued or cancelled
+var redisRemoveJobFromInProgress = redis.NewScript(8, `
 local function releaseLock(lockKey, lockInfoKey, workerPoolID)
+  if ARGV[6] ~= '' then
+    redis.call('zrem', lockKey, ARGV[6])
+    return
+  end
   redis.call('decr', lockKey)
   redis.call('hincrby', lockInfoKey, workerPoolID, -1)
 end
@@ -199,6 +516,9 @@ local result = tonumber(redis.call('lrem', inProgQueue, 1, job))
 
 if result ~= 0 then
   releaseLock(lockKey, lockInfoKey, workerPoolID)
+  if ARGV[7] == '1' then
+    redis.call('zrem', KEYS[5], job)
+  end
 
   if forward then
     local queue = KEYS[4]
@@ -206,46 +526,163 @@ if result ~= 0 then
     local failedJob = ARGV[5]
 
     redis.call('zadd', queue, score, failedJob)
+    if ARGV[8] == '1' then
+      redis.call('hset', KEYS[6], 'queue', queue, 'job', failedJob)
+    end
+  end
+
+  -- the children are resolved with the ack, so they can't be left behind by a worker dying in between
+  if ARGV[9] ~= '' then
+    redis.call('set', KEYS[8], ARGV[9], 'EX', ARGV[10])
+    local children = redis.call('lrange', KEYS[7], 0, -1)
+    redis.call('del', KEYS[7])
+    if ARGV[9] == 'succeeded' then
+      for _, child in ipairs(children) do
+        redis.call('lpush', ARGV[11] .. cjson.decode(child)['name'], child)
+      end
+    end
+    return #children
   end
 end
 
-return nil
+return 0
 `)
 
+// Used by the client to re-enqueue a single job that is in progress. Like redisRemoveJobFromInProgress,
+// the lock is only released if the job was removed from the in-progress queue, so it's safe to call twice.
+//
+// KEYS[1] = in-progress job queue
+// KEYS[2] = job queue
+// KEYS[3] = job's lock key
+// KEYS[4] = job's lock info key
+// ARGV[1] = worker pool id
+// ARGV[2] = job id
+// Returns 1 if the job was requeued, 0 if it wasn't found
+var redisLuaRequeueInProgressJob = `
+local jobs = redis.call('lrange', KEYS[1], 0, -1)
+for _, job in ipairs(jobs) do
+  local j = cjson.decode(job)
+  if j['id'] == ARGV[2] then
+    if tonumber(redis.call('lrem', KEYS[1], 1, job)) ~= 0 then
+      redis.call('lpush', KEYS[2], job)
+      -- the lock isn't held by pools with leased concurrency, whose leases expire on their own
+      if (tonumber(redis.call('hget', KEYS[4], ARGV[1])) or 0) > 0 then
+        redis.call('decr', KEYS[3])
+        redis.call('hincrby', KEYS[4], ARGV[1], -1)
+      end
+      return 1
+    end
+  end
+end
+return 0
+`
+
+// Used by the sweeper of WithInProgressLeases to re-enqueue the jobs of a job type which are still in progress
+// in the pool after their lease expired, e.g. because their worker is wedged.
+//
+// KEYS[1] = in-progress leases key, eg "work:jobs:emails:97c84119d13cb54119a38743:inprogress:leases"
+// KEYS[2] = in-progress job queue
+// KEYS[3] = job queue
+// KEYS[4] = job's lock key
+// KEYS[5] = job's lock info key
+// KEYS[6] = job's at most once key, see JobOptions.AtMostOnce
+// KEYS[7] = job's strict FIFO key, see JobOptions.StrictFIFO
+// KEYS[8] = dead queue
+// ARGV[1] = worker pool id
+// ARGV[2] = current time in milliseconds
+// ARGV[3] = current time in epoch seconds
+// Returns: {number of requeued jobs, number of at most once jobs moved to the dead queue}
+var redisLuaSweepInProgressLeases = `
+local requeued, died = 0, 0
+local expired = redis.call('zrangebyscore', KEYS[1], '-inf', ARGV[2])
+for _, job in ipairs(expired) do
+  redis.call('zrem', KEYS[1], job)
+  -- the job may have been requeued by the reaper or the client since it was dequeued
+  if tonumber(redis.call('lrem', KEYS[2], 1, job)) ~= 0 then
+    -- the lock isn't held by pools with leased concurrency, whose leases are renewed by the wedged worker
+    if (tonumber(redis.call('hget', KEYS[5], ARGV[1])) or 0) > 0 then
+      redis.call('decr', KEYS[4])
+      redis.call('hincrby', KEYS[5], ARGV[1], -1)
+    end
+    if redis.call('exists', KEYS[6]) == 1 then
+      local j = cjson.decode(job)
+      j['fails'] = (j['fails'] or 0) + 1
+      j['err'] = 'lease of the at most once job expired while it was in progress'
+      j['err_recovered'] = nil
+      j['failed_at'] = tonumber(ARGV[3])
+      redis.call('zadd', KEYS[8], ARGV[3], cjson.encode(j))
+      died = died + 1
+    elseif redis.call('exists', KEYS[7]) == 1 then
+      -- the job was the oldest of a strict FIFO queue
+      redis.call('rpush', KEYS[3], job)
+      requeued = requeued + 1
+    else
+      redis.call('lpush', KEYS[3], job)
+      requeued = requeued + 1
+    end
+  end
+end
+return {requeued, died}
+`
+
 // Used by the reaper to re-enqueue jobs that were in progress
 //
 // KEYS[1] = the 1st job's in progress queue
 // KEYS[2] = the 1st job's job queue
 // KEYS[3] = the 1nd job's lock key
 // KEYS[4] = the 1nd job's lock info key
-// KEYS[5] = the 2st job's in progress queue
-// KEYS[6] = the 2st job's job queue
-// KEYS[7] = the 2nd job's lock key
-// KEYS[8] = the 2nd job's lock info key
+// KEYS[5] = the 1st job's at most once key, see JobOptions.AtMostOnce
+// KEYS[6] = the 2st job's in progress queue
 // ...
 // KEYS[N] = the last job's in progress queue
 // KEYS[N+1] = the last job's job queue
 // KEYS[N+2] = the last job's lock key
 // KEYS[N+3] = the last job's lock info key
+// KEYS[N+4] = the last job's at most once key
+// KEYS[N+5] = dead queue
 // ARGV[1] = workerPoolID for job queue
+// ARGV[2] = current time in epoch seconds
+// ARGV[3] = strict FIFO key suffix, eg, ":strict_fifo". Appended to the job queue to know if the job goes ahead of the queued jobs
+// Returns {job, in progress queue, job queue}, or {job, in progress queue, dead queue} for at most once jobs
 var redisLuaReenqueueJob = fmt.Sprintf(`
 local function releaseLock(lockKey, lockInfoKey, workerPoolID)
-  redis.call('decr', lockKey)
-  redis.call('hincrby', lockInfoKey, workerPoolID, -1)
+  -- the lock isn't held by pools with leased concurrency, whose leases expire on their own
+  if (tonumber(redis.call('hget', lockInfoKey, workerPoolID)) or 0) > 0 then
+    redis.call('decr', lockKey)
+    redis.call('hincrby', lockInfoKey, workerPoolID, -1)
+  end
 end
 
 local keylen = #KEYS
-local res, jobQueue, inProgQueue, workerPoolID, lockKey, lockInfoKey
+local deadQueue = KEYS[keylen]
+local res, jobQueue, inProgQueue, workerPoolID, lockKey, lockInfoKey, atMostOnceKey
 workerPoolID = ARGV[1]
 
-for i=1,keylen,%d do
+for i=1,keylen-1,%d do
   inProgQueue = KEYS[i]
   jobQueue = KEYS[i+1]
   lockKey = KEYS[i+2]
   lockInfoKey = KEYS[i+3]
-  res = redis.call('rpoplpush', inProgQueue, jobQueue)
+  atMostOnceKey = KEYS[i+4]
+  res = redis.call('rpop', inProgQueue)
   if res then
     releaseLock(lockKey, lockInfoKey, workerPoolID)
+    if redis.call('exists', atMostOnceKey) == 1 then
+      -- the job may have run already: running it again could do more harm than losing it
+      local j = cjson.decode(res)
+      j['fails'] = (j['fails'] or 0) + 1
+      j['err'] = 'worker pool died while the at most once job was in progress'
+      j['err_recovered'] = nil
+      j['failed_at'] = tonumber(ARGV[2])
+      redis.call('zadd', deadQueue, ARGV[2], cjson.encode(j))
+      return {res, inProgQueue, deadQueue}
+    end
+    if redis.call('exists', jobQueue .. ARGV[3]) == 1 then
+      -- the job was the oldest of a strict FIFO queue
+      redis.call('rpush', jobQueue, res)
+    else
+      redis.call('lpush', jobQueue, res)
+    end
     return {res, inProgQueue, jobQueue}
   end
 end
@@ -261,7 +698,7 @@ return nil`, requeueKeysPerJob)
 // KEYS[N] = the last job's lock
 // KEYS[N+1] = the last job's lock info haash
 // ARGV[1] = the dead worker pool id
-// Returns: list of negative locks (which were set to zero)
+// Returns: {negative lock 1, amount it was raised by to set it to zero, negative lock 2, ...}
 var redisLuaReapStaleLocks = `
 local keylen = #KEYS
 local lock, lockInfo, deadLockCount
@@ -274,11 +711,12 @@ for i=1,keylen,2 do
   deadLockCount = tonumber(redis.call('hget', lockInfo, deadPoolID))
 
   if deadLockCount then
-    redis.call('decrby', lock, deadLockCount)
+    local count = redis.call('decrby', lock, deadLockCount)
     redis.call('hdel', lockInfo, deadPoolID)
 
-    if tonumber(redis.call('get', lock)) < 0 then
+    if count < 0 then
       table.insert(negativeLocks, lock)
+      table.insert(negativeLocks, -count)
       redis.call('set', lock, 0)
     end
   end
@@ -291,12 +729,14 @@ return negativeLocks
 // KEYS[2] = zset of dead, eg work:dead. If we don't know the jobName of a job, we'll put it in dead.
 // KEYS[3...] = known job queues, eg ["work:jobs:create_watch", "work:jobs:send_email", ...]
 // ARGV[1] = jobs prefix, eg, "work:jobs:". We'll take that and append the job name from the JSON object in order to queue up a job
-// ARGV[2] = current time in epoch seconds
+// ARGV[2] = max length key suffix, eg, ":max_length". Appended to the queue to get the max length of jobs with a deadline
+// ARGV[3] = current time in epoch seconds
+// ARGV[4] = strict FIFO key suffix, eg, ":strict_fifo", or empty. Appended to the queue to know if the job goes ahead of the queued jobs
 var redisLuaZremLpushCmd = `
 local res, j, queue
-local nowTs = tonumber(ARGV[2])
+local nowTs = tonumber(ARGV[3])
 
-res = redis.call('zrangebyscore', KEYS[1], '-inf', ARGV[2], 'LIMIT', 0, 1)
+res = redis.call('zrangebyscore', KEYS[1], '-inf', ARGV[3], 'LIMIT', 0, 1)
 
 if #res > 0 then
   j = cjson.decode(res[1])
@@ -323,16 +763,32 @@ if #res > 0 then
         end
       end
 
+      -- Jobs with a deadline (eg, periodic jobs) are dropped if the queue is full,
+      -- the same way they're dropped when they're late. Retries are always requeued,
+      -- since dropping them would lose a job that was already accepted.
+      if j['d'] ~= nil and not j['fails'] then
+        local maxLength = tonumber(redis.call('get', queue .. ARGV[2]))
+        if maxLength and maxLength > 0 and redis.call('llen', queue) >= maxLength then
+          return 'full'
+        end
+      end
+
       j['t'] = nowTs
-      redis.call('lpush', queue, cjson.encode(j))
+      if ARGV[4] ~= '' and redis.call('exists', queue .. ARGV[4]) == 1 then
+        -- the retries of strict FIFO jobs run before the jobs enqueued after them
+        redis.call('rpush', queue, cjson.encode(j))
+      else
+        redis.call('lpush', queue, cjson.encode(j))
+      end
 
       return 'ok'
     end
   end
 
   j['err'] = 'unknown job when requeueing'
+  j['err_recovered'] = nil
   j['failed_at'] = nowTs
-  redis.call('zadd', KEYS[2], ARGV[2], cjson.encode(j))
+  redis.call('zadd', KEYS[2], ARGV[3], cjson.encode(j))
 
   return 'dead' -- put on dead queue
 end
@@ -369,6 +825,7 @@ return {deletedCount, jobBytes}
 // ARGV[2] = current time in epoch seconds
 // ARGV[3] = died at. The z rank of the job.
 // ARGV[4] = job ID to requeue
+// ARGV[5] = '1' to append the death to the history of the job
 // Returns: number of jobs requeued (typically 1 or 0)
 var redisLuaRequeueSingleDeadCmd = `
 local jobs, i, j, queue, found, requeuedCount
@@ -383,10 +840,18 @@ for i=1,jobCount do
     found = false
     for _,v in pairs(KEYS) do
       if v == queue then
+        if ARGV[5] == '1' then
+          if type(j['history']) ~= 'table' then
+            j['history'] = {}
+          end
+          table.insert(j['history'], {died_at = tonumber(ARGV[3]), fails = j['fails'], err = j['err']})
+        end
         j['t'] = tonumber(ARGV[2])
         j['fails'] = nil
         j['failed_at'] = nil
+        j['first_t'] = nil
         j['err'] = nil
+        j['err_recovered'] = nil
         redis.call('lpush', queue, cjson.encode(j))
         requeuedCount = requeuedCount + 1
         found = true
@@ -395,6 +860,7 @@ for i=1,jobCount do
     end
     if not found then
       j['err'] = 'unknown job when requeueing'
+      j['err_recovered'] = nil
       j['failed_at'] = tonumber(ARGV[2])
       redis.call('zadd', KEYS[1], ARGV[2] + 5, cjson.encode(j))
     end
@@ -424,7 +890,9 @@ for i=1,jobCount do
       j['t'] = tonumber(ARGV[2])
       j['fails'] = nil
       j['failed_at'] = nil
+      j['first_t'] = nil
       j['err'] = nil
+      j['err_recovered'] = nil
       redis.call('lpush', queue, cjson.encode(j))
       requeuedCount = requeuedCount + 1
       found = true
@@ -433,6 +901,7 @@ for i=1,jobCount do
   end
   if not found then
     j['err'] = 'unknown job when requeueing'
+    j['err_recovered'] = nil
     j['failed_at'] = tonumber(ARGV[2])
     redis.call('zadd', KEYS[1], ARGV[2] + 5, cjson.encode(j))
   end
@@ -440,10 +909,246 @@ end
 return requeuedCount
 `
 
+// KEYS[1] = zset of jobs, eg work:dead
+// ARGV[1] = job name to filter by
+// ARGV[2] = rank of the first job to scan
+// ARGV[3] = max number of jobs to scan
+// ARGV[4] = number of matching jobs found by the previous scans
+// ARGV[5] = number of matching jobs to skip
+// ARGV[6] = max number of matching jobs to return
+// Returns: {rank to continue the scan from, or -1 once the zset is scanned, number of matching jobs found so far,
+// job 1, score 1, job 2, score 2, ...}
+var redisLuaZsetPageByName = `
+local start = tonumber(ARGV[2])
+local batch = tonumber(ARGV[3])
+local matched = tonumber(ARGV[4])
+local offset = tonumber(ARGV[5])
+local limit = tonumber(ARGV[6])
+local values = redis.call('zrange', KEYS[1], start, start + batch - 1, 'WITHSCORES')
+local res = {-1, 0}
+for i=1,#values,2 do
+  local j = cjson.decode(values[i])
+  if j['name'] == ARGV[1] then
+    if matched >= offset and matched < offset + limit then
+      table.insert(res, values[i])
+      table.insert(res, values[i+1])
+    end
+    matched = matched + 1
+  end
+end
+if #values == 2 * batch then
+  res[1] = start + batch
+end
+res[2] = matched
+return res
+`
+
+// KEYS[1] = zset of jobs, eg work:dead
+// ARGV[1] = job name to delete
+// ARGV[2] = rank of the first job to scan
+// ARGV[3] = max number of jobs to scan
+// Returns: {rank to continue the scan from, or -1 once the zset is scanned, number of deleted jobs}
+var redisLuaZsetDeleteByName = `
+local start = tonumber(ARGV[2])
+local batch = tonumber(ARGV[3])
+local values = redis.call('zrange', KEYS[1], start, start + batch - 1)
+local deleted = 0
+for i=1,#values do
+  local j = cjson.decode(values[i])
+  if j['name'] == ARGV[1] then
+    redis.call('zrem', KEYS[1], values[i])
+    deleted = deleted + 1
+  end
+end
+if #values < batch then
+  return {-1, deleted}
+end
+return {start + #values - deleted, deleted}
+`
+
+// Used to move jobs from the queue of a namespace to the one of another namespace, oldest first, see
+// Client.MigrateQueue.
+//
+// KEYS[1] = source job queue, eg old:jobs:send_email
+// KEYS[2] = destination job queue, eg new:jobs:send_email
+// KEYS[3] = known jobs set of the destination namespace, eg new:known_jobs
+// ARGV[1] = name of the job in the destination namespace
+// ARGV[2] = 1 if the name of the jobs must be rewritten with ARGV[1], 0 otherwise
+// ARGV[3] = max number of jobs to move
+// Returns: number of moved jobs
+var redisLuaMigrateQueue = `
+local name, rename = ARGV[1], ARGV[2] == '1'
+local moved = 0
+for i=1,tonumber(ARGV[3]) do
+  local job = redis.call('rpop', KEYS[1])
+  if not job then
+    break
+  end
+  if rename then
+    local j = cjson.decode(job)
+    j['name'] = name
+    job = cjson.encode(j)
+  end
+  redis.call('lpush', KEYS[2], job)
+  moved = moved + 1
+end
+if moved > 0 then
+  redis.call('sadd', KEYS[3], name)
+end
+return moved
+`
+
+// Used to remove the jobs past their TTL from a job queue, see EnqueueWithTTL. The expired jobs of a batch are
+// replaced with a tombstone, and the tombstones are removed from the head of the queue in a single LREM.
+//
+// KEYS[1] = job queue, eg work:jobs:send_email
+// ARGV[1] = current time in epoch seconds
+// ARGV[2] = index of the first job of the batch
+// ARGV[3] = batch size
+// Returns: {index of the next batch or -1 if it was the last one, number of removed jobs}
+var redisLuaSweepExpiredJobs = `
+local now = tonumber(ARGV[1])
+local start = tonumber(ARGV[2])
+local batch = tonumber(ARGV[3])
+local tombstone = '__work_expired__'
+local values = redis.call('lrange', KEYS[1], start, start + batch - 1)
+local removed = 0
+for i=1,#values do
+  local j = cjson.decode(values[i])
+  if j['expires_at'] ~= nil and now > j['expires_at'] then
+    redis.call('lset', KEYS[1], start + i - 1, tombstone)
+    removed = removed + 1
+  end
+end
+if removed > 0 then
+  redis.call('lrem', KEYS[1], removed, tombstone)
+end
+if #values < batch then
+  return {-1, removed}
+end
+return {start + #values - removed, removed}
+`
+
+// KEYS[1] = zset of retry jobs, eg work:retry
+// KEYS[2] = zset of dead jobs, eg work:dead. Jobs with unknown names are put there.
+// KEYS[3...] = known job queues, eg ["work:jobs:create_watch", "work:jobs:send_email", ...]
+// ARGV[1] = jobs prefix, eg, "work:jobs:". We'll take that and append the job name from the JSON object in order to queue up a job
+// ARGV[2] = current time in epoch seconds
+// ARGV[3] = max number of jobs to requeue
+// Returns: {number of jobs removed from the retry zset, number of jobs requeued}
+var redisLuaRequeueAllRetryCmd = `
+local jobs, j, queue, found, requeuedCount
+jobs = redis.call('zrange', KEYS[1], 0, tonumber(ARGV[3]) - 1)
+requeuedCount = 0
+for i=1,#jobs do
+  j = cjson.decode(jobs[i])
+  redis.call('zrem', KEYS[1], jobs[i])
+  queue = ARGV[1] .. j['name']
+  found = false
+  for k=3,#KEYS do
+    if KEYS[k] == queue then
+      j['t'] = tonumber(ARGV[2])
+      j['fails'] = nil
+      j['failed_at'] = nil
+      j['first_t'] = nil
+      j['err'] = nil
+      j['err_recovered'] = nil
+      redis.call('lpush', queue, cjson.encode(j))
+      requeuedCount = requeuedCount + 1
+      found = true
+      break
+    end
+  end
+  if not found then
+    j['err'] = 'unknown job when requeueing'
+    j['err_recovered'] = nil
+    j['failed_at'] = tonumber(ARGV[2])
+    redis.call('zadd', KEYS[2], ARGV[2], cjson.encode(j))
+  end
+end
+return {#jobs, requeuedCount}
+`
+
+// KEYS[1] = zset of retry jobs, eg work:retry
+// KEYS[2] = zset of dead jobs, eg work:dead. Jobs with unknown names are put there.
+// KEYS[3...] = known job queues, eg ["work:jobs:create_watch", "work:jobs:send_email", ...]
+// ARGV[1] = jobs prefix, eg, "work:jobs:". We'll take that and append the job name from the JSON object in order to queue up a job
+// ARGV[2] = current time in epoch seconds
+// ARGV[3] = retry at. The z rank of the job.
+// ARGV[4] = job ID to requeue
+// Returns: number of jobs requeued (typically 1 or 0)
+var redisLuaRequeueSingleRetryCmd = `
+local jobs, j, queue, found, requeuedCount
+jobs = redis.call('zrangebyscore', KEYS[1], ARGV[3], ARGV[3])
+requeuedCount = 0
+for i=1,#jobs do
+  j = cjson.decode(jobs[i])
+  if j['id'] == ARGV[4] then
+    redis.call('zrem', KEYS[1], jobs[i])
+    queue = ARGV[1] .. j['name']
+    found = false
+    for k=3,#KEYS do
+      if KEYS[k] == queue then
+        j['t'] = tonumber(ARGV[2])
+        j['fails'] = nil
+        j['failed_at'] = nil
+        j['first_t'] = nil
+        j['err'] = nil
+        j['err_recovered'] = nil
+        redis.call('lpush', queue, cjson.encode(j))
+        requeuedCount = requeuedCount + 1
+        found = true
+        break
+      end
+    end
+    if not found then
+      j['err'] = 'unknown job when requeueing'
+      j['err_recovered'] = nil
+      j['failed_at'] = tonumber(ARGV[2])
+      redis.call('zadd', KEYS[2], ARGV[2], cjson.encode(j))
+    end
+  end
+end
+return requeuedCount
+`
+
+// KEYS[1] = job queue to push onto
+// KEYS[2] = max length of the job queue, eg, work:jobs:send_email:max_length
+// ARGV[1] = job
+// ARGV[2] = max length set by the enqueuer. Stored in KEYS[2] unless empty. 0 means no limit.
+// Returns 'ok' or 'full'
+var redisLuaEnqueue = `
+local maxLength = ARGV[2]
+if maxLength ~= '' then
+  redis.call('set', KEYS[2], maxLength)
+else
+  maxLength = redis.call('get', KEYS[2])
+end
+maxLength = tonumber(maxLength)
+if maxLength and maxLength > 0 and redis.call('llen', KEYS[1]) >= maxLength then
+  return 'full'
+end
+redis.call('lpush', KEYS[1], ARGV[1])
+return 'ok'
+`
+
 // KEYS[1] = job queue to push onto
 // KEYS[2] = Unique job's key. Test for existence and set if we push.
+// KEYS[3] = max length of the job queue
 // ARGV[1] = job
+// ARGV[2] = max length set by the enqueuer, see redisLuaEnqueue
+// Returns 'ok', 'dup' or 'full'
 var redisLuaEnqueueUnique = `
+local maxLength = ARGV[2]
+if maxLength ~= '' then
+  redis.call('set', KEYS[3], maxLength)
+else
+  maxLength = redis.call('get', KEYS[3])
+end
+maxLength = tonumber(maxLength)
+if maxLength and maxLength > 0 and redis.call('llen', KEYS[1]) >= maxLength then
+  return 'full'
+end
 if redis.call('set', KEYS[2], '1', 'NX', 'EX', '86400') then
   redis.call('lpush', KEYS[1], ARGV[1])
   return 'ok'
@@ -451,6 +1156,33 @@ end
 return 'dup'
 `
 
+// KEYS[1] = job queue to push onto
+// KEYS[2] = max length of the job queue
+// KEYS[3] = idempotency key. Holds the job that was pushed with it.
+// ARGV[1] = job
+// ARGV[2] = max length set by the enqueuer, see redisLuaEnqueue
+// ARGV[3] = TTL of the idempotency key in milliseconds
+// Returns {'ok'}, {'dup', original job} or {'full'}
+var redisLuaEnqueueIdempotent = `
+local orig = redis.call('get', KEYS[3])
+if orig then
+  return {'dup', orig}
+end
+local maxLength = ARGV[2]
+if maxLength ~= '' then
+  redis.call('set', KEYS[2], maxLength)
+else
+  maxLength = redis.call('get', KEYS[2])
+end
+maxLength = tonumber(maxLength)
+if maxLength and maxLength > 0 and redis.call('llen', KEYS[1]) >= maxLength then
+  return {'full'}
+end
+redis.call('lpush', KEYS[1], ARGV[1])
+redis.call('set', KEYS[3], ARGV[1], 'PX', ARGV[3])
+return {'ok'}
+`
+
 // KEYS[1] = scheduled job queue
 // KEYS[2] = Unique job's key. Test for existence and set if we push.
 // ARGV[1] = job
@@ -463,6 +1195,48 @@ end
 return 'dup'
 `
 
+// KEYS[1] = children of the parent job waiting for it to succeed, eg, work:children:<parent id>
+// KEYS[2] = outcome of the parent job, set once it's done
+// KEYS[3] = job queue to push onto if the parent job succeeded
+// ARGV[1] = job
+// ARGV[2] = TTL of the children in seconds
+// Returns 'ok' if the job was pushed, 'pending' if it waits for the parent job, or 'cancelled' if the parent job failed
+var redisLuaEnqueueAfter = `
+local outcome = redis.call('get', KEYS[2])
+if outcome == 'succeeded' then
+  redis.call('lpush', KEYS[3], ARGV[1])
+  return 'ok'
+elseif outcome == 'failed' then
+  return 'cancelled'
+end
+redis.call('rpush', KEYS[1], ARGV[1])
+redis.call('expire', KEYS[1], ARGV[2])
+return 'pending'
+`
+
+// Defines redisNow, which returns the time of Redis in milliseconds. Scripts calling it must not write before
+// it's defined, since Redis before 5 only replicates their effects, rather than the non-deterministic script, if
+// they say so before writing.
+var redisLuaNow = `
+if redis.replicate_commands then
+  redis.replicate_commands()
+end
+local function redisNow()
+  local t = redis.call('time')
+  return tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+end
+`
+
+// Used by a worker to renew its lease while it runs a job, see WithLeasedConcurrency.
+//
+// KEYS[1] = leases key of the job type, eg "work:jobs:emails:leases"
+// ARGV[1] = lease id of the worker
+// ARGV[2] = lease TTL in milliseconds
+var redisExtendLeaseScript = redis.NewScript(1, redisLuaNow+`
+redis.call('zadd', KEYS[1], 'XX', redisNow() + tonumber(ARGV[2]), ARGV[1])
+return redis.call('pexpire', KEYS[1], ARGV[2])
+`)
+
 // Used by the reaper to release acquired lock.
 //
 // KEYS[1] = reaper lock key
@@ -508,11 +1282,11 @@ return cjson.encode(unknownPools)
 `)
 
 // Used by the reaper to DECR dangling locks. Returns the dangling lock keys that
-// have been fixed.
+// have been fixed, with the amount they were changed by.
 //
 // KEYS[1] = job's lock key
 // KEYS[2...] = job's lock info key
-// Returns: ["ns:jobs:job1:lock", "ns:jobs:job3:lock"]
+// Returns: ["ns:jobs:job1:lock", -1, "ns:jobs:job3:lock", 2]
 var redisRemoveDanglingLocksScript = redis.NewScript(-1, `
 local danglingLocks = {}
 
@@ -533,6 +1307,7 @@ for i=1,#KEYS,2 do
         local diff = locks - totalLocks
         if diff ~= 0 then
             table.insert(danglingLocks, lockKey)
+            table.insert(danglingLocks, -diff)
             redis.call('decrby', lockKey, diff)
         end
     end
@@ -8,8 +8,9 @@ import (
 )
 
 type requeuer struct {
-	namespace string
-	pool      Pool
+	keys     keyspace
+	pool     Pool
+	jobNames []string
 
 	redisRequeueScript *redis.Script
 	redisRequeueArgs   []interface{}
@@ -20,28 +21,41 @@ type requeuer struct {
 	drainChan        chan struct{}
 	doneDrainingChan chan struct{}
 
-	logger StructuredLogger
+	failover *failoverState // shared with the other loops of the pool
+	clock    Clock
+	metrics  MetricsReporter
+	logger   StructuredLogger
 }
 
 func newRequeuer(
-	namespace string,
+	keys keyspace,
 	pool Pool,
 	requeueKey string,
 	jobNames []string,
+	metrics MetricsReporter,
 	logger StructuredLogger,
 ) *requeuer {
-	args := make([]interface{}, 0, len(jobNames)+2+2)
-	args = append(args, requeueKey)              // KEY[1]
-	args = append(args, redisKeyDead(namespace)) // KEY[2]
+	// Only the retries of strict FIFO jobs go ahead of the queued jobs: the scheduled jobs are due after them.
+	strictFIFOSuffix := ""
+	if requeueKey == redisKeyRetry(keys) {
+		strictFIFOSuffix = keys.sep + "strict_fifo"
+	}
+
+	args := make([]interface{}, 0, len(jobNames)+2+4)
+	args = append(args, requeueKey)         // KEY[1]
+	args = append(args, redisKeyDead(keys)) // KEY[2]
 	for _, jobName := range jobNames {
-		args = append(args, redisKeyJobs(namespace, jobName)) // KEY[3, 4, ...]
+		args = append(args, redisKeyJobs(keys, jobName)) // KEY[3, 4, ...]
 	}
-	args = append(args, redisKeyJobsPrefix(namespace)) // ARGV[1]
-	args = append(args, 0)                             // ARGV[2] -- NOTE: We're going to change this one on every call
+	args = append(args, redisKeyJobsPrefix(keys)) // ARGV[1]
+	args = append(args, keys.sep+"max_length")    // ARGV[2]
+	args = append(args, 0)                        // ARGV[3] -- NOTE: We're going to change this one on every call
+	args = append(args, strictFIFOSuffix)         // ARGV[4]
 
 	return &requeuer{
-		namespace: namespace,
-		pool:      pool,
+		keys:     keys,
+		pool:     pool,
+		jobNames: jobNames,
 
 		redisRequeueScript: redis.NewScript(len(jobNames)+2, redisLuaZremLpushCmd),
 		redisRequeueArgs:   args,
@@ -52,7 +66,9 @@ func newRequeuer(
 		drainChan:        make(chan struct{}),
 		doneDrainingChan: make(chan struct{}),
 
-		logger: logger,
+		clock:   defaultClock,
+		metrics: metrics,
+		logger:  logger,
 	}
 }
 
@@ -84,26 +100,39 @@ func (r *requeuer) loop() {
 			r.doneStoppingChan <- struct{}{}
 			return
 		case <-r.drainChan:
-			for r.process() {
-			}
+			r.processAll()
 			r.doneDrainingChan <- struct{}{}
 		case <-ticker.C:
-			for r.process() {
+			if r.failover.backoff() == 0 {
+				r.processAll()
 			}
 		}
 	}
 }
 
+// processAll requeues all jobs that are due.
+func (r *requeuer) processAll() {
+	requeued := false
+	for r.process() {
+		requeued = true
+	}
+
+	if requeued {
+		r.reportQueueDepths()
+	}
+}
+
 func (r *requeuer) process() bool {
 	conn := r.pool.Get()
 	defer conn.Close()
 
-	r.redisRequeueArgs[len(r.redisRequeueArgs)-1] = nowEpochSeconds()
+	r.redisRequeueArgs[len(r.redisRequeueArgs)-2] = r.clock.Now().Unix() // ARGV[3]
 
 	res, err := redis.String(r.redisRequeueScript.Do(conn, r.redisRequeueArgs...))
 	if err == redis.ErrNil {
 		return false
 	} else if err != nil {
+		r.failover.failed(err)
 		r.logger.Error("requeuer.process", errAttr(err))
 		return false
 	}
@@ -113,9 +142,42 @@ func (r *requeuer) process() bool {
 	} else if res == "dead" {
 		r.logger.Error("requeuer.process.dead", slog.String("error", "no job name"))
 		return true
+	} else if res == "full" {
+		r.logger.Warn("requeuer.process.queue_full")
+		return true
 	} else if res == "ok" {
 		return true
 	}
 
 	return false
 }
+
+// reportQueueDepths reports the lengths of the job queues after jobs have been
+// requeued. It's a no-op if no metrics reporter is registered.
+func (r *requeuer) reportQueueDepths() {
+	if r.metrics == nil || r.metrics == noopMetrics {
+		return
+	}
+
+	conn := r.pool.Get()
+	defer conn.Close()
+
+	for _, jobName := range r.jobNames {
+		conn.Send("LLEN", redisKeyJobs(r.keys, jobName))
+	}
+
+	if err := conn.Flush(); err != nil {
+		r.logger.Error("requeuer.report_queue_depths.flush", errAttr(err))
+		return
+	}
+
+	for _, jobName := range r.jobNames {
+		n, err := redis.Int64(conn.Receive())
+		if err != nil {
+			r.logger.Error("requeuer.report_queue_depths.receive", errAttr(err))
+			return
+		}
+
+		r.metrics.QueueDepth(jobName, n)
+	}
+}
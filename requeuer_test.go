@@ -32,17 +32,17 @@ func TestRequeue(t *testing.T) {
 
 	resetNowEpochSecondsMock()
 
-	re := newRequeuer(ns, pool, redisKeyScheduled(ns), []string{"wat", "foo", "bar"}, noopLogger)
+	re := newRequeuer(newKeyspace(ns), pool, redisKeyScheduled(newKeyspace(ns)), []string{"wat", "foo", "bar"}, noopMetrics, noopLogger)
 	re.start()
 	re.drain()
 	re.stop()
 
-	assert.EqualValues(t, 2, listSize(pool, redisKeyJobs(ns, "wat")))
-	assert.EqualValues(t, 1, listSize(pool, redisKeyJobs(ns, "foo")))
-	assert.EqualValues(t, 0, listSize(pool, redisKeyJobs(ns, "bar")))
-	assert.EqualValues(t, 2, zsetSize(pool, redisKeyScheduled(ns)))
+	assert.EqualValues(t, 2, listSize(pool, redisKeyJobs(newKeyspace(ns), "wat")))
+	assert.EqualValues(t, 1, listSize(pool, redisKeyJobs(newKeyspace(ns), "foo")))
+	assert.EqualValues(t, 0, listSize(pool, redisKeyJobs(newKeyspace(ns), "bar")))
+	assert.EqualValues(t, 2, zsetSize(pool, redisKeyScheduled(newKeyspace(ns))))
 
-	j := jobOnQueue(pool, redisKeyJobs(ns, "foo"))
+	j := jobOnQueue(pool, redisKeyJobs(newKeyspace(ns), "foo"))
 	assert.Equal(t, j.Name, "foo")
 
 	// Because we mocked time to 10 seconds ago above, the job was put on the zset with t=10 secs ago
@@ -68,15 +68,15 @@ func TestRequeueUnknown(t *testing.T) {
 	nowish := nowEpochSeconds()
 	setNowEpochSecondsMock(nowish)
 
-	re := newRequeuer(ns, pool, redisKeyScheduled(ns), []string{"bar"}, noopLogger)
+	re := newRequeuer(newKeyspace(ns), pool, redisKeyScheduled(newKeyspace(ns)), []string{"bar"}, noopMetrics, noopLogger)
 	re.start()
 	re.drain()
 	re.stop()
 
-	assert.EqualValues(t, 0, zsetSize(pool, redisKeyScheduled(ns)))
-	assert.EqualValues(t, 1, zsetSize(pool, redisKeyDead(ns)))
+	assert.EqualValues(t, 0, zsetSize(pool, redisKeyScheduled(newKeyspace(ns))))
+	assert.EqualValues(t, 1, zsetSize(pool, redisKeyDead(newKeyspace(ns))))
 
-	rank, job := jobOnZset(pool, redisKeyDead(ns))
+	rank, job := jobOnZset(pool, redisKeyDead(newKeyspace(ns)))
 
 	assert.Equal(t, nowish, rank)
 	assert.Equal(t, nowish, job.FailedAt)
@@ -97,7 +97,7 @@ func TestRequeuePeriodic(t *testing.T) {
 		{jobName: jobName, spec: jobSpec, schedule: shedule},
 	}
 
-	enq := newPeriodicEnqueuer(ns, pool, jobs, noopLogger)
+	enq := newPeriodicEnqueuer(newKeyspace(ns), pool, jobs, noopLogger)
 	enq.start()
 	enq.stop()
 
@@ -106,15 +106,100 @@ func TestRequeuePeriodic(t *testing.T) {
 	setNowEpochSecondsMock(tMock)
 	defer resetNowEpochSecondsMock()
 
-	re := newRequeuer(ns, pool, redisKeyScheduled(ns), []string{jobName}, noopLogger)
+	re := newRequeuer(newKeyspace(ns), pool, redisKeyScheduled(newKeyspace(ns)), []string{jobName}, noopMetrics, noopLogger)
 	re.start()
 	re.drain()
 	re.stop()
 
-	llen := listSize(pool, redisKeyJobs(ns, jobName))
+	llen := listSize(pool, redisKeyJobs(newKeyspace(ns), jobName))
 	assert.Equal(t, int64(0), llen)
 }
 
+func TestRequeueMaxQueueLength(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work"
+	cleanKeyspace(ns, pool)
+
+	enqueuer := NewEnqueuer(ns, pool, WithMaxQueueLength("wat", 1))
+	_, err := enqueuer.Enqueue("wat", nil)
+	assert.NoError(t, err)
+
+	now := nowEpochSeconds()
+	periodic := &Job{Name: "wat", ID: "periodic", EnqueuedAt: now, StartingDeadline: now + 60}
+	retried := &Job{Name: "wat", ID: "retried", EnqueuedAt: now, Fails: 1}
+	retriedPeriodic := &Job{Name: "wat", ID: "retried_periodic", EnqueuedAt: now, StartingDeadline: now + 60, Fails: 1}
+
+	conn := pool.Get()
+	for _, job := range []*Job{periodic, retried, retriedPeriodic} {
+		rawJSON, err := job.serialize()
+		assert.NoError(t, err)
+		_, err = conn.Do("ZADD", redisKeyRetry(newKeyspace(ns)), now-1, rawJSON)
+		assert.NoError(t, err)
+	}
+	conn.Close()
+
+	re := newRequeuer(newKeyspace(ns), pool, redisKeyRetry(newKeyspace(ns)), []string{"wat"}, noopMetrics, noopLogger)
+	re.start()
+	re.drain()
+	re.stop()
+
+	// The periodic job is dropped since the queue is full, but the retried ones are always requeued, even with
+	// a deadline.
+	assert.EqualValues(t, 0, zsetSize(pool, redisKeyRetry(newKeyspace(ns))))
+	assert.EqualValues(t, 3, listSize(pool, redisKeyJobs(newKeyspace(ns), "wat")))
+	jobOnQueue(pool, redisKeyJobs(newKeyspace(ns), "wat"))
+	var ids []string
+	for listSize(pool, redisKeyJobs(newKeyspace(ns), "wat")) > 0 {
+		ids = append(ids, jobOnQueue(pool, redisKeyJobs(newKeyspace(ns), "wat")).ID)
+	}
+	assert.ElementsMatch(t, []string{"retried", "retried_periodic"}, ids)
+}
+
+func TestRequeueStrictFIFO(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work"
+
+	for _, strict := range []bool{false, true} {
+		cleanKeyspace(ns, pool)
+
+		wp := NewWorkerPool(TestContext{}, 1, ns, pool)
+		wp.JobWithOptions("wat", JobOptions{StrictFIFO: strict}, func(job *Job) error { return nil })
+		wp.writeConcurrencyControlsToRedis()
+
+		enqueuer := NewEnqueuer(ns, pool)
+		queued, err := enqueuer.Enqueue("wat", nil)
+		assert.NoError(t, err)
+
+		now := nowEpochSeconds()
+		conn := pool.Get()
+		for _, key := range []string{redisKeyRetry(newKeyspace(ns)), redisKeyScheduled(newKeyspace(ns))} {
+			rawJSON, err := (&Job{Name: "wat", ID: key, EnqueuedAt: now}).serialize()
+			assert.NoError(t, err)
+			_, err = conn.Do("ZADD", key, now-1, rawJSON)
+			assert.NoError(t, err)
+		}
+		conn.Close()
+
+		for _, key := range []string{redisKeyRetry(newKeyspace(ns)), redisKeyScheduled(newKeyspace(ns))} {
+			re := newRequeuer(newKeyspace(ns), pool, key, []string{"wat"}, noopMetrics, noopLogger)
+			re.start()
+			re.drain()
+			re.stop()
+		}
+
+		// The retried job goes ahead of the queued one only for strict FIFO jobs, the scheduled one never does.
+		var ids []string
+		for listSize(pool, redisKeyJobs(newKeyspace(ns), "wat")) > 0 {
+			ids = append(ids, jobOnQueue(pool, redisKeyJobs(newKeyspace(ns), "wat")).ID)
+		}
+		if strict {
+			assert.Equal(t, []string{redisKeyRetry(newKeyspace(ns)), queued.ID, redisKeyScheduled(newKeyspace(ns))}, ids)
+		} else {
+			assert.Equal(t, []string{queued.ID, redisKeyRetry(newKeyspace(ns)), redisKeyScheduled(newKeyspace(ns))}, ids)
+		}
+	}
+}
+
 func TestRequeueSlowJob(t *testing.T) {
 	pool := newTestPool(":6379")
 	ns := "work"
@@ -146,6 +231,6 @@ func TestRequeueSlowJob(t *testing.T) {
 
 	time.Sleep(time.Second * 2)
 
-	llen := listSize(pool, redisKeyJobs(ns, jobName))
+	llen := listSize(pool, redisKeyJobs(newKeyspace(ns), jobName))
 	assert.LessOrEqual(t, llen, int64(1))
 }
@@ -2,12 +2,30 @@ package work
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log/slog"
 	"reflect"
 )
 
+// JobError is the error returned by a failed job, passed to the JobErrorHandler and the dead job hook.
+// Its message is the message of the underlying error, which is stored as the LastErr of the job.
+// Use errors.As to get it, and Job.LastError to get it back from a job read from Redis, e.g. by
+// Client.DeadJobs.
+type JobError struct {
+	JobName   string
+	JobID     string
+	Fails     int64 // number of times the job had failed before this run
+	Recovered bool  // the handler or a middleware panicked, with or without RecoverMiddleware
+	Err       error
+}
+
+func (e *JobError) Error() string { return e.Err.Error() }
+func (e *JobError) Unwrap() error { return e.Err }
+
 // runJob returns an error if the job fails, or there's a panic, or we couldn't
 // reflect correctly. if we return an error, it signals we want the job to be retried.
+// The returned error is a *JobError.
 func runJob(
 	job *Job,
 	ctxType reflect.Type,
@@ -18,6 +36,10 @@ func runJob(
 	returnCtx = reflect.New(ctxType)
 	ctx := job.extractTraceContext(context.Background())
 
+	if len(jt.middleware) > 0 {
+		middlewares = append(middlewares[:len(middlewares):len(middlewares)], jt.middleware...)
+	}
+
 	next := func() error {
 		mw := chainMiddleware(returnCtx, middlewares)
 
@@ -47,16 +69,24 @@ func runJob(
 			// err turns out to be interface{}, of actual type "runtime.errorCString"
 			// Luckily, the err sprints nicely via fmt.
 			errorishError := fmt.Errorf("%v", panicErr)
-			logger.Error("runJob.panic", errAttr(errorishError))
-			returnError = errorishError
+			logger.Error("runJob.panic",
+				slog.String("job_name", job.Name), slog.String("job_id", job.ID), errAttr(errorishError))
+			returnError = newJobError(job, errorishError, true)
 		}
 	}()
 
-	returnError = next()
+	if err := next(); err != nil {
+		var panicErr *PanicError
+		returnError = newJobError(job, err, errors.As(err, &panicErr))
+	}
 
 	return
 }
 
+func newJobError(job *Job, err error, recovered bool) *JobError {
+	return &JobError{JobName: job.Name, JobID: job.ID, Fails: job.Fails, Recovered: recovered, Err: err}
+}
+
 // chainMiddleware creates a single middleware out of a chain of many middlewares.
 //
 // Execution is done in left-to-right order, including passing of context.
@@ -2,6 +2,7 @@ package work
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"reflect"
 	"testing"
@@ -61,6 +62,53 @@ func TestRunBasicMiddleware(t *testing.T) {
 	assert.Equal(t, "mw1mw2mw3h1foo", c.String())
 }
 
+func TestRunJobMiddleware(t *testing.T) {
+	mw1 := func(c *tstCtx, j *Job, next NextMiddlewareFunc) error {
+		c.record("mw1")
+		return next()
+	}
+
+	mw2 := func(c *tstCtx, j *Job, next NextMiddlewareFunc) error {
+		c.record("mw2")
+		return next()
+	}
+
+	mw3 := func(ctx context.Context, j *Job, next JobContextHandler) error {
+		j.setArg("mw3", "mw3")
+		return next(ctx, j)
+	}
+
+	h1 := func(c *tstCtx, j *Job) error {
+		c.record("h1")
+		c.record(j.Args["mw3"].(string))
+		return nil
+	}
+
+	middleware := make([]*middlewareHandler, 1, 2)
+	middleware[0] = &middlewareHandler{isGeneric: false, dynamicMiddleware: reflect.ValueOf(mw1)}
+
+	jt := &jobType{
+		Name:           "foo",
+		isGeneric:      false,
+		dynamicHandler: reflect.ValueOf(h1),
+		middleware: []*middlewareHandler{
+			{isGeneric: false, dynamicMiddleware: reflect.ValueOf(mw2)},
+			{isGeneric: true, genericMiddleware: mw3},
+		},
+	}
+
+	job := &Job{Name: "foo"}
+
+	v, err := runJob(job, tstCtxType, middleware, jt, noopLogger)
+	assert.NoError(t, err)
+	c := v.Interface().(*tstCtx)
+	assert.Equal(t, "mw1mw2h1mw3", c.String())
+
+	// The pool's middleware isn't modified.
+	assert.Equal(t, 1, len(middleware))
+	assert.Nil(t, middleware[:2][1])
+}
+
 func TestRunHandlerError(t *testing.T) {
 	mw1 := func(j *Job, next NextMiddlewareFunc) error {
 		return next()
@@ -141,12 +189,26 @@ func TestRunHandlerPanic(t *testing.T) {
 	}
 
 	job := &Job{
-		Name: "foo",
+		Name:  "foo",
+		ID:    "1",
+		Fails: 2,
 	}
 
 	_, err := runJob(job, tstCtxType, middleware, jt, noopLogger)
 	assert.Error(t, err)
 	assert.Equal(t, "dayam", err.Error())
+
+	var jobErr *JobError
+	if assert.True(t, errors.As(err, &jobErr)) {
+		assert.Equal(t, "foo", jobErr.JobName)
+		assert.Equal(t, "1", jobErr.JobID)
+		assert.EqualValues(t, 2, jobErr.Fails)
+		assert.True(t, jobErr.Recovered)
+	}
+
+	job.failed(err, 1)
+	assert.True(t, job.LastErrRecovered)
+	assert.Equal(t, &JobError{JobName: "foo", JobID: "1", Fails: 2, Recovered: true, Err: errors.New("dayam")}, job.LastError())
 }
 
 func TestRunMiddlewarePanic(t *testing.T) {
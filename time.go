@@ -2,6 +2,24 @@ package work
 
 import "time"
 
+// Clock tells the current time. The worker pool reads the time from it to schedule retries, requeue due
+// jobs, and write and check heartbeats, so a fake clock can be set with WithClock to test that without waiting.
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+// Now returns the current time, or the mocked time if it's set.
+func (systemClock) Now() time.Time {
+	if nowMock != 0 {
+		return time.Unix(nowMock, 0)
+	}
+	return time.Now()
+}
+
+var defaultClock Clock = systemClock{}
+
 var nowMock int64
 
 func nowEpochSeconds() int64 {
@@ -0,0 +1,29 @@
+package work
+
+import (
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// timeoutConn runs the commands of the connection with its own read timeout instead of the one of the pool.
+type timeoutConn struct {
+	redis.ConnWithTimeout
+	timeout time.Duration
+}
+
+func (c timeoutConn) Do(cmd string, args ...interface{}) (interface{}, error) {
+	return c.DoWithTimeout(c.timeout, cmd, args...)
+}
+
+// withReadTimeout returns conn running its commands, including scripts, with the read timeout, e.g. to fail fast
+// when fetching jobs or to wait longer for the bulk operations of the client. conn is returned as is if timeout is
+// 0 or conn doesn't support per-command timeouts, like the connections of *redis.Pool do.
+func withReadTimeout(conn redis.Conn, timeout time.Duration) redis.Conn {
+	cwt, ok := conn.(redis.ConnWithTimeout)
+	if timeout <= 0 || !ok {
+		return conn
+	}
+
+	return timeoutConn{ConnWithTimeout: cwt, timeout: timeout}
+}
@@ -0,0 +1,145 @@
+package work
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// timeoutRecordingConn records the timeouts of the commands run with DoWithTimeout.
+type timeoutRecordingConn struct {
+	redis.Conn
+	timeouts []time.Duration
+}
+
+func (c *timeoutRecordingConn) DoWithTimeout(timeout time.Duration, cmd string, args ...interface{}) (interface{}, error) {
+	c.timeouts = append(c.timeouts, timeout)
+	return c.Conn.Do(cmd, args...)
+}
+
+func (c *timeoutRecordingConn) ReceiveWithTimeout(timeout time.Duration) (interface{}, error) {
+	return c.Conn.Receive()
+}
+
+func TestWithReadTimeout(t *testing.T) {
+	pool := newTestPool(":6379")
+	conn := &timeoutRecordingConn{Conn: pool.Get()}
+	defer conn.Close()
+
+	assert.Equal(t, redis.Conn(conn), withReadTimeout(conn, 0))
+	assert.Equal(t, loadingConn{}, withReadTimeout(loadingConn{}, time.Second))
+
+	script := redis.NewScript(0, "return 1")
+	n, err := redis.Int(script.Do(withReadTimeout(conn, time.Second)))
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.NotEmpty(t, conn.timeouts)
+	for _, timeout := range conn.timeouts {
+		assert.Equal(t, time.Second, timeout)
+	}
+}
+
+func TestFetchTimeout(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work"
+	cleanKeyspace(ns, pool)
+
+	_, err := NewEnqueuer(ns, pool).Enqueue("wat", nil)
+	require.NoError(t, err)
+
+	var ran bool
+	wp := NewWorkerPool(TestContext{}, 1, ns, pool, WithFetchTimeout(time.Second))
+	wp.Job("wat", func(*Job) error {
+		ran = true
+		return nil
+	})
+	wp.Start()
+	wp.Drain()
+	wp.Stop()
+
+	assert.True(t, ran)
+
+	client := NewClient(ns, pool, WithClientBulkTimeout(time.Minute))
+	insertDeadJob(ns, pool, "wat", 12345, 12347)
+	deleted, err := client.DeleteDeadJobsByName("wat")
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, deleted)
+}
+
+// lostReplyConn runs the commands, but loses the replies of the first lost ones as if they timed out.
+type lostReplyConn struct {
+	redis.Conn
+	lost int
+}
+
+func (c *lostReplyConn) DoWithTimeout(timeout time.Duration, cmd string, args ...interface{}) (interface{}, error) {
+	reply, err := c.Conn.Do(cmd, args...)
+	if c.lost > 0 && err == nil && (cmd == "EVALSHA" || cmd == "EVAL") {
+		c.lost--
+		return nil, fmt.Errorf("i/o timeout")
+	}
+	return reply, err
+}
+
+func (c *lostReplyConn) ReceiveWithTimeout(timeout time.Duration) (interface{}, error) {
+	return c.Conn.Receive()
+}
+
+// lostReplyPool returns its connection without closing it.
+type lostReplyPool struct {
+	*lostReplyConn
+}
+
+func (p lostReplyPool) Get() redis.Conn {
+	return p
+}
+
+func (p lostReplyPool) Close() error {
+	return nil
+}
+
+func TestFetchTimeoutLostReply(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work"
+	cleanKeyspace(ns, pool)
+
+	enqueuer := NewEnqueuer(ns, pool)
+	first, err := enqueuer.Enqueue("wat", Q{"n": 1})
+	require.NoError(t, err)
+	_, err = enqueuer.Enqueue("wat", Q{"n": 2})
+	require.NoError(t, err)
+
+	conn := &lostReplyConn{Conn: pool.Get(), lost: 2}
+	defer conn.Close()
+
+	jobTypes := map[string]*jobType{
+		"wat": {Name: "wat", JobOptions: JobOptions{Priority: 1}, isGeneric: true, genericHandler: func(*Job) error { return nil }},
+	}
+	w := newWorker(newKeyspace(ns), "1", lostReplyPool{conn}, tstCtxType, nil, jobTypes, noopLogger, nil, workerWithFetchTimeout(time.Second))
+
+	// The script of the first fetch ran, so its job is in progress, and the second fetch takes the same job back.
+	_, err = w.fetchJob(w.fetchSamples())
+	require.Error(t, err)
+	_, err = w.fetchJob(w.fetchSamples())
+	require.Error(t, err)
+	assert.EqualValues(t, 1, listSize(pool, redisKeyJobs(newKeyspace(ns), "wat")))
+	assert.EqualValues(t, 1, listSize(pool, redisKeyJobsInProgress(newKeyspace(ns), "1", "wat")))
+
+	job, err := w.fetchJob(w.fetchSamples())
+	require.NoError(t, err)
+	require.NotNil(t, job)
+	assert.Equal(t, first.ID, job.ID)
+	assert.EqualValues(t, 1, listSize(pool, redisKeyJobs(newKeyspace(ns), "wat")))
+	assert.EqualValues(t, 1, listSize(pool, redisKeyJobsInProgress(newKeyspace(ns), "1", "wat")))
+
+	// Once the reply came back, the next fetch takes a new job.
+	job, err = w.fetchJob(w.fetchSamples())
+	require.NoError(t, err)
+	require.NotNil(t, job)
+	assert.NotEqual(t, first.ID, job.ID)
+	assert.EqualValues(t, 0, listSize(pool, redisKeyJobs(newKeyspace(ns), "wat")))
+}
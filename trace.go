@@ -0,0 +1,100 @@
+package work
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// The args written by InjectTraceContext, named after the W3C trace context headers.
+const (
+	TraceParentArg = "traceparent"
+	TraceStateArg  = "tracestate"
+)
+
+// InjectTraceContext writes the W3C trace context of ctx into args, for jobs enqueued without the Context
+// methods of Enqueuer, e.g. by another service or through EnqueueUniqueByKey. The args are returned for
+// convenience; a new map is made if args is nil. Nothing is written if ctx has no span.
+func InjectTraceContext(ctx context.Context, args map[string]interface{}) map[string]interface{} {
+	if !trace.SpanFromContext(ctx).SpanContext().IsValid() {
+		return args
+	}
+
+	carrier := make(propagation.MapCarrier, 2)
+	propagation.TraceContext{}.Inject(ctx, carrier)
+
+	if args == nil {
+		args = make(map[string]interface{}, len(carrier))
+	}
+	for k, v := range carrier {
+		args[k] = v
+	}
+
+	return args
+}
+
+// ExtractTraceContext returns ctx with the trace context of the job: the one of the Context methods of
+// Enqueuer, or else the one written into its args by InjectTraceContext. The handlers of the pool already get
+// it in their context.
+func ExtractTraceContext(ctx context.Context, job *Job) context.Context {
+	if job.TraceContext != nil {
+		return propagation.TraceContext{}.Extract(ctx, propagation.MapCarrier(job.TraceContext))
+	}
+
+	parent, ok := job.Args[TraceParentArg].(string)
+	if !ok {
+		return ctx
+	}
+
+	carrier := propagation.MapCarrier{TraceParentArg: parent}
+	if state, ok := job.Args[TraceStateArg].(string); ok {
+		carrier[TraceStateArg] = state
+	}
+
+	return propagation.TraceContext{}.Extract(ctx, carrier)
+}
+
+// JobSpanStarter starts a span for a run of the job, as a child of the trace context of ctx extracted from the
+// job. It returns the context of the span, passed to the middleware and the handler, and a func ending the span
+// with the error of the run, nil if it succeeded. See WithJobSpans.
+type JobSpanStarter func(ctx context.Context, job *Job) (context.Context, func(err error))
+
+// OTelJobSpans returns a JobSpanStarter starting consumer spans named after the jobs with tracer. Failed runs
+// are recorded as errors.
+func OTelJobSpans(tracer trace.Tracer) JobSpanStarter {
+	return func(ctx context.Context, job *Job) (context.Context, func(err error)) {
+		ctx, span := tracer.Start(ctx, job.Name, trace.WithSpanKind(trace.SpanKindConsumer))
+		span.SetAttributes(attribute.String("job.id", job.ID), attribute.Int64("job.fails", job.Fails))
+
+		return ctx, func(err error) {
+			if err != nil {
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+			}
+			span.End()
+		}
+	}
+}
+
+// spanMiddleware returns the middleware starting the spans of WithJobSpans. It runs before the other
+// middleware, and ends the span of the run with the recovered value if the run panics.
+func spanMiddleware(start JobSpanStarter) *middlewareHandler {
+	mw := JobContextMiddleware(func(ctx context.Context, job *Job, next JobContextHandler) (err error) {
+		ctx, end := start(ctx, job)
+		defer func() {
+			if v := recover(); v != nil {
+				end(fmt.Errorf("%v", v))
+				panic(v)
+			}
+			end(err)
+		}()
+
+		return next(ctx, job)
+	})
+
+	return &middlewareHandler{isGeneric: true, genericMiddleware: mw}
+}
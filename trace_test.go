@@ -0,0 +1,61 @@
+package work
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestJobSpans(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work"
+	cleanKeyspace(ns, pool)
+
+	exp := tracetest.NewInMemoryExporter()
+	tp := trace.NewTracerProvider(trace.WithSyncer(exp))
+
+	ctx, span := tp.Tracer("").Start(context.Background(), "enqueue")
+	span.End()
+
+	// The trace context is carried by the args of a job enqueued without a context.
+	args := InjectTraceContext(ctx, nil)
+	assert.Contains(t, args, TraceParentArg)
+	_, err := NewEnqueuer(ns, pool).Enqueue("wat", args)
+	require.NoError(t, err)
+
+	wp := NewWorkerPool(TestContext{}, 1, ns, pool, WithJobSpans(OTelJobSpans(tp.Tracer("work"))))
+	wp.JobWithOptions("wat", JobOptions{MaxFails: 1}, func(ctx context.Context, job *Job) error {
+		_, span := tp.Tracer("lib").Start(ctx, "exec")
+		defer span.End()
+		return fmt.Errorf("oops")
+	})
+
+	wp.Start()
+	wp.Drain()
+	wp.Stop()
+
+	spans := exp.GetSpans()
+	require.Len(t, spans, 3)
+	enqueue, exec, job := spans[0], spans[1], spans[2]
+	assert.Equal(t, "exec", exec.Name)
+	assert.Equal(t, "wat", job.Name)
+
+	assert.Equal(t, enqueue.SpanContext.TraceID(), job.SpanContext.TraceID())
+	assert.Equal(t, enqueue.SpanContext.SpanID(), job.Parent.SpanID())
+	assert.Equal(t, job.SpanContext.SpanID(), exec.Parent.SpanID())
+	assert.Equal(t, codes.Error, job.Status.Code)
+	assert.Equal(t, "oops", job.Status.Description)
+}
+
+func TestInjectTraceContextWithoutSpan(t *testing.T) {
+	assert.Nil(t, InjectTraceContext(context.Background(), nil))
+
+	ctx := ExtractTraceContext(context.Background(), &Job{Args: Q{"a": 1}})
+	assert.Equal(t, context.Background(), ctx)
+}
@@ -0,0 +1,76 @@
+package work
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// RegisterTyped registers the job name to fn, which gets the arguments of the job decoded into T.
+// The arguments are converted with encoding/json, so the fields of T can be renamed or omitted with json tags.
+// Jobs whose arguments can't be decoded into T are sent to the dead queue without retries.
+// Middleware and the other handlers of the pool are unaffected.
+//
+//	type Email struct {
+//		Address string `json:"address"`
+//	}
+//
+//	work.RegisterTyped(pool, "send_email", func(ctx context.Context, e Email) error { ... })
+func RegisterTyped[T any](wp *WorkerPool, name string, fn func(context.Context, T) error) *WorkerPool {
+	return RegisterTypedWithOptions(wp, name, JobOptions{}, fn)
+}
+
+// RegisterTypedWithOptions does the same as RegisterTyped with the job options, see JobWithOptions.
+func RegisterTypedWithOptions[T any](wp *WorkerPool, name string, jobOpts JobOptions, fn func(context.Context, T) error) *WorkerPool {
+	return wp.JobWithOptions(name, jobOpts, func(ctx context.Context, job *Job) error {
+		var payload T
+		if err := decodeTypedArgs(job.Args, &payload); err != nil {
+			return DeadLetter(err)
+		}
+
+		return fn(ctx, payload)
+	})
+}
+
+// EnqueueTyped enqueues a job with the specified name and payload as its arguments. The payload must
+// be encoded by encoding/json as an object, eg, a struct or a map. See RegisterTyped.
+func EnqueueTyped[T any](enq *Enqueuer, name string, payload T) (*Job, error) {
+	return EnqueueTypedContext(context.Background(), enq, name, payload)
+}
+
+// EnqueueTypedContext does the same as EnqueueTyped with context propagation.
+func EnqueueTypedContext[T any](ctx context.Context, enq *Enqueuer, name string, payload T) (*Job, error) {
+	args, err := encodeTypedArgs(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	return enq.EnqueueContext(ctx, name, args)
+}
+
+func encodeTypedArgs(payload interface{}) (Q, error) {
+	rawJSON, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("encode job args: %w", err)
+	}
+
+	var args Q
+	if err := json.Unmarshal(rawJSON, &args); err != nil {
+		return nil, fmt.Errorf("encode job args: %T isn't encoded as a JSON object", payload)
+	}
+
+	return args, nil
+}
+
+func decodeTypedArgs(args map[string]interface{}, payload interface{}) error {
+	rawJSON, err := json.Marshal(args)
+	if err != nil {
+		return fmt.Errorf("decode job args: %w", err)
+	}
+
+	if err := json.Unmarshal(rawJSON, payload); err != nil {
+		return fmt.Errorf("decode job args: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,61 @@
+package work
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testEmail struct {
+	Address string   `json:"address"`
+	Retries int      `json:"retries"`
+	Tags    []string `json:"tags,omitempty"`
+}
+
+func TestTyped(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work"
+	cleanKeyspace(ns, pool)
+
+	var got []testEmail
+	wp := NewWorkerPool(TestContext{}, 1, ns, pool)
+	RegisterTyped(wp, "send_email", func(ctx context.Context, e testEmail) error {
+		got = append(got, e)
+		return nil
+	})
+
+	enqueuer := NewEnqueuer(ns, pool)
+	email := testEmail{Address: "test@example.com", Retries: 3, Tags: []string{"welcome"}}
+	job, err := EnqueueTyped(enqueuer, "send_email", email)
+	require.NoError(t, err)
+	assert.Equal(t, "test@example.com", job.ArgString("address"))
+
+	// Jobs enqueued with the untyped API are decoded as well.
+	_, err = enqueuer.Enqueue("send_email", Q{"address": "other@example.com"})
+	require.NoError(t, err)
+
+	// Jobs that can't be decoded are dead.
+	_, err = enqueuer.Enqueue("send_email", Q{"retries": "many"})
+	require.NoError(t, err)
+
+	wp.Start()
+	wp.Drain()
+	wp.Stop()
+
+	assert.Equal(t, []testEmail{email, {Address: "other@example.com"}}, got)
+	assert.EqualValues(t, 0, zsetSize(pool, redisKeyRetry(newKeyspace(ns))))
+	assert.EqualValues(t, 1, zsetSize(pool, redisKeyDead(newKeyspace(ns))))
+}
+
+func TestEnqueueTypedNotObject(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work"
+	cleanKeyspace(ns, pool)
+
+	job, err := EnqueueTyped(NewEnqueuer(ns, pool), "send_email", "test@example.com")
+	assert.Error(t, err)
+	assert.Nil(t, job)
+	assert.EqualValues(t, 0, listSize(pool, redisKeyJobs(newKeyspace(ns), "send_email")))
+}
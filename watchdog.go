@@ -3,6 +3,7 @@ package work
 import (
 	"container/heap"
 	"log/slog"
+	"sort"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -13,20 +14,30 @@ const WatchdogFailCheckingTimeout = 60 * time.Second
 
 const processedJobsBuffer = 256
 
+// watchdogStatsTTL is how long the stats of a job that isn't periodic anymore are kept after their last update.
+const watchdogStatsTTL = time.Hour
+
 // The WatchdogStat struct represents statistics for a periodic jobs, including the name, counter,
+// and the timeout after which a planned job is counted as skipped.
+// InFlight is the number of planned runs that are neither processed nor skipped yet, while
+// Skipped counts all the runs that were skipped since the pool was started or the stats were reset.
 type WatchdogStat struct {
-	Name      string
-	Processed int64
-	Skipped   int64
+	Name                string
+	Processed           int64
+	Skipped             int64
+	InFlight            int64
+	FailCheckingTimeout time.Duration
 }
 
 // watchdog a struct that checks that periodic tasks are running.
 // It is based on data about planned tasks and how they are actually processed.
 type watchdog struct {
+	mtx                 sync.Mutex // guards periodicJobs, jobs and jobTimeouts
 	periodicJobs        []*periodicJob
-	jobs                map[string]*watchdogJob
+	jobs                map[string]*watchdogJob // kept for watchdogStatsTTL once the job isn't periodic anymore
 	processedJobs       chan *Job
 	failCheckingTimeout time.Duration
+	jobTimeouts         map[string]time.Duration // overrides failCheckingTimeout, by job name
 	stopChan            chan struct{}
 	logger              StructuredLogger
 }
@@ -48,6 +59,7 @@ func watchdogWithFailCheckingTimeout(t time.Duration) watchdogOption {
 func newWatchdog(opts ...watchdogOption) *watchdog {
 	w := &watchdog{
 		jobs:          make(map[string]*watchdogJob),
+		jobTimeouts:   make(map[string]time.Duration),
 		processedJobs: make(chan *Job, processedJobsBuffer),
 		stopChan:      make(chan struct{}),
 	}
@@ -67,13 +79,70 @@ func newWatchdog(opts ...watchdogOption) *watchdog {
 	return w
 }
 
-func (w *watchdog) addPeriodicJobs(jobs ...*periodicJob) {
-	w.periodicJobs = append(w.periodicJobs, jobs...)
+// setPeriodicJobs sets the periodic jobs to watch, e.g. when the pool is restarted or a periodic job is removed.
+// The stats of the jobs that are still periodic are kept, the runs planned for the other ones are forgotten and
+// their stats age out. The runs planned for a job with a removed schedule are planned again from its other ones.
+func (w *watchdog) setPeriodicJobs(jobs ...*periodicJob) {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+
+	kept := make(map[*periodicJob]bool, len(jobs))
+	for _, j := range jobs {
+		kept[j] = true
+	}
+	for _, j := range w.periodicJobs {
+		if job, ok := w.jobs[j.jobName]; ok && !kept[j] {
+			job.checkTimes = newCheckTimesHeap()
+		}
+	}
+
+	now := time.Now()
+	w.periodicJobs = jobs
+	for _, j := range jobs {
+		if job, ok := w.jobs[j.jobName]; ok {
+			job.updatedAt = now
+		} else {
+			w.jobs[j.jobName] = &watchdogJob{
+				checkTimes: newCheckTimesHeap(),
+				updatedAt:  now,
+			}
+		}
+	}
+
+	for name, job := range w.jobs {
+		if !w.isPeriodic(name) {
+			job.checkTimes = newCheckTimesHeap()
+		}
+	}
+}
+
+func (w *watchdog) isPeriodic(jobName string) bool {
 	for _, j := range w.periodicJobs {
-		w.jobs[j.jobName] = &watchdogJob{
-			checkTimes: newCheckTimesHeap(),
+		if j.jobName == jobName {
+			return true
 		}
 	}
+	return false
+}
+
+// setJobFailCheckingTimeout overrides the fail checking timeout of the job.
+// It must be called before the watchdog is started.
+func (w *watchdog) setJobFailCheckingTimeout(jobName string, t time.Duration) {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+
+	if t > 0 {
+		w.jobTimeouts[jobName] = t
+	} else {
+		delete(w.jobTimeouts, jobName)
+	}
+}
+
+func (w *watchdog) jobFailCheckingTimeout(jobName string) time.Duration {
+	if t, ok := w.jobTimeouts[jobName]; ok {
+		return t
+	}
+	return w.failCheckingTimeout
 }
 
 func (w *watchdog) start() {
@@ -105,10 +174,14 @@ func (w *watchdog) stop() {
 // It iterates over the list of periodic jobs, calculates the next scheduled time for each job
 // based on the current time `t`, and updates the check list for each job with the new scheduled time.
 func (w *watchdog) planning(t time.Time) {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+
 	for _, j := range w.periodicJobs {
 		n := j.schedule.Next(t)
 		h := w.jobs[j.jobName].checkTimes
 		if h.Push(n) {
+			w.jobs[j.jobName].updatedAt = t
 			w.logger.Debug("Watchdog: planning job",
 				slog.String("job_name", j.jobName),
 				slog.Time("job_next_time", n),
@@ -120,16 +193,29 @@ func (w *watchdog) planning(t time.Time) {
 
 // checking checks for skipped jobs based on the time `t`.
 // It iterates over the scheduled times for each job and compares them with the
-// current time plus the fail checking timeout. If a job's scheduled time has passed the fail checking
+// current time plus the fail checking timeout of the job. If a job's scheduled time has passed the fail checking
 // timeout, it is considered as skipped, removed from the check list, and the `skip` method is called
-// to increment the skipped count for that job.
+// to increment the skipped count for that job. The stats of the jobs that aren't periodic anymore are
+// dropped once they weren't updated for watchdogStatsTTL.
 func (w *watchdog) checking(t time.Time) {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+
 	for name, job := range w.jobs {
+		if !w.isPeriodic(name) {
+			if t.Sub(job.updatedAt) > watchdogStatsTTL {
+				delete(w.jobs, name)
+			}
+			continue
+		}
+
+		timeout := w.jobFailCheckingTimeout(name)
 		job.each(func(h *checkTimesHeap) bool {
 			n, _ := h.Peek()
-			if n.Add(w.failCheckingTimeout).Before(t) {
+			if n.Add(timeout).Before(t) {
 				h.Pop()
 				job.skipped.Add(1)
+				job.updatedAt = t
 
 				w.logger.Warn("Watchdog: skipped job",
 					slog.String("job_name", name),
@@ -148,6 +234,9 @@ func (w *watchdog) checking(t time.Time) {
 // processed method is responsible for handling a processed job in the watchdog system.
 // It iterates over the scheduled times for each job and check if job was successfully processed.
 func (w *watchdog) processed(j *Job) {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+
 	job, ok := w.jobs[j.Name]
 	if !ok {
 		return
@@ -158,6 +247,7 @@ func (w *watchdog) processed(j *Job) {
 		if !n.After(time.Unix(j.EnqueuedAt, 0)) {
 			h.Pop()
 			job.processed.Add(1)
+			job.updatedAt = time.Now()
 
 			w.logger.Debug("Watchdog: successfully processed job",
 				slog.String("job_name", j.Name),
@@ -170,24 +260,50 @@ func (w *watchdog) processed(j *Job) {
 	})
 }
 
+// stats returns the stats of the jobs sorted by name.
 func (w *watchdog) stats() []WatchdogStat {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+
 	res := make([]WatchdogStat, 0, len(w.jobs))
 
 	for k, v := range w.jobs {
 		res = append(res, WatchdogStat{
-			Name:      k,
-			Processed: v.processed.Load(),
-			Skipped:   v.skipped.Load(),
+			Name:                k,
+			Processed:           v.processed.Load(),
+			Skipped:             v.skipped.Load(),
+			InFlight:            int64(v.checkTimes.Len()),
+			FailCheckingTimeout: w.jobFailCheckingTimeout(k),
 		})
 	}
 
+	sort.Slice(res, func(i, j int) bool { return res[i].Name < res[j].Name })
+
 	return res
 }
 
+// resetStats zeroes the processed and skipped counters and drops the stats of the jobs that aren't periodic
+// anymore. The planned runs are kept.
+func (w *watchdog) resetStats() {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+
+	for name, job := range w.jobs {
+		if !w.isPeriodic(name) {
+			delete(w.jobs, name)
+			continue
+		}
+
+		job.processed.Store(0)
+		job.skipped.Store(0)
+	}
+}
+
 type watchdogJob struct {
 	checkTimes *checkTimesHeap
 	processed  atomic.Int64
 	skipped    atomic.Int64
+	updatedAt  time.Time // when the job was last planned, processed or skipped
 }
 
 func (w *watchdogJob) each(cb func(h *checkTimesHeap) bool) {
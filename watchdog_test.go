@@ -68,8 +68,6 @@ func TestCheckTimesHeap(t *testing.T) {
 }
 
 func TestWatchdog(t *testing.T) {
-	t.Parallel()
-
 	require := require.New(t)
 
 	const jobName = "test"
@@ -79,21 +77,122 @@ func TestWatchdog(t *testing.T) {
 	w := newWatchdog(
 		watchdogWithFailCheckingTimeout(time.Millisecond * 2000),
 	)
-	defer w.stop()
+	w.setPeriodicJobs(j)
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.Local)
+	w.planning(now)
+	w.planning(now.Add(time.Second))
+	w.checking(now.Add(2 * time.Second))
+	w.processed(&Job{
+		Name:       jobName,
+		EnqueuedAt: now.Add(time.Second).Unix(),
+	})
+
+	// The run planned at now+1s is processed, the one at now+2s is still in flight.
+	require.Equal([]WatchdogStat{{Name: "test", Processed: 1, Skipped: 0, InFlight: 1, FailCheckingTimeout: 2 * time.Second}}, w.stats())
+
+	// The run at now+2s isn't processed within the timeout, the one at now+3s is planned.
+	w.planning(now.Add(2 * time.Second))
+	w.checking(now.Add(4500 * time.Millisecond))
+	require.Equal([]WatchdogStat{{Name: "test", Processed: 1, Skipped: 1, InFlight: 1, FailCheckingTimeout: 2 * time.Second}}, w.stats())
+}
+
+func TestWatchdogStartProcessesJobs(t *testing.T) {
+	require := require.New(t)
+
+	const jobName = "test"
+	j, err := newPeriodicJob("* * * * * *", jobName)
+	require.NoError(err)
+
+	w := newWatchdog()
+	w.setPeriodicJobs(j)
 
-	w.addPeriodicJobs(j)
+	now := time.Now().Truncate(time.Second)
+	w.planning(now)
 	w.start()
-	w.planning(time.Now())
+	defer w.stop()
 
-	time.Sleep(time.Millisecond * 2000)
-	w.processedJobs <- &Job{
-		Name:       jobName,
-		EnqueuedAt: time.Now().Unix(),
+	w.processedJobs <- &Job{Name: jobName, EnqueuedAt: now.Add(time.Second).Unix()}
+	require.Eventually(func() bool {
+		return w.stats()[0].Processed == 1
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestWatchdogJobFailCheckingTimeout(t *testing.T) {
+	require := require.New(t)
+
+	fast, err := newPeriodicJob("* * * * * *", "fast")
+	require.NoError(err)
+	slow, err := newPeriodicJob("* * * * * *", "slow")
+	require.NoError(err)
+
+	w := newWatchdog(watchdogWithFailCheckingTimeout(time.Second))
+	w.setJobFailCheckingTimeout("slow", time.Minute)
+	w.setPeriodicJobs(fast, slow)
+
+	now := time.Now().Truncate(time.Second)
+	w.planning(now)
+	w.checking(now.Add(10 * time.Second))
+
+	stats := make(map[string]WatchdogStat)
+	for _, s := range w.stats() {
+		stats[s.Name] = s
 	}
-	time.Sleep(time.Millisecond * 500)
+	require.Equal(WatchdogStat{Name: "fast", Skipped: 1, FailCheckingTimeout: time.Second}, stats["fast"])
+	require.Equal(WatchdogStat{Name: "slow", InFlight: 1, FailCheckingTimeout: time.Minute}, stats["slow"])
+}
+
+func TestWatchdogStatsRetention(t *testing.T) {
+	require := require.New(t)
+
+	kept, err := newPeriodicJob("* * * * * *", "kept")
+	require.NoError(err)
+	removed, err := newPeriodicJob("* * * * * *", "removed")
+	require.NoError(err)
+
+	w := newWatchdog(watchdogWithFailCheckingTimeout(time.Second))
+	w.setPeriodicJobs(kept, removed)
+
+	now := time.Now().Truncate(time.Second)
+	w.planning(now)
+	w.checking(now.Add(10 * time.Second))
+	w.processed(&Job{Name: "ad-hoc", EnqueuedAt: now.Unix()})
+
+	// The pool is restarted without the removed job: its planned runs are forgotten.
+	w.setPeriodicJobs(kept)
+	require.Equal([]WatchdogStat{
+		{Name: "kept", Skipped: 1, FailCheckingTimeout: time.Second},
+		{Name: "removed", Skipped: 1, FailCheckingTimeout: time.Second},
+	}, w.stats())
+
+	w.checking(now.Add(watchdogStatsTTL + time.Minute))
+	stats := w.stats()
+	require.Equal(1, len(stats))
+	require.Equal("kept", stats[0].Name)
+
+	w.planning(now.Add(watchdogStatsTTL + time.Minute))
+	w.resetStats()
+	require.Equal([]WatchdogStat{{Name: "kept", InFlight: 1, FailCheckingTimeout: time.Second}}, w.stats())
+}
+
+func TestWatchdogRemovedSchedule(t *testing.T) {
+	require := require.New(t)
+
+	hourly, err := newPeriodicJob("0 0 * * * *", "test")
+	require.NoError(err)
+	daily, err := newPeriodicJob("0 30 0 * * *", "test")
+	require.NoError(err)
+
+	w := newWatchdog(watchdogWithFailCheckingTimeout(time.Second))
+	w.setPeriodicJobs(hourly, daily)
 
-	require.Equal(WatchdogStat{Name: "test", Processed: 1, Skipped: 0}, w.stats()[0])
+	now := time.Date(2024, 1, 1, 0, 10, 0, 0, time.Local)
+	w.planning(now)
+	require.Equal(2, w.jobs["test"].checkTimes.Len())
 
-	time.Sleep(time.Millisecond * 1600)
-	require.Equal(WatchdogStat{Name: "test", Processed: 1, Skipped: 1}, w.stats()[0])
+	// The run planned for the removed schedule isn't reported as skipped.
+	w.setPeriodicJobs(hourly)
+	w.planning(now)
+	w.checking(now.Add(40 * time.Minute))
+	require.Equal([]WatchdogStat{{Name: "test", InFlight: 1, FailCheckingTimeout: time.Second}}, w.stats())
 }
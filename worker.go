@@ -1,15 +1,61 @@
 package work
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
 	"math/rand"
 	"reflect"
+	"sync/atomic"
 	"time"
 
 	"github.com/gomodule/redigo/redis"
 )
 
-const fetchKeysPerJobType = 6
+const fetchKeysPerJobType = 10
+
+// fetchRecordTTL is how long the fetch record of a worker with WithFetchTimeout is kept, see redisKeyWorkerFetch.
+const fetchRecordTTL = time.Hour
+
+// errNoFreeSlot is returned by fetchJob when the pool already runs WithMaxTotalConcurrency jobs.
+var errNoFreeSlot = errors.New("no free slot in the worker pool")
+
+// defaultJobResultTTL is how long job results are kept if WithJobResultTTL isn't set.
+const defaultJobResultTTL = time.Hour
+
+// ErrStrayJob is passed to the JobErrorHandler, wrapped with the name of the job, when a job without a
+// registered handler is dequeued. The job is moved to the dead queue unless WithDropStrayJobs is set.
+var ErrStrayJob = fmt.Errorf("stray job: no handler")
+
+// ErrMalformedJob is returned by the fetches of the workers, wrapped with the decoding error, when a job can't be
+// decoded. The raw job is moved to the malformed jobs zset of the namespace, see WithMalformedJobsKey.
+var ErrMalformedJob = errors.New("malformed job")
+
+// ErrDeadLetter can be returned by a handler, possibly wrapped, to move the job to the dead queue
+// right away instead of retrying it, e.g. when its payload is malformed. If the job type has SkipDead,
+// the job is discarded instead. Use DeadLetter to keep the message of the original error.
+var ErrDeadLetter = errors.New("dead letter")
+
+// ErrSkipJob can be returned by a handler or middleware, possibly wrapped, to drop the job as if it had
+// succeeded, e.g. when a feature flag is off. It isn't retried nor moved to the dead queue, and it isn't
+// reported to the JobErrorHandler.
+var ErrSkipJob = errors.New("skip job")
+
+// DeadLetter wraps err so that the job is moved to the dead queue without retries, see ErrDeadLetter.
+// The error message of the dead job is the message of err.
+func DeadLetter(err error) error {
+	return &deadLetterError{err: err}
+}
+
+type deadLetterError struct {
+	err error
+}
+
+func (e *deadLetterError) Error() string        { return e.err.Error() }
+func (e *deadLetterError) Unwrap() error        { return e.err }
+func (e *deadLetterError) Is(target error) bool { return target == ErrDeadLetter }
 
 var sleepBackoffs = []time.Duration{
 	time.Millisecond * 0,
@@ -22,7 +68,7 @@ var sleepBackoffs = []time.Duration{
 type worker struct {
 	workerID      string
 	poolID        string
-	namespace     string
+	keys          keyspace
 	pool          Pool
 	jobTypes      map[string]*jobType
 	middleware    []*middlewareHandler
@@ -31,15 +77,220 @@ type worker struct {
 
 	redisFetchScript *redis.Script
 	sampler          prioritySampler
+	maxFetchSamples  int          // see WithMaxFetchJobTypes, 0 to fetch from all the queues
+	fetchRotation    []sampleItem // the samples in a fixed order, taken in turn by fetchSamples
+	fetchCursor      int
+	priorityDrain    bool          // see WithPriorityDrain
+	drainOrder       []sampleItem  // the samples by descending priority, taken in order by drainSamples
+	fetchTimeout     time.Duration // see WithFetchTimeout, 0 to use the read timeout of the pool
+	fetchKey         string        // see redisKeyWorkerFetch
+	fetchSeq         uint64        // the ID of the last fetch with fetchTimeout
+	lostFetch        uint64        // the ID of the first fetch whose reply was lost since the last reply, or 0
 	*observer
 
 	stopChan         chan struct{}
 	doneStoppingChan chan struct{}
 
-	drainChan        chan struct{}
-	doneDrainingChan chan struct{}
+	drainChan   chan chan struct{}
+	removedChan chan struct{} // closed once the worker is removed from its pool, see remove
+	fetched     atomic.Int64  // number of fetched jobs, see WorkerPool.DrainContext
+
+	deadJobHook     DeadJobHook
+	jobErrorHandler JobErrorHandler
+	expiredJobHook  ExpiredJobHook
+	failover        *failoverState // shared with the other loops of the pool
+	strayJobHandler StrayJobHandler
+	jobLogFields    JobLogFields
+	slowThreshold   time.Duration
+	jobSpans        JobSpanStarter
+	dropStrayJobs   bool
+	dependencies    bool   // see WithJobDependencies
+	malformedKey    string // see WithMalformedJobsKey, empty to drop the malformed jobs
+	codec           ArgsCodec
+	events          *jobEvents
+	maxTotal        uint     // see WithMaxTotalConcurrency, 0 without a limit
+	inProgQueues    []string // the in-progress queues of all the job types, counted against maxTotal and searched for lost fetches
+	clock           Clock
+	resultTTL       time.Duration
+	pollJitter      float64
+	leaseTTL        time.Duration   // see WithLeasedConcurrency, 0 to use the lock counters
+	inProgLeaseTTL  time.Duration   // see WithInProgressLeases, 0 without in-progress leases
+	ctx             context.Context // no more jobs are fetched once it's done
+	metrics         MetricsReporter
+	logger          StructuredLogger
+}
+
+type workerOption func(w *worker)
+
+func workerWithMetricsReporter(m MetricsReporter) workerOption {
+	return func(w *worker) {
+		if m != nil {
+			w.metrics = m
+		}
+	}
+}
+
+func workerWithDeadJobHook(h DeadJobHook) workerOption {
+	return func(w *worker) {
+		w.deadJobHook = h
+	}
+}
+
+func workerWithJobErrorHandler(h JobErrorHandler) workerOption {
+	return func(w *worker) {
+		w.jobErrorHandler = h
+	}
+}
+
+func workerWithExpiredJobHook(h ExpiredJobHook) workerOption {
+	return func(w *worker) {
+		w.expiredJobHook = h
+	}
+}
+
+func workerWithFailover(f *failoverState) workerOption {
+	return func(w *worker) {
+		w.failover = f
+		w.observer.failover = f
+	}
+}
 
-	logger StructuredLogger
+func workerWithStrayJobHandler(h StrayJobHandler, drop bool) workerOption {
+	return func(w *worker) {
+		w.strayJobHandler = h
+		w.dropStrayJobs = drop
+	}
+}
+
+func workerWithMalformedJobs(name string, drop bool) workerOption {
+	return func(w *worker) {
+		switch {
+		case drop:
+			w.malformedKey = ""
+		case name != "":
+			w.malformedKey = redisNamespacePrefix(w.keys) + name
+		}
+	}
+}
+
+func workerWithDependencies(enabled bool) workerOption {
+	return func(w *worker) {
+		w.dependencies = enabled
+	}
+}
+
+func workerWithJobLogFields(f JobLogFields) workerOption {
+	return func(w *worker) {
+		w.jobLogFields = f
+	}
+}
+
+func workerWithSlowJobThreshold(threshold time.Duration) workerOption {
+	return func(w *worker) {
+		w.slowThreshold = threshold
+	}
+}
+
+func workerWithJobSpans(start JobSpanStarter) workerOption {
+	return func(w *worker) {
+		w.jobSpans = start
+	}
+}
+
+func workerWithEvents(e *jobEvents) workerOption {
+	return func(w *worker) {
+		w.events = e
+	}
+}
+
+func workerWithMaxTotalConcurrency(n uint) workerOption {
+	return func(w *worker) {
+		w.maxTotal = n
+	}
+}
+
+func workerWithObservationArgsLimit(limit int) workerOption {
+	return func(w *worker) {
+		w.observer.argsLimit = limit
+	}
+}
+
+func workerWithObservationSampling(minDuration time.Duration) workerOption {
+	return func(w *worker) {
+		w.observer.minDuration = minDuration
+	}
+}
+
+func workerWithObserverPool(pool Pool) workerOption {
+	return func(w *worker) {
+		if pool != nil {
+			w.observer.pool = pool
+		}
+	}
+}
+
+func workerWithPollJitter(fraction float64) workerOption {
+	return func(w *worker) {
+		w.pollJitter = fraction
+	}
+}
+
+func workerWithMaxFetchSamples(n uint) workerOption {
+	return func(w *worker) {
+		w.maxFetchSamples = int(n)
+	}
+}
+
+func workerWithFetchTimeout(timeout time.Duration) workerOption {
+	return func(w *worker) {
+		w.fetchTimeout = timeout
+	}
+}
+
+func workerWithPriorityDrain(enabled bool) workerOption {
+	return func(w *worker) {
+		w.priorityDrain = enabled
+	}
+}
+
+func workerWithLeaseTTL(ttl time.Duration) workerOption {
+	return func(w *worker) {
+		w.leaseTTL = ttl
+	}
+}
+
+func workerWithInProgressLeases(ttl time.Duration) workerOption {
+	return func(w *worker) {
+		w.inProgLeaseTTL = ttl
+	}
+}
+
+func workerWithContext(ctx context.Context) workerOption {
+	return func(w *worker) {
+		w.ctx = ctx
+	}
+}
+
+func workerWithResultTTL(ttl time.Duration) workerOption {
+	return func(w *worker) {
+		if ttl > 0 {
+			w.resultTTL = ttl
+		}
+	}
+}
+
+func workerWithClock(c Clock) workerOption {
+	return func(w *worker) {
+		if c != nil {
+			w.clock = c
+		}
+	}
+}
+
+func workerWithArgsCodec(codec ArgsCodec) workerOption {
+	return func(w *worker) {
+		w.codec = codec
+	}
 }
 
 // Pool represents a pool of connections to a Redis server.
@@ -47,8 +298,25 @@ type Pool interface {
 	Get() redis.Conn
 }
 
+// ContextPool is a Pool which can also get connections with a context, like *redis.Pool. If the Pool passed to
+// the enqueuers and worker pools implements it, waiting for a connection, e.g. on an exhausted pool, stops when
+// the context of the caller is done.
+type ContextPool interface {
+	Pool
+	GetContext(ctx context.Context) (redis.Conn, error)
+}
+
+// getConn gets a connection from pool, with ctx if the pool is a ContextPool.
+func getConn(ctx context.Context, pool Pool) (redis.Conn, error) {
+	if p, ok := pool.(ContextPool); ok {
+		return p.GetContext(ctx)
+	}
+
+	return pool.Get(), nil
+}
+
 func newWorker(
-	namespace string,
+	keys keyspace,
 	poolID string,
 	pool Pool,
 	contextType reflect.Type,
@@ -56,14 +324,15 @@ func newWorker(
 	jobTypes map[string]*jobType,
 	logger StructuredLogger,
 	processedJobs chan<- *Job,
+	opts ...workerOption,
 ) *worker {
 	workerID := makeIdentifier()
-	ob := newObserver(namespace, pool, workerID, logger)
+	ob := newObserver(keys, pool, workerID, logger)
 
 	w := &worker{
 		workerID:      workerID,
 		poolID:        poolID,
-		namespace:     namespace,
+		keys:          keys,
 		pool:          pool,
 		contextType:   contextType,
 		processedJobs: processedJobs,
@@ -73,10 +342,21 @@ func newWorker(
 		stopChan:         make(chan struct{}),
 		doneStoppingChan: make(chan struct{}),
 
-		drainChan:        make(chan struct{}),
-		doneDrainingChan: make(chan struct{}),
+		drainChan:   make(chan chan struct{}),
+		removedChan: make(chan struct{}),
+
+		malformedKey: redisKeyMalformed(keys),
+		fetchKey:     redisKeyWorkerFetch(keys, workerID),
+
+		ctx:       context.Background(),
+		clock:     defaultClock,
+		resultTTL: defaultJobResultTTL,
+		metrics:   noopMetrics,
+		logger:    logger,
+	}
 
-		logger: logger,
+	for _, opt := range opts {
+		opt(w)
 	}
 
 	w.updateMiddlewareAndJobTypes(middleware, jobTypes)
@@ -87,19 +367,128 @@ func newWorker(
 // note: can't be called while the thing is started
 func (w *worker) updateMiddlewareAndJobTypes(middleware []*middlewareHandler, jobTypes map[string]*jobType) {
 	w.middleware = middleware
+	if w.jobSpans != nil {
+		w.middleware = append([]*middlewareHandler{spanMiddleware(w.jobSpans)}, middleware...)
+	}
 	sampler := prioritySampler{}
+	var inProgQueues []string
 	for _, jt := range jobTypes {
+		if w.maxTotal > 0 || w.fetchTimeout > 0 {
+			inProgQueues = append(inProgQueues, redisKeyJobsInProgress(w.keys, w.poolID, jt.Name))
+		}
 		sampler.add(jt.Priority,
-			redisKeyJobs(w.namespace, jt.Name),
-			redisKeyJobsInProgress(w.namespace, w.poolID, jt.Name),
-			redisKeyJobsPaused(w.namespace, jt.Name),
-			redisKeyJobsLock(w.namespace, jt.Name),
-			redisKeyJobsLockInfo(w.namespace, jt.Name),
-			redisKeyJobsConcurrency(w.namespace, jt.Name))
+			redisKeyJobs(w.keys, jt.Name),
+			redisKeyJobsInProgress(w.keys, w.poolID, jt.Name),
+			redisKeyJobsPaused(w.keys, jt.Name),
+			w.lockKey(jt.Name),
+			redisKeyJobsLockInfo(w.keys, jt.Name),
+			redisKeyJobsConcurrency(w.keys, jt.Name),
+			redisKeyJobsRateLimit(w.keys, jt.Name),
+			redisKeyJobsStrictFIFOBlocked(w.keys, jt.Name),
+			jt.retryKey(w.keys),
+			redisKeyJobsInProgressLeases(w.keys, w.poolID, jt.Name))
+
+		// The queues of EnqueueWithPriority are sampled like job types of their own priority, but they share
+		// the in-progress queue, pause, concurrency and rate limit keys of the job type.
+		for _, p := range jt.PriorityQueues {
+			sampler.add(p,
+				redisKeyJobsPriority(w.keys, jt.Name, p),
+				redisKeyJobsInProgress(w.keys, w.poolID, jt.Name),
+				redisKeyJobsPaused(w.keys, jt.Name),
+				w.lockKey(jt.Name),
+				redisKeyJobsLockInfo(w.keys, jt.Name),
+				redisKeyJobsConcurrency(w.keys, jt.Name),
+				redisKeyJobsRateLimit(w.keys, jt.Name),
+				redisKeyJobsStrictFIFOBlocked(w.keys, jt.Name),
+				jt.retryKey(w.keys),
+				redisKeyJobsInProgressLeases(w.keys, w.poolID, jt.Name))
+		}
 	}
 	w.sampler = sampler
+	w.inProgQueues = inProgQueues
 	w.jobTypes = jobTypes
-	w.redisFetchScript = redis.NewScript(len(jobTypes)*fetchKeysPerJobType, redisLuaFetchJob)
+	w.fetchRotation = append([]sampleItem(nil), sampler.samples...)
+	w.fetchCursor = 0
+	w.drainOrder = sampler.byPriority()
+	w.redisFetchScript = redis.NewScript(w.fetchSize()*fetchKeysPerJobType+len(inProgQueues)+1, redisLuaFetchJob)
+}
+
+// fetchSize returns the number of queues considered by each fetch.
+func (w *worker) fetchSize() int {
+	if w.maxFetchSamples > 0 && w.maxFetchSamples < len(w.sampler.samples) {
+		return w.maxFetchSamples
+	}
+	return len(w.sampler.samples)
+}
+
+// fetchSamples returns the queues to fetch from, in order: all of them, or with WithMaxFetchJobTypes the first
+// half of the cap from the weighted sample and the second half taken in turn, so that every queue is considered
+// at least once every fetchSweep fetches.
+func (w *worker) fetchSamples() []sampleItem {
+	samples := w.sampler.sample()
+	n := w.fetchSize()
+	if n == len(samples) {
+		return samples
+	}
+
+	// The sampler sorts its samples in place, so they're copied.
+	selected := make([]sampleItem, n/2, n)
+	copy(selected, samples)
+
+next:
+	for len(selected) < n {
+		s := w.fetchRotation[w.fetchCursor]
+		w.fetchCursor = (w.fetchCursor + 1) % len(w.fetchRotation)
+
+		for _, sel := range selected {
+			if sel.redisJobs == s.redisJobs {
+				continue next
+			}
+		}
+		selected = append(selected, s)
+	}
+
+	return selected
+}
+
+// fetchSweep returns the number of consecutive fetches which consider every queue at least once.
+func (w *worker) fetchSweep() int {
+	n := w.fetchSize()
+	if n == len(w.sampler.samples) {
+		return 1
+	}
+
+	rotated := n - n/2
+	return (len(w.fetchRotation) + rotated - 1) / rotated
+}
+
+// drainSamples returns the queues to fetch from while draining with WithPriorityDrain: the ones with the highest
+// priority first, in a deterministic order. With WithMaxFetchJobTypes, the given number of consecutive empty
+// fetches selects the window of the cap to fetch from, so the lower priorities are only considered once the higher
+// ones are empty.
+func (w *worker) drainSamples(emptyFetches int) []sampleItem {
+	n := w.fetchSize()
+	if n == len(w.drainOrder) {
+		return w.drainOrder
+	}
+
+	// The last window is shifted back to keep the number of keys of the fetch script.
+	start := (emptyFetches % w.drainSweep()) * n
+	if start > len(w.drainOrder)-n {
+		start = len(w.drainOrder) - n
+	}
+
+	return w.drainOrder[start : start+n]
+}
+
+// drainSweep returns the number of consecutive fetches of drainSamples which consider every queue at least once.
+func (w *worker) drainSweep() int {
+	n := w.fetchSize()
+	if n == len(w.drainOrder) {
+		return 1
+	}
+
+	return (len(w.drainOrder) + n - 1) / n
 }
 
 func (w *worker) start() {
@@ -114,71 +503,220 @@ func (w *worker) stop() {
 	w.observer.stop()
 }
 
+// remove stops the worker for good, e.g. when its pool is scaled down by SetConcurrency. Pending drains of the
+// worker return right away.
+func (w *worker) remove() {
+	w.stop()
+	close(w.removedChan)
+}
+
 func (w *worker) drain() {
-	w.drainChan <- struct{}{}
-	<-w.doneDrainingChan
+	_ = w.drainContext(context.Background())
+}
+
+// drainContext waits until the worker finds no jobs to process. If ctx is done
+// first, the worker is left running and the ctx error is returned.
+func (w *worker) drainContext(ctx context.Context) error {
+	done := make(chan struct{})
+
+	select {
+	case w.drainChan <- done:
+	case <-w.removedChan:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	select {
+	case <-done:
+	case <-w.removedChan:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
 	w.observer.drain()
+
+	return nil
 }
 
 func (w *worker) loop() {
-	var drained bool
+	var drainWaiters []chan struct{}
 	var consequtiveNoJobs int64
+	var emptyFetches int // since a job was found, see fetchSweep
 
 	// Begin immediately. We'll change the duration on each tick with a timer.Reset()
 	timer := time.NewTimer(0)
 	defer timer.Stop()
 
+	ctxDone := w.ctx.Done()
+	fetching := true
+
 	for {
 		select {
 		case <-w.stopChan:
 			w.doneStoppingChan <- struct{}{}
 			return
-		case <-w.drainChan:
-			drained = true
+		case <-ctxDone:
+			// The pool is being stopped: wait for stop without fetching jobs.
+			ctxDone = nil
+			fetching = false
+			timer.Reset(0)
+		case done := <-w.drainChan:
+			// The drain is done once all the queues were found empty since it was requested.
+			drainWaiters = append(drainWaiters, done)
+			emptyFetches = 0
 			timer.Reset(0)
 		case <-timer.C:
-			job, err := w.fetchJob()
+			if !fetching || w.ctx.Err() != nil {
+				for _, done := range drainWaiters {
+					close(done)
+				}
+				drainWaiters = nil
+				continue
+			}
+
+			// Another loop of the pool may have started a backoff since the fetch was scheduled.
+			if backoff := w.failover.backoff(); backoff > 0 {
+				timer.Reset(backoff)
+				continue
+			}
+
+			// While draining with WithPriorityDrain, the queues are fetched from by priority instead of sampled.
+			samples, sweep := w.fetchSamples(), w.fetchSweep()
+			if w.priorityDrain && len(drainWaiters) > 0 {
+				samples, sweep = w.drainSamples(emptyFetches), w.drainSweep()
+			}
+
+			job, err := w.fetchJob(samples)
+			if err == errNoFreeSlot {
+				// The jobs were left in the queues: wait for a job of the pool to be done, not for new jobs.
+				timer.Reset(10 * time.Millisecond)
+				continue
+			}
+
+			if err != nil && w.failover.failed(err) {
+				// Back off exponentially with the rest of the pool instead of hammering the new master while
+				// connections churn.
+				backoff := w.failover.backoff()
+				w.logger.Warn("worker.fetch.failover", slog.Duration("backoff", backoff), errAttr(err))
+				timer.Reset(backoff)
+				continue
+			}
+			if err == nil {
+				w.failover.succeeded()
+			}
+
 			if err != nil {
-				w.logger.Error("worker.fetch", errAttr(err))
+				if w.ctx.Err() == nil {
+					w.logger.Error("worker.fetch", errAttr(err))
+				}
 				timer.Reset(10 * time.Millisecond)
 			} else if job != nil {
+				w.fetched.Add(1)
 				if w.processedJobs != nil {
 					w.processedJobs <- job
 				}
 				w.processJob(job)
 				consequtiveNoJobs = 0
+				emptyFetches = 0
+				timer.Reset(0)
+			} else if emptyFetches++; emptyFetches < sweep {
+				// Some queues weren't considered yet, see WithMaxFetchJobTypes.
 				timer.Reset(0)
 			} else {
-				if drained {
-					w.doneDrainingChan <- struct{}{}
-					drained = false
+				emptyFetches = 0
+				for _, done := range drainWaiters {
+					close(done)
 				}
+				drainWaiters = nil
 				consequtiveNoJobs++
-				idx := consequtiveNoJobs
-				if idx >= int64(len(sleepBackoffs)) {
-					idx = int64(len(sleepBackoffs)) - 1
-				}
-				timer.Reset(sleepBackoffs[idx])
+				timer.Reset(w.idleSleep(consequtiveNoJobs))
 			}
 		}
 	}
 }
 
-func (w *worker) fetchJob() (*Job, error) {
-	// resort queues
-	// NOTE: we could optimize this to only resort every second, or something.
-	w.sampler.sample()
-	numKeys := len(w.sampler.samples) * fetchKeysPerJobType
-	var scriptArgs = make([]interface{}, 0, numKeys+1)
+// idleSleep returns how long to sleep after the given number of consecutive fetches without jobs. The step of
+// sleepBackoffs is shortened by a random fraction of up to pollJitter, so that idle workers don't poll in lockstep.
+func (w *worker) idleSleep(consequtiveNoJobs int64) time.Duration {
+	idx := consequtiveNoJobs
+	if idx >= int64(len(sleepBackoffs)) {
+		idx = int64(len(sleepBackoffs)) - 1
+	}
 
-	for _, s := range w.sampler.samples {
-		scriptArgs = append(scriptArgs, s.redisJobs, s.redisJobsInProg, s.redisJobsPaused, s.redisJobsLock, s.redisJobsLockInfo, s.redisJobsMaxConcurrency) // KEYS[1-6 * N]
+	d := sleepBackoffs[idx]
+	if w.pollJitter > 0 {
+		d -= time.Duration(rand.Float64() * w.pollJitter * float64(d))
+	}
+
+	return d
+}
+
+// maxTotalConcurrency returns the total concurrency limit of the pool for the fetch script, or -1 without a limit.
+func (w *worker) maxTotalConcurrency() int {
+	if w.maxTotal == 0 {
+		return -1
+	}
+
+	return int(w.maxTotal)
+}
+
+// nextFetchID returns the ID of the next fetch with WithFetchTimeout, recorded with the job it takes, or 0 without
+// the fetch timeout. The IDs increase, so that the fetch script knows a record from a lost fetch by its ID.
+func (w *worker) nextFetchID() uint64 {
+	if w.fetchTimeout <= 0 {
+		return 0
+	}
+
+	w.fetchSeq++
+	return w.fetchSeq
+}
+
+// fetchJob fetches a job from the first of the queues of samples which has one available.
+func (w *worker) fetchJob(samples []sampleItem) (*Job, error) {
+	fetchID := w.nextFetchID()
+	numKeys := len(samples) * fetchKeysPerJobType
+	var scriptArgs = make([]interface{}, 0, numKeys+len(w.inProgQueues)+11)
+
+	for _, s := range samples {
+		scriptArgs = append(scriptArgs, s.redisJobs, s.redisJobsInProg, s.redisJobsPaused, s.redisJobsLock, s.redisJobsLockInfo, s.redisJobsMaxConcurrency, s.redisJobsRateLimit,
+			s.redisJobsBlocked, s.redisRetry, s.redisJobsInProgLeases) // KEYS[1-10 * N]
+	}
+	for _, inProgQueue := range w.inProgQueues {
+		scriptArgs = append(scriptArgs, inProgQueue) // KEYS[10 * N + 1 ...]
+	}
+	scriptArgs = append(scriptArgs, w.fetchKey)                      // KEYS[last]
+	scriptArgs = append(scriptArgs, w.poolID)                        // ARGV[1]
+	scriptArgs = append(scriptArgs, w.leaseID())                     // ARGV[2]
+	scriptArgs = append(scriptArgs, w.clock.Now().UnixMilli())       // ARGV[3]
+	scriptArgs = append(scriptArgs, w.leaseTTL.Milliseconds())       // ARGV[4]
+	scriptArgs = append(scriptArgs, w.maxTotalConcurrency())         // ARGV[5]
+	scriptArgs = append(scriptArgs, w.inProgLeaseTTL.Milliseconds()) // ARGV[6]
+	scriptArgs = append(scriptArgs, len(w.inProgQueues))             // ARGV[7]
+	scriptArgs = append(scriptArgs, fetchID)                         // ARGV[8]
+	scriptArgs = append(scriptArgs, w.lostFetch)                     // ARGV[9]
+	scriptArgs = append(scriptArgs, fetchRecordTTL.Milliseconds())   // ARGV[10]
+	conn, err := getConn(w.ctx, w.pool)
+	if err != nil {
+		return nil, err
 	}
-	scriptArgs = append(scriptArgs, w.poolID) // ARGV[1]
-	conn := w.pool.Get()
 	defer conn.Close()
 
-	values, err := redis.Values(w.redisFetchScript.Do(conn, scriptArgs...))
+	reply, err := w.redisFetchScript.Do(withReadTimeout(conn, w.fetchTimeout), scriptArgs...)
+	if fetchID > 0 {
+		// Without a reply, the script may still have taken a job: the next fetches take it back.
+		if err == nil {
+			w.lostFetch = 0
+		} else if w.lostFetch == 0 {
+			w.lostFetch = fetchID
+		}
+	}
+	if n, ok := reply.(int64); ok && n == 0 {
+		return nil, errNoFreeSlot
+	}
+
+	values, err := redis.Values(reply, err)
 	if err == redis.ErrNil {
 		return nil, nil
 	} else if err != nil {
@@ -204,51 +742,267 @@ func (w *worker) fetchJob() (*Job, error) {
 		return nil, fmt.Errorf("response in prog not bytes")
 	}
 
-	job, err := newJob(rawJSON, dequeuedFrom, inProgQueue)
+	job, err := newJob(rawJSON, dequeuedFrom, inProgQueue, w.codec)
 	if err != nil {
-		return nil, err
+		return nil, w.removeMalformedJob(samples, rawJSON, string(inProgQueue), err)
 	}
 
 	return job, nil
 }
 
+// removeMalformedJob takes a job which can't be decoded out of the in-progress queue it was fetched into and
+// releases its lock, so that it doesn't wedge the worker or come back once the pool dies. The raw job is moved to
+// the malformed jobs zset, scored by the time it was fetched at, unless WithDropMalformedJobs is set.
+func (w *worker) removeMalformedJob(samples []sampleItem, rawJSON []byte, inProgQueue string, decodeErr error) error {
+	err := fmt.Errorf("%w in %s: %v", ErrMalformedJob, inProgQueue, decodeErr)
+
+	for _, s := range samples {
+		if s.redisJobsInProg != inProgQueue {
+			continue
+		}
+
+		// The forward queue must be a key of the namespace even if the job is dropped, see removeJobFromInProgress.
+		forwardKey := w.malformedKey
+		if forwardKey == "" {
+			forwardKey = redisKeyMalformed(w.keys)
+		}
+
+		conn := w.pool.Get()
+		defer conn.Close()
+
+		_, removeErr := redisRemoveJobFromInProgress.Do(conn,
+			s.redisJobsInProg,
+			s.redisJobsLock,
+			s.redisJobsLockInfo,
+			forwardKey,
+			s.redisJobsInProg+w.inProgressLeasesSuffix(),
+			forwardKey,
+			forwardKey,
+			forwardKey,
+			w.poolID,
+			rawJSON,
+			w.malformedKey != "",
+			w.clock.Now().Unix(),
+			rawJSON,
+			w.leaseID(),
+			w.inProgLeaseTTL > 0,
+			false,
+			"",
+			0,
+			"",
+		)
+
+		return errors.Join(err, removeErr)
+	}
+
+	return err
+}
+
 func (w *worker) processJob(job *Job) {
+	logger := w.logger
+	if w.jobLogFields != nil {
+		logger = newJobLogger(logger, w.jobLogFields(job))
+	}
+
 	if job.Unique {
-		w.deleteUniqueJob(job)
+		w.deleteUniqueJob(job, logger)
 	}
 
 	var runErr error
+	var ran bool // the handler ran, see removeJobFromInProgress
 	jt := w.jobTypes[job.Name]
 	if jt == nil {
-		runErr = fmt.Errorf("stray job: no handler")
-		w.logger.Error("process_job.stray", errAttr(runErr))
+		runErr = fmt.Errorf("%w for job %q", ErrStrayJob, job.Name)
+		logger.Error("process_job.stray", slog.String("job_id", job.ID), errAttr(runErr))
+		if w.strayJobHandler != nil {
+			w.strayJobHandler(job)
+		}
+	} else if job.ttlExpired(w.clock.Now().Unix()) {
+		logger.Debug("process_job.ttl_expired", slog.String("job_name", job.Name), slog.String("job_id", job.ID))
+	} else if job.expired(w.clock.Now().Unix(), jt.Deadline) {
+		logger.Debug("process_job.expired", slog.String("job_name", job.Name), slog.String("job_id", job.ID))
+		if w.expiredJobHook != nil {
+			w.expiredJobHook(job)
+		}
 	} else {
+		logger.Debug("process_job.started", slog.String("job_name", job.Name), slog.String("job_id", job.ID))
 		w.observeStarted(job.Name, job.ID, job.Args)
+		w.events.emit(JobEventStarted, job)
+		w.metrics.JobStarted(job.Name)
 		job.observer = w.observer // for Checkin
-		_, runErr = runJob(job, w.contextType, w.middleware, jt, w.logger)
+		job.startedAt = w.clock.Now()
+		startedAt := time.Now()
+		stopRenewing := w.renewLease(job)
+		runErr = w.runJob(job, jt, logger)
+		ran = true
+		stopRenewing()
+		duration := time.Since(startedAt)
+		skipped := errors.Is(runErr, ErrSkipJob)
+		if skipped {
+			logger.Debug("process_job.skipped", slog.String("job_name", job.Name), slog.String("job_id", job.ID))
+			runErr = nil
+		} else {
+			attrs := []any{slog.String("job_name", job.Name), slog.String("job_id", job.ID),
+				slog.Duration("duration", duration)}
+			if runErr != nil {
+				attrs = append(attrs, errAttr(runErr))
+			}
+			logger.Debug("process_job.done", attrs...)
+		}
+		if w.slowThreshold > 0 && duration >= w.slowThreshold {
+			logger.Warn("process_job.slow", slog.String("job_name", job.Name), slog.String("job_id", job.ID),
+				slog.Duration("duration", duration))
+		}
+		w.metrics.JobCompleted(job.Name, duration, runErr)
 		w.observeDone(job.Name, job.ID, runErr)
+		if skipped {
+			job.rescheduled = false
+			w.events.emit(JobEventSkipped, job)
+		} else if runErr == nil && job.rescheduled {
+			logger.Debug("process_job.rescheduled", slog.String("job_name", job.Name), slog.String("job_id", job.ID),
+				slog.Duration("in", job.rescheduleIn))
+			w.events.emit(JobEventRescheduled, job)
+		} else if runErr == nil {
+			if job.hasResult {
+				w.saveResult(job, logger)
+			}
+			w.events.emit(JobEventSucceeded, job)
+		}
 	}
 
 	if runErr != nil {
-		job.failed(runErr)
+		job.failed(runErr, w.clock.Now().Unix())
+
+		if w.jobErrorHandler != nil {
+			w.jobErrorHandler(job, runErr)
+		}
 	}
 
 	// Since we've taken the task and completed it, we must keep retrying commits
 	// until we succeed, otherwise we'll end up with block job.
 	retryErr(sleepBackoffs, func() error {
-		err := w.removeJobFromInProgress(job, jt, runErr)
+		_, err := w.removeJobFromInProgress(job, jt, runErr, ran, logger)
 		if err != nil {
-			w.logger.Warn("worker.remove_job_from_in_progress.lrem", errAttr(err))
+			w.failover.failed(err)
+			logger.Warn("worker.remove_job_from_in_progress.lrem", errAttr(err))
 		}
 
 		return err
 	})
 }
 
-func (w *worker) deleteUniqueJob(job *Job) {
-	uniqueKey, err := redisKeyUniqueJob(w.namespace, job.Name, job.Args)
+// runJob runs the job, retrying it right away up to InlineRetries times if it fails. Jobs which should not be
+// retried, jobs of a pool being stopped, jobs past their Deadline and jobs whose runs took InlineRetryTimeout
+// aren't retried inline.
+func (w *worker) runJob(job *Job, jt *jobType, logger StructuredLogger) error {
+	var err error
+	startedAt := w.clock.Now()
+	for attempt := uint(0); ; attempt++ {
+		job.rescheduled = false
+		_, err = runJob(job, w.contextType, w.middleware, jt, logger)
+		job.Attempts++
+
+		if err == nil || attempt >= jt.InlineRetries || w.ctx.Err() != nil ||
+			errors.Is(err, ErrDeadLetter) || errors.Is(err, ErrSkipJob) ||
+			job.expired(w.clock.Now().Unix(), jt.Deadline) ||
+			(jt.InlineRetryTimeout > 0 && w.clock.Now().Sub(startedAt) >= jt.InlineRetryTimeout) {
+			return err
+		}
+
+		logger.Debug("process_job.inline_retry",
+			slog.String("job_name", job.Name), slog.String("job_id", job.ID), errAttr(err))
+	}
+}
+
+// lockKey returns the key the concurrency of the job type is counted in: its leases key with
+// WithLeasedConcurrency, its lock key otherwise.
+func (w *worker) lockKey(jobName string) string {
+	if w.leaseTTL > 0 {
+		return redisKeyJobsLeases(w.keys, jobName)
+	}
+	return redisKeyJobsLock(w.keys, jobName)
+}
+
+// leaseID returns the member of the leases of the worker, or an empty string without WithLeasedConcurrency.
+// A worker runs a single job at a time, so it holds at most one lease.
+func (w *worker) leaseID() string {
+	if w.leaseTTL > 0 {
+		return w.workerID
+	}
+	return ""
+}
+
+// inProgressLeasesSuffix returns the suffix of the in-progress leases key of an in-progress queue, or an empty
+// string without WithInProgressLeases.
+func (w *worker) inProgressLeasesSuffix() string {
+	if w.inProgLeaseTTL > 0 {
+		return w.keys.sep + "leases"
+	}
+	return ""
+}
+
+// renewLease extends the lease of the job every third of the lease TTL until the returned func is called,
+// so that the lease only expires if the worker dies. It does nothing without WithLeasedConcurrency.
+func (w *worker) renewLease(job *Job) (stop func()) {
+	if w.leaseTTL <= 0 {
+		return func() {}
+	}
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+
+		ticker := time.NewTicker(w.leaseTTL / 3)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if err := w.extendLease(job.Name); err != nil {
+					w.logger.Warn("worker.renew_lease", slog.String("job_name", job.Name), errAttr(err))
+				}
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+func (w *worker) extendLease(jobName string) error {
+	conn := w.pool.Get()
+	defer conn.Close()
+
+	_, err := redisExtendLeaseScript.Do(conn, w.lockKey(jobName), w.leaseID(), w.leaseTTL.Milliseconds())
+	return err
+}
+
+// saveResult stores the result set by the handler. The job has succeeded regardless, so errors are only logged.
+func (w *worker) saveResult(job *Job, logger StructuredLogger) {
+	result, err := json.Marshal(job.result)
+	if err != nil {
+		logger.Error("worker.save_result.marshal", errAttr(err))
+		return
+	}
+
+	conn := w.pool.Get()
+	defer conn.Close()
+
+	_, err = conn.Do("SET", redisKeyJobResult(w.keys, job.ID), result, "PX", w.resultTTL.Milliseconds())
+	if err != nil {
+		logger.Error("worker.save_result.set", errAttr(err))
+	}
+}
+
+func (w *worker) deleteUniqueJob(job *Job, logger StructuredLogger) {
+	uniqueKey, err := job.uniqueKey(w.keys)
 	if err != nil {
-		w.logger.Error("worker.delete_unique_job.key", errAttr(err))
+		logger.Error("worker.delete_unique_job.key", errAttr(err))
 		return
 	}
 
@@ -257,62 +1011,140 @@ func (w *worker) deleteUniqueJob(job *Job) {
 
 	_, err = conn.Do("DEL", uniqueKey)
 	if err != nil {
-		w.logger.Error("worker.delete_unique_job.del", errAttr(err))
+		logger.Error("worker.delete_unique_job.del", errAttr(err))
 	}
 }
 
-func (w *worker) removeJobFromInProgress(job *Job, jt *jobType, runErr error) error {
+// removeJobFromInProgress acks the job, moving it to the retry, dead or scheduled queue if needed, and with
+// WithJobDependencies enqueues its children, see EnqueueAfter, if it's done. ran tells whether the handler ran.
+// It returns whether the job was moved to the retry queue.
+func (w *worker) removeJobFromInProgress(job *Job, jt *jobType, runErr error, ran bool, logger StructuredLogger) (bool, error) {
 	var (
 		forward          bool
+		dead             bool
 		queue            string
 		score            int64
-		failedJobRawJSON []byte
+		forwardedRawJSON []byte
 	)
 
 	if runErr != nil {
+		now := w.clock.Now().Unix()
+
 		switch {
 		case jt != nil && jt.SkipDead:
 			forward = false
-		case jt != nil && int64(jt.MaxFails)-job.Fails > 0:
+		case jt == nil && w.dropStrayJobs:
+			forward = false
+		case jt != nil && jt.shouldRetry(job, now) && !errors.Is(runErr, ErrDeadLetter):
 			forward = true
-			queue = redisKeyRetry(w.namespace)
-			score = nowEpochSeconds() + jt.calcBackoff(job)
+			queue = jt.retryKey(w.keys)
+			score = now + jt.calcBackoff(job, runErr)
 		default:
-			// NOTE: sidekiq limits the # of jobs: only keep jobs for 6 months, and only keep a max # of jobs
-			// The max # of jobs seems really horrible. Seems like operations should be on top of it.
-			// conn.Send("ZREMRANGEBYSCORE", redisKeyDead(w.namespace), "-inf", now - keepInterval)
-			// conn.Send("ZREMRANGEBYRANK", redisKeyDead(w.namespace), 0, -maxJobs)
+			// NOTE: the dead queue is trimmed by the reaper if WithDeadJobRetention is set.
 			forward = true
-			queue = redisKeyDead(w.namespace)
-			score = nowEpochSeconds()
+			dead = true
+			queue = redisKeyDead(w.keys)
+			score = now
 		}
 
 		if forward {
 			var err error
-			failedJobRawJSON, err = job.serialize()
+			forwardedRawJSON, err = job.serialize()
 			if err != nil {
-				w.logger.Error("worker.removeJobFromInProgress.serialize", errAttr(err))
+				logger.Error("worker.removeJobFromInProgress.serialize", errAttr(err))
 				forward = false
 			}
 		}
+	} else if job.rescheduled {
+		// The in-progress job is only moved if it's still there, so retrying the removal doesn't reschedule it twice.
+		var err error
+		forwardedRawJSON, err = job.serialize()
+		if err != nil {
+			logger.Error("worker.removeJobFromInProgress.serialize", errAttr(err))
+		} else {
+			forward = true
+			queue = redisKeyScheduled(w.keys)
+			score = w.clock.Now().Add(job.rescheduleIn).Unix()
+		}
+	}
+
+	if !forward {
+		// The forward queue is unused, but in cluster mode all the keys of the script must be in the slot of the
+		// namespace: an empty key name would fail with CROSSSLOT.
+		queue = redisKeyDead(w.keys)
+	}
+
+	// A strict FIFO job type isn't fetched while its failed job waits in the retry queue, so the jobs enqueued
+	// after it can't run first.
+	block := forward && !dead && runErr != nil && jt != nil && jt.StrictFIFO
+	retried := runErr != nil && forward && !dead
+
+	// The children of a job are enqueued once it succeeded, or dropped once it failed for good. Skipped jobs count
+	// as succeeded, and jobs which weren't run, e.g. expired ones, as failed. The outcome is kept for the children
+	// enqueued later. If the retry of a job is removed without being run, e.g. deleted with the client, its
+	// children are never resolved and wait until their list expires.
+	var outcome string
+	if w.dependencies && !retried && !job.rescheduled {
+		outcome = "failed"
+		if ran && runErr == nil {
+			outcome = "succeeded"
+		}
 	}
 
 	conn := w.pool.Get()
 	defer conn.Close()
 
-	_, err := redisRemoveJobFromInProgress.Do(conn,
+	children, err := redis.Int(redisRemoveJobFromInProgress.Do(conn,
 		job.inProgQueue,
-		redisKeyJobsLock(w.namespace, job.Name),
-		redisKeyJobsLockInfo(w.namespace, job.Name),
+		w.lockKey(job.Name),
+		redisKeyJobsLockInfo(w.keys, job.Name),
 		queue,
+		string(job.inProgQueue)+w.inProgressLeasesSuffix(),
+		redisKeyJobsStrictFIFOBlocked(w.keys, job.Name),
+		redisKeyJobChildren(w.keys, job.ID),
+		redisKeyJobOutcome(w.keys, job.ID),
 		w.poolID,
 		job.rawJSON,
 		forward,
 		score,
-		failedJobRawJSON,
-	)
+		forwardedRawJSON,
+		w.leaseID(),
+		w.inProgLeaseTTL > 0,
+		block,
+		outcome,
+		int64(jobOutcomeTTL.Seconds()),
+		redisKeyJobsPrefix(w.keys),
+	))
+	if err != nil {
+		return false, err
+	}
 
-	return err
+	if children > 0 {
+		logger.Debug("worker.resolve_children", slog.String("job_name", job.Name), slog.String("job_id", job.ID),
+			slog.String("outcome", outcome), slog.Int("children", children))
+	}
+
+	if runErr != nil {
+		if forward && !dead {
+			w.events.emit(JobEventRetried, job)
+		} else {
+			w.events.emit(JobEventDied, job)
+		}
+	}
+
+	if forward && runErr != nil {
+		if dead {
+			w.metrics.JobDied(job.Name)
+
+			if w.deadJobHook != nil {
+				w.deadJobHook(job, runErr)
+			}
+		} else {
+			w.metrics.JobRetried(job.Name)
+		}
+	}
+
+	return retried, nil
 }
 
 // Default algorithm returns an fastly increasing backoff counter which grows in an unbounded fashion
@@ -2,13 +2,18 @@ package work
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log/slog"
+	"math"
 	"reflect"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/gomodule/redigo/redis"
 	"github.com/robfig/cron/v3"
 )
 
@@ -16,29 +21,77 @@ const cronFormat = cron.SecondOptional | cron.Minute | cron.Hour | cron.Dom | cr
 
 // WorkerPool represents a pool of workers. It forms the primary API of gocraft/work. WorkerPools provide the public API of gocraft/work. You can attach jobs and middlware to them. You can start and stop them. Based on their concurrency setting, they'll spin up N worker goroutines.
 type WorkerPool struct {
+	ctx          context.Context // the pool is stopped when it's done
 	workerPoolID string
 	concurrency  uint
-	namespace    string // eg, "myapp-work"
+	keys         keyspace
 	pool         Pool
+	maintPool    Pool // see WithMaintenancePool, nil to use pool
 
 	contextType                 reflect.Type
 	jobTypes                    map[string]*jobType
 	middleware                  []*middlewareHandler
+	mtx                         sync.Mutex // guards started, workers, removing and periodicJobs
 	started                     bool
+	stopped                     chan struct{}      // closed by StopContext
+	workersCtx                  context.Context    // the context of the started workers
+	cancelWorkers               context.CancelFunc // stops the workers from fetching jobs, see StopContext
 	periodicJobs                []*periodicJob
 	watchdog                    *watchdog
 	watchdogFailCheckingTimeout time.Duration
 
 	workers          []*worker
+	removing         []*worker // removed by SetConcurrency, but still finishing their jobs
 	heartbeater      *workerPoolHeartbeater
 	retrier          *requeuer
 	scheduler        *requeuer
 	reapPeriod       time.Duration
+	reapJitter       float64
+	deadJobMaxAge    time.Duration
+	deadJobMaxCount  int64
+	ttlSweep         bool
+	recoverInProg    bool
+	inProgLeaseTTL   time.Duration
+	inProgSweeper    *inProgressSweeper
 	deadPoolReaper   *deadPoolReaper
 	periodicEnqueuer *periodicEnqueuer
 
-	reaperHook ReaperHook
-	logger     StructuredLogger
+	// The background maintenance disabled by WithoutScheduler etc.
+	withoutScheduler        bool
+	withoutRetrier          bool
+	withoutReaper           bool
+	withoutPeriodicEnqueuer bool
+	periodicDryRun          bool
+
+	reaperHook      ReaperHook
+	reenqueuedHook  ReenqueuedJobHook
+	deadJobHook     DeadJobHook
+	jobErrorHandler JobErrorHandler
+	failoverHandler FailoverHandler
+	failover        *failoverState // shared by the workers and the background loops
+	strayJobHandler StrayJobHandler
+	dropStrayJobs   bool
+	malformedKey    string
+	dropMalformed   bool
+	dependencies    bool
+	jobLogFields    JobLogFields
+	slowThreshold   time.Duration
+	jobSpans        JobSpanStarter
+	expiredJobHook  ExpiredJobHook
+	codec           ArgsCodec
+	events          jobEvents
+	maxTotal        uint // see WithMaxTotalConcurrency
+	clock           Clock
+	resultTTL       time.Duration
+	pollJitter      float64
+	fetchJobTypes   uint // see WithMaxFetchJobTypes
+	fetchTimeout    time.Duration
+	priorityDrain   bool
+	leaseTTL        time.Duration
+	obsArgsLimit    int
+	obsMinDuration  time.Duration
+	metrics         MetricsReporter
+	logger          StructuredLogger
 }
 
 type jobType struct {
@@ -48,9 +101,42 @@ type jobType struct {
 	isGeneric      bool
 	genericHandler interface{}
 	dynamicHandler reflect.Value
+	middleware     []*middlewareHandler // applied after the pool's middleware
 }
 
-func (jt *jobType) calcBackoff(j *Job) int64 {
+// shouldRetry reports whether the failed job has retries left. If both MaxFails and MaxRetryAge are set,
+// the job is retried until either of them is reached. If only MaxRetryAge is set, the number of attempts
+// isn't limited.
+func (jt *jobType) shouldRetry(j *Job, now int64) bool {
+	if jt.MaxRetryAge > 0 && now-j.FirstEnqueuedAt >= int64(jt.MaxRetryAge/time.Second) {
+		return false
+	}
+
+	if jt.MaxFails == 0 && jt.MaxRetryAge > 0 {
+		return true
+	}
+
+	return int64(jt.MaxFails)-j.Fails > 0
+}
+
+// retryKey returns the retry queue of failed jobs. If RetryQueue is set, the retries are sent to the retry queue
+// of that namespace and requeued by its pools, so they're processed by the pools of that namespace which
+// register the job type, e.g. a dedicated pool with a lower concurrency. Both namespaces must use the same
+// key separator and args codec, and they can't be in cluster mode since the keys must be in the same slot.
+func (jt *jobType) retryKey(keys keyspace) string {
+	if jt.RetryQueue != "" {
+		return redisKeyRetry(keys.withNamespace(jt.RetryQueue))
+	}
+	return redisKeyRetry(keys)
+}
+
+func (jt *jobType) calcBackoff(j *Job, err error) int64 {
+	if jt.BackoffWithError != nil {
+		if jobErr, ok := err.(*JobError); ok {
+			err = jobErr.Err
+		}
+		return jt.BackoffWithError(j, err)
+	}
 	if jt.Backoff == nil {
 		return defaultBackoffCalculator(j)
 	}
@@ -63,13 +149,37 @@ func (jt *jobType) calcBackoff(j *Job) int64 {
 // The builtin backoff calculator provides an exponentially increasing wait function.
 type BackoffCalculator func(job *Job) int64
 
+// BackoffCalculatorWithError is like BackoffCalculator, but also receives the error
+// that caused the job to fail, so the backoff can depend on the kind of failure.
+// It's the error returned by the handler, not the *JobError wrapping it.
+type BackoffCalculatorWithError func(job *Job, err error) int64
+
 // JobOptions can be passed to JobWithOptions.
 type JobOptions struct {
-	Priority       uint              // Priority from 1 to 10000
-	MaxFails       uint              // 1: send straight to dead (unless SkipDead)
-	SkipDead       bool              // If true, don't send failed jobs to the dead queue when retries are exhausted.
-	MaxConcurrency uint              // Max number of jobs to keep in flight (default is 0, meaning no max)
-	Backoff        BackoffCalculator // If not set, uses the default backoff algorithm
+	Priority           uint                       // Priority from 1 to 10000
+	MaxFails           uint                       // 1: send straight to dead (unless SkipDead). Handlers can return ErrDeadLetter to do it regardless.
+	SkipDead           bool                       // If true, don't send failed jobs to the dead queue when retries are exhausted.
+	MaxConcurrency     uint                       // Max number of jobs to keep in flight (default is 0, meaning no max)
+	Backoff            BackoffCalculator          // If not set, uses the default backoff algorithm
+	BackoffWithError   BackoffCalculatorWithError // If set, takes precedence over Backoff
+	Deadline           time.Duration              // Skip the job if it isn't started within this duration after being enqueued (default is 0, meaning no deadline)
+	WatchdogTimeout    time.Duration              // For periodic jobs, overrides the watchdog timeout of WithWatchdogFailCheckingTimeout
+	MaxRetryAge        time.Duration              // Don't retry the job once this duration has passed since it was first enqueued, see shouldRetry
+	RetryQueue         string                     // Namespace whose retry queue receives the retries instead of the pool's, see retryKey
+	InlineRetries      uint                       // Retry a failed job right away in the same worker up to this many times before the normal retry logic, unless it's past its Deadline
+	InlineRetryTimeout time.Duration              // Don't retry the job inline once this duration has passed since its first run started (default is 0, meaning no limit)
+	PriorityQueues     []uint                     // Priorities of the extra queues the jobs can be enqueued into with EnqueueWithPriority
+	AtMostOnce         bool                       // If the pool dies while the job is in progress, the reaper moves the job to the dead queue instead of requeueing it
+	RateLimit          RateLimit                  // Max rate at which the jobs start across all the pools of the namespace (default is no limit)
+	StrictFIFO         bool                       // Run the jobs one at a time in enqueue order, with the retries requeued ahead of the queued jobs and no job fetched while one waits in the retry queue. Implies a MaxConcurrency of 1
+}
+
+// RateLimit caps the rate at which the jobs of a type start with a token bucket stored in Redis, shared by all the
+// worker pools of the namespace. Each fetch of a job takes a token; without one the job stays queued and the worker
+// moves on to the other job types. The bucket is refilled by the clock of Redis.
+type RateLimit struct {
+	PerSecond float64 // Tokens added to the bucket per second, i.e. the sustained rate of jobs (default is 0, meaning no limit)
+	Burst     uint    // Max number of tokens in the bucket, i.e. the jobs that can start at once after an idle period (default is 1)
 }
 
 // Deprecated: use JobHandler instead.
@@ -104,19 +214,36 @@ type (
 // NewWorkerPool creates a new worker pool. ctx should be a struct literal whose type will be used for middleware and handlers.
 // concurrency specifies how many workers to spin up - each worker can process jobs concurrently.
 func NewWorkerPool(ctx interface{}, concurrency uint, namespace string, pool Pool, opts ...WorkerPoolOption) *WorkerPool {
+	return NewWorkerPoolWithContext(context.Background(), ctx, concurrency, namespace, pool, opts...)
+}
+
+// NewWorkerPoolWithContext creates a new worker pool like NewWorkerPool, which is stopped like with Stop when ctx is done,
+// e.g. when a signal is received. The workers stop fetching new jobs right away. jobCtx is the ctx of NewWorkerPool.
+func NewWorkerPoolWithContext(
+	ctx context.Context,
+	jobCtx interface{},
+	concurrency uint,
+	namespace string,
+	pool Pool,
+	opts ...WorkerPoolOption,
+) *WorkerPool {
 	if pool == nil {
 		panic("NewWorkerPool needs a non-nil Pool")
 	}
 
-	ctxType := reflect.TypeOf(ctx)
+	ctxType := reflect.TypeOf(jobCtx)
 	validateContextType(ctxType)
 	wp := &WorkerPool{
+		ctx:          ctx,
 		workerPoolID: makeIdentifier(),
 		concurrency:  concurrency,
-		namespace:    namespace,
+		keys:         newKeyspace(namespace),
 		pool:         pool,
 		contextType:  ctxType,
 		jobTypes:     make(map[string]*jobType),
+		reapJitter:   defaultReapJitter,
+		clock:        defaultClock,
+		metrics:      noopMetrics,
 		logger:       noopLogger,
 	}
 
@@ -124,28 +251,33 @@ func NewWorkerPool(ctx interface{}, concurrency uint, namespace string, pool Poo
 		opt(wp)
 	}
 
+	wp.failover = &failoverState{handler: wp.failoverHandler}
 	wp.watchdog = newWatchdog(
 		watchdogWithLogger(wp.logger),
 		watchdogWithFailCheckingTimeout(wp.watchdogFailCheckingTimeout),
 	)
 
 	for i := uint(0); i < wp.concurrency; i++ {
-		w := newWorker(
-			wp.namespace,
-			wp.workerPoolID,
-			wp.pool,
-			wp.contextType,
-			nil,
-			wp.jobTypes,
-			wp.logger,
-			wp.watchdog.processedJobs,
-		)
-		wp.workers = append(wp.workers, w)
+		wp.workers = append(wp.workers, wp.newWorker())
 	}
 
 	return wp
 }
 
+func (wp *WorkerPool) newWorker() *worker {
+	return newWorker(
+		wp.keys,
+		wp.workerPoolID,
+		wp.pool,
+		wp.contextType,
+		wp.middleware,
+		wp.jobTypes,
+		wp.logger,
+		wp.watchdog.processedJobs,
+		wp.workerOptions()...,
+	)
+}
+
 // Middleware appends the specified function to the middleware chain. The fn can
 // take one of these forms:
 //
@@ -156,8 +288,32 @@ func NewWorkerPool(ctx interface{}, concurrency uint, namespace string, pool Poo
 //
 // ContextType matches the type of ctx specified when creating a pool.
 func (wp *WorkerPool) Middleware(fn interface{}) *WorkerPool {
+	wp.middleware = append(wp.middleware, newMiddlewareHandler(wp.contextType, fn))
+
+	for _, w := range wp.workers {
+		w.updateMiddlewareAndJobTypes(wp.middleware, wp.jobTypes)
+	}
+
+	return wp
+}
+
+// JobMiddleware appends the specified function to the middleware chain of the 'name' jobs only.
+// It runs after the middleware added with Middleware and before the handler. The fn can take
+// the same forms as for Middleware. The job must be registered with Job or JobWithOptions first.
+func (wp *WorkerPool) JobMiddleware(name string, fn interface{}) *WorkerPool {
+	jt, ok := wp.jobTypes[name]
+	if !ok {
+		panic("work: JobMiddleware needs a registered job: " + name)
+	}
+
+	jt.middleware = append(jt.middleware, newMiddlewareHandler(wp.contextType, fn))
+
+	return wp
+}
+
+func newMiddlewareHandler(ctxType reflect.Type, fn interface{}) *middlewareHandler {
 	vfn := reflect.ValueOf(fn)
-	validateMiddlewareType(wp.contextType, vfn)
+	validateMiddlewareType(ctxType, vfn)
 
 	mw := &middlewareHandler{
 		genericMiddleware: fn,
@@ -169,13 +325,7 @@ func (wp *WorkerPool) Middleware(fn interface{}) *WorkerPool {
 		mw.isGeneric = true
 	}
 
-	wp.middleware = append(wp.middleware, mw)
-
-	for _, w := range wp.workers {
-		w.updateMiddlewareAndJobTypes(wp.middleware, wp.jobTypes)
-	}
-
-	return wp
+	return mw
 }
 
 // Job registers the job name to the specified handler fn. For instance, when workers pull jobs from the name queue they'll be processed by the specified handler function.
@@ -195,6 +345,9 @@ func (wp *WorkerPool) Job(name string, fn interface{}) *WorkerPool {
 // such as a job's priority, retry count, and whether to send dead jobs to the dead job queue or trash them.
 func (wp *WorkerPool) JobWithOptions(name string, jobOpts JobOptions, fn interface{}) *WorkerPool {
 	jobOpts = applyDefaultsAndValidate(jobOpts)
+	if jobOpts.RetryQueue != "" && jobOpts.RetryQueue != wp.keys.namespace && wp.keys.cluster {
+		panic("work: JobOptions.RetryQueue can't be another namespace in cluster mode")
+	}
 
 	vfn := reflect.ValueOf(fn)
 	validateHandlerType(wp.contextType, vfn)
@@ -221,23 +374,117 @@ func (wp *WorkerPool) JobWithOptions(name string, jobOpts JobOptions, fn interfa
 }
 
 func newPeriodicJob(spec string, jobName string) (*periodicJob, error) {
+	return newPeriodicJobInLocation(spec, jobName, nil)
+}
+
+// newPeriodicJobInLocation parses spec in loc. If loc is nil, the time zone of the spec
+// (e.g. "CRON_TZ=Europe/Moscow 0 0 9 * * *") or the local time zone is used.
+func newPeriodicJobInLocation(spec string, jobName string, loc *time.Location) (*periodicJob, error) {
 	schedule, err := cron.NewParser(cronFormat).Parse(spec)
 	if err != nil {
 		return nil, err
 	}
 
+	if loc != nil {
+		if strings.HasPrefix(spec, "TZ=") || strings.HasPrefix(spec, "CRON_TZ=") {
+			return nil, fmt.Errorf("work: spec %q already has a time zone", spec)
+		}
+
+		if s, ok := schedule.(*cron.SpecSchedule); ok {
+			s.Location = loc
+		}
+
+		// Make the IDs of the periodic jobs differ from the ones in other locations.
+		spec = "CRON_TZ=" + loc.String() + " " + spec
+	}
+
 	return &periodicJob{jobName: jobName, spec: spec, schedule: schedule}, nil
 }
 
 // PeriodicallyEnqueue will periodically enqueue jobName according to the cron-based spec.
 // The spec format is based on github.com/robfig/cron/v3, which is a relatively standard cron format.
 // Note that the first value can be seconds!
+// The schedule uses the local time zone unless the spec is prefixed with one, e.g. "CRON_TZ=Europe/Moscow 0 0 9 * * *".
 // If you have multiple worker pools on different machines, they'll all coordinate and only enqueue your job once.
 func (wp *WorkerPool) PeriodicallyEnqueue(spec string, jobName string) *WorkerPool {
+	return wp.PeriodicallyEnqueueInLocation(spec, jobName, nil)
+}
+
+// TryPeriodicallyEnqueue is like PeriodicallyEnqueue, but returns the error of parsing spec instead of panicking,
+// e.g. to validate schedules loaded from the config at runtime. Nothing is added if spec is invalid.
+func (wp *WorkerPool) TryPeriodicallyEnqueue(spec string, jobName string) error {
 	j, err := newPeriodicJob(spec, jobName)
+	if err != nil {
+		return err
+	}
+
+	wp.periodicJobs = append(wp.periodicJobs, j)
+
+	return nil
+}
+
+// PeriodicallyEnqueueInLocation is like PeriodicallyEnqueue, but the spec is interpreted in loc
+// instead of the local time zone, so e.g. daily jobs run at the same wall clock time across DST changes.
+// The spec must not have a time zone prefix.
+func (wp *WorkerPool) PeriodicallyEnqueueInLocation(spec string, jobName string, loc *time.Location) *WorkerPool {
+	j, err := newPeriodicJobInLocation(spec, jobName, loc)
+	if err != nil {
+		panic(err)
+	}
+
+	wp.periodicJobs = append(wp.periodicJobs, j)
+
+	return wp
+}
+
+// RemovePeriodicJob removes the periodic job registered with spec and jobName, if any. It can be called before
+// Start or while the pool runs: the periodic enqueuer stops enqueuing the job and the watchdog stops watching it.
+// The spec of a job registered with PeriodicallyEnqueueInLocation is prefixed with its time zone, as reported
+// by RegisteredJobs.
+//
+// The jobs already enqueued by the pools, up to a few minutes ahead, are left in the scheduled set and still run.
+// They can be deleted with Client.DeleteScheduledJob, as long as no other pool in the namespace still enqueues
+// the job with the same spec.
+func (wp *WorkerPool) RemovePeriodicJob(spec string, jobName string) {
+	wp.mtx.Lock()
+	defer wp.mtx.Unlock()
+
+	// The slice is shared with the periodic enqueuer and the watchdog, so it's copied instead of filtered in place.
+	jobs := make([]*periodicJob, 0, len(wp.periodicJobs))
+	for _, pj := range wp.periodicJobs {
+		if pj.spec != spec || pj.jobName != jobName {
+			jobs = append(jobs, pj)
+		}
+	}
+	if len(jobs) == len(wp.periodicJobs) {
+		return
+	}
+	wp.periodicJobs = jobs
+
+	if !wp.started {
+		return
+	}
+
+	wp.periodicEnqueuer.setPeriodicJobs(jobs)
+	if !wp.periodicDryRun {
+		wp.watchdog.setPeriodicJobs(jobs...)
+	}
+}
+
+// PeriodicallyEnqueueWithArgs is like PeriodicallyEnqueue, but the jobs are enqueued with the args returned by argsFn,
+// which is called with the time the job is scheduled for, e.g. to pass the date window a daily report covers.
+// argsFn should be deterministic: pools compute the args independently and only the args of the first one to enqueue
+// each occurrence of the job are used.
+func (wp *WorkerPool) PeriodicallyEnqueueWithArgs(spec, jobName string, argsFn func(time.Time) map[string]interface{}) *WorkerPool {
+	if argsFn == nil {
+		panic("work: PeriodicallyEnqueueWithArgs needs a non-nil argsFn")
+	}
+
+	j, err := newPeriodicJobInLocation(spec, jobName, nil)
 	if err != nil {
 		panic(err)
 	}
+	j.argsFn = argsFn
 
 	wp.periodicJobs = append(wp.periodicJobs, j)
 
@@ -246,52 +493,383 @@ func (wp *WorkerPool) PeriodicallyEnqueue(spec string, jobName string) *WorkerPo
 
 // Start starts the workers and associated processes.
 func (wp *WorkerPool) Start() {
+	wp.mtx.Lock()
+	defer wp.mtx.Unlock()
+
 	if wp.started {
 		return
 	}
 	wp.started = true
+	wp.stopped = make(chan struct{})
+	go wp.stopWhenDone(wp.stopped)
 
 	// TODO: we should cleanup stale keys on startup from previously registered jobs
 	wp.writeConcurrencyControlsToRedis()
 	go wp.writeKnownJobsToRedis()
 
+	if wp.recoverInProg {
+		wp.recoverOwnInProgressJobs()
+	}
+
+	// The workers stop fetching jobs as soon as the pool is being stopped, before their current jobs are done.
+	wp.workersCtx, wp.cancelWorkers = context.WithCancel(wp.ctx)
 	for _, w := range wp.workers {
+		w.ctx = wp.workersCtx
 		go w.start()
 	}
 
 	wp.heartbeater = newWorkerPoolHeartbeater(
-		wp.namespace,
-		wp.pool,
+		wp.keys,
+		wp.maintenancePool(),
 		wp.workerPoolID,
 		wp.jobTypes,
 		wp.concurrency,
 		wp.workerIDs(),
 		wp.logger,
 	)
+	wp.heartbeater.clock = wp.clock
+	wp.heartbeater.failover = wp.failover
 	wp.heartbeater.start()
 	wp.startRequeuers()
+	if wp.inProgLeaseTTL > 0 {
+		jobNames := make([]string, 0, len(wp.jobTypes))
+		for name := range wp.jobTypes {
+			jobNames = append(jobNames, name)
+		}
+		wp.inProgSweeper = newInProgressSweeper(
+			wp.keys,
+			wp.maintenancePool(),
+			wp.workerPoolID,
+			jobNames,
+			wp.inProgLeaseTTL,
+			wp.logger,
+		)
+		wp.inProgSweeper.clock = wp.clock
+		wp.inProgSweeper.failover = wp.failover
+		wp.inProgSweeper.start()
+	}
 	wp.periodicEnqueuer = newPeriodicEnqueuer(
-		wp.namespace,
+		wp.keys,
 		wp.pool,
 		wp.periodicJobs,
 		wp.logger,
 	)
-	wp.periodicEnqueuer.start()
+	wp.periodicEnqueuer.clock = wp.clock
+	wp.periodicEnqueuer.failover = wp.failover
+	wp.periodicEnqueuer.dryRun = wp.periodicDryRun
+	wp.periodicEnqueuer.events = &wp.events
+	if !wp.withoutPeriodicEnqueuer {
+		wp.periodicEnqueuer.start()
+	}
 
-	wp.watchdog.addPeriodicJobs(wp.periodicJobs...)
+	for name, jt := range wp.jobTypes {
+		wp.watchdog.setJobFailCheckingTimeout(name, jt.WatchdogTimeout)
+	}
+	if !wp.periodicDryRun {
+		// The periodic jobs of a dry run aren't enqueued, so they'd be reported as missed.
+		wp.watchdog.setPeriodicJobs(wp.periodicJobs...)
+	}
 	wp.watchdog.start()
 }
 
+// PauseJob pauses the processing of jobs with the specified name. Since the pause flag is
+// stored in Redis, the jobs are paused for all worker pools in the namespace.
+func (wp *WorkerPool) PauseJob(name string) error {
+	if _, ok := wp.jobTypes[name]; !ok {
+		return ErrUnknownJob
+	}
+
+	return setJobPaused(wp.pool, wp.keys, name, true)
+}
+
+// ResumeJob resumes the processing of jobs with the specified name which was paused by PauseJob.
+func (wp *WorkerPool) ResumeJob(name string) error {
+	if _, ok := wp.jobTypes[name]; !ok {
+		return ErrUnknownJob
+	}
+
+	return setJobPaused(wp.pool, wp.keys, name, false)
+}
+
+// SetMaxConcurrency changes the max number of jobs with the specified name to keep in flight. 0 means no max.
+// The limit is stored in Redis, so all worker pools in the namespace pick it up on the next fetch without a restart.
+func (wp *WorkerPool) SetMaxConcurrency(jobName string, n uint) error {
+	jt, ok := wp.jobTypes[jobName]
+	if !ok {
+		return ErrUnknownJob
+	}
+
+	if uint64(n) > math.MaxInt64 {
+		return fmt.Errorf("max concurrency %d is out of range", n)
+	}
+
+	if jt.StrictFIFO && n != 1 {
+		return fmt.Errorf("max concurrency of strict FIFO job %q must be 1", jobName)
+	}
+
+	conn := wp.pool.Get()
+	defer conn.Close()
+
+	// The lock orders the write with the one of Start and guards jt.MaxConcurrency, which RegisteredJobs reads.
+	wp.mtx.Lock()
+	defer wp.mtx.Unlock()
+
+	if _, err := conn.Do("SET", redisKeyJobsConcurrency(wp.keys, jobName), n); err != nil {
+		wp.logger.Error("worker_pool.set_max_concurrency", errAttr(err))
+		return err
+	}
+
+	jt.MaxConcurrency = n
+
+	return nil
+}
+
+// SetConcurrency changes the number of workers of the pool, e.g. to scale it with the load without a restart.
+// If the pool is started, the additional workers are started right away, and the extra ones stop fetching jobs
+// and are stopped once their current job is done: SetConcurrency returns when they're stopped. The heartbeat of
+// the pool is written again with the new concurrency and worker IDs.
+//
+// It's safe to call SetConcurrency while the pool is running, concurrently with Start, Stop and Drain. Stop waits
+// for the jobs of the workers being removed as well. Jobs and middleware must still be registered before the pool
+// is started.
+func (wp *WorkerPool) SetConcurrency(n uint) {
+	wp.mtx.Lock()
+	var removed []*worker
+	for uint(len(wp.workers)) < n {
+		w := wp.newWorker()
+		wp.workers = append(wp.workers, w)
+		if wp.started {
+			w.ctx = wp.workersCtx
+			w.start()
+		}
+	}
+	if uint(len(wp.workers)) > n {
+		removed = wp.workers[n:]
+		wp.workers = wp.workers[:n:n]
+	}
+	wp.concurrency = n
+	started := wp.started
+
+	if started {
+		wp.removing = append(wp.removing, removed...)
+	} else {
+		for _, w := range removed {
+			close(w.removedChan)
+		}
+	}
+	wp.mtx.Unlock()
+
+	if !started {
+		return
+	}
+
+	// The removed workers may take long to finish their jobs, so the pool isn't locked while they're waited for.
+	wg := sync.WaitGroup{}
+	for _, w := range removed {
+		wg.Add(1)
+		go func(w *worker) {
+			w.remove()
+			wg.Done()
+		}(w)
+	}
+	wg.Wait()
+
+	wp.mtx.Lock()
+	defer wp.mtx.Unlock()
+
+	removing := wp.removing[:0]
+	for _, w := range wp.removing {
+		if !containsWorker(removed, w) {
+			removing = append(removing, w)
+		}
+	}
+	wp.removing = removing
+
+	// The pool may have been stopped, and its heartbeat removed, in the meantime.
+	if wp.started {
+		wp.heartbeater.setWorkers(wp.concurrency, wp.workerIDs())
+		wp.heartbeater.heartbeat()
+	}
+}
+
+func containsWorker(workers []*worker, w *worker) bool {
+	for _, x := range workers {
+		if x == w {
+			return true
+		}
+	}
+	return false
+}
+
+// JobInfo describes a job type registered in a WorkerPool.
+type JobInfo struct {
+	Name           string
+	Priority       uint
+	MaxFails       uint
+	MaxConcurrency uint
+	SkipDead       bool
+	// Periodic is true if the job is periodically enqueued by the pool. PeriodicSpecs contains the cron specs.
+	Periodic      bool
+	PeriodicSpecs []string
+}
+
+// RegisteredJobs returns the job types registered in the pool sorted by name. Uniqueness isn't
+// reported since it's chosen by the enqueuer for every job rather than for the job type.
+func (wp *WorkerPool) RegisteredJobs() []JobInfo {
+	wp.mtx.Lock()
+	specs := make(map[string][]string)
+	for _, pj := range wp.periodicJobs {
+		specs[pj.jobName] = append(specs[pj.jobName], pj.spec)
+	}
+
+	jobs := make([]JobInfo, 0, len(wp.jobTypes))
+	for name, jt := range wp.jobTypes {
+		jobs = append(jobs, JobInfo{
+			Name:           name,
+			Priority:       jt.Priority,
+			MaxFails:       jt.MaxFails,
+			MaxConcurrency: jt.MaxConcurrency,
+			SkipDead:       jt.SkipDead,
+			Periodic:       len(specs[name]) > 0,
+			PeriodicSpecs:  specs[name],
+		})
+	}
+	wp.mtx.Unlock()
+
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].Name < jobs[j].Name
+	})
+
+	return jobs
+}
+
+// RunJobNow runs the handler of the job with the specified name synchronously, along with the pool and
+// job middleware, and returns its error. Redis isn't used, so the pool doesn't need to be started:
+// it's meant for unit tests of handlers. The args are encoded and decoded like a job going through
+// Redis, so the handler sees them as it would in production, and the context of a handler with a
+// custom context type is a zero value. Retries, hooks, metrics and events don't apply.
+func (wp *WorkerPool) RunJobNow(jobName string, args map[string]interface{}) error {
+	jt := wp.jobTypes[jobName]
+	if jt == nil {
+		return ErrStrayJob
+	}
+
+	job := &Job{
+		Name:       jobName,
+		ID:         makeIdentifier(),
+		EnqueuedAt: nowEpochSeconds(),
+		Args:       args,
+		codec:      wp.codec,
+	}
+
+	rawJSON, err := job.serialize()
+	if err != nil {
+		return err
+	}
+
+	job, err = newJob(rawJSON, nil, nil, wp.codec)
+	if err != nil {
+		return err
+	}
+
+	_, err = runJob(job, wp.contextType, wp.middleware, jt, wp.logger)
+
+	return err
+}
+
+// ReapNow runs a cycle of the dead pool reaper synchronously and returns what it reaped, instead of waiting for
+// the next periodic one, e.g. in tests or to recover the jobs of a crashed pool right away. It uses the options
+// of the pool, like its reaper hook, and can be called whether the pool is started or not, even with
+// WithoutReaper. ErrReaperBusy is returned if another process is running a reap cycle of the namespace.
+func (wp *WorkerPool) ReapNow() (ReapResult, error) {
+	jobNames := make([]string, 0, len(wp.jobTypes))
+	for name := range wp.jobTypes {
+		jobNames = append(jobNames, name)
+	}
+
+	return wp.newDeadPoolReaper(jobNames).reapNow()
+}
+
+// Events returns a channel of the lifecycle events of the jobs processed by the pool. Events are only
+// recorded once Events has been called. The channel is buffered: if the receiver falls behind, the oldest
+// events are dropped. The channel is closed by Stop; call Events again after restarting the pool.
+// Only the enqueues of the pool itself, i.e. of its periodic jobs, are reported: the jobs enqueued with an
+// Enqueuer are only seen once a worker starts them.
+func (wp *WorkerPool) Events() <-chan JobEvent {
+	return wp.events.subscribe()
+}
+
 func (wp *WorkerPool) WatchdogStats() []WatchdogStat {
 	return wp.watchdog.stats()
 }
 
+// ResetWatchdogStats zeroes the processed and skipped counts of the watchdog stats, e.g. after an incident was
+// dealt with, and drops the stats of the jobs that aren't periodic anymore. Runs in flight are still checked.
+func (wp *WorkerPool) ResetWatchdogStats() {
+	wp.watchdog.resetStats()
+}
+
+// Errors returned by WorkerPool.HealthCheck, possibly wrapped.
+var (
+	ErrRedisUnreachable = errors.New("redis unreachable")
+	ErrHeartbeatStale   = errors.New("heartbeat stale")
+)
+
+// HealthCheck pings Redis and checks that the pool has written its heartbeat recently, e.g. for liveness and
+// readiness probes. It returns an error wrapping ErrRedisUnreachable if the ping fails, or ErrHeartbeatStale if
+// the pool isn't started or hasn't written its heartbeat for as long as it takes other pools to consider it dead.
+func (wp *WorkerPool) HealthCheck(ctx context.Context) error {
+	conn, err := getConn(ctx, wp.pool)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrRedisUnreachable, err)
+	}
+	defer conn.Close()
+
+	if _, ok := conn.(redis.ConnWithContext); ok {
+		_, err = redis.DoContext(conn, ctx, "PING")
+	} else {
+		_, err = conn.Do("PING")
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrRedisUnreachable, err)
+	}
+
+	wp.mtx.Lock()
+	started, heartbeater := wp.started, wp.heartbeater
+	wp.mtx.Unlock()
+
+	if !started {
+		return fmt.Errorf("%w: the pool isn't started", ErrHeartbeatStale)
+	}
+
+	if age := wp.clock.Now().Sub(heartbeater.lastHeartbeat()); age > deadTime {
+		return fmt.Errorf("%w: the last heartbeat was %v ago", ErrHeartbeatStale, age.Round(time.Second))
+	}
+
+	return nil
+}
+
 // Stop stops the workers and associated processes.
 func (wp *WorkerPool) Stop() {
+	_ = wp.StopContext(context.Background())
+}
+
+// StopContext stops the workers and associated processes like Stop, but waits for
+// in-flight jobs only until ctx is done. In that case ctx.Err() is returned and
+// the remaining workers are left to finish their current jobs in the background.
+// The workers stop fetching jobs right away, and the pool keeps heartbeating until
+// they're done, so that their jobs aren't requeued by the dead pool reaper of another
+// pool while they're still running.
+func (wp *WorkerPool) StopContext(ctx context.Context) error {
+	wp.mtx.Lock()
+	defer wp.mtx.Unlock()
+
 	if !wp.started {
-		return
+		return nil
 	}
 	wp.started = false
+	close(wp.stopped)
+	wp.cancelWorkers()
 
 	wg := sync.WaitGroup{}
 	for _, w := range wp.workers {
@@ -301,26 +879,153 @@ func (wp *WorkerPool) Stop() {
 			wg.Done()
 		}(w)
 	}
-	wg.Wait()
-	wp.heartbeater.stop()
-	wp.retrier.stop()
-	wp.scheduler.stop()
-	wp.deadPoolReaper.stop()
-	wp.periodicEnqueuer.stop()
-	wp.watchdog.stop()
-}
-
-// Drain drains all jobs in the queue before returning. Note that if jobs are added faster than we can process them, this function wouldn't return.
-func (wp *WorkerPool) Drain() {
-	wg := sync.WaitGroup{}
-	for _, w := range wp.workers {
+	// The workers removed by SetConcurrency are already being stopped, their jobs are waited for as well.
+	for _, w := range wp.removing {
 		wg.Add(1)
 		go func(w *worker) {
-			w.drain()
+			<-w.removedChan
 			wg.Done()
 		}(w)
 	}
-	wg.Wait()
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	var err error
+	select {
+	case <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	if !wp.withoutRetrier {
+		wp.retrier.stop()
+	}
+	if !wp.withoutScheduler {
+		wp.scheduler.stop()
+	}
+	if !wp.withoutReaper {
+		wp.deadPoolReaper.stop()
+	}
+	if wp.inProgLeaseTTL > 0 {
+		wp.inProgSweeper.stop()
+	}
+	if !wp.withoutPeriodicEnqueuer {
+		wp.periodicEnqueuer.stop()
+	}
+
+	// The heartbeat and the processed jobs are still needed by the workers left running.
+	heartbeater := wp.heartbeater
+	stopWorkerProcesses := func() {
+		heartbeater.stop()
+		wp.watchdog.stop()
+		wp.events.close()
+	}
+	if err == nil {
+		stopWorkerProcesses()
+	} else {
+		go func() {
+			<-done
+			stopWorkerProcesses()
+		}()
+	}
+
+	return err
+}
+
+// stopWhenDone stops the pool when its ctx is done, unless it's stopped first.
+func (wp *WorkerPool) stopWhenDone(stopped <-chan struct{}) {
+	select {
+	case <-wp.ctx.Done():
+		wp.logger.Info("worker_pool.context_done")
+		wp.Stop()
+	case <-stopped:
+	}
+}
+
+// Drain drains all jobs in the queue before returning. Note that if jobs are added faster than we can process them, this function wouldn't return.
+func (wp *WorkerPool) Drain() {
+	_, _ = wp.DrainContext(context.Background())
+}
+
+// DrainContext is like Drain, but stops waiting when ctx is done. In that case it returns the ctx error
+// and the number of jobs still pending in the queues of the registered jobs. Unlike StopContext,
+// it leaves the workers running, so they keep processing the pending jobs.
+func (wp *WorkerPool) DrainContext(ctx context.Context) (int64, error) {
+	wp.mtx.Lock()
+	workers := wp.workers
+	wp.mtx.Unlock()
+
+	// A worker which found no job can fetch one afterwards, e.g. one of a job type at its MaxConcurrency until
+	// another worker was done, so the workers are drained again until none of them fetched a job meanwhile.
+	var err error
+	for {
+		var fetched int64
+		for _, w := range workers {
+			fetched -= w.fetched.Load()
+		}
+
+		errs := make(chan error, len(workers))
+		for _, w := range workers {
+			go func(w *worker) {
+				errs <- w.drainContext(ctx)
+			}(w)
+		}
+
+		for range workers {
+			if e := <-errs; e != nil {
+				err = e
+			}
+		}
+
+		for _, w := range workers {
+			fetched += w.fetched.Load()
+		}
+		if err != nil || fetched == 0 {
+			break
+		}
+	}
+
+	if err == nil {
+		return 0, nil
+	}
+
+	pending, pendingErr := wp.pendingJobs()
+	if pendingErr != nil {
+		wp.logger.Error("worker_pool.drain.pending_jobs", errAttr(pendingErr))
+	}
+
+	return pending, err
+}
+
+// pendingJobs returns the number of jobs in the queues of the registered jobs.
+func (wp *WorkerPool) pendingJobs() (int64, error) {
+	conn := wp.pool.Get()
+	defer conn.Close()
+
+	for name := range wp.jobTypes {
+		if err := conn.Send("LLEN", redisKeyJobs(wp.keys, name)); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := conn.Flush(); err != nil {
+		return 0, err
+	}
+
+	var pending int64
+	for range wp.jobTypes {
+		n, err := redis.Int64(conn.Receive())
+		if err != nil {
+			return 0, err
+		}
+		pending += n
+	}
+
+	return pending, nil
 }
 
 func (wp *WorkerPool) startRequeuers() {
@@ -329,19 +1034,121 @@ func (wp *WorkerPool) startRequeuers() {
 		jobNames = append(jobNames, name)
 	}
 
-	wp.retrier = newRequeuer(wp.namespace, wp.pool, redisKeyRetry(wp.namespace), jobNames, wp.logger)
-	wp.scheduler = newRequeuer(wp.namespace, wp.pool, redisKeyScheduled(wp.namespace), jobNames, wp.logger)
-	wp.deadPoolReaper = newDeadPoolReaper(
-		wp.namespace,
-		wp.pool,
+	wp.retrier = newRequeuer(wp.keys, wp.maintenancePool(), redisKeyRetry(wp.keys), jobNames, wp.metrics, wp.logger)
+	wp.scheduler = newRequeuer(wp.keys, wp.maintenancePool(), redisKeyScheduled(wp.keys), jobNames, wp.metrics, wp.logger)
+	wp.retrier.clock = wp.clock
+	wp.scheduler.clock = wp.clock
+	wp.retrier.failover = wp.failover
+	wp.scheduler.failover = wp.failover
+	wp.deadPoolReaper = wp.newDeadPoolReaper(jobNames)
+	if !wp.withoutRetrier {
+		wp.retrier.start()
+	}
+	if !wp.withoutScheduler {
+		wp.scheduler.start()
+	}
+	if !wp.withoutReaper {
+		wp.deadPoolReaper.start()
+	}
+}
+
+// recoverOwnInProgressJobs requeues the jobs left in progress by a previous run of the pool, see
+// WithRecoverOwnInProgress. It must run before the heartbeat of the pool is overwritten.
+func (wp *WorkerPool) recoverOwnInProgressJobs() {
+	jobNames := make([]string, 0, len(wp.jobTypes))
+	for name := range wp.jobTypes {
+		jobNames = append(jobNames, name)
+	}
+
+	conn := wp.pool.Get()
+	prevJobNames, err := redis.String(conn.Do("HGET", redisKeyHeartbeat(wp.keys, wp.workerPoolID), "job_names"))
+	conn.Close()
+	if err != nil && err != redis.ErrNil {
+		wp.logger.Error("worker_pool.recover_in_progress.heartbeat", errAttr(err))
+	}
+	for _, name := range strings.Split(prevJobNames, ",") {
+		if _, ok := wp.jobTypes[name]; name != "" && !ok {
+			jobNames = append(jobNames, name)
+		}
+	}
+	if len(jobNames) == 0 {
+		return
+	}
+
+	r := wp.newDeadPoolReaper(jobNames)
+	if err := r.requeueInProgressJobs(wp.workerPoolID, jobNames); err != nil {
+		wp.logger.Error("worker_pool.recover_in_progress", errAttr(err))
+		return
+	}
+	if err := r.cleanStaleLockInfo(wp.workerPoolID, jobNames); err != nil {
+		wp.logger.Error("worker_pool.recover_in_progress.locks", errAttr(err))
+	}
+}
+
+// newDeadPoolReaper makes a reaper with the options of the pool, releasing the locks of jobNames.
+func (wp *WorkerPool) newDeadPoolReaper(jobNames []string) *deadPoolReaper {
+	r := newDeadPoolReaper(
+		wp.keys,
+		wp.maintenancePool(),
 		jobNames,
 		wp.reapPeriod,
 		wp.reaperHook,
 		wp.logger,
 	)
-	wp.retrier.start()
-	wp.scheduler.start()
-	wp.deadPoolReaper.start()
+	r.jitter = wp.reapJitter
+	r.reenqueuedHook = wp.reenqueuedHook
+	r.codec = wp.codec
+	r.deadJobMaxAge = wp.deadJobMaxAge
+	r.deadJobMaxCount = wp.deadJobMaxCount
+	r.sweepTTL = wp.ttlSweep
+	for _, jt := range wp.jobTypes {
+		for _, p := range jt.PriorityQueues {
+			r.priorityQueues = append(r.priorityQueues, redisKeyJobsPriority(wp.keys, jt.Name, p))
+		}
+	}
+	r.clock = wp.clock
+	r.failover = wp.failover
+	r.metrics = wp.metrics
+	return r
+}
+
+// maintenancePool returns the pool of the background maintenance, see WithMaintenancePool.
+func (wp *WorkerPool) maintenancePool() Pool {
+	if wp.maintPool != nil {
+		return wp.maintPool
+	}
+	return wp.pool
+}
+
+func (wp *WorkerPool) workerOptions() []workerOption {
+	return []workerOption{
+		workerWithDeadJobHook(wp.deadJobHook),
+		workerWithJobErrorHandler(wp.jobErrorHandler),
+		workerWithExpiredJobHook(wp.expiredJobHook),
+		workerWithFailover(wp.failover),
+		workerWithStrayJobHandler(wp.strayJobHandler, wp.dropStrayJobs),
+		workerWithMalformedJobs(wp.malformedKey, wp.dropMalformed),
+		workerWithDependencies(wp.dependencies),
+		workerWithObserverPool(wp.maintPool),
+		workerWithArgsCodec(wp.codec),
+		workerWithMetricsReporter(wp.metrics),
+		workerWithEvents(&wp.events),
+		workerWithContext(wp.ctx),
+		workerWithMaxTotalConcurrency(wp.maxTotal),
+		workerWithClock(wp.clock),
+		workerWithResultTTL(wp.resultTTL),
+		workerWithPollJitter(wp.pollJitter),
+		workerWithMaxFetchSamples(wp.fetchJobTypes),
+		workerWithFetchTimeout(wp.fetchTimeout),
+		workerWithPriorityDrain(wp.priorityDrain),
+		workerWithJobLogFields(wp.jobLogFields),
+		workerWithSlowJobThreshold(wp.slowThreshold),
+		workerWithJobSpans(wp.jobSpans),
+		workerWithLeaseTTL(wp.leaseTTL),
+		workerWithInProgressLeases(wp.inProgLeaseTTL),
+		workerWithObservationArgsLimit(wp.obsArgsLimit),
+		workerWithObservationSampling(wp.obsMinDuration),
+	}
 }
 
 func (wp *WorkerPool) workerIDs() []string {
@@ -360,7 +1167,7 @@ func (wp *WorkerPool) writeKnownJobsToRedis() {
 
 	conn := wp.pool.Get()
 	defer conn.Close()
-	key := redisKeyKnownJobs(wp.namespace)
+	key := redisKeyKnownJobs(wp.keys)
 	jobNames := make([]interface{}, 0, len(wp.jobTypes)+1)
 	jobNames = append(jobNames, key)
 	for k := range wp.jobTypes {
@@ -371,6 +1178,18 @@ func (wp *WorkerPool) writeKnownJobsToRedis() {
 	if _, err := conn.Do("SADD", jobNames...); err != nil {
 		wp.logger.Error("write_known_jobs", errAttr(err))
 	}
+
+	priorityJobs := []interface{}{redisKeyKnownPriorityJobs(wp.keys)}
+	for _, jt := range wp.jobTypes {
+		for _, p := range jt.PriorityQueues {
+			priorityJobs = append(priorityJobs, knownPriorityJob(wp.keys, jt.Name, p))
+		}
+	}
+	if len(priorityJobs) > 1 {
+		if _, err := conn.Do("SADD", priorityJobs...); err != nil {
+			wp.logger.Error("write_known_jobs.priority", errAttr(err))
+		}
+	}
 }
 
 func (wp *WorkerPool) writeConcurrencyControlsToRedis() {
@@ -381,9 +1200,39 @@ func (wp *WorkerPool) writeConcurrencyControlsToRedis() {
 	conn := wp.pool.Get()
 	defer conn.Close()
 	for jobName, jobType := range wp.jobTypes {
-		if _, err := conn.Do("SET", redisKeyJobsConcurrency(wp.namespace, jobName), jobType.MaxConcurrency); err != nil {
+		if _, err := conn.Do("SET", redisKeyJobsConcurrency(wp.keys, jobName), jobType.MaxConcurrency); err != nil {
 			wp.logger.Error("write_concurrency_controls_max_concurrency", errAttr(err))
 		}
+
+		var err error
+		if jobType.AtMostOnce {
+			_, err = conn.Do("SET", redisKeyJobsAtMostOnce(wp.keys, jobName), 1)
+		} else {
+			_, err = conn.Do("DEL", redisKeyJobsAtMostOnce(wp.keys, jobName))
+		}
+		if err != nil {
+			wp.logger.Error("write_concurrency_controls_at_most_once", errAttr(err))
+		}
+
+		if jobType.StrictFIFO {
+			_, err = conn.Do("SET", redisKeyJobsStrictFIFO(wp.keys, jobName), 1)
+		} else {
+			_, err = conn.Do("DEL", redisKeyJobsStrictFIFO(wp.keys, jobName))
+		}
+		if err != nil {
+			wp.logger.Error("write_concurrency_controls_strict_fifo", errAttr(err))
+		}
+
+		// Only the settings of the bucket are written, so a restart doesn't refill it.
+		if limit := jobType.RateLimit; limit.PerSecond > 0 {
+			_, err = conn.Do("HSET", redisKeyJobsRateLimit(wp.keys, jobName),
+				"rate", strconv.FormatFloat(limit.PerSecond, 'f', -1, 64), "burst", limit.Burst)
+		} else {
+			_, err = conn.Do("DEL", redisKeyJobsRateLimit(wp.keys, jobName))
+		}
+		if err != nil {
+			wp.logger.Error("write_concurrency_controls_rate_limit", errAttr(err))
+		}
 	}
 }
 
@@ -584,25 +1433,106 @@ func isValidMiddlewareType(ctxType reflect.Type, vfn reflect.Value) bool {
 	return true
 }
 
+// maxPriority is the highest priority of a job type or of one of its priority queues.
+const maxPriority = 100000
+
 func applyDefaultsAndValidate(jobOpts JobOptions) JobOptions {
 	if jobOpts.Priority == 0 {
 		jobOpts.Priority = 1
 	}
 
-	if jobOpts.MaxFails == 0 {
+	if jobOpts.MaxFails == 0 && jobOpts.MaxRetryAge == 0 {
 		jobOpts.MaxFails = 4
 	}
 
-	if jobOpts.Priority > 100000 {
+	if jobOpts.Priority > maxPriority {
 		panic("work: JobOptions.Priority must be between 1 and 100000")
 	}
 
+	for _, p := range jobOpts.PriorityQueues {
+		if p == 0 || p > maxPriority {
+			panic("work: JobOptions.PriorityQueues must be between 1 and 100000")
+		}
+	}
+
+	if jobOpts.RateLimit.PerSecond < 0 || math.IsNaN(jobOpts.RateLimit.PerSecond) || math.IsInf(jobOpts.RateLimit.PerSecond, 0) {
+		panic("work: JobOptions.RateLimit.PerSecond must be a finite number not below 0")
+	}
+
+	if jobOpts.InlineRetryTimeout < 0 {
+		panic("work: JobOptions.InlineRetryTimeout must not be negative")
+	}
+
+	if jobOpts.StrictFIFO {
+		if jobOpts.MaxConcurrency > 1 {
+			panic("work: JobOptions.StrictFIFO needs a MaxConcurrency of 1")
+		}
+		if len(jobOpts.PriorityQueues) > 0 {
+			panic("work: JobOptions.StrictFIFO can't have PriorityQueues")
+		}
+		jobOpts.MaxConcurrency = 1
+	}
+
+	if jobOpts.RateLimit.PerSecond > 0 && jobOpts.RateLimit.Burst == 0 {
+		jobOpts.RateLimit.Burst = 1
+	}
+
 	return jobOpts
 }
 
 // WorkerPoolOption is an optional option for WorkerPool.
 type WorkerPoolOption func(wp *WorkerPool)
 
+// WithKeySeparator sets the separator used in the Redis keys of the worker pool instead of the default ":",
+// e.g. with "/" the jobs of the "my_app" namespace are stored in "my_app/jobs/<job_name>". An empty separator keeps
+// the default one. Keys must match between all the worker pools, enqueuers and clients sharing a namespace, so the
+// same separator must be set for all of them with WithKeySeparator, WithEnqueuerKeySeparator and
+// WithClientKeySeparator: the separator is only stored in the component it's set for.
+func WithKeySeparator(sep string) WorkerPoolOption {
+	return func(wp *WorkerPool) {
+		if sep != "" {
+			wp.keys.sep = sep
+		}
+	}
+}
+
+// WithClusterMode wraps the namespace in a Redis Cluster hash tag in all the keys, e.g. the jobs of the
+// "my_app" namespace are stored in "{my_app}:jobs:<job_name>". It puts all the keys of the namespace
+// on a single node, which is required by the Lua scripts that access the queues of several job types.
+// As with WithKeySeparator, the mode is only stored in the worker pool, so WithEnqueuerClusterMode and
+// WithClientClusterMode must be set for the enqueuers and clients of the namespace as well.
+// Namespaces that already contain a hash tag, e.g. "{my_app}", are left as is.
+func WithClusterMode() WorkerPoolOption {
+	return func(wp *WorkerPool) {
+		wp.keys = wp.keys.inCluster()
+	}
+}
+
+// WithWorkerPoolID sets the ID of the worker pool instead of a generated one, e.g. to the name of the pod,
+// so that it's recognizable in the heartbeats, the lock_info hashes and the web UI. The ID must be unique
+// among the live worker pools of the namespace. If a pool is restarted with the ID of a dead pool before
+// the reaper has found it, the jobs left in progress by the dead pool aren't requeued, unless the pool is
+// created with WithRecoverOwnInProgress.
+func WithWorkerPoolID(id string) WorkerPoolOption {
+	return func(wp *WorkerPool) {
+		if id == "" {
+			panic("work: worker pool ID can't be empty")
+		}
+		wp.workerPoolID = id
+	}
+}
+
+// WithMaintenancePool sets the pool of connections used by the background maintenance of the pool: the
+// heartbeater, the observers of the workers, the reaper, the requeuers of the retried and scheduled jobs and the
+// sweeper of WithInProgressLeases. It keeps bulk maintenance, e.g. a reaper requeueing the jobs of many dead
+// pools, from starving the fetches of the workers of connections. Both pools must connect to the same Redis. By
+// default the pool of NewWorkerPool is used.
+func WithMaintenancePool(pool Pool) WorkerPoolOption {
+	return func(wp *WorkerPool) {
+		wp.maintPool = pool
+	}
+}
+
 // WithReapPeriod defines the reaper running cycle period.
 func WithReapPeriod(p time.Duration) WorkerPoolOption {
 	return func(wp *WorkerPool) {
@@ -610,6 +1540,126 @@ func WithReapPeriod(p time.Duration) WorkerPoolOption {
 	}
 }
 
+// WithReapJitter randomly offsets the reaper running cycle period by up to the given fraction of it
+// in both directions (e.g. 0.2 for ±20%), and delays the first reap by up to the same amount.
+// This keeps many pools started at the same time from contending for the reaper lock in lockstep.
+// A fraction of 0 disables the jitter. By default, the period is extended by up to 30 seconds.
+func WithReapJitter(fraction float64) WorkerPoolOption {
+	return func(wp *WorkerPool) {
+		wp.reapJitter = math.Min(math.Max(fraction, 0), 1)
+	}
+}
+
+// WithObservationArgsLimit limits the size of the JSON args stored in the observation of a running job, which is
+// returned by Client.WorkerObservations. Args above the limit are replaced with a JSON string like
+// "<truncated: 12345 bytes>". Zero means no limit, which is the default.
+func WithObservationArgsLimit(bytes int) WorkerPoolOption {
+	return func(wp *WorkerPool) {
+		wp.obsArgsLimit = bytes
+	}
+}
+
+// WithObservationSampling writes the observation of a running job, returned by Client.WorkerObservations, only
+// once the job has run for minDuration, measured in whole seconds like the times of the observations. Short jobs
+// then don't write nor delete observations at all, while long ones are still visible. Zero, the default, writes
+// the observations of all the jobs.
+func WithObservationSampling(minDuration time.Duration) WorkerPoolOption {
+	return func(wp *WorkerPool) {
+		wp.obsMinDuration = minDuration
+	}
+}
+
+// WithPollJitter randomly shortens the sleep of idle workers between fetches by up to the given fraction of it
+// (e.g. 0.2 for up to 20%), so that the idle workers of many pools don't poll Redis in lockstep. The longest
+// sleep is unchanged. A fraction of 0 disables the jitter, which is the default.
+func WithPollJitter(fraction float64) WorkerPoolOption {
+	return func(wp *WorkerPool) {
+		wp.pollJitter = math.Min(math.Max(fraction, 0), 1)
+	}
+}
+
+// WithMaxFetchJobTypes caps the number of job types each fetch of a worker considers, for pools with hundreds
+// of job types: the fetch script gets fewer keys, and Redis checks fewer queues. Half of them are picked by
+// priority like without a cap, and the other half in turn, so that every job type is considered after a few
+// fetches. Idle workers only sleep once all the job types have been considered. The queues of
+// EnqueueWithPriority count as job types. 0 means no cap.
+func WithMaxFetchJobTypes(n uint) WorkerPoolOption {
+	return func(wp *WorkerPool) {
+		wp.fetchJobTypes = n
+	}
+}
+
+// WithFetchTimeout sets the read timeout of the fetches of the workers, overriding the one of the Redis pool,
+// so that a worker fails fast and retries when Redis is slow to reply instead of hanging for as long as the
+// slowest commands of the pool may take. It needs the connections of the pool to support per-command timeouts
+// (redis.ConnWithTimeout), like the ones of *redis.Pool; it's ignored otherwise. 0 means the timeout of the pool.
+//
+// A timeout only abandons the reply, so the fetch script may still take a job. Each worker records the job of its
+// last fetch in Redis, and its next fetch after a lost reply returns that job again instead of taking a new one.
+func WithFetchTimeout(timeout time.Duration) WorkerPoolOption {
+	return func(wp *WorkerPool) {
+		wp.fetchTimeout = timeout
+	}
+}
+
+// WithPriorityDrain makes Drain and DrainContext process the queues by descending priority instead of sampling
+// them by weight: the workers take jobs from the queues with the highest priority until they're empty before
+// moving down, e.g. so that the important jobs are flushed first if the process is killed during a shutdown.
+// Jobs enqueued during the drain into a higher priority queue are taken next.
+func WithPriorityDrain() WorkerPoolOption {
+	return func(wp *WorkerPool) {
+		wp.priorityDrain = true
+	}
+}
+
+// WithDeadJobRetention limits the dead jobs kept in the dead queue, which otherwise grows unbounded.
+// Jobs which died more than maxAge ago are removed, as are the oldest jobs beyond maxCount. Zero means
+// no limit. The dead queue is trimmed by the reaper, once per reap period.
+func WithDeadJobRetention(maxAge time.Duration, maxCount int64) WorkerPoolOption {
+	return func(wp *WorkerPool) {
+		wp.deadJobMaxAge = maxAge
+		wp.deadJobMaxCount = maxCount
+	}
+}
+
+// WithJobTTLSweep makes the reaper remove the jobs past their TTL from the queues of the pool's job types, including
+// their JobOptions.PriorityQueues, once per reap period, see EnqueueWithTTL, so that they don't take room in the
+// queues until they're dequeued. Each queue is scanned in batches, which is costly for long queues, so it's off
+// by default: expired jobs are still discarded when they're dequeued.
+func WithJobTTLSweep() WorkerPoolOption {
+	return func(wp *WorkerPool) {
+		wp.ttlSweep = true
+	}
+}
+
+// WithRecoverOwnInProgress makes Start requeue the jobs left in the in-progress queues of the pool's ID by a
+// previous run of the pool, e.g. one killed during a deploy, before the workers start, and release the concurrency
+// locks it held. The reaper does it for dead pools, but it can't tell a pool restarted with the same ID, see
+// WithWorkerPoolID, from the previous one. The in-progress queues of the job types of the previous run found in its
+// heartbeat are recovered too. Running it again finds nothing to requeue, but the ID must not be shared with
+// another live pool, whose jobs in progress would run twice.
+func WithRecoverOwnInProgress() WorkerPoolOption {
+	return func(wp *WorkerPool) {
+		wp.recoverInProg = true
+	}
+}
+
+// WithInProgressLeases gives each job dequeued by the pool a lease expiring after ttl, stored in a zset next to
+// its in-progress queue, and starts a sweeper requeueing the jobs of the pool still in progress after their lease
+// expired, e.g. the ones of a worker wedged on a hung call, while the pool itself is alive and heartbeating. The
+// reaper only requeues the jobs of dead pools. The leases aren't renewed, so ttl must be longer than any job of
+// the pool legitimately runs: a requeued job runs again, even if the first run is still going. The jobs with
+// AtMostOnce are moved to the dead queue instead. The sweeper runs every quarter of ttl, at most every minute.
+// Without this option the in-progress queues are plain lists, with no extra writes per job.
+func WithInProgressLeases(ttl time.Duration) WorkerPoolOption {
+	return func(wp *WorkerPool) {
+		if ttl <= 0 {
+			panic("work: WithInProgressLeases needs a positive lease TTL")
+		}
+		wp.inProgLeaseTTL = ttl
+	}
+}
+
 // WithReaperHook registers a hook to monitor the reaper's actions.
 func WithReaperHook(h ReaperHook) WorkerPoolOption {
 	return func(wp *WorkerPool) {
@@ -617,6 +1667,224 @@ func WithReaperHook(h ReaperHook) WorkerPoolOption {
 	}
 }
 
+// WithReenqueuedJobHook registers a hook which is called by the reaper for each job left in progress
+// by a dead worker pool, after the job is moved back to its queue. It's called on the reaper's goroutine.
+func WithReenqueuedJobHook(h ReenqueuedJobHook) WorkerPoolOption {
+	return func(wp *WorkerPool) {
+		wp.reenqueuedHook = h
+	}
+}
+
+// DeadJobHook is called when a job has exhausted its retries and has been moved
+// to the dead queue. lastErr is the error of the final attempt, a *JobError unless the job is a stray job.
+type DeadJobHook func(job *Job, lastErr error)
+
+// WithDeadJobHook registers a hook which is called after a job is moved to the
+// dead queue. It isn't called for intermediate retries or for jobs with SkipDead.
+func WithDeadJobHook(h DeadJobHook) WorkerPoolOption {
+	return func(wp *WorkerPool) {
+		wp.deadJobHook = h
+	}
+}
+
+// JobErrorHandler is called when processing of a job fails. err is a *JobError wrapping the error returned
+// by the handler, or ErrStrayJob if there's no handler for the job.
+type JobErrorHandler func(job *Job, err error)
+
+// WithJobErrorHandler registers a handler which is called every time a job fails, before the job
+// is retried or moved to the dead queue. It's a single place to report errors of all job types.
+func WithJobErrorHandler(h JobErrorHandler) WorkerPoolOption {
+	return func(wp *WorkerPool) {
+		wp.jobErrorHandler = h
+	}
+}
+
+// WithFailoverHandler registers a handler which is called when Redis replies with a MASTERDOWN, LOADING or
+// READONLY error, e.g. during a Sentinel failover, so that the pool of connections can be refreshed to point
+// to the new master. Regardless of the handler, the workers and the background processes of the pool, like the
+// heartbeater, the requeuers and the reaper, back off together exponentially from 50ms up to 5s until Redis
+// accepts the fetches of the workers again. The handler is called once at the start of each backoff, by the first
+// of them seeing such an error.
+func WithFailoverHandler(h FailoverHandler) WorkerPoolOption {
+	return func(wp *WorkerPool) {
+		wp.failoverHandler = h
+	}
+}
+
+// StrayJobHandler is called when a job without a registered handler is dequeued, e.g. a job enqueued
+// by an older version of the app whose handler has since been removed.
+type StrayJobHandler func(job *Job)
+
+// WithStrayJobHandler registers a handler which is called for every stray job, before the job is moved to
+// the dead queue, or dropped with WithDropStrayJobs. Stray jobs are also reported to the JobErrorHandler
+// with ErrStrayJob.
+func WithStrayJobHandler(h StrayJobHandler) WorkerPoolOption {
+	return func(wp *WorkerPool) {
+		wp.strayJobHandler = h
+	}
+}
+
+// WithDropStrayJobs makes the pool drop stray jobs instead of moving them to the dead queue, where they can
+// be retried once their handler is back. Use a StrayJobHandler to keep track of them.
+func WithDropStrayJobs() WorkerPoolOption {
+	return func(wp *WorkerPool) {
+		wp.dropStrayJobs = true
+	}
+}
+
+// WithMalformedJobsKey sets the name of the zset, within the namespace, receiving the raw jobs which can't be
+// decoded, e.g. corrupted entries or jobs written by an incompatible version, instead of "malformed". They're
+// scored by the time they were dequeued at, and each one is logged with ErrMalformedJob.
+func WithMalformedJobsKey(name string) WorkerPoolOption {
+	return func(wp *WorkerPool) {
+		if name == "" {
+			panic("work: malformed jobs key can't be empty")
+		}
+		wp.malformedKey = name
+	}
+}
+
+// WithDropMalformedJobs makes the pool drop the jobs which can't be decoded instead of keeping their raw bytes
+// in the malformed jobs zset, see WithMalformedJobsKey.
+func WithDropMalformedJobs() WorkerPoolOption {
+	return func(wp *WorkerPool) {
+		wp.dropMalformed = true
+	}
+}
+
+// WithJobDependencies makes the workers enqueue the children of a job, see EnqueueAfter, once it succeeds, and
+// drop them once it fails for good. The outcome of every job is then kept in Redis for a day, so that the
+// children enqueued after their parent job is done are handled too, at the cost of one more key per job. The
+// children are resolved by the script acking the parent job, so a crash can't leave them behind. It must be set
+// for all the pools running parent jobs. The children of a job whose retry is removed without being run, e.g.
+// deleted with the client or moved to the dead queue by the requeuer because its job type is unknown, are never
+// resolved and expire with their list after a week.
+func WithJobDependencies() WorkerPoolOption {
+	return func(wp *WorkerPool) {
+		wp.dependencies = true
+	}
+}
+
+// ExpiredJobHook is called when a job is skipped because it missed its deadline.
+type ExpiredJobHook func(job *Job)
+
+// WithExpiredJobHook registers a hook which is called when a dequeued job is skipped because
+// its deadline has passed. Expired jobs aren't counted as failures and aren't retried.
+func WithExpiredJobHook(h ExpiredJobHook) WorkerPoolOption {
+	return func(wp *WorkerPool) {
+		wp.expiredJobHook = h
+	}
+}
+
+// WithArgsCodec sets the codec used to encode and decode the arguments of jobs instead of JSON.
+// The enqueuers and clients of the namespace must use the same codec, see WithEnqueuerArgsCodec
+// and WithClientArgsCodec. Jobs enqueued without a codec can still be processed.
+func WithArgsCodec(codec ArgsCodec) WorkerPoolOption {
+	return func(wp *WorkerPool) {
+		wp.codec = codec
+	}
+}
+
+// WithMetricsReporter registers a reporter for job and queue metrics. If it implements LockFixReporter, it also
+// counts the concurrency locks fixed by the reaper.
+func WithMetricsReporter(m MetricsReporter) WorkerPoolOption {
+	return func(wp *WorkerPool) {
+		if m != nil {
+			wp.metrics = m
+		}
+	}
+}
+
+// WithMaxTotalConcurrency limits the number of jobs of all types the pool runs at once to n, which is
+// useful when it's lower than the concurrency of the pool, e.g. to share the pool's resources with the job
+// types differently. The fetch script counts the jobs in the in-progress queues of the pool and doesn't
+// dequeue a job without a free slot, so the jobs stay in the queues for other pools. Jobs left in the
+// in-progress queues, e.g. by a crashed run with the same WithWorkerPoolID, take a slot until they're
+// requeued. Zero means no limit.
+func WithMaxTotalConcurrency(n uint) WorkerPoolOption {
+	return func(wp *WorkerPool) {
+		wp.maxTotal = n
+	}
+}
+
+// WithLeasedConcurrency makes the pool count the running jobs of the job types with MaxConcurrency with leases
+// instead of the lock counters. A worker takes a lease expiring after leaseTTL when it dequeues a job and renews
+// it every third of leaseTTL until the job is done, so the slots of crashed workers are released once their
+// leases expire, without waiting for the reaper to requeue their jobs. The reaper still requeues the jobs of
+// dead pools, and it leaves the leases alone. The leases expire by the clock of Redis, so that the hosts of the
+// pools don't need to agree on the time.
+//
+// The leases and the lock counters are separate, so all the pools processing a job type must use the same backend.
+// To migrate, stop the pools using the lock counters before starting the ones with leases; the lock counters are
+// then left unused. leaseTTL should be much longer than the round trips to Redis, e.g. 30 seconds.
+func WithLeasedConcurrency(leaseTTL time.Duration) WorkerPoolOption {
+	return func(wp *WorkerPool) {
+		if leaseTTL <= 0 {
+			panic("work: WithLeasedConcurrency needs a positive lease TTL")
+		}
+		wp.leaseTTL = leaseTTL
+	}
+}
+
+// WithJobResultTTL sets how long the results set with Job.SetResult are kept (default is an hour).
+func WithJobResultTTL(ttl time.Duration) WorkerPoolOption {
+	return func(wp *WorkerPool) {
+		wp.resultTTL = ttl
+	}
+}
+
+// WithClock sets the clock the pool reads the time from to schedule retries, requeue retried and scheduled
+// jobs, skip expired jobs, and write and check heartbeats. It's meant for
+// tests: production pools should use the default system clock, since the time must agree with the other pools
+// and enqueuers of the namespace.
+func WithClock(c Clock) WorkerPoolOption {
+	return func(wp *WorkerPool) {
+		if c != nil {
+			wp.clock = c
+		}
+	}
+}
+
+// WithoutScheduler disables the requeuer of scheduled jobs, e.g. for a worker-only pool when another pool in the
+// namespace owns the background maintenance. Scheduled jobs stay in the scheduled queue until a pool requeues them.
+func WithoutScheduler() WorkerPoolOption {
+	return func(wp *WorkerPool) {
+		wp.withoutScheduler = true
+	}
+}
+
+// WithoutRetrier disables the requeuer of retried jobs, see WithoutScheduler.
+func WithoutRetrier() WorkerPoolOption {
+	return func(wp *WorkerPool) {
+		wp.withoutRetrier = true
+	}
+}
+
+// WithoutReaper disables the dead pool reaper, see WithoutScheduler. The jobs of dead pools aren't requeued
+// and the dead queue isn't trimmed unless another pool in the namespace runs the reaper.
+func WithoutReaper() WorkerPoolOption {
+	return func(wp *WorkerPool) {
+		wp.withoutReaper = true
+	}
+}
+
+// WithoutPeriodicEnqueuer disables the enqueueing of the periodic jobs of the pool, see WithoutScheduler.
+// Another pool in the namespace must register the same periodic jobs for them to be enqueued.
+func WithoutPeriodicEnqueuer() WorkerPoolOption {
+	return func(wp *WorkerPool) {
+		wp.withoutPeriodicEnqueuer = true
+	}
+}
+
+// WithPeriodicDryRun makes the periodic enqueuer log the jobs it would enqueue, with their names and fire times,
+// instead of enqueuing them. Nothing is written to Redis, so it can be used to check a new schedule, along with
+// WithClock and WithLogger in tests. The watchdog doesn't check the periodic jobs of a dry run.
+func WithPeriodicDryRun() WorkerPoolOption {
+	return func(wp *WorkerPool) {
+		wp.periodicDryRun = true
+	}
+}
+
 // WithLogger registers logger.
 func WithLogger(l StructuredLogger) WorkerPoolOption {
 	return func(wp *WorkerPool) {
@@ -624,8 +1892,39 @@ func WithLogger(l StructuredLogger) WorkerPoolOption {
 	}
 }
 
+// JobLogFields returns the attributes to add to the logs of a job, e.g. a trace ID from its args.
+type JobLogFields func(job *Job) []slog.Attr
+
+// WithJobLogFields adds the attributes returned by f to the lines the workers log while processing a job:
+// when it starts and is done, and its errors, including the panics recovered without RecoverMiddleware.
+// f is called once per job, before it runs.
+func WithJobLogFields(f JobLogFields) WorkerPoolOption {
+	return func(wp *WorkerPool) {
+		wp.jobLogFields = f
+	}
+}
+
+// WithSlowJobThreshold logs a warning with the name, ID and duration of the jobs whose handler runs for threshold
+// or more, whether they succeed or not, to surface latency regressions without a custom middleware. The
+// duration includes the middleware and the inline retries. Zero, the default, disables the warning.
+func WithSlowJobThreshold(threshold time.Duration) WorkerPoolOption {
+	return func(wp *WorkerPool) {
+		wp.slowThreshold = threshold
+	}
+}
+
+// WithJobSpans starts a span around every run of a job with start, e.g. OTelJobSpans(tracer), as a child of the
+// trace context propagated by the enqueuer, see ExtractTraceContext. The span covers the middleware and the
+// handler, including the inline retries as separate runs.
+func WithJobSpans(start JobSpanStarter) WorkerPoolOption {
+	return func(wp *WorkerPool) {
+		wp.jobSpans = start
+	}
+}
+
 // WithWatchdogFailCheckingTimeout defines the watchdog checking timeout
 // that marks task as failed (default WatchdogFailCheckingTimeout).
+// It can be overridden per job type with JobOptions.WatchdogTimeout.
 func WithWatchdogFailCheckingTimeout(p time.Duration) WorkerPoolOption {
 	return func(wp *WorkerPool) {
 		wp.watchdogFailCheckingTimeout = p
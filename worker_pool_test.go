@@ -4,7 +4,12 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"log/slog"
+	"os"
 	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -120,6 +125,13 @@ func TestWorkerPoolValidations(t *testing.T) {
 
 		wp.Job("wat", TestWorkerPoolValidations)
 	}()
+
+	assert.PanicsWithValue(t, "work: JobMiddleware needs a registered job: unknown", func() {
+		wp.JobMiddleware("unknown", func(j *Job, next NextMiddlewareFunc) error { return next() })
+	})
+
+	wp.Job("foo", func(j *Job) error { return nil })
+	assert.Panics(t, func() { wp.JobMiddleware("foo", TestWorkerPoolValidations) })
 }
 
 func TestWorkersPoolRunSingleThreaded(t *testing.T) {
@@ -137,7 +149,7 @@ func TestWorkersPoolRunSingleThreaded(t *testing.T) {
 	}
 
 	// make sure we've enough jobs queued up to make an interesting test
-	jobsQueued := listSize(pool, redisKeyJobs(ns, job1))
+	jobsQueued := listSize(pool, redisKeyJobs(newKeyspace(ns), job1))
 	assert.True(t, jobsQueued >= 3, "should be at least 3 jobs queued up, but only found %v", jobsQueued)
 
 	// now make sure the during the duration of job execution there is never > 1 job in flight
@@ -146,12 +158,12 @@ func TestWorkersPoolRunSingleThreaded(t *testing.T) {
 	time.Sleep(10 * time.Millisecond)
 	for time.Since(start) < totalRuntime {
 		// jobs in progress, lock count for the job and lock info for the pool should never exceed 1
-		jobsInProgress := listSize(pool, redisKeyJobsInProgress(ns, wp.workerPoolID, job1))
+		jobsInProgress := listSize(pool, redisKeyJobsInProgress(newKeyspace(ns), wp.workerPoolID, job1))
 		assert.True(t, jobsInProgress <= 1, "jobsInProgress should never exceed 1: actual=%d", jobsInProgress)
 
-		jobLockCount := getInt64(pool, redisKeyJobsLock(ns, job1))
+		jobLockCount := getInt64(pool, redisKeyJobsLock(newKeyspace(ns), job1))
 		assert.True(t, jobLockCount <= 1, "global lock count for job should never exceed 1, got: %v", jobLockCount)
-		wpLockCount := hgetInt64(pool, redisKeyJobsLockInfo(ns, job1), wp.workerPoolID)
+		wpLockCount := hgetInt64(pool, redisKeyJobsLockInfo(newKeyspace(ns), job1), wp.workerPoolID)
 		assert.True(t, wpLockCount <= 1, "lock count for the worker pool should never exceed 1: actual=%v", wpLockCount)
 		time.Sleep(time.Duration(sleepTime) * time.Millisecond)
 	}
@@ -159,10 +171,10 @@ func TestWorkersPoolRunSingleThreaded(t *testing.T) {
 	wp.Stop()
 
 	// At this point it should all be empty.
-	assert.EqualValues(t, 0, listSize(pool, redisKeyJobs(ns, job1)))
-	assert.EqualValues(t, 0, listSize(pool, redisKeyJobsInProgress(ns, wp.workerPoolID, job1)))
-	assert.EqualValues(t, 0, getInt64(pool, redisKeyJobsLock(ns, job1)))
-	assert.EqualValues(t, 0, hgetInt64(pool, redisKeyJobsLockInfo(ns, job1), wp.workerPoolID))
+	assert.EqualValues(t, 0, listSize(pool, redisKeyJobs(newKeyspace(ns), job1)))
+	assert.EqualValues(t, 0, listSize(pool, redisKeyJobsInProgress(newKeyspace(ns), wp.workerPoolID, job1)))
+	assert.EqualValues(t, 0, getInt64(pool, redisKeyJobsLock(newKeyspace(ns), job1)))
+	assert.EqualValues(t, 0, hgetInt64(pool, redisKeyJobsLockInfo(newKeyspace(ns), job1), wp.workerPoolID))
 }
 
 func TestWorkerPoolPauseSingleThreadedJobs(t *testing.T) {
@@ -187,16 +199,16 @@ func TestWorkerPoolPauseSingleThreadedJobs(t *testing.T) {
 	assert.Nil(t, err)
 
 	// check that we still have some jobs to process
-	assert.True(t, listSize(pool, redisKeyJobs(ns, job1)) >= 1)
+	assert.True(t, listSize(pool, redisKeyJobs(newKeyspace(ns), job1)) >= 1)
 
 	// now make sure no jobs get started until we unpause
 	start := time.Now()
 	totalRuntime := time.Duration(sleepTime*numJobs) * time.Millisecond
 	for time.Since(start) < totalRuntime {
-		assert.EqualValues(t, 0, listSize(pool, redisKeyJobsInProgress(ns, wp.workerPoolID, job1)))
+		assert.EqualValues(t, 0, listSize(pool, redisKeyJobsInProgress(newKeyspace(ns), wp.workerPoolID, job1)))
 		// lock count for the job and lock info for the pool should both be at 1 while job is running
-		assert.EqualValues(t, 0, getInt64(pool, redisKeyJobsLock(ns, job1)))
-		assert.EqualValues(t, 0, hgetInt64(pool, redisKeyJobsLockInfo(ns, job1), wp.workerPoolID))
+		assert.EqualValues(t, 0, getInt64(pool, redisKeyJobsLock(newKeyspace(ns), job1)))
+		assert.EqualValues(t, 0, hgetInt64(pool, redisKeyJobsLockInfo(newKeyspace(ns), job1), wp.workerPoolID))
 		time.Sleep(time.Duration(sleepTime) * time.Millisecond)
 	}
 
@@ -208,10 +220,89 @@ func TestWorkerPoolPauseSingleThreadedJobs(t *testing.T) {
 	wp.Stop()
 
 	// At this point it should all be empty.
-	assert.EqualValues(t, 0, listSize(pool, redisKeyJobs(ns, job1)))
-	assert.EqualValues(t, 0, listSize(pool, redisKeyJobsInProgress(ns, wp.workerPoolID, job1)))
-	assert.EqualValues(t, 0, getInt64(pool, redisKeyJobsLock(ns, job1)))
-	assert.EqualValues(t, 0, hgetInt64(pool, redisKeyJobsLockInfo(ns, job1), wp.workerPoolID))
+	assert.EqualValues(t, 0, listSize(pool, redisKeyJobs(newKeyspace(ns), job1)))
+	assert.EqualValues(t, 0, listSize(pool, redisKeyJobsInProgress(newKeyspace(ns), wp.workerPoolID, job1)))
+	assert.EqualValues(t, 0, getInt64(pool, redisKeyJobsLock(newKeyspace(ns), job1)))
+	assert.EqualValues(t, 0, hgetInt64(pool, redisKeyJobsLockInfo(newKeyspace(ns), job1), wp.workerPoolID))
+}
+
+func TestWorkerPoolJobLogFields(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work"
+	cleanKeyspace(ns, pool)
+
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	wp := NewWorkerPool(TestContext{}, 1, ns, pool, WithLogger(logger), WithJobLogFields(func(job *Job) []slog.Attr {
+		return []slog.Attr{slog.String("trace_id", job.ArgString("trace_id"))}
+	}))
+	wp.JobWithOptions("explode", JobOptions{MaxFails: 1}, func(job *Job) error {
+		panic("boom")
+	})
+
+	_, err := NewEnqueuer(ns, pool).Enqueue("explode", Q{"trace_id": "abc"})
+	require.NoError(t, err)
+
+	wp.Start()
+	wp.Drain()
+	wp.Stop()
+
+	lines := map[string]string{}
+	for _, line := range strings.Split(logs.String(), "\n") {
+		for _, msg := range []string{"process_job.started", "runJob.panic", "process_job.done"} {
+			if strings.Contains(line, "msg="+msg+" ") {
+				lines[msg] = line
+			}
+		}
+	}
+
+	assert.Equal(t, 3, len(lines))
+	for msg, line := range lines {
+		assert.Contains(t, line, "trace_id=abc", msg)
+	}
+	assert.Contains(t, lines["process_job.done"], "error=boom")
+}
+
+func TestWorkerPoolSlowJobThreshold(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work"
+	cleanKeyspace(ns, pool)
+
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&logs, nil))
+
+	wp := NewWorkerPool(TestContext{}, 1, ns, pool, WithLogger(logger), WithSlowJobThreshold(20*time.Millisecond))
+	wp.Job("wat", func(job *Job) error {
+		if job.ArgBool("slow") {
+			time.Sleep(30 * time.Millisecond)
+		}
+		return nil
+	})
+
+	enqueuer := NewEnqueuer(ns, pool)
+	slow, err := enqueuer.Enqueue("wat", Q{"slow": true})
+	require.NoError(t, err)
+	_, err = enqueuer.Enqueue("wat", Q{"slow": false})
+	require.NoError(t, err)
+
+	wp.Start()
+	wp.Drain()
+	wp.Stop()
+
+	var lines []string
+	for _, line := range strings.Split(logs.String(), "\n") {
+		if strings.Contains(line, "msg=process_job.slow ") {
+			lines = append(lines, line)
+		}
+	}
+
+	// Only the slow job is logged, even though it succeeded.
+	require.Equal(t, 1, len(lines))
+	assert.Contains(t, lines[0], "level=WARN")
+	assert.Contains(t, lines[0], "job_name=wat")
+	assert.Contains(t, lines[0], "job_id="+slow.ID)
+	assert.Contains(t, lines[0], "duration=")
 }
 
 func TestWorkerPoolTracing(t *testing.T) {
@@ -250,6 +341,1268 @@ func TestWorkerPoolTracing(t *testing.T) {
 	assert.Equal(t, finishedSpans[0].SpanContext.TraceID(), finishedSpans[1].SpanContext.TraceID())
 }
 
+func TestWorkerPoolStopContext(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work"
+	job1 := "job1"
+	cleanKeyspace(ns, pool)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	finished := make(chan struct{})
+
+	wp := NewWorkerPool(TestContext{}, 1, ns, pool)
+	wp.Job(job1, func(job *Job) error {
+		close(started)
+		<-release
+		close(finished)
+		return nil
+	})
+
+	enqueuer := NewEnqueuer(ns, pool)
+	_, err := enqueuer.Enqueue(job1, nil)
+	require.NoError(t, err)
+
+	wp.Start()
+	<-started
+	_, err = enqueuer.Enqueue(job1, nil)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	err = wp.StopContext(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// The job is still in progress and the pool keeps heartbeating, so the reaper of another pool leaves it alone.
+	assert.EqualValues(t, 1, listSize(pool, redisKeyJobsInProgress(newKeyspace(ns), wp.workerPoolID, job1)))
+	assert.Equal(t, []string{wp.workerPoolID}, knownJobs(pool, redisKeyWorkerPools(newKeyspace(ns))))
+
+	close(release)
+	<-finished
+
+	// The pool stops heartbeating once the job is done, and the worker didn't fetch the other job.
+	assert.Eventually(t, func() bool {
+		return len(knownJobs(pool, redisKeyWorkerPools(newKeyspace(ns)))) == 0
+	}, time.Second, 5*time.Millisecond)
+	assert.EqualValues(t, 1, listSize(pool, redisKeyJobs(newKeyspace(ns), job1)))
+	assert.EqualValues(t, 0, listSize(pool, redisKeyJobsInProgress(newKeyspace(ns), wp.workerPoolID, job1)))
+}
+
+func TestWorkerPoolWithContext(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work"
+	cleanKeyspace(ns, pool)
+
+	var processed int64
+	ctx, cancel := context.WithCancel(context.Background())
+	wp := NewWorkerPoolWithContext(ctx, TestContext{}, 2, ns, pool)
+	wp.Job("wat", func(job *Job) error {
+		atomic.AddInt64(&processed, 1)
+		return nil
+	})
+	wp.Start()
+
+	enqueuer := NewEnqueuer(ns, pool)
+	_, err := enqueuer.Enqueue("wat", nil)
+	require.NoError(t, err)
+	wp.Drain()
+	assert.EqualValues(t, 1, atomic.LoadInt64(&processed))
+
+	cancel()
+	require.Eventually(t, func() bool {
+		wp.mtx.Lock()
+		defer wp.mtx.Unlock()
+		return !wp.started
+	}, time.Second, 10*time.Millisecond)
+
+	// The pool is stopped: jobs aren't processed anymore and Stop is a no-op.
+	_, err = enqueuer.Enqueue("wat", nil)
+	require.NoError(t, err)
+	time.Sleep(50 * time.Millisecond)
+	assert.EqualValues(t, 1, atomic.LoadInt64(&processed))
+	assert.False(t, keyExists(pool, redisKeyHeartbeat(newKeyspace(ns), wp.workerPoolID)))
+	wp.Stop()
+}
+
+func TestWorkerPoolPauseResumeJob(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work"
+	job1 := "job1"
+	cleanKeyspace(ns, pool)
+
+	wp := NewWorkerPool(TestContext{}, 1, ns, pool)
+	wp.Job(job1, func(job *Job) error { return nil })
+
+	assert.ErrorIs(t, wp.PauseJob("unknown"), ErrUnknownJob)
+	assert.ErrorIs(t, wp.ResumeJob("unknown"), ErrUnknownJob)
+
+	require.NoError(t, wp.PauseJob(job1))
+	assert.True(t, keyExists(pool, redisKeyJobsPaused(newKeyspace(ns), job1)))
+
+	_, err := NewEnqueuer(ns, pool).Enqueue(job1, nil)
+	require.NoError(t, err)
+
+	wp.Start()
+	time.Sleep(50 * time.Millisecond)
+	assert.EqualValues(t, 1, listSize(pool, redisKeyJobs(newKeyspace(ns), job1)))
+
+	require.NoError(t, wp.ResumeJob(job1))
+	wp.Drain()
+	wp.Stop()
+
+	assert.EqualValues(t, 0, listSize(pool, redisKeyJobs(newKeyspace(ns), job1)))
+	assert.False(t, keyExists(pool, redisKeyJobsPaused(newKeyspace(ns), job1)))
+}
+
+func TestWorkerPoolSetMaxConcurrency(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work"
+	job1 := "job1"
+	cleanKeyspace(ns, pool)
+
+	wp := NewWorkerPool(TestContext{}, 10, ns, pool)
+	wp.JobWithOptions(job1, JobOptions{MaxConcurrency: 1}, (*TestContext).SleepyJob)
+
+	assert.ErrorIs(t, wp.SetMaxConcurrency("unknown", 1), ErrUnknownJob)
+
+	wp.Start()
+	defer wp.Stop()
+	assert.EqualValues(t, 1, getInt64(pool, redisKeyJobsConcurrency(newKeyspace(ns), job1)))
+
+	// It can be called concurrently with RegisteredJobs, see go test -race.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		wp.RegisteredJobs()
+	}()
+	require.NoError(t, wp.SetMaxConcurrency(job1, 3))
+	<-done
+	assert.EqualValues(t, 3, getInt64(pool, redisKeyJobsConcurrency(newKeyspace(ns), job1)))
+	assert.EqualValues(t, 3, wp.RegisteredJobs()[0].MaxConcurrency)
+
+	enqueuer := NewEnqueuer(ns, pool)
+	for i := 0; i < 10; i++ {
+		_, err := enqueuer.Enqueue(job1, Q{"sleep": 100})
+		require.NoError(t, err)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	assert.EqualValues(t, 3, listSize(pool, redisKeyJobsInProgress(newKeyspace(ns), wp.workerPoolID, job1)))
+	assert.EqualValues(t, 7, listSize(pool, redisKeyJobs(newKeyspace(ns), job1)))
+}
+
+func TestWorkerPoolSetConcurrency(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work"
+	job1 := "job1"
+	cleanKeyspace(ns, pool)
+
+	wp := NewWorkerPool(TestContext{}, 2, ns, pool)
+	wp.Job(job1, (*TestContext).SleepyJob)
+
+	// Before the pool is started, only the workers are changed.
+	wp.SetConcurrency(1)
+	assert.Equal(t, 1, len(wp.workers))
+
+	client := NewClient(ns, pool)
+	heartbeat := func() *WorkerPoolHeartbeat {
+		heartbeats, err := client.WorkerPoolHeartbeats()
+		require.NoError(t, err)
+		require.Equal(t, 1, len(heartbeats))
+		return heartbeats[0]
+	}
+
+	wp.Start()
+	defer wp.Stop()
+	require.Eventually(t, func() bool {
+		return keyExists(pool, redisKeyHeartbeat(newKeyspace(ns), wp.workerPoolID))
+	}, time.Second, time.Millisecond)
+	assert.EqualValues(t, 1, heartbeat().Concurrency)
+
+	wp.SetConcurrency(4)
+	hb := heartbeat()
+	assert.EqualValues(t, 4, hb.Concurrency)
+	assert.Equal(t, wp.workerIDs(), hb.WorkerIDs)
+
+	enqueuer := NewEnqueuer(ns, pool)
+	for i := 0; i < 6; i++ {
+		_, err := enqueuer.Enqueue(job1, Q{"sleep": 100})
+		require.NoError(t, err)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	assert.EqualValues(t, 4, listSize(pool, redisKeyJobsInProgress(newKeyspace(ns), wp.workerPoolID, job1)))
+
+	// Scaling down waits for the jobs of the removed workers, without locking the pool meanwhile.
+	scaled := make(chan struct{})
+	go func() {
+		wp.SetConcurrency(1)
+		close(scaled)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	assert.NoError(t, wp.HealthCheck(context.Background()))
+	select {
+	case <-scaled:
+		t.Error("SetConcurrency returned before the jobs of the removed workers were done")
+	default:
+	}
+	<-scaled
+	hb = heartbeat()
+	assert.EqualValues(t, 1, hb.Concurrency)
+	assert.Equal(t, wp.workerIDs(), hb.WorkerIDs)
+	assert.Equal(t, 1, len(hb.WorkerIDs))
+	assert.True(t, listSize(pool, redisKeyJobsInProgress(newKeyspace(ns), wp.workerPoolID, job1)) <= 1)
+
+	wp.Drain()
+	assert.EqualValues(t, 0, listSize(pool, redisKeyJobs(newKeyspace(ns), job1)))
+	assert.EqualValues(t, 0, listSize(pool, redisKeyJobsInProgress(newKeyspace(ns), wp.workerPoolID, job1)))
+}
+
+func TestWorkerPoolStopWaitsForRemovedWorkers(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work"
+	job1 := "job1"
+	cleanKeyspace(ns, pool)
+
+	started := make(chan struct{}, 2)
+	release := make(chan struct{})
+	var finished int64
+	wp := NewWorkerPool(TestContext{}, 2, ns, pool)
+	wp.Job(job1, func(job *Job) error {
+		started <- struct{}{}
+		<-release
+		atomic.AddInt64(&finished, 1)
+		return nil
+	})
+
+	enqueuer := NewEnqueuer(ns, pool)
+	for i := 0; i < 2; i++ {
+		_, err := enqueuer.Enqueue(job1, nil)
+		require.NoError(t, err)
+	}
+	wp.Start()
+	<-started
+	<-started
+
+	go wp.SetConcurrency(1)
+	require.Eventually(t, func() bool {
+		wp.mtx.Lock()
+		defer wp.mtx.Unlock()
+		return len(wp.removing) == 1
+	}, time.Second, time.Millisecond)
+
+	stopped := make(chan struct{})
+	go func() {
+		wp.Stop()
+		close(stopped)
+	}()
+	time.Sleep(20 * time.Millisecond)
+	select {
+	case <-stopped:
+		t.Error("Stop returned before the job of the removed worker was done")
+	default:
+	}
+
+	close(release)
+	<-stopped
+	assert.EqualValues(t, 2, atomic.LoadInt64(&finished))
+	assert.EqualValues(t, 0, listSize(pool, redisKeyJobsInProgress(newKeyspace(ns), wp.workerPoolID, job1)))
+}
+
+func TestWorkerPoolMaxTotalConcurrency(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work"
+	cleanKeyspace(ns, pool)
+
+	var running, maxRunning, done int64
+	handler := func(job *Job) error {
+		n := atomic.AddInt64(&running, 1)
+		for {
+			m := atomic.LoadInt64(&maxRunning)
+			if n <= m || atomic.CompareAndSwapInt64(&maxRunning, m, n) {
+				break
+			}
+		}
+		time.Sleep(30 * time.Millisecond)
+		atomic.AddInt64(&running, -1)
+		atomic.AddInt64(&done, 1)
+		return nil
+	}
+
+	wp := NewWorkerPool(TestContext{}, 10, ns, pool, WithMaxTotalConcurrency(2))
+	wp.Job("job1", handler)
+	wp.Job("job2", handler)
+
+	enqueuer := NewEnqueuer(ns, pool)
+	for i := 0; i < 5; i++ {
+		for _, name := range []string{"job1", "job2"} {
+			_, err := enqueuer.Enqueue(name, nil)
+			require.NoError(t, err)
+		}
+	}
+
+	wp.Start()
+	time.Sleep(15 * time.Millisecond)
+	// Jobs that can't be run yet are left in the queues.
+	queued := listSize(pool, redisKeyJobs(newKeyspace(ns), "job1")) + listSize(pool, redisKeyJobs(newKeyspace(ns), "job2"))
+	assert.EqualValues(t, 8, queued)
+
+	wp.Drain()
+	wp.Stop()
+
+	assert.EqualValues(t, 10, atomic.LoadInt64(&done))
+	assert.EqualValues(t, 2, atomic.LoadInt64(&maxRunning))
+}
+
+type fakeClock struct {
+	mtx sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func TestWorkerPoolJobQueueWait(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work"
+	cleanKeyspace(ns, pool)
+
+	setNowEpochSecondsMock(1425263409)
+	defer resetNowEpochSecondsMock()
+	_, err := NewEnqueuer(ns, pool).Enqueue("wat", nil)
+	require.NoError(t, err)
+
+	clock := &fakeClock{now: time.Unix(1425263414, 0)}
+	var started time.Time
+	var wait time.Duration
+	wp := NewWorkerPool(TestContext{}, 1, ns, pool, WithClock(clock))
+	wp.Middleware(func(job *Job, next NextMiddlewareFunc) error {
+		started, wait = job.StartedTime(), job.QueueWait()
+		return next()
+	})
+	wp.Job("wat", func(job *Job) error { return nil })
+
+	wp.Start()
+	wp.Drain()
+	wp.Stop()
+
+	assert.Equal(t, clock.now, started)
+	assert.Equal(t, 5*time.Second, wait)
+}
+
+func TestWorkerPoolRateLimit(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work"
+	cleanKeyspace(ns, pool)
+
+	enqueuer := NewEnqueuer(ns, pool)
+	for i := 0; i < 6; i++ {
+		_, err := enqueuer.Enqueue("wat", nil)
+		require.NoError(t, err)
+	}
+
+	// The bucket is refilled by the time of Redis, which is moved forward by moving back the last refill.
+	bucket := redisKeyJobsRateLimit(newKeyspace(ns), "wat")
+	advance := func(d time.Duration) {
+		conn := pool.Get()
+		defer conn.Close()
+		ts, err := redis.Int64(conn.Do("HGET", bucket, "ts"))
+		require.NoError(t, err)
+		_, err = conn.Do("HSET", bucket, "ts", ts-d.Milliseconds())
+		require.NoError(t, err)
+	}
+
+	// The bucket is shared by the pools of the namespace.
+	var runs int64
+	var pools []*WorkerPool
+	for i := 0; i < 2; i++ {
+		wp := NewWorkerPool(TestContext{}, 2, ns, pool)
+		wp.JobWithOptions("wat", JobOptions{RateLimit: RateLimit{PerSecond: 2, Burst: 3}}, func(job *Job) error {
+			atomic.AddInt64(&runs, 1)
+			return nil
+		})
+		wp.Start()
+		defer wp.Stop()
+		pools = append(pools, wp)
+	}
+	drain := func() {
+		for _, wp := range pools {
+			wp.Drain()
+		}
+	}
+
+	drain()
+	assert.EqualValues(t, 3, atomic.LoadInt64(&runs))
+	assert.EqualValues(t, 3, listSize(pool, redisKeyJobs(newKeyspace(ns), "wat")))
+
+	advance(500 * time.Millisecond)
+	drain()
+	assert.EqualValues(t, 4, atomic.LoadInt64(&runs))
+
+	// The bucket holds no more than the burst.
+	advance(time.Minute)
+	for i := 0; i < 4; i++ {
+		_, err := enqueuer.Enqueue("wat", nil)
+		require.NoError(t, err)
+	}
+	drain()
+	assert.EqualValues(t, 7, atomic.LoadInt64(&runs))
+	assert.EqualValues(t, 3, listSize(pool, redisKeyJobs(newKeyspace(ns), "wat")))
+
+	assert.Panics(t, func() {
+		pools[0].JobWithOptions("bad", JobOptions{RateLimit: RateLimit{PerSecond: -1}}, func(job *Job) error { return nil })
+	})
+}
+
+func TestWorkerPoolStrictFIFO(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work"
+	cleanKeyspace(ns, pool)
+
+	enqueuer := NewEnqueuer(ns, pool)
+	for i := 0; i < 10; i++ {
+		_, err := enqueuer.Enqueue("wat", Q{"i": i})
+		require.NoError(t, err)
+	}
+
+	var mtx sync.Mutex
+	var order []int64
+	var running, maxRunning int64
+	wp := NewWorkerPool(TestContext{}, 4, ns, pool)
+	wp.JobWithOptions("wat", JobOptions{StrictFIFO: true}, func(job *Job) error {
+		n := atomic.AddInt64(&running, 1)
+		defer atomic.AddInt64(&running, -1)
+
+		mtx.Lock()
+		order = append(order, job.ArgInt64("i"))
+		if n > maxRunning {
+			maxRunning = n
+		}
+		mtx.Unlock()
+		time.Sleep(time.Millisecond)
+		return nil
+	})
+	assert.EqualValues(t, 1, wp.jobTypes["wat"].MaxConcurrency)
+	assert.Error(t, wp.SetMaxConcurrency("wat", 2))
+
+	wp.Start()
+	wp.Drain()
+	wp.Stop()
+
+	assert.Equal(t, []int64{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}, order)
+	assert.EqualValues(t, 1, maxRunning)
+
+	assert.Panics(t, func() {
+		wp.JobWithOptions("bad", JobOptions{StrictFIFO: true, MaxConcurrency: 2}, func(job *Job) error { return nil })
+	})
+	assert.Panics(t, func() {
+		wp.JobWithOptions("bad", JobOptions{StrictFIFO: true, PriorityQueues: []uint{10}}, func(job *Job) error { return nil })
+	})
+}
+
+func TestWorkerPoolJobDependencies(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work"
+	cleanKeyspace(ns, pool)
+
+	var mtx sync.Mutex
+	var ran []string
+	wp := NewWorkerPool(TestContext{}, 1, ns, pool, WithJobDependencies())
+	wp.JobWithOptions("step", JobOptions{MaxFails: 1}, func(job *Job) error {
+		mtx.Lock()
+		ran = append(ran, job.ArgString("name"))
+		mtx.Unlock()
+		if job.ArgBool("fail") {
+			return fmt.Errorf("oops")
+		}
+		return nil
+	})
+	wp.JobWithOptions("flaky", JobOptions{MaxFails: 3}, func(job *Job) error { return fmt.Errorf("oops") })
+
+	enqueuer := NewEnqueuer(ns, pool)
+	first, err := enqueuer.Enqueue("step", Q{"name": "first"})
+	require.NoError(t, err)
+	second, err := enqueuer.EnqueueAfter(first.ID, "step", Q{"name": "second"})
+	require.NoError(t, err)
+	_, err = enqueuer.EnqueueAfter(second.ID, "step", Q{"name": "third", "fail": true})
+	require.NoError(t, err)
+
+	failed, err := enqueuer.Enqueue("step", Q{"name": "failed", "fail": true})
+	require.NoError(t, err)
+	_, err = enqueuer.EnqueueAfter(failed.ID, "step", Q{"name": "cancelled"})
+	require.NoError(t, err)
+
+	flaky, err := enqueuer.Enqueue("flaky", nil)
+	require.NoError(t, err)
+	_, err = enqueuer.EnqueueAfter(flaky.ID, "step", Q{"name": "waiting"})
+	require.NoError(t, err)
+
+	wp.Start()
+	wp.Drain()
+	wp.Stop()
+
+	assert.ElementsMatch(t, []string{"first", "second", "third", "failed"}, ran)
+	assert.False(t, keyExists(pool, redisKeyJobChildren(newKeyspace(ns), failed.ID)))
+
+	// A retried job isn't done yet.
+	assert.EqualValues(t, 1, listSize(pool, redisKeyJobChildren(newKeyspace(ns), flaky.ID)))
+	assert.False(t, keyExists(pool, redisKeyJobOutcome(newKeyspace(ns), flaky.ID)))
+
+	// The outcome is kept for the children enqueued later.
+	_, err = enqueuer.EnqueueAfter(failed.ID, "step", nil)
+	assert.ErrorIs(t, err, ErrParentFailed)
+	_, err = enqueuer.EnqueueAfter(first.ID, "step", Q{"name": "late"})
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, listSize(pool, redisKeyJobs(newKeyspace(ns), "step")))
+}
+
+func TestWorkerPoolWithClock(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work"
+	cleanKeyspace(ns, pool)
+
+	clock := &fakeClock{now: time.Unix(1425263409, 0)}
+
+	var calls int64
+	wp := NewWorkerPool(TestContext{}, 1, ns, pool, WithClock(clock))
+	wp.JobWithOptions("wat", JobOptions{MaxFails: 3}, func(job *Job) error {
+		if atomic.AddInt64(&calls, 1) == 1 {
+			return fmt.Errorf("oops")
+		}
+		return nil
+	})
+
+	_, err := NewEnqueuer(ns, pool).Enqueue("wat", nil)
+	require.NoError(t, err)
+
+	wp.Start()
+	defer wp.Stop()
+	wp.Drain()
+
+	// The retry is scheduled with the backoff from the time of the clock.
+	retryAt, job := jobOnZset(pool, redisKeyRetry(newKeyspace(ns)))
+	assert.EqualValues(t, 1425263409, job.FailedAt)
+	assert.True(t, retryAt >= 1425263409+15 && retryAt < 1425263409+120, "retry at %d", retryAt)
+
+	// The retry isn't due yet.
+	wp.retrier.drain()
+	wp.Drain()
+	assert.EqualValues(t, 1, zsetSize(pool, redisKeyRetry(newKeyspace(ns))))
+	assert.EqualValues(t, 1, atomic.LoadInt64(&calls))
+
+	clock.Advance(2 * time.Minute)
+	wp.retrier.drain()
+	wp.Drain()
+	assert.EqualValues(t, 0, zsetSize(pool, redisKeyRetry(newKeyspace(ns))))
+	assert.EqualValues(t, 2, atomic.LoadInt64(&calls))
+}
+
+func TestWorkerPoolRetryQueue(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work"
+	retryNs := "work-retries"
+	cleanKeyspace(ns, pool)
+	cleanKeyspace(retryNs, pool)
+
+	var calls int64
+	handler := func(job *Job) error {
+		if atomic.AddInt64(&calls, 1) == 1 {
+			return fmt.Errorf("oops")
+		}
+		return nil
+	}
+
+	wp := NewWorkerPool(TestContext{}, 1, ns, pool)
+	wp.JobWithOptions("wat", JobOptions{MaxFails: 3, RetryQueue: retryNs}, handler)
+
+	_, err := NewEnqueuer(ns, pool).Enqueue("wat", nil)
+	require.NoError(t, err)
+
+	wp.Start()
+	wp.Drain()
+	wp.Stop()
+
+	assert.EqualValues(t, 0, zsetSize(pool, redisKeyRetry(newKeyspace(ns))))
+	assert.EqualValues(t, 1, zsetSize(pool, redisKeyRetry(newKeyspace(retryNs))))
+
+	// The retry is processed by the pool of the retry namespace.
+	clock := &fakeClock{now: time.Now().Add(time.Hour)}
+	retryWp := NewWorkerPool(TestContext{}, 1, retryNs, pool, WithClock(clock))
+	retryWp.JobWithOptions("wat", JobOptions{MaxFails: 3}, handler)
+	retryWp.Start()
+	retryWp.retrier.drain()
+	retryWp.Drain()
+	retryWp.Stop()
+
+	assert.EqualValues(t, 0, zsetSize(pool, redisKeyRetry(newKeyspace(retryNs))))
+	assert.EqualValues(t, 2, atomic.LoadInt64(&calls))
+
+	clusterWp := NewWorkerPool(TestContext{}, 1, "work-cluster", pool, WithClusterMode())
+	assert.Panics(t, func() {
+		clusterWp.JobWithOptions("wat", JobOptions{RetryQueue: retryNs}, handler)
+	})
+}
+
+func TestWorkerPoolWithoutBackgroundMaintenance(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work"
+	cleanKeyspace(ns, pool)
+
+	enqueuer := NewEnqueuer(ns, pool)
+	_, err := enqueuer.EnqueueIn("wat", 0, nil)
+	require.NoError(t, err)
+
+	conn := pool.Get()
+	defer conn.Close()
+	_, err = conn.Do("ZADD", redisKeyRetry(newKeyspace(ns)), 0, `{"name":"wat","id":"1","t":1}`)
+	require.NoError(t, err)
+
+	wp := NewWorkerPool(TestContext{}, 1, ns, pool,
+		WithoutScheduler(),
+		WithoutRetrier(),
+		WithoutReaper(),
+		WithoutPeriodicEnqueuer(),
+	)
+	wp.Job("wat", func(job *Job) error { return nil })
+	wp.PeriodicallyEnqueue("* * * * * *", "wat")
+	wp.Start()
+	time.Sleep(1100 * time.Millisecond) // longer than the period of the requeuers
+	wp.Drain()
+	wp.Stop()
+
+	assert.EqualValues(t, 1, zsetSize(pool, redisKeyScheduled(newKeyspace(ns))))
+	assert.EqualValues(t, 1, zsetSize(pool, redisKeyRetry(newKeyspace(ns))))
+	assert.EqualValues(t, 0, listSize(pool, redisKeyJobs(newKeyspace(ns), "wat")))
+}
+
+func TestWorkerPoolHealthCheck(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work"
+	cleanKeyspace(ns, pool)
+
+	ctx := context.Background()
+	clock := &fakeClock{now: time.Now()}
+	wp := NewWorkerPool(TestContext{}, 1, ns, pool, WithClock(clock))
+	wp.Job("wat", func(job *Job) error { return nil })
+
+	assert.ErrorIs(t, wp.HealthCheck(ctx), ErrHeartbeatStale)
+
+	wp.Start()
+	defer wp.Stop()
+	assert.NoError(t, wp.HealthCheck(ctx))
+
+	// Let the first heartbeat happen before the clock moves.
+	for !keyExists(pool, redisKeyHeartbeat(newKeyspace(ns), wp.workerPoolID)) {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(10 * time.Millisecond)
+	clock.Advance(time.Minute)
+	assert.ErrorIs(t, wp.HealthCheck(ctx), ErrHeartbeatStale)
+
+	unreachable := &redis.Pool{Dial: func() (redis.Conn, error) { return nil, fmt.Errorf("no redis") }}
+	wp2 := NewWorkerPool(TestContext{}, 1, ns, unreachable)
+	assert.ErrorIs(t, wp2.HealthCheck(ctx), ErrRedisUnreachable)
+
+	// Waiting for a connection of an exhausted pool stops with the context.
+	exhausted := newTestPool(":6379")
+	exhausted.MaxActive = 1
+	conn := exhausted.Get()
+	defer conn.Close()
+	wp3 := NewWorkerPool(TestContext{}, 1, ns, exhausted)
+	timeoutCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, wp3.HealthCheck(timeoutCtx), ErrRedisUnreachable)
+}
+
+func TestWorkerPoolKeySeparator(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work-slash"
+	job1 := "job1"
+	cleanKeyspace(ns, pool)
+
+	wp := NewWorkerPool(TestContext{}, 1, ns, pool, WithKeySeparator("/"))
+	wp.Job(job1, func(job *Job) error { return nil })
+
+	assert.Equal(t, "work-slash/jobs/job1", redisKeyJobs(wp.keys, job1))
+	assert.Equal(t, "work-slash/jobs/job1/"+wp.workerPoolID+"/inprogress", redisKeyJobsInProgress(wp.keys, wp.workerPoolID, job1))
+	assert.Equal(t, job1, redisJobNameFromLockKey(wp.keys, redisKeyJobsLock(wp.keys, job1)))
+	assert.Equal(t, "work:jobs:job1", redisKeyJobs(newKeyspace("work"), job1))
+
+	enqueuer := NewEnqueuer(ns, pool, WithEnqueuerKeySeparator("/"))
+	_, err := enqueuer.Enqueue(job1, nil)
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, listSize(pool, "work-slash/jobs/job1"))
+
+	queues, err := NewClient(ns, pool, WithClientKeySeparator("/")).Queues()
+	require.NoError(t, err)
+	if assert.Equal(t, 1, len(queues)) {
+		assert.EqualValues(t, 1, queues[0].Count)
+	}
+
+	wp.Start()
+	wp.Drain()
+	wp.Stop()
+	assert.EqualValues(t, 0, listSize(pool, "work-slash/jobs/job1"))
+
+	// The separator is only set for the components created with it.
+	assert.Equal(t, "work-slash:jobs:", NewEnqueuer(ns, pool).queuePrefix)
+	assert.Equal(t, "work-slash:jobs:job1", redisKeyJobs(NewWorkerPool(TestContext{}, 1, ns, pool).keys, job1))
+	assert.Equal(t, "work-empty:jobs:job1", redisKeyJobs(NewWorkerPool(TestContext{}, 1, "work-empty", pool, WithKeySeparator("")).keys, job1))
+}
+
+func TestWorkerPoolClusterMode(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work-cluster"
+	cleanKeyspace("{"+ns+"}", pool)
+
+	var processed int64
+	wp := NewWorkerPool(TestContext{}, 2, ns, pool, WithClusterMode())
+	keys := wp.keys
+	for _, name := range []string{"job1", "job2"} {
+		wp.JobWithOptions(name, JobOptions{MaxConcurrency: 1}, func(job *Job) error {
+			atomic.AddInt64(&processed, 1)
+			return nil
+		})
+	}
+
+	tagged := []string{
+		redisKeyJobs(keys, "job1"),
+		redisKeyJobsInProgress(keys, wp.workerPoolID, "job2"),
+		redisKeyJobsLock(keys, "job1"),
+		redisKeyJobsLockInfo(keys, "job2"),
+		redisKeyJobsPaused(keys, "job1"),
+		redisKeyRetry(keys),
+		redisKeyDead(keys),
+		redisKeyScheduled(keys),
+		redisKeyKnownJobs(keys),
+		redisKeyHeartbeat(keys, wp.workerPoolID),
+		redisKeyUniqueJobByKey(keys, "job1", "key"),
+	}
+	for _, key := range tagged {
+		assert.Equal(t, ns, redisHashTag(key), key)
+	}
+	assert.Equal(t, "{work-cluster}:jobs:job1", redisKeyJobs(keys, "job1"))
+
+	enqueuer := NewEnqueuer(ns, pool, WithEnqueuerClusterMode())
+	for _, name := range []string{"job1", "job2"} {
+		_, err := enqueuer.Enqueue(name, nil)
+		require.NoError(t, err)
+	}
+
+	queues, err := NewClient(ns, pool, WithClientClusterMode()).Queues()
+	require.NoError(t, err)
+	assert.Equal(t, 2, len(queues))
+
+	wp.Start()
+	wp.Drain()
+	wp.Stop()
+	assert.EqualValues(t, 2, atomic.LoadInt64(&processed))
+
+	// A hash tag in the namespace is kept.
+	NewEnqueuer("{work-tagged}", pool, WithEnqueuerClusterMode())
+	assert.Equal(t, "{work-tagged}:jobs:job1", redisKeyJobs(newKeyspace("{work-tagged}").inCluster(), "job1"))
+
+	assert.Panics(t, func() { NewWorkerPool(TestContext{}, 1, "", pool, WithClusterMode()) })
+}
+
+// crossSlotPool fails the scripts whose keys aren't all in the hash tag, like Redis Cluster does with CROSSSLOT.
+type crossSlotPool struct {
+	Pool
+	tag string
+}
+
+func (p crossSlotPool) Get() redis.Conn { return crossSlotConn{p.Pool.Get(), p.tag} }
+
+type crossSlotConn struct {
+	redis.Conn
+	tag string
+}
+
+func (c crossSlotConn) Do(cmd string, args ...interface{}) (interface{}, error) {
+	if cmd == "EVALSHA" || cmd == "EVAL" {
+		n, _ := args[1].(int)
+		for _, key := range args[2 : 2+n] {
+			if k, _ := redis.String(key, nil); redisHashTag(k) != c.tag {
+				return nil, redis.Error(fmt.Sprintf("CROSSSLOT Keys in request don't hash to the same slot: %q", k))
+			}
+		}
+	}
+	return c.Conn.Do(cmd, args...)
+}
+
+// runClusterModeJobs runs jobs going through all the paths of the ack script in a pool in cluster mode, using
+// workPool for the pool and the enqueuer.
+func runClusterModeJobs(t *testing.T, pool *redis.Pool, workPool Pool, ns string) {
+	var ran sync.Map
+	wp := NewWorkerPool(TestContext{}, 1, ns, workPool, WithClusterMode(), WithDropMalformedJobs())
+	keys := wp.keys
+	for name, opts := range map[string]JobOptions{
+		"ok":    {MaxConcurrency: 1},
+		"retry": {MaxFails: 2},
+		"skip":  {MaxFails: 1, SkipDead: true},
+		"dead":  {MaxFails: 1},
+	} {
+		name := name
+		wp.JobWithOptions(name, opts, func(job *Job) error {
+			ran.Store(name, true)
+			if name != "ok" {
+				return fmt.Errorf("oops")
+			}
+			return nil
+		})
+	}
+
+	enqueuer := NewEnqueuer(ns, workPool, WithEnqueuerClusterMode())
+	for _, name := range []string{"ok", "retry", "skip", "dead"} {
+		_, err := enqueuer.Enqueue(name, nil)
+		require.NoError(t, err)
+	}
+	conn := pool.Get()
+	_, err := conn.Do("RPUSH", redisKeyJobs(keys, "ok"), `{"name":"ok","id":`)
+	conn.Close()
+	require.NoError(t, err)
+
+	wp.Start()
+	wp.Drain()
+	wp.Stop()
+
+	for _, name := range []string{"ok", "retry", "skip", "dead"} {
+		_, ok := ran.Load(name)
+		assert.True(t, ok, name)
+		assert.EqualValues(t, 0, listSize(pool, redisKeyJobs(keys, name)), name)
+		assert.EqualValues(t, 0, listSize(pool, redisKeyJobsInProgress(keys, wp.workerPoolID, name)), name)
+	}
+	assert.EqualValues(t, 0, getInt64(pool, redisKeyJobsLock(keys, "ok")))
+	assert.EqualValues(t, 1, zsetSize(pool, redisKeyRetry(keys)))
+	assert.EqualValues(t, 1, zsetSize(pool, redisKeyDead(keys)))
+}
+
+func TestWorkerPoolClusterModeScriptKeys(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work-cluster"
+	cleanKeyspace("{"+ns+"}", pool)
+
+	runClusterModeJobs(t, pool, crossSlotPool{Pool: pool, tag: ns}, ns)
+}
+
+// TestWorkerPoolRedisCluster runs against the Redis Cluster node at WORK_TEST_REDIS_CLUSTER, e.g. "127.0.0.1:7000".
+// The test connects to the node serving the slot of the namespace.
+func TestWorkerPoolRedisCluster(t *testing.T) {
+	addr := os.Getenv("WORK_TEST_REDIS_CLUSTER")
+	if addr == "" {
+		t.Skip("WORK_TEST_REDIS_CLUSTER isn't set")
+	}
+	ns := "work-cluster"
+
+	conn, err := redis.Dial("tcp", addr)
+	require.NoError(t, err)
+	slot, err := redis.Int64(conn.Do("CLUSTER", "KEYSLOT", "{"+ns+"}"))
+	require.NoError(t, err)
+	ranges, err := redis.Values(conn.Do("CLUSTER", "SLOTS"))
+	conn.Close()
+	require.NoError(t, err)
+
+	var nodeAddr string
+	for _, r := range ranges {
+		var start, end int64
+		var node []interface{}
+		_, err := redis.Scan(r.([]interface{}), &start, &end, &node)
+		require.NoError(t, err)
+		if start <= slot && slot <= end {
+			host, _ := redis.String(node[0], nil)
+			port, _ := redis.Int64(node[1], nil)
+			nodeAddr = fmt.Sprintf("%s:%d", host, port)
+		}
+	}
+	require.NotEmpty(t, nodeAddr)
+
+	pool := newTestPool(nodeAddr)
+	cleanKeyspace("{"+ns+"}", pool)
+	runClusterModeJobs(t, pool, pool, ns)
+}
+
+func TestWorkerPoolDrainContext(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work"
+	job1 := "job1"
+	cleanKeyspace(ns, pool)
+
+	wp := setupTestWorkerPool(pool, ns, job1, 1, JobOptions{Priority: 1})
+	wp.Start()
+	defer wp.Stop()
+
+	enqueuer := NewEnqueuer(ns, pool)
+	for i := 0; i < 10; i++ {
+		_, err := enqueuer.Enqueue(job1, Q{"sleep": 30})
+		require.NoError(t, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	pending, err := wp.DrainContext(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.True(t, pending > 0 && pending < 10, "pending: %d", pending)
+
+	// The workers are still running and finish the remaining jobs.
+	pending, err = wp.DrainContext(context.Background())
+	assert.NoError(t, err)
+	assert.EqualValues(t, 0, pending)
+	assert.EqualValues(t, 0, listSize(pool, redisKeyJobs(newKeyspace(ns), job1)))
+}
+
+func TestWorkerPoolGocraftJobs(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work"
+	cleanKeyspace(ns, pool)
+
+	conn := pool.Get()
+	defer conn.Close()
+
+	// The keys written by gocraft/work, see gocraftJobs.
+	now := time.Now().Unix()
+	uniqueKey := "work:unique:send_email:{\"address\":\"u@example.com\"}\n"
+	for _, cmd := range [][]interface{}{
+		{"SADD", "work:known_jobs", "send_email"},
+		{"LPUSH", "work:jobs:send_email", gocraftJobs["queued"], gocraftJobs["nil_args"], gocraftJobs["unique"]},
+		{"SET", uniqueKey, "1", "EX", 86400},
+		{"ZADD", "work:retry", now - 1, gocraftJobs["retry"]},
+		{"ZADD", "work:scheduled", now - 1, gocraftJobs["scheduled"]},
+		{"ZADD", "work:dead", 1425263420, gocraftJobs["dead"]},
+	} {
+		_, err := conn.Do(cmd[0].(string), cmd[1:]...)
+		require.NoError(t, err)
+	}
+
+	for _, key := range []string{redisKeyRetry(newKeyspace(ns)), redisKeyScheduled(newKeyspace(ns))} {
+		re := newRequeuer(newKeyspace(ns), pool, key, []string{"send_email"}, noopMetrics, noopLogger)
+		re.start()
+		re.drain()
+		re.stop()
+	}
+	require.NoError(t, NewClient(ns, pool).RetryDeadJob(1425263420, "5a3bd2ba1e6b6f8ebe1ac1f6"))
+	assert.EqualValues(t, 6, listSize(pool, redisKeyJobs(newKeyspace(ns), "send_email")))
+
+	customers := map[string]int64{}
+	wp := NewWorkerPool(TestContext{}, 1, ns, pool)
+	wp.Job("send_email", func(job *Job) error {
+		if _, ok := job.Args["customer_id"]; ok {
+			customers[job.ID] = job.ArgInt64("customer_id")
+		} else {
+			customers[job.ID] = 0
+		}
+		return job.ArgError()
+	})
+
+	wp.Start()
+	wp.Drain()
+	wp.Stop()
+
+	assert.Equal(t, map[string]int64{
+		"5a3bd2ba1e6b6f8ebe1ac1f2": 4,
+		"5a3bd2ba1e6b6f8ebe1ac1f3": 0,
+		"5a3bd2ba1e6b6f8ebe1ac1f4": 0,
+		"5a3bd2ba1e6b6f8ebe1ac1f5": 0,
+		"5a3bd2ba1e6b6f8ebe1ac1f6": 5,
+		"5a3bd2ba1e6b6f8ebe1ac1f7": 6,
+	}, customers)
+	assert.EqualValues(t, 0, listSize(pool, redisKeyJobs(newKeyspace(ns), "send_email")))
+	assert.EqualValues(t, 0, zsetSize(pool, redisKeyRetry(newKeyspace(ns))))
+	assert.EqualValues(t, 0, zsetSize(pool, redisKeyDead(newKeyspace(ns))))
+	assert.False(t, keyExists(pool, uniqueKey))
+}
+
+func TestWorkerPoolArgsCodec(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work"
+	job1 := "job1"
+	cleanKeyspace(ns, pool)
+
+	at := time.Date(2024, 3, 1, 12, 30, 15, 123456789, time.UTC)
+
+	var got interface{}
+	wp := NewWorkerPool(TestContext{}, 1, ns, pool, WithArgsCodec(gobArgsCodec{}))
+	wp.Job(job1, func(job *Job) error {
+		got = job.Args["at"]
+		return nil
+	})
+
+	enqueuer := NewEnqueuer(ns, pool, WithEnqueuerArgsCodec(gobArgsCodec{}))
+	_, err := enqueuer.Enqueue(job1, Q{"at": at})
+	require.NoError(t, err)
+
+	wp.Start()
+	wp.Drain()
+	wp.Stop()
+
+	assert.Equal(t, at, got)
+}
+
+func TestWorkerPoolWithWorkerPoolID(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work"
+	job1 := "job1"
+	cleanKeyspace(ns, pool)
+
+	wp := NewWorkerPool(TestContext{}, 1, ns, pool, WithWorkerPoolID("pod-1"))
+	assert.Equal(t, "pod-1", wp.workerPoolID)
+
+	var lockInfo map[string]string
+	wp.Job(job1, func(job *Job) error {
+		lockInfo = readHash(pool, redisKeyJobsLockInfo(newKeyspace(ns), job1))
+		return nil
+	})
+
+	_, err := NewEnqueuer(ns, pool).Enqueue(job1, nil)
+	require.NoError(t, err)
+
+	wp.Start()
+	wp.Drain()
+
+	heartbeats, err := NewClient(ns, pool).WorkerPoolHeartbeats()
+	require.NoError(t, err)
+	if assert.Equal(t, 1, len(heartbeats)) {
+		assert.Equal(t, "pod-1", heartbeats[0].WorkerPoolID)
+	}
+	wp.Stop()
+
+	assert.Equal(t, map[string]string{"pod-1": "1"}, lockInfo)
+
+	assert.Panics(t, func() { NewWorkerPool(TestContext{}, 1, ns, pool, WithWorkerPoolID("")) })
+}
+
+func TestWorkerPoolRecoverOwnInProgress(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work"
+	job1, oldJob := "job1", "old_job"
+	cleanKeyspace(ns, pool)
+
+	// A previous run of pod-1 was killed with a job of each type in progress.
+	enqueuer := NewEnqueuer(ns, pool)
+	conn := pool.Get()
+	for _, name := range []string{job1, oldJob} {
+		_, err := enqueuer.Enqueue(name, nil)
+		require.NoError(t, err)
+		_, err = conn.Do("RPOPLPUSH", redisKeyJobs(newKeyspace(ns), name), redisKeyJobsInProgress(newKeyspace(ns), "pod-1", name))
+		require.NoError(t, err)
+	}
+	_, err := conn.Do("SET", redisKeyJobsLock(newKeyspace(ns), job1), 1)
+	require.NoError(t, err)
+	_, err = conn.Do("HSET", redisKeyJobsLockInfo(newKeyspace(ns), job1), "pod-1", 1)
+	require.NoError(t, err)
+	_, err = conn.Do("HSET", redisKeyHeartbeat(newKeyspace(ns), "pod-1"), "job_names", job1+","+oldJob)
+	require.NoError(t, err)
+	conn.Close()
+
+	var runs int64
+	wp := NewWorkerPool(TestContext{}, 1, ns, pool, WithWorkerPoolID("pod-1"), WithRecoverOwnInProgress())
+	wp.JobWithOptions(job1, JobOptions{MaxConcurrency: 1}, func(job *Job) error {
+		atomic.AddInt64(&runs, 1)
+		return nil
+	})
+
+	wp.Start()
+	wp.Drain()
+	wp.Stop()
+
+	// The job ran although the previous run held the only slot.
+	assert.EqualValues(t, 1, atomic.LoadInt64(&runs))
+	assert.EqualValues(t, 0, listSize(pool, redisKeyJobsInProgress(newKeyspace(ns), "pod-1", job1)))
+	assert.EqualValues(t, 0, getInt64(pool, redisKeyJobsLock(newKeyspace(ns), job1)))
+	assert.EqualValues(t, 0, listSize(pool, redisKeyJobsInProgress(newKeyspace(ns), "pod-1", oldJob)))
+	assert.EqualValues(t, 1, listSize(pool, redisKeyJobs(newKeyspace(ns), oldJob)))
+
+	// Nothing is left to recover.
+	wp = NewWorkerPool(TestContext{}, 1, ns, pool, WithWorkerPoolID("pod-1"), WithRecoverOwnInProgress())
+	wp.recoverOwnInProgressJobs()
+	assert.EqualValues(t, 1, listSize(pool, redisKeyJobs(newKeyspace(ns), oldJob)))
+	assert.EqualValues(t, 0, getInt64(pool, redisKeyJobsLock(newKeyspace(ns), job1)))
+}
+
+// countingPool counts the connections taken from it.
+type countingPool struct {
+	Pool
+	gets atomic.Int64
+}
+
+func (p *countingPool) Get() redis.Conn {
+	p.gets.Add(1)
+	return p.Pool.Get()
+}
+
+func TestWorkerPoolWithMaintenancePool(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work"
+	cleanKeyspace(ns, pool)
+
+	maint := &countingPool{Pool: pool}
+	wp := NewWorkerPool(TestContext{}, 2, ns, pool, WithMaintenancePool(maint))
+	wp.Job("wat", func(job *Job) error { return nil })
+	_, err := NewEnqueuer(ns, pool).Enqueue("wat", nil)
+	require.NoError(t, err)
+
+	wp.Start()
+	wp.Drain()
+
+	assert.Equal(t, maint, wp.heartbeater.pool)
+	assert.Equal(t, maint, wp.retrier.pool)
+	assert.Equal(t, maint, wp.scheduler.pool)
+	assert.Equal(t, maint, wp.deadPoolReaper.pool)
+	for _, w := range wp.workers {
+		assert.Equal(t, maint, w.observer.pool)
+		assert.Equal(t, pool, w.pool)
+	}
+	assert.True(t, maint.gets.Load() > 0)
+
+	heartbeats, err := NewClient(ns, pool).WorkerPoolHeartbeats()
+	require.NoError(t, err)
+	assert.Equal(t, 1, len(heartbeats))
+	wp.Stop()
+
+	// Without the option, the main pool is used.
+	wp = NewWorkerPool(TestContext{}, 1, ns, pool)
+	assert.Equal(t, pool, wp.workers[0].observer.pool)
+	assert.Equal(t, pool, wp.newDeadPoolReaper(nil).pool)
+}
+
+func TestWorkerPoolInProgressLeases(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work"
+	cleanKeyspace(ns, pool)
+
+	// The first run is wedged until the job is run again after its lease expired.
+	var runs atomic.Int64
+	unwedge := make(chan struct{})
+	wp := NewWorkerPool(TestContext{}, 2, ns, pool, WithInProgressLeases(200*time.Millisecond))
+	wp.Job("wat", func(job *Job) error {
+		if runs.Add(1) == 1 {
+			<-unwedge
+		}
+		return nil
+	})
+	_, err := NewEnqueuer(ns, pool).Enqueue("wat", nil)
+	require.NoError(t, err)
+
+	wp.Start()
+	assert.Eventually(t, func() bool { return runs.Load() == 2 }, 2*time.Second, 10*time.Millisecond)
+	close(unwedge)
+	wp.Stop()
+
+	assert.EqualValues(t, 2, runs.Load())
+	assert.EqualValues(t, 0, listSize(pool, redisKeyJobsInProgress(newKeyspace(ns), wp.workerPoolID, "wat")))
+	assert.False(t, keyExists(pool, redisKeyJobsInProgressLeases(newKeyspace(ns), wp.workerPoolID, "wat")))
+
+	assert.Panics(t, func() { NewWorkerPool(TestContext{}, 1, ns, pool, WithInProgressLeases(0)) })
+}
+
+func TestWorkerPoolRunJobNow(t *testing.T) {
+	// The pool can't connect to Redis: RunJobNow must not need it.
+	pool := &redis.Pool{Dial: func() (redis.Conn, error) { return nil, fmt.Errorf("no redis") }}
+	wp := NewWorkerPool(tstCtx{}, 1, "work", pool)
+
+	var calls []string
+	wp.Middleware(func(c *tstCtx, job *Job, next NextMiddlewareFunc) error {
+		calls = append(calls, "pool")
+		c.record("pool,")
+		return next()
+	})
+	wp.Job("wat", func(c *tstCtx, job *Job) error {
+		calls = append(calls, "handler")
+		assert.Equal(t, "pool,", c.String())
+		assert.EqualValues(t, 3, job.ArgInt64("n"))
+		return job.ArgError()
+	})
+	wp.JobMiddleware("wat", func(job *Job, next NextMiddlewareFunc) error {
+		calls = append(calls, "job")
+		return next()
+	})
+	wp.Job("fail", func(job *Job) error {
+		return fmt.Errorf("oops")
+	})
+
+	require.NoError(t, wp.RunJobNow("wat", map[string]interface{}{"n": 3}))
+	assert.Equal(t, []string{"pool", "job", "handler"}, calls)
+
+	// Every run gets a fresh context.
+	calls = nil
+	require.NoError(t, wp.RunJobNow("wat", map[string]interface{}{"n": 3}))
+	assert.Equal(t, []string{"pool", "job", "handler"}, calls)
+
+	assert.EqualError(t, wp.RunJobNow("fail", nil), "oops")
+	assert.Equal(t, ErrStrayJob, wp.RunJobNow("unknown", nil))
+}
+
+func TestWorkerPoolRegisteredJobs(t *testing.T) {
+	pool := newTestPool(":6379")
+	wp := NewWorkerPool(TestContext{}, 1, "work", pool)
+	wp.Job("foo", func(job *Job) error { return nil })
+	wp.JobWithOptions("bar", JobOptions{Priority: 10, MaxFails: 1, MaxConcurrency: 2, SkipDead: true}, func(job *Job) error { return nil })
+	wp.PeriodicallyEnqueue("0 0 * * * *", "foo")
+
+	assert.Equal(t, []JobInfo{
+		{Name: "bar", Priority: 10, MaxFails: 1, MaxConcurrency: 2, SkipDead: true},
+		{Name: "foo", Priority: 1, MaxFails: 4, Periodic: true, PeriodicSpecs: []string{"0 0 * * * *"}},
+	}, wp.RegisteredJobs())
+}
+
+func TestWorkerPoolLeasedConcurrency(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work"
+	cleanKeyspace(ns, pool)
+	leases := redisKeyJobsLeases(newKeyspace(ns), "wat")
+
+	// The lease of a crashed worker expired: it doesn't hold the only slot anymore.
+	conn := pool.Get()
+	_, err := conn.Do("ZADD", leases, time.Now().UnixMilli()-1000, "crashed")
+	conn.Close()
+	require.NoError(t, err)
+
+	var running, maxRunning int64
+	wp := NewWorkerPool(TestContext{}, 2, ns, pool, WithLeasedConcurrency(150*time.Millisecond))
+	wp.JobWithOptions("wat", JobOptions{MaxConcurrency: 1}, func(job *Job) error {
+		if n := atomic.AddInt64(&running, 1); n > atomic.LoadInt64(&maxRunning) {
+			atomic.StoreInt64(&maxRunning, n)
+		}
+		defer atomic.AddInt64(&running, -1)
+
+		counts, err := NewClient(ns, pool).ActiveJobCounts()
+		assert.NoError(t, err)
+		assert.EqualValues(t, 1, counts["wat"])
+
+		// The lease is renewed while the job runs longer than the lease TTL.
+		time.Sleep(300 * time.Millisecond)
+		assert.EqualValues(t, 1, zsetSize(pool, leases))
+		assert.EqualValues(t, 0, getInt64(pool, redisKeyJobsLock(newKeyspace(ns), "wat")))
+		return nil
+	})
+
+	enqueuer := NewEnqueuer(ns, pool)
+	for i := 0; i < 2; i++ {
+		_, err := enqueuer.Enqueue("wat", nil)
+		require.NoError(t, err)
+	}
+
+	wp.Start()
+	wp.Drain()
+	wp.Stop()
+
+	assert.EqualValues(t, 1, atomic.LoadInt64(&maxRunning))
+	assert.EqualValues(t, 0, listSize(pool, redisKeyJobs(newKeyspace(ns), "wat")))
+	assert.EqualValues(t, 0, zsetSize(pool, leases))
+	assert.False(t, keyExists(pool, redisKeyJobsLockInfo(newKeyspace(ns), "wat")))
+	assert.Panics(t, func() { NewWorkerPool(TestContext{}, 1, ns, pool, WithLeasedConcurrency(0)) })
+}
+
 // Test Helpers
 func (t *TestContext) SleepyJob(job *Job) error {
 	sleepTime := time.Duration(job.ArgInt64("sleep"))
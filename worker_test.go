@@ -11,6 +11,7 @@ import (
 
 	"github.com/gomodule/redigo/redis"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestWorkerBasics(t *testing.T) {
@@ -63,7 +64,7 @@ func TestWorkerBasics(t *testing.T) {
 	_, err = enqueuer.Enqueue(job3, Q{"a": 3})
 	assert.Nil(t, err)
 
-	w := newWorker(ns, "1", pool, tstCtxType, nil, jobTypes, noopLogger, nil)
+	w := newWorker(newKeyspace(ns), "1", pool, tstCtxType, nil, jobTypes, noopLogger, nil)
 	w.start()
 	w.drain()
 	w.stop()
@@ -74,19 +75,19 @@ func TestWorkerBasics(t *testing.T) {
 	assert.EqualValues(t, 3.0, arg3)
 
 	// nothing in retries or dead
-	assert.EqualValues(t, 0, zsetSize(pool, redisKeyRetry(ns)))
-	assert.EqualValues(t, 0, zsetSize(pool, redisKeyDead(ns)))
+	assert.EqualValues(t, 0, zsetSize(pool, redisKeyRetry(newKeyspace(ns))))
+	assert.EqualValues(t, 0, zsetSize(pool, redisKeyDead(newKeyspace(ns))))
 
 	// Nothing in the queues or in-progress queues
-	assert.EqualValues(t, 0, listSize(pool, redisKeyJobs(ns, job1)))
-	assert.EqualValues(t, 0, listSize(pool, redisKeyJobs(ns, job2)))
-	assert.EqualValues(t, 0, listSize(pool, redisKeyJobs(ns, job3)))
-	assert.EqualValues(t, 0, listSize(pool, redisKeyJobsInProgress(ns, "1", job1)))
-	assert.EqualValues(t, 0, listSize(pool, redisKeyJobsInProgress(ns, "1", job2)))
-	assert.EqualValues(t, 0, listSize(pool, redisKeyJobsInProgress(ns, "1", job3)))
+	assert.EqualValues(t, 0, listSize(pool, redisKeyJobs(newKeyspace(ns), job1)))
+	assert.EqualValues(t, 0, listSize(pool, redisKeyJobs(newKeyspace(ns), job2)))
+	assert.EqualValues(t, 0, listSize(pool, redisKeyJobs(newKeyspace(ns), job3)))
+	assert.EqualValues(t, 0, listSize(pool, redisKeyJobsInProgress(newKeyspace(ns), "1", job1)))
+	assert.EqualValues(t, 0, listSize(pool, redisKeyJobsInProgress(newKeyspace(ns), "1", job2)))
+	assert.EqualValues(t, 0, listSize(pool, redisKeyJobsInProgress(newKeyspace(ns), "1", job3)))
 
 	// nothing in the worker status
-	h := readHash(pool, redisKeyWorkerObservation(ns, w.workerID))
+	h := readHash(pool, redisKeyWorkerObservation(newKeyspace(ns), w.workerID))
 	assert.EqualValues(t, 0, len(h))
 }
 
@@ -113,20 +114,20 @@ func TestWorkerInProgress(t *testing.T) {
 	_, err := enqueuer.Enqueue(job1, Q{"a": 1})
 	assert.Nil(t, err)
 
-	w := newWorker(ns, "1", pool, tstCtxType, nil, jobTypes, noopLogger, nil)
+	w := newWorker(newKeyspace(ns), "1", pool, tstCtxType, nil, jobTypes, noopLogger, nil)
 	w.start()
 
 	// instead of w.forceIter(), we'll wait for 10 milliseconds to let the job start
 	// The job will then sleep for 30ms. In that time, we should be able to see something in the in-progress queue.
 	time.Sleep(10 * time.Millisecond)
-	assert.EqualValues(t, 0, listSize(pool, redisKeyJobs(ns, job1)))
-	assert.EqualValues(t, 1, listSize(pool, redisKeyJobsInProgress(ns, "1", job1)))
-	assert.EqualValues(t, 1, getInt64(pool, redisKeyJobsLock(ns, job1)))
-	assert.EqualValues(t, 1, hgetInt64(pool, redisKeyJobsLockInfo(ns, job1), w.poolID))
+	assert.EqualValues(t, 0, listSize(pool, redisKeyJobs(newKeyspace(ns), job1)))
+	assert.EqualValues(t, 1, listSize(pool, redisKeyJobsInProgress(newKeyspace(ns), "1", job1)))
+	assert.EqualValues(t, 1, getInt64(pool, redisKeyJobsLock(newKeyspace(ns), job1)))
+	assert.EqualValues(t, 1, hgetInt64(pool, redisKeyJobsLockInfo(newKeyspace(ns), job1), w.poolID))
 
 	// nothing in the worker status
 	w.observer.drain()
-	h := readHash(pool, redisKeyWorkerObservation(ns, w.workerID))
+	h := readHash(pool, redisKeyWorkerObservation(newKeyspace(ns), w.workerID))
 	assert.Equal(t, job1, h["job_name"])
 	assert.Equal(t, `{"a":1}`, h["args"])
 	// NOTE: we could check for job_id and started_at, but it's a PITA and it's tested in observer_test.
@@ -135,11 +136,11 @@ func TestWorkerInProgress(t *testing.T) {
 	w.stop()
 
 	// At this point, it should all be empty.
-	assert.EqualValues(t, 0, listSize(pool, redisKeyJobs(ns, job1)))
-	assert.EqualValues(t, 0, listSize(pool, redisKeyJobsInProgress(ns, "1", job1)))
+	assert.EqualValues(t, 0, listSize(pool, redisKeyJobs(newKeyspace(ns), job1)))
+	assert.EqualValues(t, 0, listSize(pool, redisKeyJobsInProgress(newKeyspace(ns), "1", job1)))
 
 	// nothing in the worker status
-	h = readHash(pool, redisKeyWorkerObservation(ns, w.workerID))
+	h = readHash(pool, redisKeyWorkerObservation(newKeyspace(ns), w.workerID))
 	assert.EqualValues(t, 0, len(h))
 }
 
@@ -164,21 +165,21 @@ func TestWorkerRetry(t *testing.T) {
 	enqueuer := NewEnqueuer(ns, pool)
 	_, err := enqueuer.Enqueue(job1, Q{"a": 1})
 	assert.Nil(t, err)
-	w := newWorker(ns, "1", pool, tstCtxType, nil, jobTypes, noopLogger, nil)
+	w := newWorker(newKeyspace(ns), "1", pool, tstCtxType, nil, jobTypes, noopLogger, nil)
 	w.start()
 	w.drain()
 	w.stop()
 
 	// Ensure the right stuff is in our queues:
-	assert.EqualValues(t, 1, zsetSize(pool, redisKeyRetry(ns)))
-	assert.EqualValues(t, 0, zsetSize(pool, redisKeyDead(ns)))
-	assert.EqualValues(t, 0, listSize(pool, redisKeyJobs(ns, job1)))
-	assert.EqualValues(t, 0, listSize(pool, redisKeyJobsInProgress(ns, "1", job1)))
-	assert.EqualValues(t, 0, getInt64(pool, redisKeyJobsLock(ns, job1)))
-	assert.EqualValues(t, 0, hgetInt64(pool, redisKeyJobsLockInfo(ns, job1), w.poolID))
+	assert.EqualValues(t, 1, zsetSize(pool, redisKeyRetry(newKeyspace(ns))))
+	assert.EqualValues(t, 0, zsetSize(pool, redisKeyDead(newKeyspace(ns))))
+	assert.EqualValues(t, 0, listSize(pool, redisKeyJobs(newKeyspace(ns), job1)))
+	assert.EqualValues(t, 0, listSize(pool, redisKeyJobsInProgress(newKeyspace(ns), "1", job1)))
+	assert.EqualValues(t, 0, getInt64(pool, redisKeyJobsLock(newKeyspace(ns), job1)))
+	assert.EqualValues(t, 0, hgetInt64(pool, redisKeyJobsLockInfo(newKeyspace(ns), job1), w.poolID))
 
 	// Get the job on the retry queue
-	ts, job := jobOnZset(pool, redisKeyRetry(ns))
+	ts, job := jobOnZset(pool, redisKeyRetry(newKeyspace(ns)))
 
 	assert.True(t, ts > nowEpochSeconds())      // enqueued in the future
 	assert.True(t, ts < (nowEpochSeconds()+80)) // but less than a minute from now (first failure)
@@ -216,19 +217,19 @@ func TestWorkerRetryWithCustomBackoff(t *testing.T) {
 	enqueuer := NewEnqueuer(ns, pool)
 	_, err := enqueuer.Enqueue(job1, Q{"a": 1})
 	assert.Nil(t, err)
-	w := newWorker(ns, "1", pool, tstCtxType, nil, jobTypes, noopLogger, nil)
+	w := newWorker(newKeyspace(ns), "1", pool, tstCtxType, nil, jobTypes, noopLogger, nil)
 	w.start()
 	w.drain()
 	w.stop()
 
 	// Ensure the right stuff is in our queues:
-	assert.EqualValues(t, 1, zsetSize(pool, redisKeyRetry(ns)))
-	assert.EqualValues(t, 0, zsetSize(pool, redisKeyDead(ns)))
-	assert.EqualValues(t, 0, listSize(pool, redisKeyJobs(ns, job1)))
-	assert.EqualValues(t, 0, listSize(pool, redisKeyJobsInProgress(ns, "1", job1)))
+	assert.EqualValues(t, 1, zsetSize(pool, redisKeyRetry(newKeyspace(ns))))
+	assert.EqualValues(t, 0, zsetSize(pool, redisKeyDead(newKeyspace(ns))))
+	assert.EqualValues(t, 0, listSize(pool, redisKeyJobs(newKeyspace(ns), job1)))
+	assert.EqualValues(t, 0, listSize(pool, redisKeyJobsInProgress(newKeyspace(ns), "1", job1)))
 
 	// Get the job on the retry queue
-	ts, job := jobOnZset(pool, redisKeyRetry(ns))
+	ts, job := jobOnZset(pool, redisKeyRetry(newKeyspace(ns)))
 
 	assert.True(t, ts > nowEpochSeconds())      // enqueued in the future
 	assert.True(t, ts < (nowEpochSeconds()+10)) // but less than ten secs in
@@ -240,6 +241,404 @@ func TestWorkerRetryWithCustomBackoff(t *testing.T) {
 	assert.Equal(t, 1, calledCustom)
 }
 
+func TestWorkerDeadLetter(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work"
+	cleanKeyspace(ns, pool)
+
+	jobTypes := make(map[string]*jobType)
+	for name, opts := range map[string]JobOptions{
+		"wrapped":  {Priority: 1, MaxFails: 4},
+		"preserve": {Priority: 1, MaxFails: 4},
+		"skip":     {Priority: 1, MaxFails: 4, SkipDead: true},
+	} {
+		name := name
+		jobTypes[name] = &jobType{
+			Name:       name,
+			JobOptions: opts,
+			isGeneric:  true,
+			genericHandler: func(job *Job) error {
+				if name == "preserve" {
+					return DeadLetter(fmt.Errorf("malformed payload"))
+				}
+				return fmt.Errorf("malformed payload: %w", ErrDeadLetter)
+			},
+		}
+	}
+
+	enqueuer := NewEnqueuer(ns, pool)
+	for name := range jobTypes {
+		_, err := enqueuer.Enqueue(name, nil)
+		assert.NoError(t, err)
+	}
+
+	w := newWorker(newKeyspace(ns), "1", pool, tstCtxType, nil, jobTypes, noopLogger, nil)
+	w.start()
+	w.drain()
+	w.stop()
+
+	assert.EqualValues(t, 0, zsetSize(pool, redisKeyRetry(newKeyspace(ns))))
+	assert.EqualValues(t, 2, zsetSize(pool, redisKeyDead(newKeyspace(ns))))
+
+	jobs, _, err := NewClient(ns, pool).DeadJobs(1)
+	assert.NoError(t, err)
+	errs := map[string]string{}
+	for _, job := range jobs {
+		assert.EqualValues(t, 1, job.Fails)
+		errs[job.Name] = job.LastErr
+	}
+	assert.Equal(t, map[string]string{
+		"wrapped":  "malformed payload: dead letter",
+		"preserve": "malformed payload",
+	}, errs)
+}
+
+func TestWorkerSkipJob(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work"
+	cleanKeyspace(ns, pool)
+
+	var handled, errored int64
+	wp := NewWorkerPool(TestContext{}, 1, ns, pool, WithJobErrorHandler(func(job *Job, err error) {
+		atomic.AddInt64(&errored, 1)
+	}))
+	wp.Middleware(func(job *Job, next NextMiddlewareFunc) error {
+		if job.ArgBool("off") {
+			return fmt.Errorf("feature is off: %w", ErrSkipJob)
+		}
+		return next()
+	})
+	wp.Job("wat", func(job *Job) error {
+		atomic.AddInt64(&handled, 1)
+		return nil
+	})
+	events := wp.Events()
+
+	enqueuer := NewEnqueuer(ns, pool)
+	_, err := enqueuer.Enqueue("wat", Q{"off": true})
+	assert.NoError(t, err)
+	_, err = enqueuer.Enqueue("wat", Q{"off": false})
+	assert.NoError(t, err)
+
+	wp.Start()
+	wp.Drain()
+	wp.Stop()
+
+	assert.EqualValues(t, 1, atomic.LoadInt64(&handled))
+	assert.EqualValues(t, 0, atomic.LoadInt64(&errored))
+	assert.EqualValues(t, 0, zsetSize(pool, redisKeyRetry(newKeyspace(ns))))
+	assert.EqualValues(t, 0, zsetSize(pool, redisKeyDead(newKeyspace(ns))))
+	assert.EqualValues(t, 0, listSize(pool, redisKeyJobsInProgress(newKeyspace(ns), wp.workerPoolID, "wat")))
+	assert.EqualValues(t, 0, getInt64(pool, redisKeyJobsLock(newKeyspace(ns), "wat")))
+
+	var types []JobEventType
+	for ev := range events {
+		types = append(types, ev.Type)
+	}
+	assert.ElementsMatch(t, []JobEventType{JobEventStarted, JobEventSkipped, JobEventStarted, JobEventSucceeded}, types)
+}
+
+func TestWorkerReschedule(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work"
+	cleanKeyspace(ns, pool)
+
+	clock := &fakeClock{now: time.Unix(1425263409, 0)}
+	wp := NewWorkerPool(TestContext{}, 1, ns, pool, WithClock(clock))
+	wp.Job("wat", func(job *Job) error {
+		job.Reschedule(time.Minute)
+		job.Reschedule(30 * time.Second)
+		if job.ArgBool("fail") {
+			return fmt.Errorf("oops")
+		}
+		return nil
+	})
+	events := wp.Events()
+
+	enqueuer := NewEnqueuer(ns, pool)
+	rescheduled, err := enqueuer.Enqueue("wat", Q{"fail": false})
+	assert.NoError(t, err)
+	_, err = enqueuer.Enqueue("wat", Q{"fail": true})
+	assert.NoError(t, err)
+
+	wp.Start()
+	wp.Drain()
+	wp.Stop()
+
+	assert.EqualValues(t, 1, zsetSize(pool, redisKeyScheduled(newKeyspace(ns))))
+	score, job := jobOnZset(pool, redisKeyScheduled(newKeyspace(ns)))
+	assert.EqualValues(t, 1425263439, score)
+	assert.Equal(t, rescheduled.ID, job.ID)
+	assert.EqualValues(t, 0, job.Fails)
+	assert.Equal(t, "", job.LastErr)
+
+	// The reschedule of a failed job is ignored.
+	assert.EqualValues(t, 1, zsetSize(pool, redisKeyRetry(newKeyspace(ns))))
+	assert.EqualValues(t, 0, listSize(pool, redisKeyJobsInProgress(newKeyspace(ns), wp.workerPoolID, "wat")))
+	assert.EqualValues(t, 0, getInt64(pool, redisKeyJobsLock(newKeyspace(ns), "wat")))
+
+	var types []JobEventType
+	for ev := range events {
+		types = append(types, ev.Type)
+	}
+	assert.ElementsMatch(t, []JobEventType{JobEventStarted, JobEventRescheduled, JobEventStarted, JobEventRetried}, types)
+}
+
+func TestWorkerInlineRetries(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work"
+	cleanKeyspace(ns, pool)
+
+	calls := map[string]int{}
+	handlers := map[string]func(job *Job) error{
+		"flaky": func(job *Job) error {
+			if calls["flaky"] < 3 {
+				return fmt.Errorf("flaky")
+			}
+			return nil
+		},
+		"broken": func(job *Job) error {
+			return fmt.Errorf("broken")
+		},
+		"malformed": func(job *Job) error {
+			return DeadLetter(fmt.Errorf("malformed"))
+		},
+	}
+
+	jobTypes := make(map[string]*jobType)
+	for name, h := range handlers {
+		name, h := name, h
+		jobTypes[name] = &jobType{
+			Name:       name,
+			JobOptions: JobOptions{Priority: 1, MaxFails: 3, InlineRetries: 2},
+			isGeneric:  true,
+			genericHandler: func(job *Job) error {
+				calls[name]++
+				return h(job)
+			},
+		}
+	}
+
+	enqueuer := NewEnqueuer(ns, pool)
+	for name := range jobTypes {
+		_, err := enqueuer.Enqueue(name, nil)
+		assert.NoError(t, err)
+	}
+
+	w := newWorker(newKeyspace(ns), "1", pool, tstCtxType, nil, jobTypes, noopLogger, nil)
+	w.start()
+	w.drain()
+	w.stop()
+
+	assert.Equal(t, map[string]int{"flaky": 3, "broken": 3, "malformed": 1}, calls)
+
+	assert.EqualValues(t, 1, zsetSize(pool, redisKeyRetry(newKeyspace(ns))))
+	_, job := jobOnZset(pool, redisKeyRetry(newKeyspace(ns)))
+	assert.Equal(t, "broken", job.Name)
+	assert.EqualValues(t, 1, job.Fails)
+	assert.EqualValues(t, 3, job.Attempts)
+
+	assert.EqualValues(t, 1, zsetSize(pool, redisKeyDead(newKeyspace(ns))))
+}
+
+func TestWorkerInlineRetriesDeadline(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work"
+	cleanKeyspace(ns, pool)
+
+	clock := &fakeClock{now: time.Now()}
+	calls := 0
+	jobTypes := map[string]*jobType{
+		"slow": {
+			Name:       "slow",
+			JobOptions: JobOptions{Priority: 1, MaxFails: 3, InlineRetries: 2, Deadline: 10 * time.Second},
+			isGeneric:  true,
+			genericHandler: func(job *Job) error {
+				calls++
+				clock.Advance(time.Minute)
+				return fmt.Errorf("slow")
+			},
+		},
+	}
+
+	enqueuer := NewEnqueuer(ns, pool)
+	_, err := enqueuer.Enqueue("slow", nil)
+	assert.NoError(t, err)
+
+	w := newWorker(newKeyspace(ns), "1", pool, tstCtxType, nil, jobTypes, noopLogger, nil, workerWithClock(clock))
+	w.start()
+	w.drain()
+	w.stop()
+
+	// The first run outlives the deadline, so the job goes straight to the retry queue.
+	assert.Equal(t, 1, calls)
+	assert.EqualValues(t, 1, zsetSize(pool, redisKeyRetry(newKeyspace(ns))))
+	_, job := jobOnZset(pool, redisKeyRetry(newKeyspace(ns)))
+	assert.EqualValues(t, 1, job.Fails)
+	assert.EqualValues(t, 1, job.Attempts)
+}
+
+func TestWorkerInlineRetryTimeout(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work"
+	cleanKeyspace(ns, pool)
+
+	clock := &fakeClock{now: time.Now()}
+	calls := 0
+	jobTypes := map[string]*jobType{
+		"slow": {
+			Name:       "slow",
+			JobOptions: JobOptions{Priority: 1, MaxFails: 3, InlineRetries: 5, InlineRetryTimeout: 30 * time.Second},
+			isGeneric:  true,
+			genericHandler: func(job *Job) error {
+				calls++
+				clock.Advance(20 * time.Second)
+				return fmt.Errorf("slow")
+			},
+		},
+	}
+
+	enqueuer := NewEnqueuer(ns, pool)
+	_, err := enqueuer.Enqueue("slow", nil)
+	assert.NoError(t, err)
+
+	w := newWorker(newKeyspace(ns), "1", pool, tstCtxType, nil, jobTypes, noopLogger, nil, workerWithClock(clock))
+	w.start()
+	w.drain()
+	w.stop()
+
+	// The second run ends past the time budget of the inline retries, so the job goes to the retry queue.
+	assert.Equal(t, 2, calls)
+	assert.EqualValues(t, 1, zsetSize(pool, redisKeyRetry(newKeyspace(ns))))
+	_, job := jobOnZset(pool, redisKeyRetry(newKeyspace(ns)))
+	assert.EqualValues(t, 1, job.Fails)
+	assert.EqualValues(t, 2, job.Attempts)
+
+	assert.Panics(t, func() { applyDefaultsAndValidate(JobOptions{InlineRetryTimeout: -time.Second}) })
+}
+
+func TestWorkerMaxRetryAge(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work"
+	cleanKeyspace(ns, pool)
+
+	jobTypes := map[string]*jobType{
+		"wat": {
+			Name:       "wat",
+			JobOptions: applyDefaultsAndValidate(JobOptions{MaxRetryAge: time.Hour}),
+			isGeneric:  true,
+			genericHandler: func(job *Job) error {
+				return fmt.Errorf("sorry kid")
+			},
+		},
+	}
+	assert.EqualValues(t, 0, jobTypes["wat"].MaxFails)
+
+	enqueuedAt := int64(1425263409)
+	setNowEpochSecondsMock(enqueuedAt)
+	defer resetNowEpochSecondsMock()
+
+	_, err := NewEnqueuer(ns, pool).Enqueue("wat", nil)
+	assert.NoError(t, err)
+
+	retrier := newRequeuer(newKeyspace(ns), pool, redisKeyRetry(newKeyspace(ns)), []string{"wat"}, noopMetrics, noopLogger)
+	w := newWorker(newKeyspace(ns), "1", pool, tstCtxType, nil, jobTypes, noopLogger, nil)
+	w.start()
+	defer w.stop()
+
+	// More attempts than the default MaxFails, all within the max age.
+	for i := int64(1); i <= 5; i++ {
+		w.drain()
+		assert.EqualValues(t, 1, zsetSize(pool, redisKeyRetry(newKeyspace(ns))))
+		assert.EqualValues(t, 0, zsetSize(pool, redisKeyDead(newKeyspace(ns))))
+
+		_, job := jobOnZset(pool, redisKeyRetry(newKeyspace(ns)))
+		assert.Equal(t, i, job.Fails)
+		assert.Equal(t, enqueuedAt, job.FirstEnqueuedAt)
+
+		setNowEpochSecondsMock(enqueuedAt + i*10*60)
+		retrier.processAll()
+	}
+
+	setNowEpochSecondsMock(enqueuedAt + 3600)
+	retrier.processAll()
+	w.drain()
+	assert.EqualValues(t, 0, zsetSize(pool, redisKeyRetry(newKeyspace(ns))))
+	assert.EqualValues(t, 1, zsetSize(pool, redisKeyDead(newKeyspace(ns))))
+}
+
+func TestJobTypeShouldRetry(t *testing.T) {
+	now := int64(1425263409)
+	job := &Job{Fails: 2, FirstEnqueuedAt: now - 600}
+
+	for _, tc := range []struct {
+		opts  JobOptions
+		retry bool
+	}{
+		{JobOptions{MaxFails: 3}, true},
+		{JobOptions{MaxFails: 2}, false},
+		{JobOptions{MaxRetryAge: time.Hour}, true},
+		{JobOptions{MaxRetryAge: 10 * time.Minute}, false},
+		{JobOptions{MaxFails: 3, MaxRetryAge: 5 * time.Minute}, false},
+		{JobOptions{MaxFails: 2, MaxRetryAge: time.Hour}, false},
+		{JobOptions{MaxFails: 3, MaxRetryAge: time.Hour}, true},
+	} {
+		jt := &jobType{JobOptions: tc.opts}
+		assert.Equal(t, tc.retry, jt.shouldRetry(job, now), "%+v", tc.opts)
+	}
+}
+
+func TestWorkerRetryWithErrorBackoff(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work"
+	job1 := "job1"
+	deleteQueue(pool, ns, job1)
+	deleteRetryAndDead(pool, ns)
+
+	errRateLimited := fmt.Errorf("rate limited")
+	var gotErr error
+
+	jobTypes := make(map[string]*jobType)
+	jobTypes[job1] = &jobType{
+		Name: job1,
+		JobOptions: JobOptions{
+			Priority: 1,
+			MaxFails: 3,
+			Backoff: func(job *Job) int64 {
+				t.Error("Backoff should not be called when BackoffWithError is set")
+				return 0
+			},
+			BackoffWithError: func(job *Job, err error) int64 {
+				gotErr = err
+				if err == errRateLimited {
+					return 600
+				}
+				return 5
+			},
+		},
+		isGeneric: true,
+		genericHandler: func(job *Job) error {
+			return errRateLimited
+		},
+	}
+
+	enqueuer := NewEnqueuer(ns, pool)
+	_, err := enqueuer.Enqueue(job1, Q{"a": 1})
+	assert.Nil(t, err)
+	w := newWorker(newKeyspace(ns), "1", pool, tstCtxType, nil, jobTypes, noopLogger, nil)
+	w.start()
+	w.drain()
+	w.stop()
+
+	assert.EqualValues(t, 1, zsetSize(pool, redisKeyRetry(newKeyspace(ns))))
+	assert.Equal(t, errRateLimited, gotErr)
+
+	ts, job := jobOnZset(pool, redisKeyRetry(newKeyspace(ns)))
+	assert.True(t, ts >= nowEpochSeconds()+590)
+	assert.True(t, ts <= nowEpochSeconds()+600)
+	assert.EqualValues(t, 1, job.Fails)
+}
+
 func TestWorkerDead(t *testing.T) {
 	pool := newTestPool(":6379")
 	ns := "work"
@@ -273,27 +672,27 @@ func TestWorkerDead(t *testing.T) {
 	assert.Nil(t, err)
 	_, err = enqueuer.Enqueue(job2, nil)
 	assert.Nil(t, err)
-	w := newWorker(ns, "1", pool, tstCtxType, nil, jobTypes, noopLogger, nil)
+	w := newWorker(newKeyspace(ns), "1", pool, tstCtxType, nil, jobTypes, noopLogger, nil)
 	w.start()
 	w.drain()
 	w.stop()
 
 	// Ensure the right stuff is in our queues:
-	assert.EqualValues(t, 0, zsetSize(pool, redisKeyRetry(ns)))
-	assert.EqualValues(t, 1, zsetSize(pool, redisKeyDead(ns)))
+	assert.EqualValues(t, 0, zsetSize(pool, redisKeyRetry(newKeyspace(ns))))
+	assert.EqualValues(t, 1, zsetSize(pool, redisKeyDead(newKeyspace(ns))))
 
-	assert.EqualValues(t, 0, listSize(pool, redisKeyJobs(ns, job1)))
-	assert.EqualValues(t, 0, listSize(pool, redisKeyJobsInProgress(ns, "1", job1)))
-	assert.EqualValues(t, 0, getInt64(pool, redisKeyJobsLock(ns, job1)))
-	assert.EqualValues(t, 0, hgetInt64(pool, redisKeyJobsLockInfo(ns, job1), w.poolID))
+	assert.EqualValues(t, 0, listSize(pool, redisKeyJobs(newKeyspace(ns), job1)))
+	assert.EqualValues(t, 0, listSize(pool, redisKeyJobsInProgress(newKeyspace(ns), "1", job1)))
+	assert.EqualValues(t, 0, getInt64(pool, redisKeyJobsLock(newKeyspace(ns), job1)))
+	assert.EqualValues(t, 0, hgetInt64(pool, redisKeyJobsLockInfo(newKeyspace(ns), job1), w.poolID))
 
-	assert.EqualValues(t, 0, listSize(pool, redisKeyJobs(ns, job2)))
-	assert.EqualValues(t, 0, listSize(pool, redisKeyJobsInProgress(ns, "1", job2)))
-	assert.EqualValues(t, 0, getInt64(pool, redisKeyJobsLock(ns, job2)))
-	assert.EqualValues(t, 0, hgetInt64(pool, redisKeyJobsLockInfo(ns, job2), w.poolID))
+	assert.EqualValues(t, 0, listSize(pool, redisKeyJobs(newKeyspace(ns), job2)))
+	assert.EqualValues(t, 0, listSize(pool, redisKeyJobsInProgress(newKeyspace(ns), "1", job2)))
+	assert.EqualValues(t, 0, getInt64(pool, redisKeyJobsLock(newKeyspace(ns), job2)))
+	assert.EqualValues(t, 0, hgetInt64(pool, redisKeyJobsLockInfo(newKeyspace(ns), job2), w.poolID))
 
 	// Get the job on the dead queue
-	ts, job := jobOnZset(pool, redisKeyDead(ns))
+	ts, job := jobOnZset(pool, redisKeyDead(newKeyspace(ns)))
 
 	assert.True(t, ts <= nowEpochSeconds())
 
@@ -303,6 +702,336 @@ func TestWorkerDead(t *testing.T) {
 	assert.True(t, (nowEpochSeconds()-job.FailedAt) <= 2)
 }
 
+func TestWorkerDeadJobHook(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work"
+	cleanKeyspace(ns, pool)
+
+	jobTypes := make(map[string]*jobType)
+	for name, opts := range map[string]JobOptions{
+		"dead":  {Priority: 1, MaxFails: 1},
+		"skip":  {Priority: 1, MaxFails: 1, SkipDead: true},
+		"retry": {Priority: 1, MaxFails: 3},
+	} {
+		name := name
+		jobTypes[name] = &jobType{
+			Name:       name,
+			JobOptions: opts,
+			isGeneric:  true,
+			genericHandler: func(job *Job) error {
+				return fmt.Errorf("sorry %s", name)
+			},
+		}
+	}
+
+	enqueuer := NewEnqueuer(ns, pool)
+	for name := range jobTypes {
+		_, err := enqueuer.Enqueue(name, nil)
+		assert.NoError(t, err)
+	}
+
+	var (
+		hookJobs []*Job
+		hookErrs []error
+	)
+	hook := func(job *Job, lastErr error) {
+		hookJobs = append(hookJobs, job)
+		hookErrs = append(hookErrs, lastErr)
+	}
+
+	w := newWorker(newKeyspace(ns), "1", pool, tstCtxType, nil, jobTypes, noopLogger, nil, workerWithDeadJobHook(hook))
+	w.start()
+	w.drain()
+	w.stop()
+
+	assert.EqualValues(t, 1, zsetSize(pool, redisKeyDead(newKeyspace(ns))))
+	assert.EqualValues(t, 1, zsetSize(pool, redisKeyRetry(newKeyspace(ns))))
+
+	if assert.Equal(t, 1, len(hookJobs)) {
+		assert.Equal(t, "dead", hookJobs[0].Name)
+		assert.EqualValues(t, 1, hookJobs[0].Fails)
+		assert.Equal(t, "sorry dead", hookJobs[0].LastErr)
+		assert.EqualError(t, hookErrs[0], "sorry dead")
+	}
+}
+
+func TestWorkerJobErrorHandler(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work"
+	job1 := "job1"
+	cleanKeyspace(ns, pool)
+
+	jobTypes := map[string]*jobType{
+		job1: {
+			Name:       job1,
+			JobOptions: JobOptions{Priority: 1, MaxFails: 3},
+			isGeneric:  true,
+			genericHandler: func(job *Job) error {
+				if job.ArgBool("fail") {
+					return fmt.Errorf("sorry")
+				}
+				return nil
+			},
+		},
+	}
+
+	enqueuer := NewEnqueuer(ns, pool)
+	_, err := enqueuer.Enqueue(job1, Q{"fail": true})
+	assert.NoError(t, err)
+	_, err = enqueuer.Enqueue(job1, Q{"fail": false})
+	assert.NoError(t, err)
+
+	// A job without a handler which ended up in the job1 queue.
+	stray := &Job{Name: "stray", ID: makeIdentifier(), EnqueuedAt: nowEpochSeconds()}
+	rawJSON, err := stray.serialize()
+	assert.NoError(t, err)
+	conn := pool.Get()
+	_, err = conn.Do("LPUSH", redisKeyJobs(newKeyspace(ns), job1), rawJSON)
+	conn.Close()
+	assert.NoError(t, err)
+
+	var (
+		mtx      sync.Mutex
+		failures = map[string]error{}
+		fails    = map[string]int64{}
+	)
+	handler := func(job *Job, err error) {
+		mtx.Lock()
+		defer mtx.Unlock()
+		failures[job.Name] = err
+		fails[job.Name] = job.Fails
+	}
+
+	w := newWorker(newKeyspace(ns), "1", pool, tstCtxType, nil, jobTypes, noopLogger, nil, workerWithJobErrorHandler(handler))
+	w.start()
+	w.drain()
+	w.stop()
+
+	assert.Equal(t, 2, len(failures))
+	assert.EqualError(t, failures[job1], "sorry")
+	assert.EqualValues(t, 1, fails[job1])
+	assert.ErrorIs(t, failures["stray"], ErrStrayJob)
+	assert.EqualValues(t, 1, fails["stray"])
+}
+
+func TestWorkerStrayJobs(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work"
+	job1 := "job1"
+
+	for _, drop := range []bool{false, true} {
+		cleanKeyspace(ns, pool)
+
+		jobTypes := map[string]*jobType{
+			job1: {
+				Name:           job1,
+				JobOptions:     JobOptions{Priority: 1, MaxFails: 3},
+				isGeneric:      true,
+				genericHandler: func(job *Job) error { return nil },
+			},
+		}
+
+		// A job whose handler was removed, left in the job1 queue.
+		stray := &Job{Name: "removed", ID: makeIdentifier(), EnqueuedAt: nowEpochSeconds()}
+		rawJSON, err := stray.serialize()
+		assert.NoError(t, err)
+		conn := pool.Get()
+		_, err = conn.Do("LPUSH", redisKeyJobs(newKeyspace(ns), job1), rawJSON)
+		conn.Close()
+		assert.NoError(t, err)
+
+		var strays []*Job
+		w := newWorker(newKeyspace(ns), "1", pool, tstCtxType, nil, jobTypes, noopLogger, nil,
+			workerWithStrayJobHandler(func(job *Job) { strays = append(strays, job) }, drop))
+		w.start()
+		w.drain()
+		w.stop()
+
+		if assert.Equal(t, 1, len(strays)) {
+			assert.Equal(t, stray.ID, strays[0].ID)
+		}
+		assert.EqualValues(t, 0, listSize(pool, redisKeyJobsInProgress(newKeyspace(ns), "1", job1)))
+
+		if drop {
+			assert.EqualValues(t, 0, zsetSize(pool, redisKeyDead(newKeyspace(ns))))
+		} else {
+			assert.EqualValues(t, 1, zsetSize(pool, redisKeyDead(newKeyspace(ns))))
+			_, dead := jobOnZset(pool, redisKeyDead(newKeyspace(ns)))
+			assert.Equal(t, stray.ID, dead.ID)
+			assert.Equal(t, `stray job: no handler for job "removed"`, dead.LastErr)
+		}
+	}
+}
+
+func TestWorkerMalformedJobs(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work"
+	job1 := "job1"
+
+	tests := []struct {
+		name string
+		drop bool
+		key  string
+	}{
+		{"", false, redisKeyMalformed(newKeyspace(ns))},
+		{"poison", false, redisNamespacePrefix(newKeyspace(ns)) + "poison"},
+		{"", true, ""},
+	}
+	for _, tt := range tests {
+		cleanKeyspace(ns, pool)
+
+		var ran int
+		jobTypes := map[string]*jobType{
+			job1: {
+				Name:           job1,
+				JobOptions:     JobOptions{Priority: 1, MaxFails: 3, MaxConcurrency: 1},
+				isGeneric:      true,
+				genericHandler: func(job *Job) error { ran++; return nil },
+			},
+		}
+
+		// A corrupted entry ahead of a valid job.
+		_, err := NewEnqueuer(ns, pool).Enqueue(job1, nil)
+		assert.NoError(t, err)
+		raw := []byte(`{"name":"job1","id":`)
+		conn := pool.Get()
+		_, err = conn.Do("RPUSH", redisKeyJobs(newKeyspace(ns), job1), raw)
+		conn.Close()
+		assert.NoError(t, err)
+
+		w := newWorker(newKeyspace(ns), "1", pool, tstCtxType, nil, jobTypes, noopLogger, nil,
+			workerWithMalformedJobs(tt.name, tt.drop))
+		job, err := w.fetchJob(w.fetchSamples())
+		assert.Nil(t, job)
+		assert.ErrorIs(t, err, ErrMalformedJob)
+
+		// The lock of the malformed job is released, so the valid job can run.
+		w.start()
+		w.drain()
+		w.stop()
+
+		assert.Equal(t, 1, ran)
+		assert.EqualValues(t, 0, listSize(pool, redisKeyJobsInProgress(newKeyspace(ns), "1", job1)))
+		assert.EqualValues(t, 0, getInt64(pool, redisKeyJobsLock(newKeyspace(ns), job1)))
+
+		if tt.drop {
+			assert.EqualValues(t, 0, zsetSize(pool, redisKeyMalformed(newKeyspace(ns))))
+			continue
+		}
+		conn = pool.Get()
+		malformed, err := redis.ByteSlices(conn.Do("ZRANGE", tt.key, 0, -1))
+		conn.Close()
+		assert.NoError(t, err)
+		assert.Equal(t, [][]byte{raw}, malformed)
+	}
+}
+
+func TestWorkerExpiredJobs(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work"
+	job1 := "job1"
+	job2 := "job2"
+	cleanKeyspace(ns, pool)
+
+	var ran []string
+	jobTypes := make(map[string]*jobType)
+	for name, opts := range map[string]JobOptions{
+		job1: {Priority: 1, MaxFails: 3},
+		job2: {Priority: 1, MaxFails: 3, Deadline: time.Minute},
+	} {
+		jobTypes[name] = &jobType{
+			Name:       name,
+			JobOptions: opts,
+			isGeneric:  true,
+			genericHandler: func(job *Job) error {
+				ran = append(ran, job.ArgString("id"))
+				return nil
+			},
+		}
+	}
+
+	setNowEpochSecondsMock(1425263409)
+	enqueuer := NewEnqueuer(ns, pool)
+	_, err := enqueuer.EnqueueWithDeadline(job1, time.Unix(1425263409+30, 0), Q{"id": "expired"})
+	assert.NoError(t, err)
+	_, err = enqueuer.EnqueueWithDeadline(job1, time.Unix(1425263409+120, 0), Q{"id": "fresh"})
+	assert.NoError(t, err)
+	_, err = enqueuer.Enqueue(job2, Q{"id": "waited_too_long"})
+	assert.NoError(t, err)
+
+	setNowEpochSecondsMock(1425263409 + 90)
+	defer resetNowEpochSecondsMock()
+
+	var expired []string
+	hook := func(job *Job) {
+		expired = append(expired, job.ArgString("id"))
+	}
+
+	w := newWorker(newKeyspace(ns), "1", pool, tstCtxType, nil, jobTypes, noopLogger, nil, workerWithExpiredJobHook(hook))
+	w.start()
+	w.drain()
+	w.stop()
+
+	assert.Equal(t, []string{"fresh"}, ran)
+	assert.ElementsMatch(t, []string{"expired", "waited_too_long"}, expired)
+
+	assert.EqualValues(t, 0, listSize(pool, redisKeyJobs(newKeyspace(ns), job1)))
+	assert.EqualValues(t, 0, listSize(pool, redisKeyJobs(newKeyspace(ns), job2)))
+	assert.EqualValues(t, 0, listSize(pool, redisKeyJobsInProgress(newKeyspace(ns), "1", job1)))
+	assert.EqualValues(t, 0, listSize(pool, redisKeyJobsInProgress(newKeyspace(ns), "1", job2)))
+	assert.EqualValues(t, 0, zsetSize(pool, redisKeyRetry(newKeyspace(ns))))
+	assert.EqualValues(t, 0, zsetSize(pool, redisKeyDead(newKeyspace(ns))))
+}
+
+func TestWorkerTTLExpiredJobs(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work"
+	job1 := "job1"
+	cleanKeyspace(ns, pool)
+
+	var ran []string
+	jobTypes := map[string]*jobType{
+		job1: {
+			Name:       job1,
+			JobOptions: JobOptions{Priority: 1, MaxFails: 3},
+			isGeneric:  true,
+			genericHandler: func(job *Job) error {
+				ran = append(ran, job.ArgString("id"))
+				return nil
+			},
+		},
+	}
+
+	setNowEpochSecondsMock(1425263409)
+	enqueuer := NewEnqueuer(ns, pool)
+	_, err := enqueuer.EnqueueWithTTL(job1, 30*time.Second, Q{"id": "expired"})
+	assert.NoError(t, err)
+	_, err = enqueuer.EnqueueWithTTL(job1, 2*time.Minute, Q{"id": "fresh"})
+	assert.NoError(t, err)
+
+	setNowEpochSecondsMock(1425263409 + 90)
+	defer resetNowEpochSecondsMock()
+
+	// Unlike the jobs past their deadline, the expired jobs aren't passed to the hook.
+	var expired []string
+	hook := func(job *Job) {
+		expired = append(expired, job.ArgString("id"))
+	}
+
+	w := newWorker(newKeyspace(ns), "1", pool, tstCtxType, nil, jobTypes, noopLogger, nil, workerWithExpiredJobHook(hook))
+	w.start()
+	w.drain()
+	w.stop()
+
+	assert.Equal(t, []string{"fresh"}, ran)
+	assert.Empty(t, expired)
+
+	assert.EqualValues(t, 0, listSize(pool, redisKeyJobs(newKeyspace(ns), job1)))
+	assert.EqualValues(t, 0, listSize(pool, redisKeyJobsInProgress(newKeyspace(ns), "1", job1)))
+	assert.EqualValues(t, 0, zsetSize(pool, redisKeyRetry(newKeyspace(ns))))
+	assert.EqualValues(t, 0, zsetSize(pool, redisKeyDead(newKeyspace(ns))))
+}
+
 func TestWorkersPaused(t *testing.T) {
 	pool := newTestPool(":6379")
 	ns := "work"
@@ -326,7 +1055,7 @@ func TestWorkersPaused(t *testing.T) {
 	_, err := enqueuer.Enqueue(job1, Q{"a": 1})
 	assert.Nil(t, err)
 
-	w := newWorker(ns, "1", pool, tstCtxType, nil, jobTypes, noopLogger, nil)
+	w := newWorker(newKeyspace(ns), "1", pool, tstCtxType, nil, jobTypes, noopLogger, nil)
 	// pause the jobs prior to starting
 	err = pauseJobs(ns, job1, pool)
 	assert.Nil(t, err)
@@ -337,8 +1066,8 @@ func TestWorkersPaused(t *testing.T) {
 	// make sure the jobs stay in the still in the run queue and not moved to in progress
 	for i := 0; i < 2; i++ {
 		time.Sleep(10 * time.Millisecond)
-		assert.EqualValues(t, 1, listSize(pool, redisKeyJobs(ns, job1)))
-		assert.EqualValues(t, 0, listSize(pool, redisKeyJobsInProgress(ns, "1", job1)))
+		assert.EqualValues(t, 1, listSize(pool, redisKeyJobs(newKeyspace(ns), job1)))
+		assert.EqualValues(t, 0, listSize(pool, redisKeyJobsInProgress(newKeyspace(ns), "1", job1)))
 	}
 
 	// now unpause the jobs and check that they start
@@ -346,25 +1075,324 @@ func TestWorkersPaused(t *testing.T) {
 	assert.Nil(t, err)
 	// sleep through 2 backoffs to make sure we allow enough time to start running
 	time.Sleep(20 * time.Millisecond)
-	assert.EqualValues(t, 0, listSize(pool, redisKeyJobs(ns, job1)))
-	assert.EqualValues(t, 1, listSize(pool, redisKeyJobsInProgress(ns, "1", job1)))
+	assert.EqualValues(t, 0, listSize(pool, redisKeyJobs(newKeyspace(ns), job1)))
+	assert.EqualValues(t, 1, listSize(pool, redisKeyJobsInProgress(newKeyspace(ns), "1", job1)))
 
 	w.observer.drain()
-	h := readHash(pool, redisKeyWorkerObservation(ns, w.workerID))
+	h := readHash(pool, redisKeyWorkerObservation(newKeyspace(ns), w.workerID))
 	assert.Equal(t, job1, h["job_name"])
 	assert.Equal(t, `{"a":1}`, h["args"])
 	w.drain()
 	w.stop()
 
 	// At this point, it should all be empty.
-	assert.EqualValues(t, 0, listSize(pool, redisKeyJobs(ns, job1)))
-	assert.EqualValues(t, 0, listSize(pool, redisKeyJobsInProgress(ns, "1", job1)))
+	assert.EqualValues(t, 0, listSize(pool, redisKeyJobs(newKeyspace(ns), job1)))
+	assert.EqualValues(t, 0, listSize(pool, redisKeyJobsInProgress(newKeyspace(ns), "1", job1)))
 
 	// nothing in the worker status
-	h = readHash(pool, redisKeyWorkerObservation(ns, w.workerID))
+	h = readHash(pool, redisKeyWorkerObservation(newKeyspace(ns), w.workerID))
 	assert.EqualValues(t, 0, len(h))
 }
 
+func TestWorkerStrictFIFORetry(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work"
+	cleanKeyspace(ns, pool)
+
+	jobTypes := map[string]*jobType{
+		"wat": {
+			Name:           "wat",
+			JobOptions:     JobOptions{Priority: 1, MaxFails: 2, StrictFIFO: true, Backoff: func(*Job) int64 { return 0 }},
+			isGeneric:      true,
+			genericHandler: func(*Job) error { return nil },
+		},
+	}
+	conn := pool.Get()
+	_, err := conn.Do("SET", redisKeyJobsStrictFIFO(newKeyspace(ns), "wat"), 1)
+	conn.Close()
+	require.NoError(t, err)
+
+	enqueuer := NewEnqueuer(ns, pool)
+	first, err := enqueuer.Enqueue("wat", Q{"i": 0})
+	require.NoError(t, err)
+	_, err = enqueuer.Enqueue("wat", Q{"i": 1})
+	require.NoError(t, err)
+
+	w := newWorker(newKeyspace(ns), "1", pool, tstCtxType, nil, jobTypes, noopLogger, nil)
+	job, err := w.fetchJob(w.fetchSamples())
+	require.NoError(t, err)
+	require.NotNil(t, job)
+	assert.Equal(t, first.ID, job.ID)
+
+	retried, err := w.removeJobFromInProgress(job, jobTypes["wat"], fmt.Errorf("oops"), true, noopLogger)
+	require.NoError(t, err)
+	assert.True(t, retried)
+
+	// The job enqueued after the failed one isn't fetched while the retry waits.
+	job, err = w.fetchJob(w.fetchSamples())
+	require.NoError(t, err)
+	assert.Nil(t, job)
+	assert.EqualValues(t, 1, listSize(pool, redisKeyJobs(newKeyspace(ns), "wat")))
+
+	re := newRequeuer(newKeyspace(ns), pool, redisKeyRetry(newKeyspace(ns)), []string{"wat"}, noopMetrics, noopLogger)
+	re.start()
+	re.drain()
+	re.stop()
+
+	// Once requeued, the retry runs first and the job type is unblocked.
+	job, err = w.fetchJob(w.fetchSamples())
+	require.NoError(t, err)
+	require.NotNil(t, job)
+	assert.Equal(t, first.ID, job.ID)
+	assert.False(t, keyExists(pool, redisKeyJobsStrictFIFOBlocked(newKeyspace(ns), "wat")))
+}
+
+func TestWorkerPriorityQueues(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work"
+	cleanKeyspace(ns, pool)
+
+	var order []int64
+	wp := NewWorkerPool(TestContext{}, 1, ns, pool)
+	wp.JobWithOptions("export", JobOptions{Priority: 1, PriorityQueues: []uint{100000}}, func(job *Job) error {
+		order = append(order, job.ArgInt64("i"))
+		return nil
+	})
+
+	enqueuer := NewEnqueuer(ns, pool)
+	for i := 1; i <= 3; i++ {
+		_, err := enqueuer.Enqueue("export", Q{"i": i})
+		assert.NoError(t, err)
+	}
+	job, err := enqueuer.EnqueueWithPriority("export", 100000, Q{"i": 0})
+	assert.NoError(t, err)
+	assert.Equal(t, "export", job.Name)
+	assert.EqualValues(t, 3, listSize(pool, redisKeyJobs(newKeyspace(ns), "export")))
+	assert.EqualValues(t, 1, listSize(pool, redisKeyJobsPriority(newKeyspace(ns), "export", 100000)))
+
+	// The jobs of the priority queue are counted with the ones of the job type.
+	queues, err := NewClient(ns, pool).Queues()
+	assert.NoError(t, err)
+	assert.Len(t, queues, 1)
+	assert.EqualValues(t, 4, queues[0].Count)
+
+	for _, p := range []uint{0, 100001} {
+		_, err = enqueuer.EnqueueWithPriority("export", p, nil)
+		assert.Equal(t, ErrInvalidPriority, err)
+	}
+
+	wp.Start()
+	wp.Drain()
+	wp.Stop()
+
+	// The boosted job is all but certain to be sampled first.
+	assert.Equal(t, []int64{0, 1, 2, 3}, order)
+	assert.EqualValues(t, 0, listSize(pool, redisKeyJobsPriority(newKeyspace(ns), "export", 100000)))
+	assert.EqualValues(t, 0, listSize(pool, redisKeyJobsInProgress(newKeyspace(ns), wp.workerPoolID, "export")))
+
+	assert.Panics(t, func() {
+		wp.JobWithOptions("bad", JobOptions{PriorityQueues: []uint{0}}, func(job *Job) error { return nil })
+	})
+}
+
+func TestWorkerFetchSamples(t *testing.T) {
+	jobTypes := map[string]*jobType{}
+	for i := 0; i < 7; i++ {
+		name := fmt.Sprint("job", i)
+		jobTypes[name] = &jobType{Name: name, JobOptions: JobOptions{Priority: uint(i + 1)}}
+	}
+
+	w := newWorker(newKeyspace("work"), "1", newTestPool(":6379"), tstCtxType, nil, jobTypes, noopLogger, nil, workerWithMaxFetchSamples(4))
+	assert.Equal(t, 4, w.fetchSize())
+	assert.Equal(t, 4, w.fetchSweep())
+
+	considered := map[string]bool{}
+	for i := 0; i < w.fetchSweep(); i++ {
+		samples := w.fetchSamples()
+		assert.Equal(t, 4, len(samples))
+
+		seen := map[string]bool{}
+		for _, s := range samples {
+			assert.False(t, seen[s.redisJobs])
+			seen[s.redisJobs] = true
+			considered[s.redisJobs] = true
+		}
+	}
+	assert.Equal(t, 7, len(considered))
+
+	// The sampler keeps all the job types.
+	all := map[string]bool{}
+	for _, s := range w.sampler.samples {
+		all[s.redisJobs] = true
+	}
+	assert.Equal(t, 7, len(all))
+
+	// Without a cap, every fetch considers all the job types.
+	w = newWorker(newKeyspace("work"), "1", newTestPool(":6379"), tstCtxType, nil, jobTypes, noopLogger, nil)
+	assert.Equal(t, 7, len(w.fetchSamples()))
+	assert.Equal(t, 1, w.fetchSweep())
+}
+
+func TestWorkerFetchFreeSlots(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work"
+	job1 := "job1"
+	cleanKeyspace(ns, pool)
+
+	jobTypes := map[string]*jobType{
+		job1: {Name: job1, JobOptions: JobOptions{Priority: 1}, isGeneric: true, genericHandler: func(*Job) error { return nil }},
+	}
+	w := newWorker(newKeyspace(ns), "1", pool, tstCtxType, nil, jobTypes, noopLogger, nil, workerWithMaxTotalConcurrency(2))
+	assert.Equal(t, 2, w.maxTotalConcurrency())
+	assert.Equal(t, -1, newWorker(newKeyspace(ns), "1", pool, tstCtxType, nil, jobTypes, noopLogger, nil).maxTotalConcurrency())
+
+	enqueuer := NewEnqueuer(ns, pool)
+	for i := 0; i < 3; i++ {
+		_, err := enqueuer.Enqueue(job1, nil)
+		assert.NoError(t, err)
+	}
+
+	// Each fetched job takes a slot until it leaves the in-progress queue.
+	for i := 1; i <= 2; i++ {
+		job, err := w.fetchJob(w.fetchSamples())
+		assert.NoError(t, err)
+		assert.NotNil(t, job)
+		assert.EqualValues(t, i, getInt64(pool, redisKeyJobsLock(newKeyspace(ns), job1)))
+	}
+
+	// Without a free slot, the job is left in its queue and no lock is taken.
+	job, err := w.fetchJob(w.fetchSamples())
+	assert.Equal(t, errNoFreeSlot, err)
+	assert.Nil(t, job)
+	assert.EqualValues(t, 1, listSize(pool, redisKeyJobs(newKeyspace(ns), job1)))
+	assert.EqualValues(t, 2, getInt64(pool, redisKeyJobsLock(newKeyspace(ns), job1)))
+
+	conn := pool.Get()
+	_, err = conn.Do("RPOP", redisKeyJobsInProgress(newKeyspace(ns), "1", job1))
+	conn.Close()
+	assert.NoError(t, err)
+
+	job, err = w.fetchJob(w.fetchSamples())
+	assert.NoError(t, err)
+	assert.NotNil(t, job)
+	assert.EqualValues(t, 0, listSize(pool, redisKeyJobs(newKeyspace(ns), job1)))
+}
+
+func TestWorkerMaxFetchJobTypes(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work"
+	cleanKeyspace(ns, pool)
+
+	var processed int64
+	wp := NewWorkerPool(TestContext{}, 1, ns, pool, WithMaxFetchJobTypes(1))
+	enqueuer := NewEnqueuer(ns, pool)
+	for i := 0; i < 5; i++ {
+		name := fmt.Sprint("job", i)
+		wp.Job(name, func(job *Job) error {
+			atomic.AddInt64(&processed, 1)
+			return nil
+		})
+		_, err := enqueuer.Enqueue(name, nil)
+		assert.NoError(t, err)
+	}
+
+	// Draining waits for every queue to be considered.
+	wp.Start()
+	wp.Drain()
+	wp.Stop()
+
+	assert.EqualValues(t, 5, atomic.LoadInt64(&processed))
+}
+
+func TestWorkerDrainSamples(t *testing.T) {
+	jobTypes := map[string]*jobType{}
+	for i := 0; i < 7; i++ {
+		name := fmt.Sprint("job", i)
+		jobTypes[name] = &jobType{Name: name, JobOptions: JobOptions{Priority: uint(i/2 + 1)}}
+	}
+
+	names := func(samples []sampleItem) []string {
+		var names []string
+		for _, s := range samples {
+			names = append(names, redisJobNameFromKey(newKeyspace("work"), s.redisJobs))
+		}
+		return names
+	}
+
+	w := newWorker(newKeyspace("work"), "1", newTestPool(":6379"), tstCtxType, nil, jobTypes, noopLogger, nil)
+	assert.Equal(t, []string{"job6", "job4", "job5", "job2", "job3", "job0", "job1"}, names(w.drainSamples(0)))
+	assert.Equal(t, 1, w.drainSweep())
+
+	// With a cap, the windows are taken in order, and the last one is shifted back.
+	w = newWorker(newKeyspace("work"), "1", newTestPool(":6379"), tstCtxType, nil, jobTypes, noopLogger, nil, workerWithMaxFetchSamples(3))
+	assert.Equal(t, 3, w.drainSweep())
+	assert.Equal(t, []string{"job6", "job4", "job5"}, names(w.drainSamples(0)))
+	assert.Equal(t, []string{"job2", "job3", "job0"}, names(w.drainSamples(1)))
+	assert.Equal(t, []string{"job3", "job0", "job1"}, names(w.drainSamples(2)))
+	assert.Equal(t, []string{"job6", "job4", "job5"}, names(w.drainSamples(3)))
+}
+
+func TestWorkerPriorityDrain(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work"
+	cleanKeyspace(ns, pool)
+
+	var mtx sync.Mutex
+	var processed []string
+	handler := func(job *Job) error {
+		mtx.Lock()
+		processed = append(processed, job.Name)
+		mtx.Unlock()
+		return nil
+	}
+	jobTypes := map[string]*jobType{
+		"high": {Name: "high", JobOptions: JobOptions{Priority: 2}, isGeneric: true, genericHandler: handler},
+		"low":  {Name: "low", JobOptions: JobOptions{Priority: 1}, isGeneric: true, genericHandler: handler},
+	}
+
+	enqueuer := NewEnqueuer(ns, pool)
+	for i := 0; i < 10; i++ {
+		_, err := enqueuer.Enqueue("low", nil)
+		assert.NoError(t, err)
+		_, err = enqueuer.Enqueue("high", nil)
+		assert.NoError(t, err)
+	}
+
+	// The worker can't fetch until the job taking its only slot is done, after the drain is requested.
+	blockerQueue := redisKeyJobsInProgress(newKeyspace(ns), "1", "low")
+	conn := pool.Get()
+	_, err := conn.Do("LPUSH", blockerQueue, "blocker")
+	conn.Close()
+	assert.NoError(t, err)
+
+	w := newWorker(newKeyspace(ns), "1", pool, tstCtxType, nil, jobTypes, noopLogger, nil, workerWithMaxTotalConcurrency(1), workerWithPriorityDrain(true))
+	w.start()
+	defer w.stop()
+
+	drained := make(chan struct{})
+	go func() {
+		w.drain()
+		close(drained)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	conn = pool.Get()
+	_, err = conn.Do("DEL", blockerQueue)
+	conn.Close()
+	assert.NoError(t, err)
+	<-drained
+
+	expected := make([]string, 0, 20)
+	for i := 0; i < 10; i++ {
+		expected = append(expected, "high")
+	}
+	for i := 0; i < 10; i++ {
+		expected = append(expected, "low")
+	}
+	mtx.Lock()
+	assert.Equal(t, expected, processed)
+	mtx.Unlock()
+}
+
 // Test that in the case of an unavailable Redis server,
 // the worker loop exits in the case of a WorkerPool.Stop
 func TestStop(t *testing.T) {
@@ -382,6 +1410,68 @@ func TestStop(t *testing.T) {
 	wp.Stop()
 }
 
+func TestWorkerIdleSleep(t *testing.T) {
+	w := &worker{pollJitter: 0.5}
+	for n := int64(1); n < 10; n++ {
+		longest := sleepBackoffs[len(sleepBackoffs)-1]
+		if n < int64(len(sleepBackoffs)) {
+			longest = sleepBackoffs[n]
+		}
+
+		for i := 0; i < 20; i++ {
+			d := w.idleSleep(n)
+			assert.True(t, d <= longest && d >= longest/2, "sleep %v for step %d", d, n)
+		}
+	}
+
+	w.pollJitter = 0
+	assert.Equal(t, sleepBackoffs[len(sleepBackoffs)-1], w.idleSleep(100))
+}
+
+func TestWorkerLeasesUseRedisTime(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work"
+	cleanKeyspace(ns, pool)
+
+	jobTypes := map[string]*jobType{
+		"wat": {Name: "wat", JobOptions: JobOptions{Priority: 1, MaxConcurrency: 1}, isGeneric: true, genericHandler: func(*Job) error { return nil }},
+	}
+	conn := pool.Get()
+	defer conn.Close()
+	_, err := conn.Do("SET", redisKeyJobsConcurrency(newKeyspace(ns), "wat"), 1)
+	require.NoError(t, err)
+	_, err = NewEnqueuer(ns, pool).Enqueue("wat", nil)
+	require.NoError(t, err)
+
+	// The lease of another host is live by the time of Redis.
+	leases := redisKeyJobsLeases(newKeyspace(ns), "wat")
+	now, err := redisTimeMillis(conn)
+	require.NoError(t, err)
+	_, err = conn.Do("ZADD", leases, now+time.Minute.Milliseconds(), "other")
+	require.NoError(t, err)
+
+	// A host whose clock is ahead doesn't take it as expired.
+	clock := &fakeClock{now: time.Now().Add(time.Hour)}
+	w := newWorker(newKeyspace(ns), "1", pool, tstCtxType, nil, jobTypes, noopLogger, nil,
+		workerWithClock(clock), workerWithLeaseTTL(time.Minute))
+	job, err := w.fetchJob(w.fetchSamples())
+	assert.NoError(t, err)
+	assert.Nil(t, job)
+	assert.EqualValues(t, 1, zsetSize(pool, leases))
+
+	_, err = conn.Do("ZADD", leases, now-1, "other")
+	require.NoError(t, err)
+	job, err = w.fetchJob(w.fetchSamples())
+	require.NoError(t, err)
+	require.NotNil(t, job)
+
+	// The lease of the worker is scored and renewed by the time of Redis as well.
+	require.NoError(t, w.extendLease("wat"))
+	score, err := redis.Int64(conn.Do("ZSCORE", leases, w.leaseID()))
+	assert.NoError(t, err)
+	assert.InDelta(t, now+time.Minute.Milliseconds(), score, float64(10*time.Second.Milliseconds()))
+}
+
 func BenchmarkJobProcessing(b *testing.B) {
 	pool := newTestPool(":6379")
 	ns := "work"
@@ -427,7 +1517,7 @@ func deleteQueue(pool *redis.Pool, namespace, jobName string) {
 	conn := pool.Get()
 	defer conn.Close()
 
-	_, err := conn.Do("DEL", redisKeyJobs(namespace, jobName), redisKeyJobsInProgress(namespace, "1", jobName))
+	_, err := conn.Do("DEL", redisKeyJobs(newKeyspace(namespace), jobName), redisKeyJobsInProgress(newKeyspace(namespace), "1", jobName))
 	if err != nil {
 		panic("could not delete queue: " + err.Error())
 	}
@@ -437,7 +1527,7 @@ func deleteRetryAndDead(pool *redis.Pool, namespace string) {
 	conn := pool.Get()
 	defer conn.Close()
 
-	_, err := conn.Do("DEL", redisKeyRetry(namespace), redisKeyDead(namespace))
+	_, err := conn.Do("DEL", redisKeyRetry(newKeyspace(namespace)), redisKeyDead(newKeyspace(namespace)))
 	if err != nil {
 		panic("could not delete retry/dead queue: " + err.Error())
 	}
@@ -476,6 +1566,17 @@ func getInt64(pool *redis.Pool, key string) int64 {
 	return v
 }
 
+func keyExists(pool *redis.Pool, key string) bool {
+	conn := pool.Get()
+	defer conn.Close()
+
+	v, err := redis.Bool(conn.Do("EXISTS", key))
+	if err != nil {
+		panic("could not EXISTS: " + err.Error())
+	}
+	return v
+}
+
 func hgetInt64(pool *redis.Pool, redisKey, hashKey string) int64 {
 	conn := pool.Get()
 	defer conn.Close()
@@ -498,7 +1599,7 @@ func jobOnZset(pool *redis.Pool, key string) (int64, *Job) {
 
 	vv := v.([]interface{})
 
-	job, err := newJob(vv[0].([]byte), nil, nil)
+	job, err := newJob(vv[0].([]byte), nil, nil, nil)
 	if err != nil {
 		panic("couldn't get job: " + err.Error())
 	}
@@ -521,7 +1622,7 @@ func jobOnQueue(pool *redis.Pool, key string) *Job {
 		panic("could RPOP from job queue: " + err.Error())
 	}
 
-	job, err := newJob(rawJSON, nil, nil)
+	job, err := newJob(rawJSON, nil, nil, nil)
 	if err != nil {
 		panic("couldn't get job: " + err.Error())
 	}
@@ -559,7 +1660,7 @@ func pauseJobs(namespace, jobName string, pool *redis.Pool) error {
 	conn := pool.Get()
 	defer conn.Close()
 
-	if _, err := conn.Do("SET", redisKeyJobsPaused(namespace, jobName), "1"); err != nil {
+	if _, err := conn.Do("SET", redisKeyJobsPaused(newKeyspace(namespace), jobName), "1"); err != nil {
 		return err
 	}
 	return nil
@@ -569,7 +1670,7 @@ func unpauseJobs(namespace, jobName string, pool *redis.Pool) error {
 	conn := pool.Get()
 	defer conn.Close()
 
-	if _, err := conn.Do("DEL", redisKeyJobsPaused(namespace, jobName)); err != nil {
+	if _, err := conn.Do("DEL", redisKeyJobsPaused(newKeyspace(namespace), jobName)); err != nil {
 		return err
 	}
 	return nil
@@ -579,13 +1680,13 @@ func deletePausedAndLockedKeys(namespace, jobName string, pool *redis.Pool) erro
 	conn := pool.Get()
 	defer conn.Close()
 
-	if _, err := conn.Do("DEL", redisKeyJobsPaused(namespace, jobName)); err != nil {
+	if _, err := conn.Do("DEL", redisKeyJobsPaused(newKeyspace(namespace), jobName)); err != nil {
 		return err
 	}
-	if _, err := conn.Do("DEL", redisKeyJobsLock(namespace, jobName)); err != nil {
+	if _, err := conn.Do("DEL", redisKeyJobsLock(newKeyspace(namespace), jobName)); err != nil {
 		return err
 	}
-	if _, err := conn.Do("DEL", redisKeyJobsLockInfo(namespace, jobName)); err != nil {
+	if _, err := conn.Do("DEL", redisKeyJobsLockInfo(newKeyspace(namespace), jobName)); err != nil {
 		return err
 	}
 	return nil
@@ -668,25 +1769,60 @@ func TestWorkerRetryRemoveFromInProgress(t *testing.T) {
 	_, err := enqueuer.Enqueue(job1, Q{"a": 1})
 	assert.Nil(t, err)
 
-	w := newWorker(ns, "1", pool, tstCtxType, nil, jobTypes, noopLogger, nil)
+	w := newWorker(newKeyspace(ns), "1", pool, tstCtxType, nil, jobTypes, noopLogger, nil)
 	w.start()
 	defer w.stop()
 
 	wg.Wait()
 
 	// One job still in progress.
-	assert.EqualValues(t, 1, listSize(originPool, redisKeyJobsInProgress(ns, "1", job1)))
+	assert.EqualValues(t, 1, listSize(originPool, redisKeyJobsInProgress(newKeyspace(ns), "1", job1)))
 
 	pool.On()
 	time.Sleep(time.Millisecond * 10)
 
 	// Nothing in retries or dead.
-	assert.EqualValues(t, 0, zsetSize(originPool, redisKeyRetry(ns)))
-	assert.EqualValues(t, 0, zsetSize(originPool, redisKeyDead(ns)))
+	assert.EqualValues(t, 0, zsetSize(originPool, redisKeyRetry(newKeyspace(ns))))
+	assert.EqualValues(t, 0, zsetSize(originPool, redisKeyDead(newKeyspace(ns))))
 
 	// Nothing in the queues or in-progress queues.
-	assert.EqualValues(t, 0, listSize(originPool, redisKeyJobs(ns, job1)))
-	assert.EqualValues(t, 0, listSize(originPool, redisKeyJobsInProgress(ns, "1", job1)))
+	assert.EqualValues(t, 0, listSize(originPool, redisKeyJobs(newKeyspace(ns), job1)))
+	assert.EqualValues(t, 0, listSize(originPool, redisKeyJobsInProgress(newKeyspace(ns), "1", job1)))
+}
+
+func TestWorkerAckResolvesChildren(t *testing.T) {
+	pool := newTestPool(":6379")
+	ns := "work"
+	cleanKeyspace(ns, pool)
+
+	jobTypes := map[string]*jobType{
+		"wat": {Name: "wat", JobOptions: JobOptions{Priority: 1}, isGeneric: true, genericHandler: func(*Job) error { return nil }},
+	}
+
+	enqueuer := NewEnqueuer(ns, pool)
+	parent, err := enqueuer.Enqueue("wat", nil)
+	require.NoError(t, err)
+	_, err = enqueuer.EnqueueAfter(parent.ID, "child", nil)
+	require.NoError(t, err)
+
+	w := newWorker(newKeyspace(ns), "1", pool, tstCtxType, nil, jobTypes, noopLogger, nil, workerWithDependencies(true))
+	job, err := w.fetchJob(w.fetchSamples())
+	require.NoError(t, err)
+	require.NotNil(t, job)
+
+	// The children are enqueued by the ack of their parent job.
+	_, err = w.removeJobFromInProgress(job, jobTypes["wat"], nil, true, noopLogger)
+	require.NoError(t, err)
+	assert.EqualValues(t, 0, listSize(pool, redisKeyJobsInProgress(newKeyspace(ns), "1", "wat")))
+	assert.False(t, keyExists(pool, redisKeyJobChildren(newKeyspace(ns), parent.ID)))
+	assert.EqualValues(t, 1, listSize(pool, redisKeyJobs(newKeyspace(ns), "child")))
+
+	// A child enqueued after the ack is enqueued right away, and a retried ack changes nothing.
+	_, err = enqueuer.EnqueueAfter(parent.ID, "child", nil)
+	require.NoError(t, err)
+	_, err = w.removeJobFromInProgress(job, jobTypes["wat"], nil, true, noopLogger)
+	require.NoError(t, err)
+	assert.EqualValues(t, 2, listSize(pool, redisKeyJobs(newKeyspace(ns), "child")))
 }
 
 type switchablePool struct {